@@ -2,10 +2,12 @@ module github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/examples/sampl
 
 go 1.24.4
 
-require github.com/segmentio/kafka-go v0.4.50
+require (
+	github.com/jamiealquiza/tachymeter v2.0.0+incompatible
+	github.com/segmentio/kafka-go v0.4.50
+)
 
 require (
-	github.com/jamiealquiza/tachymeter v2.0.0+incompatible // indirect
 	github.com/klauspost/compress v1.15.9 // indirect
 	github.com/pierrec/lz4/v4 v4.1.15 // indirect
 )
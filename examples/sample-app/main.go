@@ -10,6 +10,7 @@ import (
 	"os"
 	"os/signal"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -17,21 +18,54 @@ import (
 	"github.com/segmentio/kafka-go"
 )
 
+// consumerConfig tunes how fast the consumer works through messages, so lag
+// scenarios can be reproduced when testing the scaler.
+type consumerConfig struct {
+	processDelay   time.Duration
+	commitInterval time.Duration
+	concurrency    int
+}
+
+func parseFlags(args []string) (string, consumerConfig, error) {
+	fs := flag.NewFlagSet("sample-app", flag.ContinueOnError)
+	mode := fs.String("mode", "consumer", "run mode: 'consumer' or 'producer'")
+	var cfg consumerConfig
+	fs.DurationVar(&cfg.processDelay, "processDelay", 100*time.Millisecond, "simulated processing time per message")
+	fs.DurationVar(&cfg.commitInterval, "commitInterval", time.Second, "how often offsets are committed; 0 commits after every message")
+	fs.IntVar(&cfg.concurrency, "concurrency", 1, "number of messages processed in parallel")
+	if err := fs.Parse(args); err != nil {
+		return "", consumerConfig{}, err
+	}
+
+	if cfg.processDelay < 0 {
+		return "", consumerConfig{}, fmt.Errorf("-processDelay must not be negative, got %s", cfg.processDelay)
+	}
+	if cfg.commitInterval < 0 {
+		return "", consumerConfig{}, fmt.Errorf("-commitInterval must not be negative, got %s", cfg.commitInterval)
+	}
+	if cfg.concurrency < 1 {
+		return "", consumerConfig{}, fmt.Errorf("-concurrency must be at least 1, got %d", cfg.concurrency)
+	}
+	return *mode, cfg, nil
+}
+
 func main() {
-	mode := flag.String("mode", "consumer", "run mode: 'consumer' or 'producer'")
-	flag.Parse()
+	mode, cfg, err := parseFlags(os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	switch *mode {
+	switch mode {
 	case "consumer":
-		runConsumer()
+		runConsumer(cfg)
 	case "producer":
 		runProducer()
 	default:
-		log.Fatalf("unknown mode: %s (use 'consumer' or 'producer')", *mode)
+		log.Fatalf("unknown mode: %s (use 'consumer' or 'producer')", mode)
 	}
 }
 
-func runConsumer() {
+func runConsumer(cfg consumerConfig) {
 	brokers := getEnv("KAFKA_BROKERS", "localhost:9092")
 	topic := getEnv("KAFKA_TOPIC", "test-topic")
 	groupID := getEnv("KAFKA_GROUP_ID", "sample-consumer-group")
@@ -42,7 +76,7 @@ func runConsumer() {
 		GroupID:        groupID,
 		MinBytes:       10e3,
 		MaxBytes:       10e6,
-		CommitInterval: time.Second,
+		CommitInterval: cfg.commitInterval,
 		StartOffset:    kafka.LastOffset,
 	})
 
@@ -56,6 +90,7 @@ func runConsumer() {
 	log.Printf("Brokers: %s", brokers)
 	log.Printf("Topic: %s", topic)
 	log.Printf("Group ID: %s", groupID)
+	log.Printf("Process delay: %s, commit interval: %s, concurrency: %d", cfg.processDelay, cfg.commitInterval, cfg.concurrency)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -72,30 +107,46 @@ func runConsumer() {
 		cancel()
 	}()
 
-	for {
-		select {
-		case <-ctx.Done():
-			log.Println("Consumer stopped")
-			return
-		default:
-				msg, err := reader.ReadMessage(ctx)
+	consume(ctx, reader, cfg, func(msg kafka.Message) {
+		latency := time.Since(msg.Time)
+		t.AddTime(latency)
+		log.Printf("[part: %d, offset: %d]message acked (latency: %s)",
+			msg.Partition, msg.Offset, latency)
+	})
+	log.Println("Consumer stopped")
+}
 
-			if err != nil {
-				if ctx.Err() != nil {
-					return
+// messageReader is the part of *kafka.Reader the consumer loop uses.
+type messageReader interface {
+	ReadMessage(ctx context.Context) (kafka.Message, error)
+}
+
+// consume reads messages with cfg.concurrency workers until ctx is cancelled,
+// sleeping cfg.processDelay on each before calling acked. Offsets are
+// committed by the reader as messages are read.
+func consume(ctx context.Context, reader messageReader, cfg consumerConfig, acked func(kafka.Message)) {
+	var wg sync.WaitGroup
+	for range cfg.concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				msg, err := reader.ReadMessage(ctx)
+				if err != nil {
+					if ctx.Err() != nil {
+						return
+					}
+					log.Printf("Error reading message: %v", err)
+					time.Sleep(time.Second)
+					continue
 				}
-				log.Printf("Error reading message: %v", err)
-				time.Sleep(time.Second)
-				continue
-			}
 
-			time.Sleep(100 * time.Millisecond)
-			latency := time.Since(msg.Time)
-			t.AddTime(latency)
-			log.Printf("[part: %d, offset: %d]message acked (latency: %.2f)",
-				msg.Partition, msg.Offset, latency)
-		}
+				time.Sleep(cfg.processDelay)
+				acked(msg)
+			}
+		}()
 	}
+	wg.Wait()
 }
 
 func runProducer() {
@@ -120,8 +171,14 @@ func runProducer() {
 	log.Printf("Brokers: %s", brokers)
 	log.Printf("Topic: %s", topic)
 
+	streamCtx, stopStreams := context.WithCancel(context.Background())
+	defer stopStreams()
+	streams := &streamer{ctx: streamCtx, writer: writer}
+
 	mux := http.NewServeMux()
 	mux.HandleFunc("POST /produce", produceHandler(writer))
+	mux.HandleFunc("POST /stream", streams.start)
+	mux.HandleFunc("DELETE /stream", streams.stop)
 
 	srv := &http.Server{
 		Addr:    ":" + port,
@@ -133,6 +190,7 @@ func runProducer() {
 		signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 		<-sigChan
 		log.Println("Shutting down producer API...")
+		stopStreams()
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 		srv.Shutdown(ctx)
@@ -148,6 +206,9 @@ type produceRequest struct {
 	Count       int    `json:"count"`
 	MessageSize int    `json:"messageSize"`
 	Key         string `json:"key"`
+	// Rate spreads the messages out at this many per second instead of
+	// writing them all at once; 0 writes them in a single batch.
+	Rate float64 `json:"rate"`
 }
 
 type produceResponse struct {
@@ -155,7 +216,24 @@ type produceResponse struct {
 	Message  string `json:"message"`
 }
 
-func produceHandler(writer *kafka.Writer) http.HandlerFunc {
+// messageWriter is the part of *kafka.Writer the producer uses.
+type messageWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// newMessage builds the i-th message of a request.
+func newMessage(req produceRequest, i int) kafka.Message {
+	key := req.Key
+	if key == "" {
+		key = fmt.Sprintf("load-%d", i)
+	}
+	return kafka.Message{
+		Key:   []byte(key),
+		Value: fmt.Appendf(nil, `{"seq":%d,"payload":"%s"}`, i, strings.Repeat("x", req.MessageSize)),
+	}
+}
+
+func produceHandler(writer messageWriter) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req produceRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -169,41 +247,144 @@ func produceHandler(writer *kafka.Writer) http.HandlerFunc {
 		if req.MessageSize <= 0 {
 			req.MessageSize = 64
 		}
+		if req.Rate < 0 {
+			http.Error(w, `{"error":"rate must not be negative"}`, http.StatusBadRequest)
+			return
+		}
 
-		payload := strings.Repeat("x", req.MessageSize)
-
-		messages := make([]kafka.Message, req.Count)
-		for i := range messages {
-			key := req.Key
-			if key == "" {
-				key = fmt.Sprintf("load-%d", i)
+		var produced int
+		var err error
+		if req.Rate > 0 {
+			// Bounded by the request so a client disconnect stops production
+			produced, err = produceAtRate(r.Context(), writer, req, req.Count)
+		} else {
+			ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+			defer cancel()
+
+			messages := make([]kafka.Message, req.Count)
+			for i := range messages {
+				messages[i] = newMessage(req, i)
 			}
-			messages[i] = kafka.Message{
-				Key:   []byte(key),
-				Value: fmt.Appendf(nil, `{"seq":%d,"payload":"%s"}`, i, payload),
+			if err = writer.WriteMessages(ctx, messages...); err == nil {
+				produced = req.Count
 			}
 		}
 
-		ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
-		defer cancel()
-
-		if err := writer.WriteMessages(ctx, messages...); err != nil {
+		if err != nil {
 			log.Printf("Failed to produce messages: %v", err)
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
 			return
 		}
 
-		log.Printf("Produced %d messages (size=%d each)", req.Count, req.MessageSize)
+		log.Printf("Produced %d messages (size=%d each)", produced, req.MessageSize)
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(produceResponse{
-			Produced: req.Count,
-			Message:  fmt.Sprintf("produced %d messages", req.Count),
+			Produced: produced,
+			Message:  fmt.Sprintf("produced %d messages", produced),
 		})
 	}
 }
 
+// rateTick is how often produceAtRate writes the messages that have come due,
+// so high rates are sent in small batches rather than one write per message.
+const rateTick = 100 * time.Millisecond
+
+// produceAtRate writes messages at req.Rate per second until count have been
+// written, or until ctx is done when count is 0. It returns how many were
+// written; stopping because ctx is done is not an error.
+func produceAtRate(ctx context.Context, writer messageWriter, req produceRequest, count int) (int, error) {
+	ticker := time.NewTicker(rateTick)
+	defer ticker.Stop()
+
+	start := time.Now()
+	sent := 0
+	for count == 0 || sent < count {
+		select {
+		case <-ctx.Done():
+			return sent, nil
+		case now := <-ticker.C:
+			due := int(req.Rate*now.Sub(start).Seconds()) - sent
+			if count > 0 {
+				due = min(due, count-sent)
+			}
+			if due <= 0 {
+				continue
+			}
+
+			messages := make([]kafka.Message, due)
+			for i := range messages {
+				messages[i] = newMessage(req, sent+i)
+			}
+			if err := writer.WriteMessages(ctx, messages...); err != nil {
+				if ctx.Err() != nil {
+					return sent, nil
+				}
+				return sent, err
+			}
+			sent += due
+		}
+	}
+	return sent, nil
+}
+
+// streamer runs a single continuous produce loop in the background, for
+// building up the sustained backlog the persistent scaler reacts to.
+type streamer struct {
+	ctx    context.Context
+	writer messageWriter
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+}
+
+// start replaces any running stream with one at the requested rate.
+func (s *streamer) start(w http.ResponseWriter, r *http.Request) {
+	var req produceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"invalid JSON body"}`, http.StatusBadRequest)
+		return
+	}
+	if req.Rate <= 0 {
+		http.Error(w, `{"error":"rate must be positive"}`, http.StatusBadRequest)
+		return
+	}
+	if req.MessageSize <= 0 {
+		req.MessageSize = 64
+	}
+
+	s.mu.Lock()
+	if s.cancel != nil {
+		s.cancel()
+	}
+	ctx, cancel := context.WithCancel(s.ctx)
+	s.cancel = cancel
+	s.mu.Unlock()
+
+	go func() {
+		produced, err := produceAtRate(ctx, s.writer, req, 0)
+		if err != nil {
+			log.Printf("Stream stopped after %d messages: %v", produced, err)
+			return
+		}
+		log.Printf("Stream stopped after %d messages", produced)
+	}()
+
+	log.Printf("Streaming %.1f messages/sec (size=%d each)", req.Rate, req.MessageSize)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *streamer) stop(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	if s.cancel != nil {
+		s.cancel()
+		s.cancel = nil
+	}
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestParseFlags(t *testing.T) {
+	mode, cfg, err := parseFlags([]string{"-processDelay", "2s", "-commitInterval", "0", "-concurrency", "4"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if mode != "consumer" {
+		t.Errorf("mode = %q, want consumer", mode)
+	}
+	want := consumerConfig{processDelay: 2 * time.Second, commitInterval: 0, concurrency: 4}
+	if cfg != want {
+		t.Errorf("cfg = %+v, want %+v", cfg, want)
+	}
+
+	_, cfg, err = parseFlags(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want = consumerConfig{processDelay: 100 * time.Millisecond, commitInterval: time.Second, concurrency: 1}
+	if cfg != want {
+		t.Errorf("defaults = %+v, want %+v", cfg, want)
+	}
+
+	for _, args := range [][]string{
+		{"-processDelay", "-1s"},
+		{"-commitInterval", "-1s"},
+		{"-concurrency", "0"},
+	} {
+		if _, _, err := parseFlags(args); err == nil {
+			t.Errorf("expected error for %v", args)
+		}
+	}
+}
+
+// fakeReader hands out count messages, then blocks until ctx is cancelled.
+type fakeReader struct {
+	mu    sync.Mutex
+	count int
+}
+
+func (r *fakeReader) ReadMessage(ctx context.Context) (kafka.Message, error) {
+	r.mu.Lock()
+	if r.count > 0 {
+		r.count--
+		offset := int64(r.count)
+		r.mu.Unlock()
+		return kafka.Message{Offset: offset}, nil
+	}
+	r.mu.Unlock()
+	<-ctx.Done()
+	return kafka.Message{}, ctx.Err()
+}
+
+func TestConsume_HonorsProcessDelay(t *testing.T) {
+	tests := []struct {
+		concurrency int
+		minElapsed  time.Duration
+	}{
+		{concurrency: 1, minElapsed: 4 * 20 * time.Millisecond},
+		{concurrency: 2, minElapsed: 2 * 20 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		ctx, cancel := context.WithCancel(context.Background())
+		cfg := consumerConfig{processDelay: 20 * time.Millisecond, concurrency: tt.concurrency}
+
+		var mu sync.Mutex
+		acked := 0
+		start := time.Now()
+		var elapsed time.Duration
+		done := make(chan struct{})
+		go func() {
+			consume(ctx, &fakeReader{count: 4}, cfg, func(kafka.Message) {
+				mu.Lock()
+				defer mu.Unlock()
+				acked++
+				if acked == 4 {
+					elapsed = time.Since(start)
+					cancel()
+				}
+			})
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("concurrency %d: consume didn't return after cancel", tt.concurrency)
+		}
+		if acked != 4 {
+			t.Errorf("concurrency %d: acked %d messages, want 4", tt.concurrency, acked)
+		}
+		if elapsed < tt.minElapsed {
+			t.Errorf("concurrency %d: processed 4 messages in %s, want at least %s", tt.concurrency, elapsed, tt.minElapsed)
+		}
+	}
+}
+
+// fakeWriter records how many messages were written.
+type fakeWriter struct {
+	mu      sync.Mutex
+	written int
+}
+
+func (w *fakeWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.written += len(msgs)
+	return nil
+}
+
+func (w *fakeWriter) count() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.written
+}
+
+func TestProduceHandler_Rate(t *testing.T) {
+	writer := &fakeWriter{}
+	body := strings.NewReader(`{"count":20,"rate":40}`)
+	rec := httptest.NewRecorder()
+
+	start := time.Now()
+	produceHandler(writer)(rec, httptest.NewRequest(http.MethodPost, "/produce", body))
+	elapsed := time.Since(start)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	if writer.count() != 20 {
+		t.Errorf("wrote %d messages, want 20", writer.count())
+	}
+	// 20 messages at 40/sec take about 500ms.
+	if elapsed < 400*time.Millisecond || elapsed > 1500*time.Millisecond {
+		t.Errorf("produced 20 messages at 40/sec in %s, want about 500ms", elapsed)
+	}
+}
+
+func TestProduceAtRate_StreamsUntilCancelled(t *testing.T) {
+	writer := &fakeWriter{}
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	produced, err := produceAtRate(ctx, writer, produceRequest{Rate: 100, MessageSize: 8}, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if produced != writer.count() {
+		t.Errorf("reported %d messages, writer saw %d", produced, writer.count())
+	}
+	// About 50 in 500ms; allow for tick alignment and scheduling.
+	if produced < 35 || produced > 55 {
+		t.Errorf("produced %d messages in 500ms at 100/sec, want about 50", produced)
+	}
+}
@@ -2,60 +2,306 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"log"
-	"net"
+	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"google.golang.org/grpc"
 
 	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/config"
+	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/debug"
 	pb "github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/externalscaler"
 	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/kafka"
 	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/lag"
+	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/logging"
+	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/metrics"
 	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/scraper"
 	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/server"
+	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/sink"
+	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/store"
 )
 
+// bindBackoff is the wait before the first retry of a gRPC listen that found
+// its port in use.
+const bindBackoff = 500 * time.Millisecond
+
 func main() {
-	cfg, err := config.ParseFromEnv()
+	selfTest := flag.Bool("selftest", false, "fetch lag once to check broker connectivity and credentials, then exit")
+	configFile := flag.String("config", "", "read metadata keys from this key=value file, falling back to env vars, and reload it on SIGHUP")
+	flag.Parse()
+
+	if err := run(*configFile, *selfTest); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run starts the scaler and serves until a shutdown signal. Errors are
+// returned rather than fatal, so the fetcher, sink and exporter are closed
+// on every path out.
+func run(configFile string, selfTest bool) error {
+	cfg, err := loadConfig(configFile)
 	if err != nil {
-		log.Fatalf("Failed to parse config: %v", err)
+		return fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	// In JSON mode the standard log package is routed through the same
+	// handler, so every line is structured
+	if cfg.LogFormat == config.LogFormatJSON {
+		slog.SetDefault(logging.New(cfg.LogFormat, os.Stderr))
 	}
 
 	log.Printf("Starting persistent Kafka lag scaler")
 	log.Printf("  Brokers:          %s", cfg.BootstrapServers)
 	log.Printf("  Topic:            %s", cfg.Topic)
-	log.Printf("  Consumer Group:   %s", cfg.ConsumerGroup)
+	log.Printf("  Consumer Group:   %s (strategy: %s)", cfg.ConsumerGroup, cfg.MultiGroupStrategy)
+	if cfg.LagMode == config.LagModeReplication {
+		log.Printf("  Lag Mode:         %s (mirror: %s on %s)", cfg.LagMode, cfg.ReplicationTopic, cfg.ReplicationBrokers)
+	} else {
+		log.Printf("  Lag Mode:         %s", cfg.LagMode)
+	}
+	if cfg.ConsumerGroupPattern != "" {
+		log.Printf("  Group Pattern:    %s (refresh: %s)", cfg.ConsumerGroupPattern, cfg.GroupRefresh)
+	}
+	log.Printf("  Partitions:       include=%v exclude=%v max=%d", cfg.IncludePartitions, cfg.ExcludePartitions, cfg.MaxPartitions)
+	log.Printf("  SASL:             %s (user: %s, password: %s)", cfg.SASLMechanism, cfg.SASLUsername, cfg.SASLPassword)
+	log.Printf("  TLS:              %v", cfg.TLSEnabled)
+	log.Printf("  Broker Rate:      %g/s", cfg.BrokerRateLimit)
+	log.Printf("  Evaluation Mode:  %s (lagging partitions threshold: %d, acceleration threshold: %g, crossing count: %d)", cfg.EvaluationMode, cfg.LaggingPartitionsThreshold, cfg.AccelerationThreshold, cfg.CrossingCount)
 	log.Printf("  Lag Threshold:    %d", cfg.LagThreshold)
 	log.Printf("  Sustain Duration: %s", cfg.SustainDuration)
+	log.Printf("  Panic Threshold:  %d", cfg.PanicThreshold)
+	log.Printf("  Min Stretch:      %d samples", cfg.MinStretchSamples)
+	log.Printf("  Require Current:  %v", cfg.RequireCurrentAboveThreshold)
+	log.Printf("  Quorum:           %d", cfg.ActivationQuorum)
+	log.Printf("  Min Active:       %s", cfg.MinActiveDuration)
+	log.Printf("  Verdict TTL:      %s", cfg.VerdictTTL)
+	log.Printf("  Drain Confirm:    %s", cfg.DrainConfirmDuration)
+	log.Printf("  Drain Time:       %s", cfg.DrainTimeThreshold)
+	log.Printf("  Lookback:         %s", cfg.PersistenceLookback)
+	log.Printf("  Warmup:           %d samples", cfg.WarmupSamples)
+	log.Printf("  Initial Retries:  %d", cfg.InitialFetchRetries)
+	log.Printf("  Breaker:          %d failures (max backoff: %s)", cfg.BreakerThreshold, cfg.BreakerMaxBackoff)
 	log.Printf("  Sampling Interval:%s", cfg.SamplingInterval)
-	log.Printf("  Window Size:      %d", cfg.WindowSize)
+	log.Printf("  Window Size:      %d (retention: %d)", cfg.WindowSize, cfg.RetentionSize)
+	log.Printf("  Schema Version:   %s", cfg.SchemaVersion)
+	log.Printf("  Window Store:     %s", cfg.WindowStorePath)
+	log.Printf("  Sink:             %s", cfg.Sink)
+	log.Printf("  Evaluation Cache: %s", cfg.EvaluationCacheTTL)
+	log.Printf("  Eviction Policy:  %s (margin: %s)", cfg.EvictionPolicy, cfg.EvictionMargin)
+	log.Printf("  Compact Samples:  %v", cfg.CompactSamples)
+	log.Printf("  Sample Spacing:   %g of interval (%s)", cfg.MinSampleSpacing, cfg.CloseSamples)
+	log.Printf("  Aggregate:        %v", cfg.AggregatePartitions)
+	log.Printf("  Lag Source:       %s (offset fetch mode: %s, requests: %s)", cfg.LagSource, cfg.OffsetFetchMode, cfg.OffsetRequests)
+	log.Printf("  Lag Basis:        %s", cfg.LagBasis)
+	log.Printf("  Lag Unit:         %s (record size refresh: %s)", cfg.LagUnit, cfg.RecordSizeRefresh)
+	log.Printf("  Isolation Level:  %s", cfg.IsolationLevel)
+	log.Printf("  Missing Offsets:  %s", cfg.MissingOffsets)
+	log.Printf("  Total Lag:        %s", cfg.TotalLagConsistency)
+	log.Printf("  Metadata Cache:   %s", cfg.MetadataCacheTTL)
+	log.Printf("  Offset Reset:     %d", cfg.OffsetResetThreshold)
+	log.Printf("  Max Plausible:    %d", cfg.MaxPlausibleLag)
+	log.Printf("  New Partitions:   %s grace", cfg.NewPartitionGrace)
+	log.Printf("  Stale Commits:    %s (weight: %g)", cfg.CommitStaleness, cfg.StaleCommitWeight)
+	log.Printf("  Strict Offsets:   %v", cfg.StrictOffsets)
+	log.Printf("  Skip Rebalance:   %v", cfg.SkipDuringRebalance)
+	log.Printf("  Group Members:    %s", cfg.GroupMembers)
+	log.Printf("  Suppress Schedule:%s", cfg.SuppressSchedule)
+	log.Printf("  Empty Unhealthy:  %v", cfg.EmptyTopicUnhealthy)
+	log.Printf("  Compacted Topic:  %v (refresh: %s)", cfg.CompactedTopic, cfg.CompactionRefresh)
+	log.Printf("  Partition Metrics:%v", cfg.PartitionMetrics)
+	log.Printf("  Scoped Metrics:   %v", cfg.NamespaceScopedMetrics)
+	log.Printf("  Per Partition:    %v", cfg.NormalizeByPartitions)
+	log.Printf("  Metric Bounds:    floor=%d ceiling=%d", cfg.MetricFloor, cfg.MetricCeiling)
+	for _, m := range cfg.Metrics {
+		log.Printf("  Metric:           %s %s (target: %d)", m.Aggregation, m.Name, m.Target)
+	}
+	log.Printf("  Exemplars:        %v", cfg.Exemplars)
+	log.Printf("  Metrics Exporter: %s", cfg.MetricsExporter)
+	if cfg.MetricsExporter == config.MetricsExporterOTLP {
+		log.Printf("  OTLP Endpoint:    %s", cfg.OTLPEndpoint)
+	}
+	log.Printf("  Debug Endpoints:  %v", cfg.DebugEndpoints)
+	log.Printf("  Bind Retries:     %d", cfg.BindRetries)
 
-	fetcher := kafka.NewLagFetcher(cfg.BootstrapServers, cfg.Topic, cfg.ConsumerGroup)
-	window := lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
-	scr := scraper.New(fetcher, window, cfg.SamplingInterval)
+	fetcher, err := kafka.NewLagFetcher(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create lag fetcher: %w", err)
+	}
+	defer fetcher.Close()
+	// With -selftest the exit code is the result, e.g. for an init container
+	if selfTest {
+		if err := scraper.SelfTest(context.Background(), fetcher, cfg, os.Stdout); err != nil {
+			return fmt.Errorf("self test failed: %w", err)
+		}
+		return nil
+	}
+	windowOpts := []lag.WindowOption{
+		lag.WithEvictionPolicy(lag.EvictionPolicy(cfg.EvictionPolicy)),
+		lag.WithEvictionMargin(cfg.EvictionMargin),
+	}
+	if cfg.CompactSamples {
+		windowOpts = append(windowOpts, lag.WithCompaction())
+	}
+	if cfg.MinSampleSpacing > 0 {
+		spacing := time.Duration(cfg.MinSampleSpacing * float64(cfg.SamplingInterval))
+		windowOpts = append(windowOpts, lag.WithMinSpacing(spacing, lag.SpacingPolicy(cfg.CloseSamples)))
+	}
+	// With a fixed partition set the window's storage can be sized up front
+	if n := len(cfg.IncludePartitions); n > 0 {
+		windowOpts = append(windowOpts, lag.WithPartitionsHint(n*max(len(cfg.ConsumerGroups()), 1)))
+	}
+	// The window stores the full retention; evaluators only search the
+	// last WindowSize samples' worth of it, via PersistenceLookback
+	window := lag.NewSlidingWindow(cfg.RetentionSize, cfg.SamplingInterval, windowOpts...)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// Start background scraper
-	go scr.Run(ctx)
+	var scraperOpts []scraper.Option
+	if cfg.WindowStorePath != "" {
+		windowStore := store.NewFile(cfg.WindowStorePath)
+		samples, err := windowStore.Load(ctx)
+		if err != nil {
+			log.Printf("Failed to load saved window, starting empty: %v", err)
+		}
+		window.Restore(samples)
+		log.Printf("Restored %d samples from %s", window.Len(), cfg.WindowStorePath)
+		scraperOpts = append(scraperOpts, scraper.WithSaver(windowStore))
+	}
+	switch cfg.Sink {
+	case config.SinkWebhook:
+		scraperOpts = append(scraperOpts, scraper.WithSink(sink.NewWebhook(string(cfg.SinkURL))))
+	case config.SinkKafka:
+		writer, err := kafka.NewWriter(cfg, cfg.SinkTopic)
+		if err != nil {
+			return fmt.Errorf("failed to create sink writer: %w", err)
+		}
+		kafkaSink := sink.NewKafka(writer)
+		defer kafkaSink.Close()
+		scraperOpts = append(scraperOpts, scraper.WithSink(kafkaSink))
+	}
+	scr := scraper.New(fetcher, window, cfg, scraperOpts...)
+
+	// Start background scraper. It finishes its current fetch and saves the
+	// window after cancel, so shutdown waits on scraperDone
+	scraperDone := make(chan struct{})
+	go func() {
+		scr.Run(ctx)
+		close(scraperDone)
+	}()
+
+	// Start metrics/debug HTTP server
+	mux := http.NewServeMux()
+	if cfg.Exemplars {
+		metrics.EnableExemplars()
+	}
+	switch cfg.MetricsExporter {
+	case config.MetricsExporterPrometheus:
+		metricsHandler := promhttp.Handler()
+		if cfg.Exemplars {
+			metricsHandler = promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer,
+				promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true}))
+		}
+		mux.Handle("GET /metrics", metricsHandler)
+	case config.MetricsExporterOTLP:
+		provider, err := metrics.StartOTLP(ctx, cfg.OTLPEndpoint)
+		if err != nil {
+			return fmt.Errorf("failed to start OTLP metrics exporter: %w", err)
+		}
+		// Flushed once the scraper has stopped, so the last scrape is exported
+		defer func() {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := provider.Shutdown(shutdownCtx); err != nil {
+				log.Printf("Failed to flush OTLP metrics: %v", err)
+			}
+		}()
+	}
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		if err := scr.Healthy(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		if err := scr.Ready(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+	var debugHandler *debug.Handler
+	if cfg.DebugEndpoints {
+		debugHandler = debug.New(window, scr, server.NewEvaluator(cfg), cfg)
+		debugHandler.Register(mux)
+	}
+	httpServer := &http.Server{Addr: fmt.Sprintf(":%d", cfg.MetricsPort), Handler: mux}
+
+	go func() {
+		log.Printf("Metrics server listening on :%d", cfg.MetricsPort)
+		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("Metrics server error: %v", err)
+		}
+	}()
 
 	// Start gRPC server
-	port := os.Getenv("GRPC_PORT")
-	if port == "" {
-		port = "50051"
+	lis, err := server.Listen(ctx, fmt.Sprintf(":%d", cfg.GRPCPort), cfg.BindRetries, bindBackoff)
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
 	}
 
-	lis, err := net.Listen("tcp", ":"+port)
+	creds, err := server.TLSCredentials(cfg)
 	if err != nil {
-		log.Fatalf("Failed to listen: %v", err)
+		return fmt.Errorf("failed to load gRPC TLS credentials: %w", err)
+	}
+	var grpcOpts []grpc.ServerOption
+	if creds != nil {
+		grpcOpts = append(grpcOpts, grpc.Creds(creds))
 	}
+	grpcServer := grpc.NewServer(grpcOpts...)
+	scalerServer := server.New(window, cfg, server.WithPartitions(fetcher))
+	pb.RegisterExternalScalerServer(grpcServer, scalerServer)
 
-	grpcServer := grpc.NewServer()
-	pb.RegisterExternalScalerServer(grpcServer, server.New(window, cfg))
+	if configFile != "" {
+		go func() {
+			current := cfg
+			hup := make(chan os.Signal, 1)
+			signal.Notify(hup, syscall.SIGHUP)
+			for range hup {
+				next, err := loadConfig(configFile)
+				if err != nil {
+					log.Printf("Failed to reload config, keeping the current one: %v", err)
+					continue
+				}
+				if changed := current.ConnectionChanges(next); len(changed) > 0 {
+					log.Printf("Config reload changes the Kafka connection settings %s, which need a restart; keeping the current config", strings.Join(changed, ", "))
+					continue
+				}
+				next, ignored := current.Reload(next)
+				if len(ignored) > 0 {
+					log.Printf("Config reload ignores changes to %s, which take effect on restart", strings.Join(ignored, ", "))
+				}
+				window.Resize(next.RetentionSize, next.SamplingInterval)
+				scr.Reconfigure(next)
+				scalerServer.Reconfigure(next)
+				if debugHandler != nil {
+					debugHandler.Reconfigure(server.NewEvaluator(next), next)
+				}
+				current = next
+				log.Printf("Reloaded config from %s", configFile)
+			}
+		}()
+	}
 
 	go func() {
 		sigChan := make(chan os.Signal, 1)
@@ -63,11 +309,22 @@ func main() {
 		<-sigChan
 		log.Println("Received shutdown signal, stopping...")
 		cancel()
+		httpServer.Close()
 		grpcServer.GracefulStop()
 	}()
 
-	log.Printf("gRPC server listening on :%s", port)
+	log.Printf("gRPC server listening on :%d (tls: %v, client certs: %v)", cfg.GRPCPort, creds != nil, cfg.GRPCClientCA != "")
 	if err := grpcServer.Serve(lis); err != nil {
-		log.Fatalf("Failed to serve: %v", err)
+		return fmt.Errorf("failed to serve: %w", err)
+	}
+	<-scraperDone
+	return nil
+}
+
+// loadConfig parses the config from path when set, otherwise from env vars.
+func loadConfig(path string) (*config.ScalerConfig, error) {
+	if path == "" {
+		return config.ParseFromEnv()
 	}
+	return config.ParseFile(path)
 }
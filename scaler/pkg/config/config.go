@@ -1,102 +1,1977 @@
 package config
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/url"
 	"os"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
 )
 
+const (
+	LagSourceOffsetFetch     = "offsetFetch"
+	LagSourceConsumerOffsets = "consumerOffsets"
+
+	LagBasisCommitted = "committed"
+	LagBasisEarliest  = "earliest"
+
+	LagModeConsumer    = "consumer"
+	LagModeReplication = "replication"
+
+	LagUnitMessages = "messages"
+	LagUnitBytes    = "bytes"
+	LagUnitSeconds  = "seconds"
+
+	MultiGroupStrategySum = "sum"
+	MultiGroupStrategyMax = "max"
+
+	MissingOffsetsSkip         = "skip"
+	MissingOffsetsCarryForward = "carryForward"
+
+	TotalLagLatest   = "latest"
+	TotalLagLastTick = "lastTick"
+
+	GroupMembersOff      = "off"
+	GroupMembersReport   = "report"
+	GroupMembersSuppress = "suppress"
+
+	IsolationReadUncommitted = "read_uncommitted"
+	IsolationReadCommitted   = "read_committed"
+
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+
+	EvaluationModeAbsolute = "absolute"
+	EvaluationModeBreadth  = "breadth"
+	EvaluationModeTotal    = "total"
+	// EvaluationModeAcceleration activates on sustained growth in the rate
+	// lag grows at rather than on its level.
+	EvaluationModeAcceleration = "acceleration"
+	// EvaluationModeCrossings activates on lag repeatedly crossing the
+	// threshold rather than staying above it.
+	EvaluationModeCrossings = "crossings"
+
+	EvictionPolicyTime   = "time"
+	EvictionPolicyCount  = "count"
+	EvictionPolicyHybrid = "hybrid"
+
+	OffsetFetchModeAuto     = "auto"
+	OffsetFetchModeNegative = "negative"
+	OffsetFetchModeOmitted  = "omitted"
+
+	OffsetRequestsSequential = "sequential"
+	OffsetRequestsConcurrent = "concurrent"
+
+	CloseSamplesReject = "reject"
+	CloseSamplesMerge  = "merge"
+
+	SinkWebhook = "webhook"
+	SinkKafka   = "kafka"
+
+	MetricsExporterPrometheus = "prometheus"
+	MetricsExporterOTLP       = "otlp"
+	MetricsExporterNone       = "none"
+
+	MetricTotal             = "total"
+	MetricMax               = "max"
+	MetricLaggingPartitions = "laggingPartitions"
+	MetricRate              = "rate"
+
+	SASLPlain       = "plain"
+	SASLScramSHA256 = "scram_sha256"
+	SASLScramSHA512 = "scram_sha512"
+)
+
+// Secret holds credential material. It formats as a fixed placeholder so
+// that logging a config (or any struct embedding it) never leaks the value.
+type Secret string
+
+const redacted = "[REDACTED]"
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+func (s Secret) GoString() string {
+	return s.String()
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// Metric is one metric reported to KEDA: an aggregation of the evaluation
+// result, under Name, with the HPA target Target.
+type Metric struct {
+	Aggregation string `json:"aggregation"`
+	Name        string `json:"name,omitempty"`
+	Target      int64  `json:"target"`
+}
+
 type ScalerConfig struct {
-	BootstrapServers string
-	Topic            string
-	ConsumerGroup    string
-	LagThreshold     int64
-	SustainDuration  time.Duration
-	SamplingInterval time.Duration
-	WindowSize       int
+	// SchemaVersion is the metadata schema the keys were read under.
+	SchemaVersion string `json:"schemaVersion"`
+
+	BootstrapServers string        `json:"bootstrapServers"`
+	Topic            string        `json:"topic"`
+	ConsumerGroup    string        `json:"consumerGroup"`
+	LagThreshold     int64         `json:"lagThreshold"`
+	SustainDuration  time.Duration `json:"sustainDuration"`
+	SamplingInterval time.Duration `json:"samplingInterval"`
+	WindowSize       int           `json:"windowSize"`
+
+	// RetentionSize is how many samples per partition the window stores, for
+	// statistics and dashboards, while WindowSize * SamplingInterval stays
+	// the horizon decisions are made over. Defaults to WindowSize.
+	RetentionSize int `json:"retentionSize"`
+
+	// ConsumerGroupPattern, instead of ConsumerGroup, tracks every group
+	// whose name matches this regular expression, re-listing groups every
+	// GroupRefresh.
+	ConsumerGroupPattern string        `json:"consumerGroupPattern,omitempty"`
+	GroupRefresh         time.Duration `json:"groupRefresh"`
+
+	// LagMode is what lag measures: consumer lag behind the group's
+	// committed offsets, or in replication mode how far ReplicationTopic on
+	// ReplicationBrokers, a mirror of Topic, trails its end offsets. They
+	// default to Topic and BootstrapServers, but can't both.
+	LagMode            string `json:"lagMode"`
+	ReplicationTopic   string `json:"replicationTopic,omitempty"`
+	ReplicationBrokers string `json:"replicationBrokers,omitempty"`
+
+	// EvaluationMode selects how samples are turned into a decision.
+	EvaluationMode string `json:"evaluationMode"`
+
+	// EvaluationCacheTTL bounds how long an evaluation is reused for repeat
+	// polls of an unchanged window; 0 disables caching.
+	EvaluationCacheTTL time.Duration `json:"evaluationCacheTTL"`
+
+	// GRPCPort is the port the external scaler gRPC server listens on, and
+	// MetricsPort the one serving /metrics and the debug endpoints.
+	GRPCPort    int `json:"grpcPort"`
+	MetricsPort int `json:"metricsPort"`
+
+	// BindRetries is how many more times the gRPC server tries to listen
+	// while its port is in use, e.g. by the pod a rolling restart is
+	// replacing, doubling the wait between attempts; 0 fails at once.
+	BindRetries int `json:"bindRetries"`
+
+	// Exemplars attaches the partition and committed offset to each lag
+	// histogram observation and serves /metrics as OpenMetrics, which is
+	// the only format exemplars are exposed in.
+	Exemplars bool `json:"exemplars"`
+
+	// MetricsExporter selects how the scaler's own metrics leave the
+	// process: served on /metrics, pushed over OTLP/gRPC to OTLPEndpoint,
+	// or not at all. OTLPEndpoint empty falls back to the standard
+	// OTEL_EXPORTER_OTLP_ENDPOINT.
+	MetricsExporter string `json:"metricsExporter"`
+	OTLPEndpoint    string `json:"otlpEndpoint,omitempty"`
+
+	// PartitionMetrics reports a metric per partition alongside the total,
+	// for HPAs that target individual partitions.
+	PartitionMetrics bool `json:"partitionMetrics"`
+
+	// NormalizeByPartitions reports total lag divided by the number of
+	// partitions in the latest scrape, so an AverageValue target stays
+	// meaningful as partitions are added.
+	NormalizeByPartitions bool `json:"normalizeByPartitions"`
+
+	// NamespaceScopedMetrics prefixes every reported metric name with the
+	// ScaledObject's namespace and name, so scalers sharing a KEDA can't
+	// collide.
+	NamespaceScopedMetrics bool `json:"namespaceScopedMetrics"`
+
+	// Metrics, when set, replaces the single total-lag metric with each of
+	// these aggregations, reported together so an HPA can weigh several
+	// signals. A Metric without a Name is named after the trigger's metric
+	// and its aggregation.
+	Metrics []Metric `json:"metrics,omitempty"`
+
+	// GRPCTLSCert and GRPCTLSKey are PEM file paths that enable TLS on the
+	// gRPC server; GRPCClientCA additionally requires client certificates
+	// signed by that CA. All empty serves plaintext.
+	GRPCTLSCert  string `json:"grpcTLSCert,omitempty"`
+	GRPCTLSKey   string `json:"grpcTLSKey,omitempty"`
+	GRPCClientCA string `json:"grpcClientCA,omitempty"`
+
+	// MetadataCacheTTL is how long the partition list from the last
+	// successful Metadata call is reused when a fresh one fails, e.g. during
+	// a controller election; 0 disables.
+	MetadataCacheTTL time.Duration `json:"metadataCacheTTL"`
+
+	// StrictOffsets flags samples whose committed offset is past the end
+	// offset instead of silently clamping their lag to 0.
+	StrictOffsets bool `json:"strictOffsets"`
+
+	// SkipDuringRebalance skips a scrape while a consumer group is
+	// rebalancing, when its committed offsets may be a mix of stale and
+	// fresh values.
+	SkipDuringRebalance bool `json:"skipDuringRebalance"`
+
+	// GroupMembers looks up each consumer group's active member count with
+	// DescribeGroups: report only exposes it, suppress also keeps the scaler
+	// inactive while no group has any members, since adding replicas can't
+	// help consumers that are all crashing.
+	GroupMembers string `json:"groupMembers"`
+
+	// SuppressSchedule keeps the scaler inactive, reporting a zero metric,
+	// during the times it matches, e.g. maintenance windows whose backlog a
+	// scheduled job handles. Samples are still collected throughout.
+	SuppressSchedule Schedule `json:"suppressSchedule"`
+
+	// EmptyTopicUnhealthy makes /healthz fail while the topic exists but has
+	// no partitions, e.g. mid-creation or mid-deletion. The scaler stays
+	// inactive either way.
+	EmptyTopicUnhealthy bool `json:"emptyTopicUnhealthy"`
+
+	// CompactedTopic discounts each partition's lag by the fraction of its
+	// backlog's offsets that still hold a record after log compaction,
+	// sampled every CompactionRefresh. Without it lag on a compacted topic
+	// counts offsets the consumer will never read.
+	CompactedTopic    bool          `json:"compactedTopic"`
+	CompactionRefresh time.Duration `json:"compactionRefresh"`
+
+	DebugEndpoints bool   `json:"debugEndpoints"`
+	LogFormat      string `json:"logFormat"`
+	LagSource      string `json:"lagSource"`
+	LagBasis       string `json:"lagBasis"`
+	EvictionPolicy string `json:"evictionPolicy"`
+	CompactSamples bool   `json:"compactSamples"`
+
+	// OffsetFetchMode is how the brokers' OffsetFetch responses report a
+	// partition the group never committed: auto accepts both a -1 offset and
+	// an omitted partition; negative expects -1 and omitted expects the
+	// partition left out, treating the other form as an unknown offset whose
+	// partition is skipped. Only applies to the offsetFetch lag source.
+	OffsetFetchMode string `json:"offsetFetchMode"`
+
+	// OffsetRequests is how a scrape orders its offset requests: sequential
+	// asks the group coordinator for committed offsets once ListOffsets has
+	// returned end offsets; concurrent sends both at once, for a scrape
+	// taking one round-trip fewer. Kafka has no single request returning
+	// both.
+	OffsetRequests string `json:"offsetRequests"`
+
+	// MinSampleSpacing is the fraction of SamplingInterval a sample must be
+	// taken after the previous one for its partition to be added as a
+	// separate sample; a closer one, e.g. from a retried fetch, is rejected or
+	// merged into the previous one according to CloseSamples. 0 adds every
+	// sample.
+	MinSampleSpacing float64 `json:"minSampleSpacing"`
+	CloseSamples     string  `json:"closeSamples"`
+
+	// AggregatePartitions stores one sample of total lag per scrape instead
+	// of one per partition, shrinking the window at the cost of
+	// per-partition persistence and diagnostics.
+	AggregatePartitions bool `json:"aggregatePartitions"`
+
+	// LagUnit is what lag is measured in. With bytes, lag is estimated from
+	// each partition's average record size, sampled every RecordSizeRefresh.
+	// With seconds, lag is the age of each partition's oldest unconsumed
+	// record. lagThreshold and the reported metric are in the same unit.
+	LagUnit           string        `json:"lagUnit"`
+	RecordSizeRefresh time.Duration `json:"recordSizeRefresh"`
+
+	// EvictionMargin extends time-based eviction beyond WindowSize *
+	// SamplingInterval so the sample at the sustain boundary isn't dropped.
+	EvictionMargin time.Duration `json:"evictionMargin"`
+
+	// PanicThreshold activates immediately, skipping SustainDuration, when
+	// any partition's current lag reaches it; 0 disables.
+	PanicThreshold int64 `json:"panicThreshold"`
+
+	// RequireCurrentAboveThreshold additionally requires the sustained
+	// partition's latest lag to still be at or above LagThreshold, so an
+	// older stretch that has since drained doesn't keep the scaler active.
+	RequireCurrentAboveThreshold bool `json:"requireCurrentAboveThreshold"`
+
+	// MinStretchSamples is the fewest above-threshold samples a stretch must
+	// hold, in addition to spanning SustainDuration; 0 disables.
+	MinStretchSamples int `json:"minStretchSamples"`
+
+	// LaggingPartitionsThreshold is, in breadth evaluation mode, how many
+	// partitions may hold sustained lag before the scaler activates.
+	LaggingPartitionsThreshold int `json:"laggingPartitionsThreshold"`
+
+	// AccelerationThreshold is, in acceleration evaluation mode, the lag
+	// acceleration in lag units per second squared that must be sustained
+	// for the scaler to activate.
+	AccelerationThreshold float64 `json:"accelerationThreshold"`
+
+	// CrossingCount is, in crossings evaluation mode, how many times a
+	// partition's lag must cross from below the lag threshold to at or above
+	// it within the persistence lookback for the scaler to activate.
+	CrossingCount int `json:"crossingCount"`
+
+	// MetricScale multiplies both the metric target and the reported metric
+	// value, giving fractional values more resolution in the int64 metric.
+	MetricScale int64 `json:"metricScale"`
+
+	// MetricFloor and MetricCeiling clamp each reported metric value, in
+	// the metric's own units before MetricScale, after persistence gating,
+	// so the floor applies to the 0 reported while not persistent too. 0
+	// disables either.
+	MetricFloor   int64 `json:"metricFloor"`
+	MetricCeiling int64 `json:"metricCeiling"`
+
+	// WarmupSamples is how many samples the window must hold before any
+	// decision is reported; until then the scaler stays inactive.
+	WarmupSamples int `json:"warmupSamples"`
+
+	// ActivationQuorum is how many consecutive scrapes' evaluations must agree
+	// before the reported activation state changes; 1 reports every verdict
+	// as is.
+	ActivationQuorum int `json:"activationQuorum"`
+
+	// MinActiveDuration is how long the scaler stays active after activating,
+	// even if lag clears sooner; 0 disables.
+	MinActiveDuration time.Duration `json:"minActiveDuration"`
+
+	// VerdictTTL is the longest an active verdict is reported without a
+	// fresh evaluation confirming it on a sample taken within the TTL, so
+	// the hold features can't keep a verdict alive after scraping stalls;
+	// 0 disables.
+	VerdictTTL time.Duration `json:"verdictTTL"`
+
+	// DrainConfirmDuration keeps the scaler active after persistence clears
+	// until total lag has been zero for this long, so consumers aren't
+	// scaled to zero on a momentary drain; 0 disables. It can't exceed the
+	// window, which is all the history there is to confirm it from.
+	DrainConfirmDuration time.Duration `json:"drainConfirmDuration"`
+
+	// DrainTimeThreshold reports the scaler inactive, even with lag, while
+	// the backlog is projected to clear within it at the current consume
+	// rate; 0 disables.
+	DrainTimeThreshold time.Duration `json:"drainTimeThreshold"`
+
+	// PersistenceLookback bounds how far back, from the newest sample, the
+	// search for a sustained stretch looks, so an old stretch in a long
+	// window no longer satisfies persistence. Current-lag statistics still
+	// cover the whole window. Defaults to the evaluation horizon,
+	// WindowSize * SamplingInterval, so a longer RetentionSize only adds
+	// history for statistics.
+	PersistenceLookback time.Duration `json:"persistenceLookback"`
+
+	// InitialFetchRetries is how many times a failed first scrape is retried,
+	// with backoff, before waiting for the next sampling tick.
+	InitialFetchRetries int `json:"initialFetchRetries"`
+
+	// BreakerThreshold is how many consecutive failed scrapes open the
+	// scraper's circuit breaker, after which scrapes back off exponentially,
+	// with jitter, up to BreakerMaxBackoff; 0 disables the breaker.
+	BreakerThreshold  int           `json:"breakerThreshold"`
+	BreakerMaxBackoff time.Duration `json:"breakerMaxBackoff"`
+
+	// WindowStorePath is a file the window is restored from at startup and
+	// saved to on shutdown; empty keeps the window in memory only.
+	WindowStorePath string `json:"windowStorePath,omitempty"`
+
+	// Sink, when set, forwards every scrape's samples to SinkURL as a
+	// webhook or to SinkTopic on the same brokers; empty disables. The URL
+	// is a Secret since webhook URLs often embed a token.
+	Sink      string `json:"sink,omitempty"`
+	SinkURL   Secret `json:"sinkURL,omitempty"`
+	SinkTopic string `json:"sinkTopic,omitempty"`
+
+	// MaxPlausibleLag discards samples whose lag exceeds it as broker
+	// glitches; 0 disables.
+	MaxPlausibleLag int64 `json:"maxPlausibleLag"`
+
+	// NewPartitionGrace ignores a partition's samples for this long after
+	// it's first seen, so a partition added to the topic, which shows its
+	// whole log as lag until a consumer is assigned it, can't trip
+	// activation. Partitions seen on the first scrape aren't new; 0 disables.
+	NewPartitionGrace time.Duration `json:"newPartitionGrace"`
+
+	// CommitStaleness flags samples with lag whose committed offset hasn't
+	// moved for this long, e.g. from a consumer that commits rarely and
+	// so looks further behind than it is; 0 disables. StaleCommitWeight,
+	// from 0 to 1, scales the lag of flagged samples during evaluation; 1
+	// only flags them.
+	CommitStaleness   time.Duration `json:"commitStaleness"`
+	StaleCommitWeight float64       `json:"staleCommitWeight"`
+
+	// OffsetResetThreshold is the backward committed-offset jump that marks
+	// a partition as reset; 0 disables detection.
+	OffsetResetThreshold int64 `json:"offsetResetThreshold"`
+
+	// IncludePartitions, when set, restricts lag measurement to these
+	// partitions; ExcludePartitions is then applied within that set.
+	IncludePartitions []int `json:"includePartitions,omitempty"`
+	ExcludePartitions []int `json:"excludePartitions,omitempty"`
+
+	// MaxPartitions fails a scrape that would measure lag on more than this
+	// many partitions, after filtering, instead of issuing offset requests
+	// for all of them; 0 disables the cap.
+	MaxPartitions int `json:"maxPartitions"`
+
+	// TotalLagConsistency is which partitions total lag is summed over:
+	// latest sums every partition's latest sample however old, lastTick only
+	// those sampled within the most recent sampling interval, so a partition
+	// whose leader missed a tick doesn't mix a stale value into the total.
+	TotalLagConsistency string `json:"totalLagConsistency"`
+
+	// MultiGroupStrategy combines the lag of several consumer groups on the
+	// same partition: sum adds them, max takes the slowest group.
+	MultiGroupStrategy string `json:"multiGroupStrategy"`
+
+	// BrokerRateLimit caps broker round-trips per second across the fetcher
+	// and its lag sources; 0 disables the limit.
+	BrokerRateLimit float64 `json:"brokerRateLimit"`
+
+	// IsolationLevel is the isolation level end offsets are listed at.
+	// read_committed lists the last stable offset, so open and aborted
+	// transactions a transactional consumer won't read don't count as lag.
+	IsolationLevel string `json:"isolationLevel"`
+
+	// MissingOffsets is what to do with a partition absent from the
+	// ListOffsets response: skip it, or carry forward its last offsets.
+	MissingOffsets string `json:"missingOffsets"`
+
+	// Kafka credentials, from the scaler's own environment or config file
+	SASLMechanism string `json:"sasl"`
+	SASLUsername  string `json:"username"`
+	SASLPassword  Secret `json:"password"`
+	TLSEnabled    bool   `json:"tls"`
+	TLSCA         string `json:"ca"`
+	TLSCert       string `json:"cert"`
+	TLSKey        Secret `json:"key"`
+
+	// Credentials for ReplicationBrokers in replication mode, each
+	// defaulting to its counterpart above.
+	ReplicationSASLMechanism string `json:"replicationSasl"`
+	ReplicationSASLUsername  string `json:"replicationUsername"`
+	ReplicationSASLPassword  Secret `json:"replicationPassword"`
+	ReplicationTLSEnabled    bool   `json:"replicationTls"`
+	ReplicationTLSCA         string `json:"replicationCa"`
+	ReplicationTLSCert       string `json:"replicationCert"`
+	ReplicationTLSKey        Secret `json:"replicationKey"`
+}
+
+// Credentials are the SASL and TLS settings for connecting to one cluster.
+type Credentials struct {
+	SASLMechanism string
+	SASLUsername  string
+	SASLPassword  Secret
+	TLSEnabled    bool
+	TLSCA         string
+	TLSCert       string
+	TLSKey        Secret
+}
+
+// Credentials returns the settings for BootstrapServers.
+func (c *ScalerConfig) Credentials() Credentials {
+	return Credentials{
+		SASLMechanism: c.SASLMechanism,
+		SASLUsername:  c.SASLUsername,
+		SASLPassword:  c.SASLPassword,
+		TLSEnabled:    c.TLSEnabled,
+		TLSCA:         c.TLSCA,
+		TLSCert:       c.TLSCert,
+		TLSKey:        c.TLSKey,
+	}
+}
+
+// ReplicationCredentials returns the settings for ReplicationBrokers.
+func (c *ScalerConfig) ReplicationCredentials() Credentials {
+	return Credentials{
+		SASLMechanism: c.ReplicationSASLMechanism,
+		SASLUsername:  c.ReplicationSASLUsername,
+		SASLPassword:  c.ReplicationSASLPassword,
+		TLSEnabled:    c.ReplicationTLSEnabled,
+		TLSCA:         c.ReplicationTLSCA,
+		TLSCert:       c.ReplicationTLSCert,
+		TLSKey:        c.ReplicationTLSKey,
+	}
+}
+
+// MarshalJSON renders durations as human-readable strings; secrets are
+// redacted by Secret's own marshaler.
+func (c ScalerConfig) MarshalJSON() ([]byte, error) {
+	type plain ScalerConfig
+	return json.Marshal(struct {
+		plain
+		SustainDuration    string `json:"sustainDuration"`
+		SamplingInterval   string `json:"samplingInterval"`
+		EvaluationCacheTTL string `json:"evaluationCacheTTL"`
+		EvictionMargin     string `json:"evictionMargin"`
+		RecordSizeRefresh  string `json:"recordSizeRefresh"`
+		MinActiveDuration  string `json:"minActiveDuration"`
+		VerdictTTL         string `json:"verdictTTL"`
+		NewPartitionGrace  string `json:"newPartitionGrace"`
+		CommitStaleness    string `json:"commitStaleness"`
+		GroupRefresh       string `json:"groupRefresh"`
+		CompactionRefresh  string `json:"compactionRefresh"`
+		BreakerMaxBackoff  string `json:"breakerMaxBackoff"`
+		MetadataCacheTTL   string `json:"metadataCacheTTL"`
+		DrainConfirm       string `json:"drainConfirmDuration"`
+		Lookback           string `json:"persistenceLookback"`
+		DrainTimeThreshold string `json:"drainTimeThreshold"`
+	}{
+		plain:              plain(c),
+		SustainDuration:    c.SustainDuration.String(),
+		SamplingInterval:   c.SamplingInterval.String(),
+		EvaluationCacheTTL: c.EvaluationCacheTTL.String(),
+		EvictionMargin:     c.EvictionMargin.String(),
+		RecordSizeRefresh:  c.RecordSizeRefresh.String(),
+		MinActiveDuration:  c.MinActiveDuration.String(),
+		VerdictTTL:         c.VerdictTTL.String(),
+		NewPartitionGrace:  c.NewPartitionGrace.String(),
+		CommitStaleness:    c.CommitStaleness.String(),
+		GroupRefresh:       c.GroupRefresh.String(),
+		CompactionRefresh:  c.CompactionRefresh.String(),
+		BreakerMaxBackoff:  c.BreakerMaxBackoff.String(),
+		MetadataCacheTTL:   c.MetadataCacheTTL.String(),
+		DrainConfirm:       c.DrainConfirmDuration.String(),
+		Lookback:           c.PersistenceLookback.String(),
+		DrainTimeThreshold: c.DrainTimeThreshold.String(),
+	})
 }
 
 func ParseFromMetadata(metadata map[string]string) (*ScalerConfig, error) {
 	cfg := &ScalerConfig{
-		LagThreshold:     500,
-		SustainDuration:  120 * time.Second,
-		SamplingInterval: 10 * time.Second,
-		WindowSize:       30,
+		LagThreshold:        500,
+		SustainDuration:     120 * time.Second,
+		SamplingInterval:    10 * time.Second,
+		WindowSize:          30,
+		ActivationQuorum:    1,
+		MetricScale:         1,
+		LagSource:           LagSourceOffsetFetch,
+		LagBasis:            LagBasisCommitted,
+		EvictionPolicy:      EvictionPolicyTime,
+		CloseSamples:        CloseSamplesReject,
+		OffsetFetchMode:     OffsetFetchModeAuto,
+		OffsetRequests:      OffsetRequestsSequential,
+		LogFormat:           LogFormatText,
+		EvaluationMode:      EvaluationModeAbsolute,
+		MissingOffsets:      MissingOffsetsSkip,
+		MultiGroupStrategy:  MultiGroupStrategySum,
+		TotalLagConsistency: TotalLagLatest,
+		GroupMembers:        GroupMembersOff,
+		IsolationLevel:      IsolationReadUncommitted,
+		LagUnit:             LagUnitMessages,
+		RecordSizeRefresh:   5 * time.Minute,
+		GRPCPort:            50051,
+		BindRetries:         5,
+		StaleCommitWeight:   1,
+		MetricsPort:         9090,
+		MetricsExporter:     MetricsExporterPrometheus,
+		InitialFetchRetries: 3,
+		GroupRefresh:        time.Minute,
+		CompactionRefresh:   5 * time.Minute,
+		BreakerThreshold:    5,
+		BreakerMaxBackoff:   5 * time.Minute,
+		MetadataCacheTTL:    time.Minute,
+	}
+
+	metadata, version, err := applySchema(metadata)
+	if err != nil {
+		return nil, err
 	}
+	cfg.SchemaVersion = version
+
+	// Every field is checked even after one fails, so all problems are
+	// reported together
+	var errs []error
 
 	cfg.BootstrapServers = getMetadataOrEnv(metadata, "bootstrapServers", "KAFKA_BROKERS", "localhost:9092")
 	cfg.Topic = getMetadataOrEnv(metadata, "topic", "KAFKA_TOPIC", "")
 	cfg.ConsumerGroup = getMetadataOrEnv(metadata, "consumerGroup", "KAFKA_GROUP_ID", "")
 
+	cfg.ConsumerGroupPattern = getMetadataOrEnv(metadata, "consumerGroupPattern", "KAFKA_GROUP_PATTERN", "")
+
 	if cfg.Topic == "" {
-		return nil, fmt.Errorf("topic is required")
+		errs = append(errs, fmt.Errorf("topic is required"))
+	}
+
+	cfg.LagMode = getMetadataOrEnv(metadata, "lagMode", "LAG_MODE", LagModeConsumer)
+	cfg.ReplicationTopic = getMetadataOrEnv(metadata, "replicationTopic", "REPLICATION_TOPIC", cfg.Topic)
+	cfg.ReplicationBrokers = getMetadataOrEnv(metadata, "replicationBrokers", "REPLICATION_BROKERS", cfg.BootstrapServers)
+	replication := cfg.LagMode == LagModeReplication
+	switch cfg.LagMode {
+	case LagModeConsumer:
+	case LagModeReplication:
+		if cfg.ReplicationTopic == cfg.Topic && cfg.ReplicationBrokers == cfg.BootstrapServers {
+			errs = append(errs, fmt.Errorf("lagMode %q requires replicationTopic or replicationBrokers to name the mirror", LagModeReplication))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("invalid lagMode %q: must be %q or %q", cfg.LagMode, LagModeConsumer, LagModeReplication))
+	}
+
+	switch {
+	case replication:
+		// Lag is measured against the mirror, not a group
+	case cfg.ConsumerGroupPattern != "" && len(cfg.ConsumerGroups()) > 0:
+		errs = append(errs, fmt.Errorf("consumerGroup and consumerGroupPattern are mutually exclusive"))
+	case cfg.ConsumerGroupPattern != "":
+		if _, err := regexp.Compile(cfg.ConsumerGroupPattern); err != nil {
+			errs = append(errs, fmt.Errorf("invalid consumerGroupPattern: %w", err))
+		}
+	case len(cfg.ConsumerGroups()) == 0:
+		errs = append(errs, fmt.Errorf("consumerGroup is required"))
 	}
-	if cfg.ConsumerGroup == "" {
-		return nil, fmt.Errorf("consumerGroup is required")
+
+	if v, ok := metadata["groupRefreshSeconds"]; ok {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid groupRefreshSeconds: %w", err))
+		} else {
+			cfg.GroupRefresh = time.Duration(n) * time.Second
+		}
+	} else if v := os.Getenv("GROUP_REFRESH_SECONDS"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid GROUP_REFRESH_SECONDS: %w", err))
+		} else {
+			cfg.GroupRefresh = time.Duration(n) * time.Second
+		}
+	}
+	if cfg.GroupRefresh < 0 {
+		errs = append(errs, fmt.Errorf("groupRefreshSeconds must not be negative, got %s", cfg.GroupRefresh))
 	}
 
 	if v, ok := metadata["lagThreshold"]; ok {
 		n, err := strconv.ParseInt(v, 10, 64)
 		if err != nil {
-			return nil, fmt.Errorf("invalid lagThreshold: %w", err)
+			errs = append(errs, fmt.Errorf("invalid lagThreshold: %w", err))
+		} else {
+			cfg.LagThreshold = n
 		}
-		cfg.LagThreshold = n
 	} else if v := os.Getenv("LAG_THRESHOLD"); v != "" {
 		n, err := strconv.ParseInt(v, 10, 64)
 		if err != nil {
-			return nil, fmt.Errorf("invalid LAG_THRESHOLD: %w", err)
+			errs = append(errs, fmt.Errorf("invalid LAG_THRESHOLD: %w", err))
+		} else {
+			cfg.LagThreshold = n
 		}
-		cfg.LagThreshold = n
 	}
 
 	if v, ok := metadata["sustainSeconds"]; ok {
 		n, err := strconv.ParseInt(v, 10, 64)
 		if err != nil {
-			return nil, fmt.Errorf("invalid sustainSeconds: %w", err)
+			errs = append(errs, fmt.Errorf("invalid sustainSeconds: %w", err))
+		} else {
+			cfg.SustainDuration = time.Duration(n) * time.Second
 		}
-		cfg.SustainDuration = time.Duration(n) * time.Second
 	} else if v := os.Getenv("SUSTAIN_SECONDS"); v != "" {
 		n, err := strconv.ParseInt(v, 10, 64)
 		if err != nil {
-			return nil, fmt.Errorf("invalid SUSTAIN_SECONDS: %w", err)
+			errs = append(errs, fmt.Errorf("invalid SUSTAIN_SECONDS: %w", err))
+		} else {
+			cfg.SustainDuration = time.Duration(n) * time.Second
 		}
-		cfg.SustainDuration = time.Duration(n) * time.Second
+	}
+	if cfg.SustainDuration < 0 {
+		errs = append(errs, fmt.Errorf("sustainSeconds must not be negative, got %s", cfg.SustainDuration))
 	}
 
 	if v, ok := metadata["samplingInterval"]; ok {
 		n, err := strconv.ParseInt(v, 10, 64)
 		if err != nil {
-			return nil, fmt.Errorf("invalid samplingInterval: %w", err)
+			errs = append(errs, fmt.Errorf("invalid samplingInterval: %w", err))
+		} else {
+			cfg.SamplingInterval = time.Duration(n) * time.Second
 		}
-		cfg.SamplingInterval = time.Duration(n) * time.Second
 	} else if v := os.Getenv("SAMPLING_INTERVAL"); v != "" {
 		n, err := strconv.ParseInt(v, 10, 64)
 		if err != nil {
-			return nil, fmt.Errorf("invalid SAMPLING_INTERVAL: %w", err)
+			errs = append(errs, fmt.Errorf("invalid SAMPLING_INTERVAL: %w", err))
+		} else {
+			cfg.SamplingInterval = time.Duration(n) * time.Second
+		}
+	}
+	if cfg.SamplingInterval <= 0 {
+		errs = append(errs, fmt.Errorf("samplingInterval must be positive, got %s", cfg.SamplingInterval))
+	}
+
+	// One sampling interval of margin keeps the sample at the sustain
+	// boundary when the window and sustain duration are the same length
+	cfg.EvictionMargin = cfg.SamplingInterval
+	if v, ok := metadata["evictionMarginSeconds"]; ok {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid evictionMarginSeconds: %w", err))
+		} else {
+			cfg.EvictionMargin = time.Duration(n) * time.Second
+		}
+	} else if v := os.Getenv("EVICTION_MARGIN_SECONDS"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid EVICTION_MARGIN_SECONDS: %w", err))
+		} else {
+			cfg.EvictionMargin = time.Duration(n) * time.Second
+		}
+	}
+	if cfg.EvictionMargin < 0 {
+		errs = append(errs, fmt.Errorf("evictionMarginSeconds must not be negative, got %s", cfg.EvictionMargin))
+	}
+
+	// Default to half the sampling interval: new samples invalidate the cache
+	// anyway, so this only bounds how stale a repeated poll can be
+	cfg.EvaluationCacheTTL = cfg.SamplingInterval / 2
+	if v, ok := metadata["evaluationCacheSeconds"]; ok {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid evaluationCacheSeconds: %w", err))
+		} else {
+			cfg.EvaluationCacheTTL = time.Duration(n) * time.Second
+		}
+	} else if v := os.Getenv("EVALUATION_CACHE_SECONDS"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid EVALUATION_CACHE_SECONDS: %w", err))
+		} else {
+			cfg.EvaluationCacheTTL = time.Duration(n) * time.Second
 		}
-		cfg.SamplingInterval = time.Duration(n) * time.Second
 	}
 
 	if v, ok := metadata["windowSize"]; ok {
 		n, err := strconv.Atoi(v)
 		if err != nil {
-			return nil, fmt.Errorf("invalid windowSize: %w", err)
+			errs = append(errs, fmt.Errorf("invalid windowSize: %w", err))
+		} else {
+			cfg.WindowSize = n
 		}
-		cfg.WindowSize = n
 	} else if v := os.Getenv("WINDOW_SIZE"); v != "" {
 		n, err := strconv.Atoi(v)
 		if err != nil {
-			return nil, fmt.Errorf("invalid WINDOW_SIZE: %w", err)
+			errs = append(errs, fmt.Errorf("invalid WINDOW_SIZE: %w", err))
+		} else {
+			cfg.WindowSize = n
 		}
-		cfg.WindowSize = n
+	}
+	if cfg.WindowSize <= 0 {
+		errs = append(errs, fmt.Errorf("windowSize must be positive, got %d", cfg.WindowSize))
 	}
 
-	return cfg, nil
-}
+	cfg.RetentionSize = cfg.WindowSize
+	if v, ok := metadata["retentionSize"]; ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid retentionSize: %w", err))
+		} else {
+			cfg.RetentionSize = n
+		}
+	} else if v := os.Getenv("RETENTION_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid RETENTION_SIZE: %w", err))
+		} else {
+			cfg.RetentionSize = n
+		}
+	}
+	if cfg.RetentionSize < cfg.WindowSize {
+		errs = append(errs, fmt.Errorf("retentionSize %d must not be smaller than windowSize %d", cfg.RetentionSize, cfg.WindowSize))
+	}
 
-func ParseFromEnv() (*ScalerConfig, error) {
-	return ParseFromMetadata(nil)
+	if v, ok := metadata["panicThreshold"]; ok {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid panicThreshold: %w", err))
+		} else {
+			cfg.PanicThreshold = n
+		}
+	} else if v := os.Getenv("PANIC_THRESHOLD"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid PANIC_THRESHOLD: %w", err))
+		} else {
+			cfg.PanicThreshold = n
+		}
+	}
+	if cfg.PanicThreshold > 0 && cfg.PanicThreshold <= cfg.LagThreshold {
+		errs = append(errs, fmt.Errorf("panicThreshold (%d) must be greater than lagThreshold (%d)", cfg.PanicThreshold, cfg.LagThreshold))
+	}
+
+	if v, ok := metadata["minStretchSamples"]; ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid minStretchSamples: %w", err))
+		} else {
+			cfg.MinStretchSamples = n
+		}
+	} else if v := os.Getenv("MIN_STRETCH_SAMPLES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid MIN_STRETCH_SAMPLES: %w", err))
+		} else {
+			cfg.MinStretchSamples = n
+		}
+	}
+	if cfg.MinStretchSamples < 0 {
+		errs = append(errs, fmt.Errorf("minStretchSamples must not be negative, got %d", cfg.MinStretchSamples))
+	}
+
+	if v, ok := metadata["metricScale"]; ok {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid metricScale: %w", err))
+		} else {
+			cfg.MetricScale = n
+		}
+	} else if v := os.Getenv("METRIC_SCALE"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid METRIC_SCALE: %w", err))
+		} else {
+			cfg.MetricScale = n
+		}
+	}
+	if cfg.MetricScale < 1 {
+		errs = append(errs, fmt.Errorf("metricScale must be at least 1, got %d", cfg.MetricScale))
+	}
+
+	if v, ok := metadata["metricFloor"]; ok {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid metricFloor: %w", err))
+		} else {
+			cfg.MetricFloor = n
+		}
+	} else if v := os.Getenv("METRIC_FLOOR"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid METRIC_FLOOR: %w", err))
+		} else {
+			cfg.MetricFloor = n
+		}
+	}
+	if cfg.MetricFloor < 0 {
+		errs = append(errs, fmt.Errorf("metricFloor must not be negative, got %d", cfg.MetricFloor))
+	}
+
+	if v, ok := metadata["metricCeiling"]; ok {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid metricCeiling: %w", err))
+		} else {
+			cfg.MetricCeiling = n
+		}
+	} else if v := os.Getenv("METRIC_CEILING"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid METRIC_CEILING: %w", err))
+		} else {
+			cfg.MetricCeiling = n
+		}
+	}
+	if cfg.MetricCeiling < 0 {
+		errs = append(errs, fmt.Errorf("metricCeiling must not be negative, got %d", cfg.MetricCeiling))
+	}
+	if cfg.MetricCeiling > 0 && cfg.MetricFloor > cfg.MetricCeiling {
+		errs = append(errs, fmt.Errorf("metricFloor (%d) must not exceed metricCeiling (%d)", cfg.MetricFloor, cfg.MetricCeiling))
+	}
+
+	if v, ok := metadata["initialFetchRetries"]; ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid initialFetchRetries: %w", err))
+		} else {
+			cfg.InitialFetchRetries = n
+		}
+	} else if v := os.Getenv("INITIAL_FETCH_RETRIES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid INITIAL_FETCH_RETRIES: %w", err))
+		} else {
+			cfg.InitialFetchRetries = n
+		}
+	}
+	if cfg.InitialFetchRetries < 0 {
+		errs = append(errs, fmt.Errorf("initialFetchRetries must not be negative, got %d", cfg.InitialFetchRetries))
+	}
+
+	if v, ok := metadata["breakerThreshold"]; ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid breakerThreshold: %w", err))
+		} else {
+			cfg.BreakerThreshold = n
+		}
+	} else if v := os.Getenv("BREAKER_THRESHOLD"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid BREAKER_THRESHOLD: %w", err))
+		} else {
+			cfg.BreakerThreshold = n
+		}
+	}
+	if cfg.BreakerThreshold < 0 {
+		errs = append(errs, fmt.Errorf("breakerThreshold must not be negative, got %d", cfg.BreakerThreshold))
+	}
+
+	if v, ok := metadata["breakerMaxBackoffSeconds"]; ok {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid breakerMaxBackoffSeconds: %w", err))
+		} else {
+			cfg.BreakerMaxBackoff = time.Duration(n) * time.Second
+		}
+	} else if v := os.Getenv("BREAKER_MAX_BACKOFF_SECONDS"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid BREAKER_MAX_BACKOFF_SECONDS: %w", err))
+		} else {
+			cfg.BreakerMaxBackoff = time.Duration(n) * time.Second
+		}
+	}
+	if cfg.BreakerMaxBackoff < 0 {
+		errs = append(errs, fmt.Errorf("breakerMaxBackoffSeconds must not be negative, got %s", cfg.BreakerMaxBackoff))
+	}
+
+	if v, ok := metadata["warmupSamples"]; ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid warmupSamples: %w", err))
+		} else {
+			cfg.WarmupSamples = n
+		}
+	} else if v := os.Getenv("WARMUP_SAMPLES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid WARMUP_SAMPLES: %w", err))
+		} else {
+			cfg.WarmupSamples = n
+		}
+	}
+	if cfg.WarmupSamples < 0 {
+		errs = append(errs, fmt.Errorf("warmupSamples must not be negative, got %d", cfg.WarmupSamples))
+	}
+
+	if v, ok := metadata["activationQuorum"]; ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid activationQuorum: %w", err))
+		} else {
+			cfg.ActivationQuorum = n
+		}
+	} else if v := os.Getenv("ACTIVATION_QUORUM"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid ACTIVATION_QUORUM: %w", err))
+		} else {
+			cfg.ActivationQuorum = n
+		}
+	}
+	if cfg.ActivationQuorum < 1 {
+		errs = append(errs, fmt.Errorf("activationQuorum must be at least 1, got %d", cfg.ActivationQuorum))
+	}
+
+	if v, ok := metadata["minActiveSeconds"]; ok {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid minActiveSeconds: %w", err))
+		} else {
+			cfg.MinActiveDuration = time.Duration(n) * time.Second
+		}
+	} else if v := os.Getenv("MIN_ACTIVE_SECONDS"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid MIN_ACTIVE_SECONDS: %w", err))
+		} else {
+			cfg.MinActiveDuration = time.Duration(n) * time.Second
+		}
+	}
+	if cfg.MinActiveDuration < 0 {
+		errs = append(errs, fmt.Errorf("minActiveSeconds must not be negative, got %s", cfg.MinActiveDuration))
+	}
+
+	if v, ok := metadata["verdictTTLSeconds"]; ok {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid verdictTTLSeconds: %w", err))
+		} else {
+			cfg.VerdictTTL = time.Duration(n) * time.Second
+		}
+	} else if v := os.Getenv("VERDICT_TTL_SECONDS"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid VERDICT_TTL_SECONDS: %w", err))
+		} else {
+			cfg.VerdictTTL = time.Duration(n) * time.Second
+		}
+	}
+	// A shorter TTL would expire every verdict between two scrapes
+	if cfg.VerdictTTL < 0 || (cfg.VerdictTTL > 0 && cfg.VerdictTTL < cfg.SamplingInterval) {
+		errs = append(errs, fmt.Errorf("verdictTTLSeconds must be 0 or at least samplingInterval %s, got %s", cfg.SamplingInterval, cfg.VerdictTTL))
+	}
+
+	if v, ok := metadata["drainConfirmSeconds"]; ok {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid drainConfirmSeconds: %w", err))
+		} else {
+			cfg.DrainConfirmDuration = time.Duration(n) * time.Second
+		}
+	} else if v := os.Getenv("DRAIN_CONFIRM_SECONDS"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid DRAIN_CONFIRM_SECONDS: %w", err))
+		} else {
+			cfg.DrainConfirmDuration = time.Duration(n) * time.Second
+		}
+	}
+	if cfg.DrainConfirmDuration < 0 {
+		errs = append(errs, fmt.Errorf("drainConfirmSeconds must not be negative, got %s", cfg.DrainConfirmDuration))
+	} else if window := time.Duration(cfg.WindowSize) * cfg.SamplingInterval; cfg.DrainConfirmDuration > window {
+		errs = append(errs, fmt.Errorf("drainConfirmSeconds %s exceeds the window of %s", cfg.DrainConfirmDuration, window))
+	}
+
+	if v, ok := metadata["drainTimeThresholdSeconds"]; ok {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid drainTimeThresholdSeconds: %w", err))
+		} else {
+			cfg.DrainTimeThreshold = time.Duration(n) * time.Second
+		}
+	} else if v := os.Getenv("DRAIN_TIME_THRESHOLD_SECONDS"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid DRAIN_TIME_THRESHOLD_SECONDS: %w", err))
+		} else {
+			cfg.DrainTimeThreshold = time.Duration(n) * time.Second
+		}
+	}
+	if cfg.DrainTimeThreshold < 0 {
+		errs = append(errs, fmt.Errorf("drainTimeThresholdSeconds must not be negative, got %s", cfg.DrainTimeThreshold))
+	}
+
+	cfg.PersistenceLookback = time.Duration(cfg.WindowSize) * cfg.SamplingInterval
+	if v, ok := metadata["persistenceLookbackSeconds"]; ok {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid persistenceLookbackSeconds: %w", err))
+		} else {
+			cfg.PersistenceLookback = time.Duration(n) * time.Second
+		}
+	} else if v := os.Getenv("PERSISTENCE_LOOKBACK_SECONDS"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid PERSISTENCE_LOOKBACK_SECONDS: %w", err))
+		} else {
+			cfg.PersistenceLookback = time.Duration(n) * time.Second
+		}
+	}
+	// Only checked when set: a default window shorter than sustainSeconds was
+	// already a misconfiguration of its own
+	if _, set := metadata["persistenceLookbackSeconds"]; (set || os.Getenv("PERSISTENCE_LOOKBACK_SECONDS") != "") && cfg.PersistenceLookback < cfg.SustainDuration {
+		errs = append(errs, fmt.Errorf("persistenceLookbackSeconds %s is shorter than sustainSeconds %s, so lag could never persist", cfg.PersistenceLookback, cfg.SustainDuration))
+	}
+
+	if v, ok := metadata["brokerRateLimit"]; ok {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid brokerRateLimit: %w", err))
+		} else {
+			cfg.BrokerRateLimit = f
+		}
+	} else if v := os.Getenv("BROKER_RATE_LIMIT"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid BROKER_RATE_LIMIT: %w", err))
+		} else {
+			cfg.BrokerRateLimit = f
+		}
+	}
+	if cfg.BrokerRateLimit < 0 {
+		errs = append(errs, fmt.Errorf("brokerRateLimit must not be negative, got %g", cfg.BrokerRateLimit))
+	}
+
+	if cfg.GRPCPort, err = parsePort(metadata, "grpcPort", "GRPC_PORT", cfg.GRPCPort); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.MetricsPort, err = parsePort(metadata, "metricsPort", "METRICS_PORT", cfg.MetricsPort); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.GRPCPort == cfg.MetricsPort {
+		errs = append(errs, fmt.Errorf("grpcPort and metricsPort must differ, both are %d", cfg.GRPCPort))
+	}
+	if v, ok := metadata["bindRetries"]; ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid bindRetries: %w", err))
+		} else {
+			cfg.BindRetries = n
+		}
+	} else if v := os.Getenv("BIND_RETRIES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid BIND_RETRIES: %w", err))
+		} else {
+			cfg.BindRetries = n
+		}
+	}
+	if cfg.BindRetries < 0 {
+		errs = append(errs, fmt.Errorf("bindRetries must be non-negative, got %d", cfg.BindRetries))
+	}
+
+	cfg.GRPCTLSCert = getMetadataOrEnv(metadata, "grpcTLSCert", "GRPC_TLS_CERT", "")
+	cfg.GRPCTLSKey = getMetadataOrEnv(metadata, "grpcTLSKey", "GRPC_TLS_KEY", "")
+	cfg.GRPCClientCA = getMetadataOrEnv(metadata, "grpcClientCA", "GRPC_CLIENT_CA", "")
+	if (cfg.GRPCTLSCert == "") != (cfg.GRPCTLSKey == "") {
+		errs = append(errs, fmt.Errorf("grpcTLSCert and grpcTLSKey must be provided together"))
+	}
+	if cfg.GRPCClientCA != "" && cfg.GRPCTLSCert == "" {
+		errs = append(errs, fmt.Errorf("grpcClientCA requires grpcTLSCert and grpcTLSKey"))
+	}
+
+	if v, ok := metadata["metadataCacheTTLSeconds"]; ok {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid metadataCacheTTLSeconds: %w", err))
+		} else {
+			cfg.MetadataCacheTTL = time.Duration(n) * time.Second
+		}
+	} else if v := os.Getenv("METADATA_CACHE_TTL_SECONDS"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid METADATA_CACHE_TTL_SECONDS: %w", err))
+		} else {
+			cfg.MetadataCacheTTL = time.Duration(n) * time.Second
+		}
+	}
+	if cfg.MetadataCacheTTL < 0 {
+		errs = append(errs, fmt.Errorf("metadataCacheTTLSeconds must not be negative, got %s", cfg.MetadataCacheTTL))
+	}
+
+	if v, ok := metadata["strictOffsets"]; ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid strictOffsets: %w", err))
+		} else {
+			cfg.StrictOffsets = b
+		}
+	} else if v := os.Getenv("STRICT_OFFSETS"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid STRICT_OFFSETS: %w", err))
+		} else {
+			cfg.StrictOffsets = b
+		}
+	}
+
+	if v, ok := metadata["emptyTopicUnhealthy"]; ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid emptyTopicUnhealthy: %w", err))
+		} else {
+			cfg.EmptyTopicUnhealthy = b
+		}
+	} else if v := os.Getenv("EMPTY_TOPIC_UNHEALTHY"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid EMPTY_TOPIC_UNHEALTHY: %w", err))
+		} else {
+			cfg.EmptyTopicUnhealthy = b
+		}
+	}
+
+	if v, ok := metadata["compactedTopic"]; ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid compactedTopic: %w", err))
+		} else {
+			cfg.CompactedTopic = b
+		}
+	} else if v := os.Getenv("COMPACTED_TOPIC"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid COMPACTED_TOPIC: %w", err))
+		} else {
+			cfg.CompactedTopic = b
+		}
+	}
+
+	if v, ok := metadata["compactionRefreshSeconds"]; ok {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid compactionRefreshSeconds: %w", err))
+		} else {
+			cfg.CompactionRefresh = time.Duration(n) * time.Second
+		}
+	} else if v := os.Getenv("COMPACTION_REFRESH_SECONDS"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid COMPACTION_REFRESH_SECONDS: %w", err))
+		} else {
+			cfg.CompactionRefresh = time.Duration(n) * time.Second
+		}
+	}
+	if cfg.CompactionRefresh < 0 {
+		errs = append(errs, fmt.Errorf("compactionRefreshSeconds must not be negative, got %s", cfg.CompactionRefresh))
+	}
+
+	if v, ok := metadata["skipDuringRebalance"]; ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid skipDuringRebalance: %w", err))
+		} else {
+			cfg.SkipDuringRebalance = b
+		}
+	} else if v := os.Getenv("SKIP_DURING_REBALANCE"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid SKIP_DURING_REBALANCE: %w", err))
+		} else {
+			cfg.SkipDuringRebalance = b
+		}
+	}
+
+	if v, ok := metadata["requireCurrentAboveThreshold"]; ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid requireCurrentAboveThreshold: %w", err))
+		} else {
+			cfg.RequireCurrentAboveThreshold = b
+		}
+	} else if v := os.Getenv("REQUIRE_CURRENT_ABOVE_THRESHOLD"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid REQUIRE_CURRENT_ABOVE_THRESHOLD: %w", err))
+		} else {
+			cfg.RequireCurrentAboveThreshold = b
+		}
+	}
+
+	if v, ok := metadata["partitionMetrics"]; ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid partitionMetrics: %w", err))
+		} else {
+			cfg.PartitionMetrics = b
+		}
+	} else if v := os.Getenv("PARTITION_METRICS"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid PARTITION_METRICS: %w", err))
+		} else {
+			cfg.PartitionMetrics = b
+		}
+	}
+
+	if v, ok := metadata["normalizeByPartitions"]; ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid normalizeByPartitions: %w", err))
+		} else {
+			cfg.NormalizeByPartitions = b
+		}
+	} else if v := os.Getenv("NORMALIZE_BY_PARTITIONS"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid NORMALIZE_BY_PARTITIONS: %w", err))
+		} else {
+			cfg.NormalizeByPartitions = b
+		}
+	}
+
+	if metrics, err := parseMetrics(getMetadataOrEnv(metadata, "metrics", "METRICS", "")); err != nil {
+		errs = append(errs, fmt.Errorf("invalid metrics: %w", err))
+	} else {
+		cfg.Metrics = metrics
+	}
+
+	if v, ok := metadata["namespaceScopedMetrics"]; ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid namespaceScopedMetrics: %w", err))
+		} else {
+			cfg.NamespaceScopedMetrics = b
+		}
+	} else if v := os.Getenv("NAMESPACE_SCOPED_METRICS"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid NAMESPACE_SCOPED_METRICS: %w", err))
+		} else {
+			cfg.NamespaceScopedMetrics = b
+		}
+	}
+
+	if v, ok := metadata["exemplars"]; ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid exemplars: %w", err))
+		} else {
+			cfg.Exemplars = b
+		}
+	} else if v := os.Getenv("METRICS_EXEMPLARS"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid METRICS_EXEMPLARS: %w", err))
+		} else {
+			cfg.Exemplars = b
+		}
+	}
+
+	cfg.MetricsExporter = getMetadataOrEnv(metadata, "metricsExporter", "METRICS_EXPORTER", cfg.MetricsExporter)
+	cfg.OTLPEndpoint = getMetadataOrEnv(metadata, "otlpEndpoint", "OTLP_ENDPOINT", "")
+	switch cfg.MetricsExporter {
+	case MetricsExporterPrometheus, MetricsExporterNone:
+	case MetricsExporterOTLP:
+		if cfg.OTLPEndpoint != "" {
+			if u, err := url.Parse(cfg.OTLPEndpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				errs = append(errs, fmt.Errorf("invalid otlpEndpoint %q: must be an http:// or https:// URL", cfg.OTLPEndpoint))
+			}
+		}
+	default:
+		errs = append(errs, fmt.Errorf("invalid metricsExporter %q: must be %q, %q or %q", cfg.MetricsExporter, MetricsExporterPrometheus, MetricsExporterOTLP, MetricsExporterNone))
+	}
+
+	if v, ok := metadata["debugEndpoints"]; ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid debugEndpoints: %w", err))
+		} else {
+			cfg.DebugEndpoints = b
+		}
+	} else if v := os.Getenv("DEBUG_ENDPOINTS"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid DEBUG_ENDPOINTS: %w", err))
+		} else {
+			cfg.DebugEndpoints = b
+		}
+	}
+
+	if v, ok := metadata["compactSamples"]; ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid compactSamples: %w", err))
+		} else {
+			cfg.CompactSamples = b
+		}
+	} else if v := os.Getenv("COMPACT_SAMPLES"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid COMPACT_SAMPLES: %w", err))
+		} else {
+			cfg.CompactSamples = b
+		}
+	}
+
+	if v, ok := metadata["minSampleSpacing"]; ok {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid minSampleSpacing: %w", err))
+		} else {
+			cfg.MinSampleSpacing = f
+		}
+	} else if v := os.Getenv("MIN_SAMPLE_SPACING"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid MIN_SAMPLE_SPACING: %w", err))
+		} else {
+			cfg.MinSampleSpacing = f
+		}
+	}
+	if cfg.MinSampleSpacing < 0 || cfg.MinSampleSpacing > 1 {
+		errs = append(errs, fmt.Errorf("minSampleSpacing must be between 0 and 1, got %g", cfg.MinSampleSpacing))
+	}
+
+	cfg.CloseSamples = getMetadataOrEnv(metadata, "closeSamples", "CLOSE_SAMPLES", cfg.CloseSamples)
+	switch cfg.CloseSamples {
+	case CloseSamplesReject, CloseSamplesMerge:
+	default:
+		errs = append(errs, fmt.Errorf("invalid closeSamples %q: must be %q or %q", cfg.CloseSamples, CloseSamplesReject, CloseSamplesMerge))
+	}
+
+	if v, ok := metadata["aggregatePartitions"]; ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid aggregatePartitions: %w", err))
+		} else {
+			cfg.AggregatePartitions = b
+		}
+	} else if v := os.Getenv("AGGREGATE_PARTITIONS"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid AGGREGATE_PARTITIONS: %w", err))
+		} else {
+			cfg.AggregatePartitions = b
+		}
+	}
+
+	if v, ok := metadata["maxPlausibleLag"]; ok {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid maxPlausibleLag: %w", err))
+		} else {
+			cfg.MaxPlausibleLag = n
+		}
+	} else if v := os.Getenv("MAX_PLAUSIBLE_LAG"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid MAX_PLAUSIBLE_LAG: %w", err))
+		} else {
+			cfg.MaxPlausibleLag = n
+		}
+	}
+	if cfg.MaxPlausibleLag > 0 && cfg.PanicThreshold > 0 && cfg.MaxPlausibleLag <= cfg.PanicThreshold {
+		errs = append(errs, fmt.Errorf("maxPlausibleLag (%d) must be greater than panicThreshold (%d)", cfg.MaxPlausibleLag, cfg.PanicThreshold))
+	}
+
+	if v, ok := metadata["newPartitionGraceSeconds"]; ok {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid newPartitionGraceSeconds: %w", err))
+		} else {
+			cfg.NewPartitionGrace = time.Duration(n) * time.Second
+		}
+	} else if v := os.Getenv("NEW_PARTITION_GRACE_SECONDS"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid NEW_PARTITION_GRACE_SECONDS: %w", err))
+		} else {
+			cfg.NewPartitionGrace = time.Duration(n) * time.Second
+		}
+	}
+	if cfg.NewPartitionGrace < 0 {
+		errs = append(errs, fmt.Errorf("newPartitionGraceSeconds must be non-negative, got %s", cfg.NewPartitionGrace))
+	}
+
+	if v, ok := metadata["commitStalenessSeconds"]; ok {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid commitStalenessSeconds: %w", err))
+		} else {
+			cfg.CommitStaleness = time.Duration(n) * time.Second
+		}
+	} else if v := os.Getenv("COMMIT_STALENESS_SECONDS"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid COMMIT_STALENESS_SECONDS: %w", err))
+		} else {
+			cfg.CommitStaleness = time.Duration(n) * time.Second
+		}
+	}
+	if cfg.CommitStaleness < 0 {
+		errs = append(errs, fmt.Errorf("commitStalenessSeconds must be non-negative, got %s", cfg.CommitStaleness))
+	}
+	if v, ok := metadata["staleCommitWeight"]; ok {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid staleCommitWeight: %w", err))
+		} else {
+			cfg.StaleCommitWeight = f
+		}
+	} else if v := os.Getenv("STALE_COMMIT_WEIGHT"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid STALE_COMMIT_WEIGHT: %w", err))
+		} else {
+			cfg.StaleCommitWeight = f
+		}
+	}
+	if cfg.StaleCommitWeight < 0 || cfg.StaleCommitWeight > 1 {
+		errs = append(errs, fmt.Errorf("staleCommitWeight must be between 0 and 1, got %g", cfg.StaleCommitWeight))
+	} else if cfg.StaleCommitWeight < 1 && cfg.CommitStaleness == 0 {
+		errs = append(errs, fmt.Errorf("staleCommitWeight requires commitStalenessSeconds"))
+	}
+
+	if v, ok := metadata["offsetResetThreshold"]; ok {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid offsetResetThreshold: %w", err))
+		} else {
+			cfg.OffsetResetThreshold = n
+		}
+	} else if v := os.Getenv("OFFSET_RESET_THRESHOLD"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid OFFSET_RESET_THRESHOLD: %w", err))
+		} else {
+			cfg.OffsetResetThreshold = n
+		}
+	}
+
+	cfg.LagSource = getMetadataOrEnv(metadata, "lagSource", "LAG_SOURCE", cfg.LagSource)
+	switch cfg.LagSource {
+	case LagSourceOffsetFetch, LagSourceConsumerOffsets:
+	default:
+		errs = append(errs, fmt.Errorf("invalid lagSource %q: must be %q or %q", cfg.LagSource, LagSourceOffsetFetch, LagSourceConsumerOffsets))
+	}
+
+	cfg.OffsetFetchMode = getMetadataOrEnv(metadata, "offsetFetchMode", "OFFSET_FETCH_MODE", cfg.OffsetFetchMode)
+	switch cfg.OffsetFetchMode {
+	case OffsetFetchModeAuto, OffsetFetchModeNegative, OffsetFetchModeOmitted:
+	default:
+		errs = append(errs, fmt.Errorf("invalid offsetFetchMode %q: must be %q, %q or %q", cfg.OffsetFetchMode, OffsetFetchModeAuto, OffsetFetchModeNegative, OffsetFetchModeOmitted))
+	}
+
+	cfg.OffsetRequests = getMetadataOrEnv(metadata, "offsetRequests", "OFFSET_REQUESTS", cfg.OffsetRequests)
+	switch cfg.OffsetRequests {
+	case OffsetRequestsSequential, OffsetRequestsConcurrent:
+	default:
+		errs = append(errs, fmt.Errorf("invalid offsetRequests %q: must be %q or %q", cfg.OffsetRequests, OffsetRequestsSequential, OffsetRequestsConcurrent))
+	}
+	// Each consumerOffsets source tails the offsets topic for as long as the
+	// scaler runs, so it can't follow a changing set of groups
+	if cfg.ConsumerGroupPattern != "" && cfg.LagSource == LagSourceConsumerOffsets {
+		errs = append(errs, fmt.Errorf("consumerGroupPattern requires lagSource %q", LagSourceOffsetFetch))
+	}
+
+	cfg.LagBasis = getMetadataOrEnv(metadata, "lagBasis", "LAG_BASIS", cfg.LagBasis)
+	switch cfg.LagBasis {
+	case LagBasisCommitted, LagBasisEarliest:
+	default:
+		errs = append(errs, fmt.Errorf("invalid lagBasis %q: must be %q or %q", cfg.LagBasis, LagBasisCommitted, LagBasisEarliest))
+	}
+
+	cfg.LagUnit = getMetadataOrEnv(metadata, "lagUnit", "LAG_UNIT", cfg.LagUnit)
+	switch cfg.LagUnit {
+	case LagUnitMessages, LagUnitBytes, LagUnitSeconds:
+	default:
+		errs = append(errs, fmt.Errorf("invalid lagUnit %q: must be %q, %q or %q", cfg.LagUnit, LagUnitMessages, LagUnitBytes, LagUnitSeconds))
+	}
+
+	if v, ok := metadata["recordSizeRefreshSeconds"]; ok {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid recordSizeRefreshSeconds: %w", err))
+		} else {
+			cfg.RecordSizeRefresh = time.Duration(n) * time.Second
+		}
+	} else if v := os.Getenv("RECORD_SIZE_REFRESH_SECONDS"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid RECORD_SIZE_REFRESH_SECONDS: %w", err))
+		} else {
+			cfg.RecordSizeRefresh = time.Duration(n) * time.Second
+		}
+	}
+	if cfg.RecordSizeRefresh < 0 {
+		errs = append(errs, fmt.Errorf("recordSizeRefreshSeconds must not be negative, got %s", cfg.RecordSizeRefresh))
+	}
+
+	cfg.EvictionPolicy = getMetadataOrEnv(metadata, "evictionPolicy", "EVICTION_POLICY", cfg.EvictionPolicy)
+	switch cfg.EvictionPolicy {
+	case EvictionPolicyTime, EvictionPolicyCount, EvictionPolicyHybrid:
+	default:
+		errs = append(errs, fmt.Errorf("invalid evictionPolicy %q: must be %q, %q or %q", cfg.EvictionPolicy, EvictionPolicyTime, EvictionPolicyCount, EvictionPolicyHybrid))
+	}
+
+	cfg.EvaluationMode = getMetadataOrEnv(metadata, "evaluationMode", "EVALUATION_MODE", cfg.EvaluationMode)
+	switch cfg.EvaluationMode {
+	case EvaluationModeAbsolute, EvaluationModeBreadth, EvaluationModeTotal, EvaluationModeAcceleration, EvaluationModeCrossings:
+	default:
+		errs = append(errs, fmt.Errorf("invalid evaluationMode %q: must be %q, %q, %q, %q or %q", cfg.EvaluationMode, EvaluationModeAbsolute, EvaluationModeBreadth, EvaluationModeTotal, EvaluationModeAcceleration, EvaluationModeCrossings))
+	}
+
+	if v, ok := metadata["accelerationThreshold"]; ok {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid accelerationThreshold: %w", err))
+		} else {
+			cfg.AccelerationThreshold = f
+		}
+	} else if v := os.Getenv("ACCELERATION_THRESHOLD"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid ACCELERATION_THRESHOLD: %w", err))
+		} else {
+			cfg.AccelerationThreshold = f
+		}
+	}
+	// At 0 any lag that isn't decelerating, even steady or none, would count
+	if cfg.EvaluationMode == EvaluationModeAcceleration && cfg.AccelerationThreshold <= 0 {
+		errs = append(errs, fmt.Errorf("evaluationMode %q requires a positive accelerationThreshold, got %g", EvaluationModeAcceleration, cfg.AccelerationThreshold))
+	}
+
+	if v, ok := metadata["crossingCount"]; ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid crossingCount: %w", err))
+		} else {
+			cfg.CrossingCount = n
+		}
+	} else if v := os.Getenv("CROSSING_COUNT"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid CROSSING_COUNT: %w", err))
+		} else {
+			cfg.CrossingCount = n
+		}
+	}
+	if cfg.EvaluationMode == EvaluationModeCrossings && cfg.CrossingCount < 1 {
+		errs = append(errs, fmt.Errorf("evaluationMode %q requires a crossingCount of at least 1, got %d", EvaluationModeCrossings, cfg.CrossingCount))
+	}
+
+	if cfg.AggregatePartitions && cfg.EvaluationMode == EvaluationModeBreadth {
+		errs = append(errs, fmt.Errorf("aggregatePartitions can't be combined with evaluationMode %q, which counts individual partitions", EvaluationModeBreadth))
+	}
+
+	if v, ok := metadata["laggingPartitionsThreshold"]; ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid laggingPartitionsThreshold: %w", err))
+		} else {
+			cfg.LaggingPartitionsThreshold = n
+		}
+	} else if v := os.Getenv("LAGGING_PARTITIONS_THRESHOLD"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid LAGGING_PARTITIONS_THRESHOLD: %w", err))
+		} else {
+			cfg.LaggingPartitionsThreshold = n
+		}
+	}
+	if cfg.LaggingPartitionsThreshold < 0 {
+		errs = append(errs, fmt.Errorf("laggingPartitionsThreshold must not be negative, got %d", cfg.LaggingPartitionsThreshold))
+	}
+
+	cfg.MultiGroupStrategy = getMetadataOrEnv(metadata, "multiGroupStrategy", "MULTI_GROUP_STRATEGY", cfg.MultiGroupStrategy)
+	switch cfg.MultiGroupStrategy {
+	case MultiGroupStrategySum, MultiGroupStrategyMax:
+	default:
+		errs = append(errs, fmt.Errorf("invalid multiGroupStrategy %q: must be %q or %q", cfg.MultiGroupStrategy, MultiGroupStrategySum, MultiGroupStrategyMax))
+	}
+
+	// Ages don't add up: summing them across partitions or groups would
+	// report a backlog older than any record in it
+	if cfg.LagUnit == LagUnitSeconds {
+		if cfg.EvaluationMode == EvaluationModeTotal {
+			errs = append(errs, fmt.Errorf("lagUnit %q can't be combined with evaluationMode %q", LagUnitSeconds, EvaluationModeTotal))
+		}
+		if cfg.MultiGroupStrategy == MultiGroupStrategySum && (len(cfg.ConsumerGroups()) > 1 || cfg.ConsumerGroupPattern != "") {
+			errs = append(errs, fmt.Errorf("lagUnit %q requires multiGroupStrategy %q when tracking several groups", LagUnitSeconds, MultiGroupStrategyMax))
+		}
+	}
+
+	// The aggregate sample hides how many partitions it stands for, and an
+	// age shared out across partitions means nothing
+	if cfg.NormalizeByPartitions {
+		if cfg.AggregatePartitions {
+			errs = append(errs, fmt.Errorf("normalizeByPartitions can't be combined with aggregatePartitions, which doesn't keep the partition count"))
+		}
+		if cfg.LagUnit == LagUnitSeconds {
+			errs = append(errs, fmt.Errorf("normalizeByPartitions can't be combined with lagUnit %q", LagUnitSeconds))
+		}
+	}
+
+	cfg.MissingOffsets = getMetadataOrEnv(metadata, "missingOffsets", "MISSING_OFFSETS", cfg.MissingOffsets)
+	switch cfg.MissingOffsets {
+	case MissingOffsetsSkip, MissingOffsetsCarryForward:
+	default:
+		errs = append(errs, fmt.Errorf("invalid missingOffsets %q: must be %q or %q", cfg.MissingOffsets, MissingOffsetsSkip, MissingOffsetsCarryForward))
+	}
+
+	cfg.IsolationLevel = getMetadataOrEnv(metadata, "isolationLevel", "ISOLATION_LEVEL", cfg.IsolationLevel)
+	switch cfg.IsolationLevel {
+	case IsolationReadUncommitted, IsolationReadCommitted:
+	default:
+		errs = append(errs, fmt.Errorf("invalid isolationLevel %q: must be %q or %q", cfg.IsolationLevel, IsolationReadUncommitted, IsolationReadCommitted))
+	}
+
+	cfg.TotalLagConsistency = getMetadataOrEnv(metadata, "totalLagConsistency", "TOTAL_LAG_CONSISTENCY", cfg.TotalLagConsistency)
+	switch cfg.TotalLagConsistency {
+	case TotalLagLatest, TotalLagLastTick:
+	default:
+		errs = append(errs, fmt.Errorf("invalid totalLagConsistency %q: must be %q or %q", cfg.TotalLagConsistency, TotalLagLatest, TotalLagLastTick))
+	}
+
+	cfg.GroupMembers = getMetadataOrEnv(metadata, "groupMembers", "GROUP_MEMBERS", cfg.GroupMembers)
+	switch cfg.GroupMembers {
+	case GroupMembersOff, GroupMembersReport, GroupMembersSuppress:
+	default:
+		errs = append(errs, fmt.Errorf("invalid groupMembers %q: must be %q, %q or %q", cfg.GroupMembers, GroupMembersOff, GroupMembersReport, GroupMembersSuppress))
+	}
+	if s, err := ParseSchedule(getMetadataOrEnv(metadata, "suppressSchedule", "SUPPRESS_SCHEDULE", "")); err != nil {
+		errs = append(errs, fmt.Errorf("invalid suppressSchedule: %w", err))
+	} else {
+		cfg.SuppressSchedule = s
+	}
+
+	if cfg.GroupMembers != GroupMembersOff && cfg.LagBasis == LagBasisEarliest {
+		errs = append(errs, fmt.Errorf("groupMembers %q requires lagBasis %q", cfg.GroupMembers, LagBasisCommitted))
+	}
+	if replication {
+		if cfg.LagBasis != LagBasisCommitted {
+			errs = append(errs, fmt.Errorf("lagMode %q can't be combined with lagBasis %q", LagModeReplication, cfg.LagBasis))
+		}
+		if cfg.GroupMembers != GroupMembersOff {
+			errs = append(errs, fmt.Errorf("lagMode %q can't be combined with groupMembers %q", LagModeReplication, cfg.GroupMembers))
+		}
+		if cfg.LagUnit == LagUnitSeconds {
+			errs = append(errs, fmt.Errorf("lagMode %q can't be combined with lagUnit %q", LagModeReplication, LagUnitSeconds))
+		}
+	}
+
+	cfg.LogFormat = getMetadataOrEnv(metadata, "logFormat", "LOG_FORMAT", cfg.LogFormat)
+	switch cfg.LogFormat {
+	case LogFormatText, LogFormatJSON:
+	default:
+		errs = append(errs, fmt.Errorf("invalid logFormat %q: must be %q or %q", cfg.LogFormat, LogFormatText, LogFormatJSON))
+	}
+
+	cfg.WindowStorePath = getMetadataOrEnv(metadata, "windowStorePath", "WINDOW_STORE_PATH", "")
+
+	cfg.Sink = getMetadataOrEnv(metadata, "sink", "LAG_SINK", "")
+	cfg.SinkURL = Secret(getMetadataOrEnv(metadata, "sinkURL", "LAG_SINK_URL", ""))
+	cfg.SinkTopic = getMetadataOrEnv(metadata, "sinkTopic", "LAG_SINK_TOPIC", "")
+	switch cfg.Sink {
+	case "":
+	case SinkWebhook:
+		if cfg.SinkURL == "" {
+			errs = append(errs, fmt.Errorf("sink %q requires sinkURL", SinkWebhook))
+		}
+	case SinkKafka:
+		if cfg.SinkTopic == "" {
+			errs = append(errs, fmt.Errorf("sink %q requires sinkTopic", SinkKafka))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("invalid sink %q: must be %q or %q", cfg.Sink, SinkWebhook, SinkKafka))
+	}
+
+	if err := parsePartitionFilters(metadata, cfg); err != nil {
+		errs = append(errs, err)
+	}
+
+	if v, ok := metadata["maxPartitions"]; ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid maxPartitions: %w", err))
+		} else {
+			cfg.MaxPartitions = n
+		}
+	} else if v := os.Getenv("MAX_PARTITIONS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid MAX_PARTITIONS: %w", err))
+		} else {
+			cfg.MaxPartitions = n
+		}
+	}
+	if cfg.MaxPartitions < 0 {
+		errs = append(errs, fmt.Errorf("maxPartitions must be non-negative, got %d", cfg.MaxPartitions))
+	}
+
+	if err := parseCredentials(metadata, cfg); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// parsePartitionFilters reads the comma-separated include/exclude partition
+// lists. Listing a partition in both is rejected as ambiguous.
+func parsePartitionFilters(metadata map[string]string, cfg *ScalerConfig) error {
+	var err error
+	cfg.IncludePartitions, err = parsePartitionList(getMetadataOrEnv(metadata, "includePartitions", "INCLUDE_PARTITIONS", ""))
+	if err != nil {
+		return fmt.Errorf("invalid includePartitions: %w", err)
+	}
+	cfg.ExcludePartitions, err = parsePartitionList(getMetadataOrEnv(metadata, "excludePartitions", "EXCLUDE_PARTITIONS", ""))
+	if err != nil {
+		return fmt.Errorf("invalid excludePartitions: %w", err)
+	}
+
+	included := make(map[int]bool, len(cfg.IncludePartitions))
+	for _, p := range cfg.IncludePartitions {
+		included[p] = true
+	}
+	for _, p := range cfg.ExcludePartitions {
+		if included[p] {
+			return fmt.Errorf("partition %d is in both includePartitions and excludePartitions", p)
+		}
+	}
+	return nil
+}
+
+func parsePartitionList(v string) ([]int, error) {
+	var partitions []int
+	for _, field := range strings.Split(v, ",") {
+		if field = strings.TrimSpace(field); field == "" {
+			continue
+		}
+		n, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, fmt.Errorf("negative partition %d", n)
+		}
+		partitions = append(partitions, n)
+	}
+	return partitions, nil
+}
+
+// parseMetrics reads a comma-separated list of aggregation:name:target
+// metrics, e.g. "total:kafka_lag:1000,rate::500". The name may be left empty;
+// names that are given must be distinct.
+func parseMetrics(v string) ([]Metric, error) {
+	var metrics []Metric
+	names, unnamed := make(map[string]bool), make(map[string]bool)
+	for _, field := range strings.Split(v, ",") {
+		if field = strings.TrimSpace(field); field == "" {
+			continue
+		}
+		parts := strings.Split(field, ":")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("%q is not aggregation:name:target", field)
+		}
+		m := Metric{Aggregation: strings.TrimSpace(parts[0]), Name: strings.TrimSpace(parts[1])}
+		switch m.Aggregation {
+		case MetricTotal, MetricMax, MetricLaggingPartitions, MetricRate:
+		default:
+			return nil, fmt.Errorf("unknown aggregation %q, must be %q, %q, %q or %q",
+				m.Aggregation, MetricTotal, MetricMax, MetricLaggingPartitions, MetricRate)
+		}
+		target, err := strconv.ParseInt(strings.TrimSpace(parts[2]), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("target of %q: %w", field, err)
+		}
+		if target < 1 {
+			return nil, fmt.Errorf("target of %q must be at least 1, got %d", field, target)
+		}
+		m.Target = target
+
+		// Unnamed metrics are told apart by their aggregation
+		if m.Name == "" {
+			if unnamed[m.Aggregation] {
+				return nil, fmt.Errorf("aggregation %q is listed twice without a name", m.Aggregation)
+			}
+			unnamed[m.Aggregation] = true
+		} else {
+			if names[m.Name] {
+				return nil, fmt.Errorf("metric name %q is listed twice", m.Name)
+			}
+			names[m.Name] = true
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics, nil
+}
+
+// parseCredentials reads SASL and TLS settings, under the same key names as
+// KEDA's built-in Kafka scaler, then the mirror's under the same names
+// prefixed with replication.
+func parseCredentials(metadata map[string]string, cfg *ScalerConfig) error {
+	creds, err := readCredentials(metadata, "", "KAFKA_", Credentials{})
+	if err != nil {
+		return err
+	}
+	cfg.SASLMechanism = creds.SASLMechanism
+	cfg.SASLUsername = creds.SASLUsername
+	cfg.SASLPassword = creds.SASLPassword
+	cfg.TLSEnabled = creds.TLSEnabled
+	cfg.TLSCA = creds.TLSCA
+	cfg.TLSCert = creds.TLSCert
+	cfg.TLSKey = creds.TLSKey
+
+	replica, err := readCredentials(metadata, "replication", "REPLICATION_", creds)
+	if err != nil {
+		return err
+	}
+	cfg.ReplicationSASLMechanism = replica.SASLMechanism
+	cfg.ReplicationSASLUsername = replica.SASLUsername
+	cfg.ReplicationSASLPassword = replica.SASLPassword
+	cfg.ReplicationTLSEnabled = replica.TLSEnabled
+	cfg.ReplicationTLSCA = replica.TLSCA
+	cfg.ReplicationTLSCert = replica.TLSCert
+	cfg.ReplicationTLSKey = replica.TLSKey
+
+	return nil
+}
+
+// readCredentials reads one set of credentials from the metadata keys named
+// with keyPrefix and env vars named with envPrefix, falling back to defaults.
+func readCredentials(metadata map[string]string, keyPrefix, envPrefix string, defaults Credentials) (Credentials, error) {
+	key := func(name string) string {
+		if keyPrefix == "" {
+			return name
+		}
+		return keyPrefix + strings.ToUpper(name[:1]) + name[1:]
+	}
+	get := func(name, env, defaultValue string) string {
+		return getMetadataOrEnv(metadata, key(name), envPrefix+env, defaultValue)
+	}
+
+	var creds Credentials
+	creds.SASLMechanism = get("sasl", "SASL_MECHANISM", defaults.SASLMechanism)
+	switch creds.SASLMechanism {
+	case "", "none":
+		creds.SASLMechanism = ""
+	case SASLPlain, SASLScramSHA256, SASLScramSHA512:
+		creds.SASLUsername = get("username", "SASL_USERNAME", defaults.SASLUsername)
+		creds.SASLPassword = Secret(get("password", "SASL_PASSWORD", string(defaults.SASLPassword)))
+		if creds.SASLUsername == "" || creds.SASLPassword == "" {
+			return creds, fmt.Errorf("%s and %s are required for %s %s", key("username"), key("password"), key("sasl"), creds.SASLMechanism)
+		}
+	default:
+		return creds, fmt.Errorf("invalid %s %q: must be none, %q, %q or %q", key("sasl"), creds.SASLMechanism, SASLPlain, SASLScramSHA256, SASLScramSHA512)
+	}
+
+	defaultTLS := "disable"
+	if defaults.TLSEnabled {
+		defaultTLS = "enable"
+	}
+	switch v := get("tls", "TLS", defaultTLS); v {
+	case "enable", "true":
+		creds.TLSEnabled = true
+	case "disable", "false":
+		creds.TLSEnabled = false
+	default:
+		return creds, fmt.Errorf("invalid %s %q: must be enable or disable", key("tls"), v)
+	}
+
+	creds.TLSCA = get("ca", "TLS_CA", defaults.TLSCA)
+	creds.TLSCert = get("cert", "TLS_CERT", defaults.TLSCert)
+	creds.TLSKey = Secret(get("key", "TLS_KEY", string(defaults.TLSKey)))
+	if (creds.TLSCert == "") != (creds.TLSKey == "") {
+		return creds, fmt.Errorf("%s and %s must be provided together", key("cert"), key("key"))
+	}
+
+	return creds, nil
+}
+
+// parsePort reads a TCP port from metadata key or envKey, falling back to
+// defaultPort, which is also returned alongside any error.
+func parsePort(metadata map[string]string, key, envKey string, defaultPort int) (int, error) {
+	port := defaultPort
+	if v, ok := metadata[key]; ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return defaultPort, fmt.Errorf("invalid %s: %w", key, err)
+		}
+		port = n
+	} else if v := os.Getenv(envKey); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return defaultPort, fmt.Errorf("invalid %s: %w", envKey, err)
+		}
+		port = n
+	}
+	if port < 1 || port > 65535 {
+		return defaultPort, fmt.Errorf("%s must be between 1 and 65535, got %d", key, port)
+	}
+	return port, nil
+}
+
+func ParseFromEnv() (*ScalerConfig, error) {
+	return ParseFromMetadata(nil)
+}
+
+// ConsumerGroups returns the tracked groups. ConsumerGroup may list several,
+// comma-separated, whose lag is combined per MultiGroupStrategy.
+func (c *ScalerConfig) ConsumerGroups() []string {
+	var groups []string
+	for _, g := range strings.Split(c.ConsumerGroup, ",") {
+		if g = strings.TrimSpace(g); g != "" {
+			groups = append(groups, g)
+		}
+	}
+	return groups
 }
 
 func getMetadataOrEnv(metadata map[string]string, key, envKey, defaultVal string) string {
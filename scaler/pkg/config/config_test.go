@@ -1,6 +1,10 @@
 package config
 
 import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 )
@@ -86,6 +90,39 @@ func TestParseFromMetadata_MissingTopic(t *testing.T) {
 	}
 }
 
+func TestParseFromMetadata_ConsumerGroupPattern(t *testing.T) {
+	meta := map[string]string{
+		"topic":                "my-topic",
+		"consumerGroupPattern": "^orders-[a-z0-9]+$",
+		"groupRefreshSeconds":  "30",
+	}
+
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.ConsumerGroupPattern != "^orders-[a-z0-9]+$" || cfg.GroupRefresh != 30*time.Second {
+		t.Errorf("unexpected pattern config: %q every %s", cfg.ConsumerGroupPattern, cfg.GroupRefresh)
+	}
+
+	meta["consumerGroup"] = "orders-1"
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error when both consumerGroup and consumerGroupPattern are set")
+	}
+	delete(meta, "consumerGroup")
+
+	meta["consumerGroupPattern"] = "orders-("
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error for an invalid consumerGroupPattern")
+	}
+
+	meta["consumerGroupPattern"] = "^orders-"
+	meta["lagSource"] = LagSourceConsumerOffsets
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error combining consumerGroupPattern with the consumerOffsets lag source")
+	}
+}
+
 func TestParseFromMetadata_MissingConsumerGroup(t *testing.T) {
 	meta := map[string]string{
 		"topic": "my-topic",
@@ -224,3 +261,1984 @@ func TestParseFromMetadata_InvalidEnvVars(t *testing.T) {
 		t.Fatal("expected error for invalid LAG_THRESHOLD env var")
 	}
 }
+
+func TestParseFromMetadata_LagSource(t *testing.T) {
+	meta := map[string]string{
+		"topic":         "my-topic",
+		"consumerGroup": "my-group",
+	}
+
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.LagSource != LagSourceOffsetFetch {
+		t.Errorf("expected default lagSource %q, got %q", LagSourceOffsetFetch, cfg.LagSource)
+	}
+
+	meta["lagSource"] = "consumerOffsets"
+	cfg, err = ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.LagSource != LagSourceConsumerOffsets {
+		t.Errorf("lagSource = %q, want %q", cfg.LagSource, LagSourceConsumerOffsets)
+	}
+
+	meta["lagSource"] = "burrow"
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error for unknown lagSource")
+	}
+}
+
+func TestParseFromMetadata_EvictionPolicy(t *testing.T) {
+	meta := map[string]string{
+		"topic":          "my-topic",
+		"consumerGroup":  "my-group",
+		"evictionPolicy": "hybrid",
+	}
+
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.EvictionPolicy != EvictionPolicyHybrid {
+		t.Errorf("evictionPolicy = %q, want %q", cfg.EvictionPolicy, EvictionPolicyHybrid)
+	}
+
+	meta["evictionPolicy"] = "lru"
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error for unknown evictionPolicy")
+	}
+}
+
+func TestParseFromMetadata_CompactSamples(t *testing.T) {
+	t.Setenv("COMPACT_SAMPLES", "true")
+
+	cfg, err := ParseFromMetadata(map[string]string{
+		"topic":         "my-topic",
+		"consumerGroup": "my-group",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.CompactSamples {
+		t.Error("expected compactSamples from env")
+	}
+
+	_, err = ParseFromMetadata(map[string]string{
+		"topic":          "my-topic",
+		"consumerGroup":  "my-group",
+		"compactSamples": "sometimes",
+	})
+	if err == nil {
+		t.Fatal("expected error for invalid compactSamples")
+	}
+}
+
+func TestParseFromMetadata_MinSampleSpacing(t *testing.T) {
+	meta := map[string]string{
+		"topic":         "my-topic",
+		"consumerGroup": "my-group",
+	}
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.MinSampleSpacing != 0 || cfg.CloseSamples != CloseSamplesReject {
+		t.Errorf("expected spacing disabled with reject by default, got %g and %q", cfg.MinSampleSpacing, cfg.CloseSamples)
+	}
+
+	meta["minSampleSpacing"] = "0.5"
+	meta["closeSamples"] = "merge"
+	cfg, err = ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.MinSampleSpacing != 0.5 || cfg.CloseSamples != CloseSamplesMerge {
+		t.Errorf("minSampleSpacing = %g, closeSamples = %q, want 0.5 and %q", cfg.MinSampleSpacing, cfg.CloseSamples, CloseSamplesMerge)
+	}
+
+	for key, value := range map[string]string{
+		"minSampleSpacing": "1.5",
+		"closeSamples":     "average",
+	} {
+		bad := map[string]string{"topic": "my-topic", "consumerGroup": "my-group", key: value}
+		if _, err := ParseFromMetadata(bad); err == nil {
+			t.Errorf("expected error for %s=%s", key, value)
+		}
+	}
+}
+
+func TestParseFromMetadata_AggregatePartitions(t *testing.T) {
+	t.Setenv("AGGREGATE_PARTITIONS", "true")
+
+	cfg, err := ParseFromMetadata(map[string]string{
+		"topic":         "my-topic",
+		"consumerGroup": "my-group",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.AggregatePartitions {
+		t.Error("expected aggregatePartitions from env")
+	}
+
+	_, err = ParseFromMetadata(map[string]string{
+		"topic":          "my-topic",
+		"consumerGroup":  "my-group",
+		"evaluationMode": EvaluationModeBreadth,
+	})
+	if err == nil {
+		t.Fatal("expected error combining aggregatePartitions with breadth evaluation")
+	}
+}
+
+func TestParseFromMetadata_Credentials(t *testing.T) {
+	meta := map[string]string{
+		"topic":         "my-topic",
+		"consumerGroup": "my-group",
+		"sasl":          "scram_sha512",
+		"username":      "scaler",
+		"password":      "hunter2",
+		"tls":           "enable",
+		"ca":            "-----BEGIN CERTIFICATE-----",
+	}
+
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.SASLMechanism != SASLScramSHA512 {
+		t.Errorf("sasl = %q", cfg.SASLMechanism)
+	}
+	if cfg.SASLUsername != "scaler" || cfg.SASLPassword != "hunter2" {
+		t.Errorf("credentials = %q / %q", cfg.SASLUsername, string(cfg.SASLPassword))
+	}
+	if !cfg.TLSEnabled || cfg.TLSCA == "" {
+		t.Errorf("expected TLS enabled with CA, got enabled=%v", cfg.TLSEnabled)
+	}
+}
+
+func TestParseFromMetadata_CredentialsAreRedacted(t *testing.T) {
+	meta := map[string]string{
+		"topic":         "my-topic",
+		"consumerGroup": "my-group",
+		"sasl":          "plain",
+		"username":      "scaler",
+		"password":      "hunter2",
+		"cert":          "cert-pem",
+		"key":           "super-secret-key",
+	}
+
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, format := range []string{"%v", "%+v", "%#v", "%s"} {
+		out := fmt.Sprintf(format, *cfg)
+		if strings.Contains(out, "hunter2") || strings.Contains(out, "super-secret-key") {
+			t.Errorf("format %s leaked a secret: %s", format, out)
+		}
+	}
+}
+
+func TestParseFromMetadata_InvalidCredentials(t *testing.T) {
+	cases := map[string]map[string]string{
+		"unknown mechanism": {"sasl": "gssapi", "username": "u", "password": "p"},
+		"missing password":  {"sasl": "plain", "username": "u"},
+		"invalid tls":       {"tls": "maybe"},
+		"cert without key":  {"cert": "cert-pem"},
+	}
+
+	for name, extra := range cases {
+		meta := map[string]string{"topic": "my-topic", "consumerGroup": "my-group"}
+		for k, v := range extra {
+			meta[k] = v
+		}
+		if _, err := ParseFromMetadata(meta); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestParseFromMetadata_ReplicationCredentials(t *testing.T) {
+	meta := map[string]string{
+		"topic":              "my-topic",
+		"consumerGroup":      "my-group",
+		"lagMode":            "replication",
+		"replicationBrokers": "dr-broker:9092",
+		"sasl":               "plain",
+		"username":           "scaler",
+		"password":           "hunter2",
+		"tls":                "enable",
+	}
+
+	// Unset, the mirror connects as the source does
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.ReplicationCredentials() != cfg.Credentials() {
+		t.Errorf("expected the source's credentials, got %+v", cfg.ReplicationCredentials())
+	}
+
+	meta["replicationSasl"] = "scram_sha256"
+	meta["replicationUsername"] = "mirror"
+	meta["replicationPassword"] = "swordfish"
+	meta["replicationTls"] = "disable"
+	cfg, err = ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	replica := cfg.ReplicationCredentials()
+	if replica.SASLMechanism != SASLScramSHA256 || replica.SASLUsername != "mirror" || replica.SASLPassword != "swordfish" || replica.TLSEnabled {
+		t.Errorf("replication credentials = %+v", replica)
+	}
+	if cfg.SASLMechanism != SASLPlain || cfg.SASLUsername != "scaler" || !cfg.TLSEnabled {
+		t.Errorf("source credentials changed: %+v", cfg.Credentials())
+	}
+
+	meta["replicationCert"] = "cert-pem"
+	_, err = ParseFromMetadata(meta)
+	if err == nil || !strings.Contains(err.Error(), "replicationCert and replicationKey") {
+		t.Errorf("expected a replicationCert without replicationKey error, got %v", err)
+	}
+}
+
+func TestParseFromMetadata_OffsetResetThreshold(t *testing.T) {
+	meta := map[string]string{
+		"topic":                "my-topic",
+		"consumerGroup":        "my-group",
+		"offsetResetThreshold": "10000",
+	}
+
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.OffsetResetThreshold != 10000 {
+		t.Errorf("offsetResetThreshold = %d, want 10000", cfg.OffsetResetThreshold)
+	}
+
+	meta["offsetResetThreshold"] = "lots"
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error for invalid offsetResetThreshold")
+	}
+}
+
+func TestParseFromMetadata_PanicThreshold(t *testing.T) {
+	meta := map[string]string{
+		"topic":          "my-topic",
+		"consumerGroup":  "my-group",
+		"lagThreshold":   "500",
+		"panicThreshold": "50000",
+	}
+
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.PanicThreshold != 50000 {
+		t.Errorf("panicThreshold = %d, want 50000", cfg.PanicThreshold)
+	}
+
+	meta["panicThreshold"] = "400"
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error when panicThreshold is not above lagThreshold")
+	}
+}
+
+func TestParseFromMetadata_LagBasis(t *testing.T) {
+	meta := map[string]string{
+		"topic":         "my-topic",
+		"consumerGroup": "my-group",
+	}
+
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.LagBasis != LagBasisCommitted {
+		t.Errorf("expected default lagBasis %q, got %q", LagBasisCommitted, cfg.LagBasis)
+	}
+
+	t.Setenv("LAG_BASIS", "earliest")
+	cfg, err = ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.LagBasis != LagBasisEarliest {
+		t.Errorf("lagBasis = %q, want %q", cfg.LagBasis, LagBasisEarliest)
+	}
+
+	meta["lagBasis"] = "latest"
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error for unknown lagBasis")
+	}
+}
+
+func TestParseFromMetadata_EvaluationCache(t *testing.T) {
+	meta := map[string]string{
+		"topic":            "my-topic",
+		"consumerGroup":    "my-group",
+		"samplingInterval": "20",
+	}
+
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.EvaluationCacheTTL != 10*time.Second {
+		t.Errorf("expected default cache TTL of half the sampling interval, got %s", cfg.EvaluationCacheTTL)
+	}
+
+	meta["evaluationCacheSeconds"] = "0"
+	cfg, err = ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.EvaluationCacheTTL != 0 {
+		t.Errorf("expected caching disabled, got %s", cfg.EvaluationCacheTTL)
+	}
+
+	meta["evaluationCacheSeconds"] = "soon"
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error for invalid evaluationCacheSeconds")
+	}
+}
+
+func TestParseFromMetadata_MinStretchSamples(t *testing.T) {
+	meta := map[string]string{
+		"topic":             "my-topic",
+		"consumerGroup":     "my-group",
+		"minStretchSamples": "6",
+	}
+
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.MinStretchSamples != 6 {
+		t.Errorf("minStretchSamples = %d, want 6", cfg.MinStretchSamples)
+	}
+
+	meta["minStretchSamples"] = "-1"
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error for negative minStretchSamples")
+	}
+}
+
+func TestParseFromMetadata_InitialFetchRetries(t *testing.T) {
+	meta := map[string]string{
+		"topic":         "my-topic",
+		"consumerGroup": "my-group",
+	}
+
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.InitialFetchRetries != 3 {
+		t.Errorf("expected default initialFetchRetries 3, got %d", cfg.InitialFetchRetries)
+	}
+
+	meta["initialFetchRetries"] = "0"
+	cfg, err = ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.InitialFetchRetries != 0 {
+		t.Errorf("initialFetchRetries = %d, want 0", cfg.InitialFetchRetries)
+	}
+
+	meta["initialFetchRetries"] = "-1"
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error for negative initialFetchRetries")
+	}
+}
+
+func TestParseFromMetadata_Breaker(t *testing.T) {
+	meta := map[string]string{
+		"topic":         "my-topic",
+		"consumerGroup": "my-group",
+	}
+
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.BreakerThreshold != 5 || cfg.BreakerMaxBackoff != 5*time.Minute {
+		t.Errorf("defaults = %d/%s, want 5/5m", cfg.BreakerThreshold, cfg.BreakerMaxBackoff)
+	}
+
+	meta["breakerThreshold"] = "0"
+	meta["breakerMaxBackoffSeconds"] = "60"
+	cfg, err = ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.BreakerThreshold != 0 || cfg.BreakerMaxBackoff != time.Minute {
+		t.Errorf("got %d/%s, want 0/1m", cfg.BreakerThreshold, cfg.BreakerMaxBackoff)
+	}
+
+	meta["breakerThreshold"] = "-1"
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error for negative breakerThreshold")
+	}
+}
+
+func TestParseFromMetadata_MinActiveSeconds(t *testing.T) {
+	meta := map[string]string{
+		"topic":            "my-topic",
+		"consumerGroup":    "my-group",
+		"minActiveSeconds": "300",
+	}
+
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.MinActiveDuration != 5*time.Minute {
+		t.Errorf("minActiveDuration = %s, want 5m", cfg.MinActiveDuration)
+	}
+
+	meta["minActiveSeconds"] = "-1"
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error for negative minActiveSeconds")
+	}
+}
+
+func TestParseFromMetadata_VerdictTTLSeconds(t *testing.T) {
+	meta := map[string]string{
+		"topic":             "my-topic",
+		"consumerGroup":     "my-group",
+		"verdictTTLSeconds": "600",
+	}
+
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.VerdictTTL != 10*time.Minute {
+		t.Errorf("verdictTTL = %s, want 10m", cfg.VerdictTTL)
+	}
+
+	for _, v := range []string{"-1", "5"} {
+		meta["verdictTTLSeconds"] = v
+		if _, err := ParseFromMetadata(meta); err == nil {
+			t.Errorf("expected error for verdictTTLSeconds %s with a 10s sampling interval", v)
+		}
+	}
+}
+
+func TestParseFromMetadata_DrainConfirmSeconds(t *testing.T) {
+	meta := map[string]string{
+		"topic":         "my-topic",
+		"consumerGroup": "my-group",
+	}
+
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.DrainConfirmDuration != 0 {
+		t.Errorf("expected drain confirmation disabled by default, got %s", cfg.DrainConfirmDuration)
+	}
+
+	meta["drainConfirmSeconds"] = "60"
+	cfg, err = ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.DrainConfirmDuration != time.Minute {
+		t.Errorf("drainConfirmDuration = %s, want 1m", cfg.DrainConfirmDuration)
+	}
+
+	meta["drainConfirmSeconds"] = "-1"
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error for negative drainConfirmSeconds")
+	}
+
+	// The default window spans 30 samples 10s apart
+	meta["drainConfirmSeconds"] = "600"
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error for drainConfirmSeconds longer than the window")
+	}
+}
+
+func TestParseFromMetadata_Metrics(t *testing.T) {
+	meta := map[string]string{
+		"topic":         "my-topic",
+		"consumerGroup": "my-group",
+		"metrics":       "total:kafka_lag:1000, rate::50,laggingPartitions::3",
+	}
+
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []Metric{
+		{Aggregation: MetricTotal, Name: "kafka_lag", Target: 1000},
+		{Aggregation: MetricRate, Target: 50},
+		{Aggregation: MetricLaggingPartitions, Target: 3},
+	}
+	if !slices.Equal(cfg.Metrics, want) {
+		t.Errorf("metrics = %+v, want %+v", cfg.Metrics, want)
+	}
+
+	for _, bad := range []string{
+		"total:1000",
+		"median::100",
+		"max::0",
+		"max::ten",
+		"max:a:10,total:a:10",
+		"max::10,max::20",
+	} {
+		meta["metrics"] = bad
+		if _, err := ParseFromMetadata(meta); err == nil {
+			t.Errorf("expected error for metrics %q", bad)
+		}
+	}
+}
+
+func TestParseFromMetadata_PersistenceLookbackSeconds(t *testing.T) {
+	meta := map[string]string{
+		"topic":         "my-topic",
+		"consumerGroup": "my-group",
+		"windowSize":    "60",
+	}
+
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.PersistenceLookback != 10*time.Minute {
+		t.Errorf("expected the lookback to default to the 10m window, got %s", cfg.PersistenceLookback)
+	}
+
+	meta["persistenceLookbackSeconds"] = "180"
+	cfg, err = ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.PersistenceLookback != 3*time.Minute {
+		t.Errorf("persistenceLookback = %s, want 3m", cfg.PersistenceLookback)
+	}
+
+	// Shorter than the default 2m sustain
+	meta["persistenceLookbackSeconds"] = "60"
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error for persistenceLookbackSeconds shorter than sustainSeconds")
+	}
+}
+
+func TestParseFromMetadata_SustainSeconds(t *testing.T) {
+	meta := map[string]string{
+		"topic":          "my-topic",
+		"consumerGroup":  "my-group",
+		"sustainSeconds": "0",
+	}
+
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.SustainDuration != 0 {
+		t.Errorf("sustainDuration = %s, want 0", cfg.SustainDuration)
+	}
+
+	meta["sustainSeconds"] = "-1"
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error for negative sustainSeconds")
+	}
+}
+
+func TestParseFromMetadata_TotalLagConsistency(t *testing.T) {
+	meta := map[string]string{
+		"topic":         "my-topic",
+		"consumerGroup": "my-group",
+	}
+
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.TotalLagConsistency != TotalLagLatest {
+		t.Errorf("expected default totalLagConsistency %q, got %q", TotalLagLatest, cfg.TotalLagConsistency)
+	}
+
+	meta["totalLagConsistency"] = "lastTick"
+	cfg, err = ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.TotalLagConsistency != TotalLagLastTick {
+		t.Errorf("totalLagConsistency = %q, want %q", cfg.TotalLagConsistency, TotalLagLastTick)
+	}
+
+	meta["totalLagConsistency"] = "eventually"
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error for unknown totalLagConsistency")
+	}
+}
+
+func TestParseFromMetadata_Exemplars(t *testing.T) {
+	meta := map[string]string{
+		"topic":         "my-topic",
+		"consumerGroup": "my-group",
+	}
+
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Exemplars {
+		t.Error("expected exemplars disabled by default")
+	}
+
+	meta["exemplars"] = "true"
+	cfg, err = ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.Exemplars {
+		t.Error("expected exemplars enabled")
+	}
+
+	meta["exemplars"] = "sometimes"
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error for invalid exemplars")
+	}
+}
+
+func TestParseFromMetadata_IsolationLevel(t *testing.T) {
+	meta := map[string]string{
+		"topic":         "my-topic",
+		"consumerGroup": "my-group",
+	}
+
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.IsolationLevel != IsolationReadUncommitted {
+		t.Errorf("expected default isolationLevel %q, got %q", IsolationReadUncommitted, cfg.IsolationLevel)
+	}
+
+	meta["isolationLevel"] = "read_committed"
+	cfg, err = ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.IsolationLevel != IsolationReadCommitted {
+		t.Errorf("isolationLevel = %q, want %q", cfg.IsolationLevel, IsolationReadCommitted)
+	}
+
+	meta["isolationLevel"] = "serializable"
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error for unknown isolationLevel")
+	}
+}
+
+func TestParseFromMetadata_DrainTimeThresholdSeconds(t *testing.T) {
+	meta := map[string]string{
+		"topic":                     "my-topic",
+		"consumerGroup":             "my-group",
+		"drainTimeThresholdSeconds": "120",
+	}
+
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.DrainTimeThreshold != 2*time.Minute {
+		t.Errorf("drainTimeThreshold = %s, want 2m", cfg.DrainTimeThreshold)
+	}
+
+	meta["drainTimeThresholdSeconds"] = "-1"
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error for negative drainTimeThresholdSeconds")
+	}
+}
+
+func TestParseFromMetadata_NamespaceScopedMetrics(t *testing.T) {
+	meta := map[string]string{
+		"topic":                  "my-topic",
+		"consumerGroup":          "my-group",
+		"namespaceScopedMetrics": "true",
+	}
+
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.NamespaceScopedMetrics {
+		t.Error("expected namespaceScopedMetrics enabled")
+	}
+
+	meta["namespaceScopedMetrics"] = "maybe"
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error for invalid namespaceScopedMetrics")
+	}
+}
+
+func TestParseFromMetadata_RetentionSize(t *testing.T) {
+	meta := map[string]string{
+		"topic":         "my-topic",
+		"consumerGroup": "my-group",
+		"windowSize":    "12",
+	}
+
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.RetentionSize != 12 {
+		t.Errorf("expected retentionSize to default to windowSize, got %d", cfg.RetentionSize)
+	}
+
+	meta["retentionSize"] = "360"
+	cfg, err = ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.RetentionSize != 360 {
+		t.Errorf("retentionSize = %d, want 360", cfg.RetentionSize)
+	}
+	// Decisions still look back over the 2 minute window, not the hour
+	if cfg.PersistenceLookback != 2*time.Minute {
+		t.Errorf("persistenceLookback = %s, want the 2m evaluation horizon", cfg.PersistenceLookback)
+	}
+
+	meta["retentionSize"] = "6"
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error for retentionSize smaller than windowSize")
+	}
+}
+
+func TestParseFromMetadata_EmptyTopicUnhealthy(t *testing.T) {
+	meta := map[string]string{
+		"topic":         "my-topic",
+		"consumerGroup": "my-group",
+	}
+
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.EmptyTopicUnhealthy {
+		t.Error("expected emptyTopicUnhealthy disabled by default")
+	}
+
+	meta["emptyTopicUnhealthy"] = "true"
+	cfg, err = ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.EmptyTopicUnhealthy {
+		t.Error("expected emptyTopicUnhealthy enabled")
+	}
+
+	meta["emptyTopicUnhealthy"] = "perhaps"
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error for invalid emptyTopicUnhealthy")
+	}
+}
+
+func TestParseFromMetadata_ActivationQuorum(t *testing.T) {
+	meta := map[string]string{
+		"topic":         "my-topic",
+		"consumerGroup": "my-group",
+	}
+
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.ActivationQuorum != 1 {
+		t.Errorf("expected default activationQuorum 1, got %d", cfg.ActivationQuorum)
+	}
+
+	meta["activationQuorum"] = "3"
+	cfg, err = ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.ActivationQuorum != 3 {
+		t.Errorf("activationQuorum = %d, want 3", cfg.ActivationQuorum)
+	}
+
+	meta["activationQuorum"] = "0"
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error for activationQuorum below 1")
+	}
+}
+
+func TestParseFromMetadata_PartitionFilters(t *testing.T) {
+	meta := map[string]string{
+		"topic":             "my-topic",
+		"consumerGroup":     "my-group",
+		"includePartitions": "0, 2,4",
+		"excludePartitions": "1",
+	}
+
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fmt.Sprint(cfg.IncludePartitions) != "[0 2 4]" {
+		t.Errorf("includePartitions = %v, want [0 2 4]", cfg.IncludePartitions)
+	}
+	if fmt.Sprint(cfg.ExcludePartitions) != "[1]" {
+		t.Errorf("excludePartitions = %v, want [1]", cfg.ExcludePartitions)
+	}
+
+	tests := map[string]map[string]string{
+		"non-integer include": {"includePartitions": "0,one"},
+		"non-integer exclude": {"excludePartitions": "x"},
+		"negative partition":  {"includePartitions": "-1"},
+		"overlapping lists":   {"includePartitions": "0,1", "excludePartitions": "1"},
+	}
+	for name, extra := range tests {
+		t.Run(name, func(t *testing.T) {
+			m := map[string]string{"topic": "my-topic", "consumerGroup": "my-group"}
+			for k, v := range extra {
+				m[k] = v
+			}
+			if _, err := ParseFromMetadata(m); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestParseFromMetadata_EvictionMargin(t *testing.T) {
+	meta := map[string]string{
+		"topic":            "my-topic",
+		"consumerGroup":    "my-group",
+		"samplingInterval": "15",
+	}
+
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.EvictionMargin != 15*time.Second {
+		t.Errorf("expected default margin of one sampling interval, got %s", cfg.EvictionMargin)
+	}
+
+	meta["evictionMarginSeconds"] = "0"
+	cfg, err = ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.EvictionMargin != 0 {
+		t.Errorf("expected no margin, got %s", cfg.EvictionMargin)
+	}
+
+	meta["evictionMarginSeconds"] = "-5"
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error for negative evictionMarginSeconds")
+	}
+}
+
+func TestParseFromMetadata_LogFormat(t *testing.T) {
+	meta := map[string]string{
+		"topic":         "my-topic",
+		"consumerGroup": "my-group",
+	}
+
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.LogFormat != LogFormatText {
+		t.Errorf("expected default logFormat %q, got %q", LogFormatText, cfg.LogFormat)
+	}
+
+	t.Setenv("LOG_FORMAT", "json")
+	cfg, err = ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.LogFormat != LogFormatJSON {
+		t.Errorf("logFormat = %q, want %q", cfg.LogFormat, LogFormatJSON)
+	}
+
+	meta["logFormat"] = "xml"
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error for unknown logFormat")
+	}
+}
+
+func TestParseFromMetadata_MissingOffsets(t *testing.T) {
+	meta := map[string]string{
+		"topic":         "my-topic",
+		"consumerGroup": "my-group",
+	}
+
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.MissingOffsets != MissingOffsetsSkip {
+		t.Errorf("expected default missingOffsets %q, got %q", MissingOffsetsSkip, cfg.MissingOffsets)
+	}
+
+	meta["missingOffsets"] = "carryForward"
+	cfg, err = ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.MissingOffsets != MissingOffsetsCarryForward {
+		t.Errorf("missingOffsets = %q, want %q", cfg.MissingOffsets, MissingOffsetsCarryForward)
+	}
+
+	meta["missingOffsets"] = "zero"
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error for unknown missingOffsets")
+	}
+}
+
+func TestParseFromMetadata_GroupMembers(t *testing.T) {
+	meta := map[string]string{
+		"topic":         "my-topic",
+		"consumerGroup": "my-group",
+	}
+
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.GroupMembers != GroupMembersOff {
+		t.Errorf("expected default groupMembers %q, got %q", GroupMembersOff, cfg.GroupMembers)
+	}
+
+	meta["groupMembers"] = "suppress"
+	cfg, err = ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.GroupMembers != GroupMembersSuppress {
+		t.Errorf("groupMembers = %q, want %q", cfg.GroupMembers, GroupMembersSuppress)
+	}
+
+	meta["lagBasis"] = "earliest"
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error for groupMembers with the earliest lag basis")
+	}
+
+	delete(meta, "lagBasis")
+	meta["groupMembers"] = "alert"
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error for unknown groupMembers")
+	}
+}
+
+func TestParseFromMetadata_WarmupSamples(t *testing.T) {
+	meta := map[string]string{
+		"topic":         "my-topic",
+		"consumerGroup": "my-group",
+		"warmupSamples": "12",
+	}
+
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.WarmupSamples != 12 {
+		t.Errorf("warmupSamples = %d, want 12", cfg.WarmupSamples)
+	}
+
+	meta["warmupSamples"] = "-3"
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error for negative warmupSamples")
+	}
+}
+
+func TestParseFromMetadata_MultipleGroups(t *testing.T) {
+	meta := map[string]string{
+		"topic":              "my-topic",
+		"consumerGroup":      "group-a, group-b",
+		"multiGroupStrategy": "max",
+	}
+
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if groups := cfg.ConsumerGroups(); len(groups) != 2 || groups[0] != "group-a" || groups[1] != "group-b" {
+		t.Errorf("ConsumerGroups() = %v, want [group-a group-b]", groups)
+	}
+	if cfg.MultiGroupStrategy != MultiGroupStrategyMax {
+		t.Errorf("multiGroupStrategy = %q, want %q", cfg.MultiGroupStrategy, MultiGroupStrategyMax)
+	}
+
+	meta["multiGroupStrategy"] = "avg"
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error for unknown multiGroupStrategy")
+	}
+
+	meta["consumerGroup"] = " , "
+	delete(meta, "multiGroupStrategy")
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error when consumerGroup lists no groups")
+	}
+}
+
+func TestParseFromMetadata_MetricScale(t *testing.T) {
+	meta := map[string]string{
+		"topic":         "my-topic",
+		"consumerGroup": "my-group",
+	}
+
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.MetricScale != 1 {
+		t.Errorf("expected default metricScale 1, got %d", cfg.MetricScale)
+	}
+
+	meta["metricScale"] = "100"
+	cfg, err = ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.MetricScale != 100 {
+		t.Errorf("metricScale = %d, want 100", cfg.MetricScale)
+	}
+
+	meta["metricScale"] = "0"
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error for metricScale below 1")
+	}
+}
+
+func TestParseFromMetadata_EvaluationMode(t *testing.T) {
+	meta := map[string]string{
+		"topic":         "my-topic",
+		"consumerGroup": "my-group",
+	}
+
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.EvaluationMode != EvaluationModeAbsolute {
+		t.Errorf("expected default evaluationMode %q, got %q", EvaluationModeAbsolute, cfg.EvaluationMode)
+	}
+
+	meta["evaluationMode"] = "total"
+	cfg, err = ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.EvaluationMode != EvaluationModeTotal {
+		t.Errorf("evaluationMode = %q, want %q", cfg.EvaluationMode, EvaluationModeTotal)
+	}
+
+	meta["evaluationMode"] = "vibes"
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error for unknown evaluationMode")
+	}
+}
+
+func TestParseFromMetadata_OffsetFetchMode(t *testing.T) {
+	meta := map[string]string{
+		"topic":         "my-topic",
+		"consumerGroup": "my-group",
+	}
+
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.OffsetFetchMode != OffsetFetchModeAuto {
+		t.Errorf("expected default offsetFetchMode %q, got %q", OffsetFetchModeAuto, cfg.OffsetFetchMode)
+	}
+
+	meta["offsetFetchMode"] = "omitted"
+	cfg, err = ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.OffsetFetchMode != OffsetFetchModeOmitted {
+		t.Errorf("offsetFetchMode = %q, want %q", cfg.OffsetFetchMode, OffsetFetchModeOmitted)
+	}
+
+	meta["offsetFetchMode"] = "zero"
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error for unknown offsetFetchMode")
+	}
+}
+
+func TestParseFromMetadata_OffsetRequests(t *testing.T) {
+	meta := map[string]string{
+		"topic":         "my-topic",
+		"consumerGroup": "my-group",
+	}
+
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.OffsetRequests != OffsetRequestsSequential {
+		t.Errorf("expected default offsetRequests %q, got %q", OffsetRequestsSequential, cfg.OffsetRequests)
+	}
+
+	meta["offsetRequests"] = "concurrent"
+	cfg, err = ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.OffsetRequests != OffsetRequestsConcurrent {
+		t.Errorf("offsetRequests = %q, want %q", cfg.OffsetRequests, OffsetRequestsConcurrent)
+	}
+
+	meta["offsetRequests"] = "batched"
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error for unknown offsetRequests")
+	}
+}
+
+func TestParseFromMetadata_AccelerationThreshold(t *testing.T) {
+	meta := map[string]string{
+		"topic":          "my-topic",
+		"consumerGroup":  "my-group",
+		"evaluationMode": "acceleration",
+	}
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error for acceleration mode without accelerationThreshold")
+	}
+
+	meta["accelerationThreshold"] = "0.5"
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.EvaluationMode != EvaluationModeAcceleration || cfg.AccelerationThreshold != 0.5 {
+		t.Errorf("evaluationMode = %q, accelerationThreshold = %g, want %q and 0.5", cfg.EvaluationMode, cfg.AccelerationThreshold, EvaluationModeAcceleration)
+	}
+
+	meta["accelerationThreshold"] = "fast"
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error for invalid accelerationThreshold")
+	}
+}
+
+func TestParseFromMetadata_MaxPartitions(t *testing.T) {
+	meta := map[string]string{
+		"topic":         "my-topic",
+		"consumerGroup": "my-group",
+	}
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.MaxPartitions != 0 {
+		t.Errorf("expected maxPartitions to default to 0, got %d", cfg.MaxPartitions)
+	}
+
+	meta["maxPartitions"] = "500"
+	cfg, err = ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.MaxPartitions != 500 {
+		t.Errorf("maxPartitions = %d, want 500", cfg.MaxPartitions)
+	}
+
+	meta["maxPartitions"] = "-1"
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error for negative maxPartitions")
+	}
+}
+
+func TestParseFromMetadata_SuppressSchedule(t *testing.T) {
+	meta := map[string]string{
+		"topic":            "my-topic",
+		"consumerGroup":    "my-group",
+		"suppressSchedule": "0-29 2 * * *; * 22-23 * * 5",
+	}
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.SuppressSchedule.IsZero() || cfg.SuppressSchedule.String() != meta["suppressSchedule"] {
+		t.Errorf("suppressSchedule = %q, want %q", cfg.SuppressSchedule, meta["suppressSchedule"])
+	}
+
+	meta["suppressSchedule"] = "* 25 * * *"
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error for an hour out of range")
+	}
+}
+
+func TestParseFromMetadata_CrossingCount(t *testing.T) {
+	meta := map[string]string{
+		"topic":          "my-topic",
+		"consumerGroup":  "my-group",
+		"evaluationMode": "crossings",
+	}
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error for crossings mode without crossingCount")
+	}
+
+	meta["crossingCount"] = "3"
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.EvaluationMode != EvaluationModeCrossings || cfg.CrossingCount != 3 {
+		t.Errorf("evaluationMode = %q, crossingCount = %d, want %q and 3", cfg.EvaluationMode, cfg.CrossingCount, EvaluationModeCrossings)
+	}
+
+	meta["crossingCount"] = "0"
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error for a crossingCount of 0")
+	}
+
+	meta["crossingCount"] = "often"
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error for invalid crossingCount")
+	}
+}
+
+func TestParseFromMetadata_BrokerRateLimit(t *testing.T) {
+	meta := map[string]string{
+		"topic":           "my-topic",
+		"consumerGroup":   "my-group",
+		"brokerRateLimit": "2.5",
+	}
+
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.BrokerRateLimit != 2.5 {
+		t.Errorf("brokerRateLimit = %g, want 2.5", cfg.BrokerRateLimit)
+	}
+
+	meta["brokerRateLimit"] = "-1"
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error for negative brokerRateLimit")
+	}
+}
+
+func TestParseFromMetadata_MaxPlausibleLag(t *testing.T) {
+	meta := map[string]string{
+		"topic":           "my-topic",
+		"consumerGroup":   "my-group",
+		"panicThreshold":  "50000",
+		"maxPlausibleLag": "10000000",
+	}
+
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.MaxPlausibleLag != 10_000_000 {
+		t.Errorf("maxPlausibleLag = %d, want 10000000", cfg.MaxPlausibleLag)
+	}
+
+	meta["maxPlausibleLag"] = "40000"
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error when maxPlausibleLag would discard panic-level lag")
+	}
+}
+
+func TestParseFromMetadata_MetricBounds(t *testing.T) {
+	meta := map[string]string{
+		"topic":         "my-topic",
+		"consumerGroup": "my-group",
+		"metricFloor":   "10",
+		"metricCeiling": "50000",
+	}
+
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.MetricFloor != 10 || cfg.MetricCeiling != 50000 {
+		t.Errorf("got floor %d ceiling %d, want 10 and 50000", cfg.MetricFloor, cfg.MetricCeiling)
+	}
+
+	meta["metricFloor"] = "60000"
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Error("expected error when metricFloor exceeds metricCeiling")
+	}
+
+	meta["metricCeiling"] = "0"
+	if _, err := ParseFromMetadata(meta); err != nil {
+		t.Errorf("expected any floor to be valid with the ceiling disabled, got %v", err)
+	}
+
+	meta["metricFloor"] = "-1"
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Error("expected error for negative metricFloor")
+	}
+}
+
+func TestParseFromMetadata_NewPartitionGrace(t *testing.T) {
+	meta := map[string]string{
+		"topic":         "my-topic",
+		"consumerGroup": "my-group",
+	}
+
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.NewPartitionGrace != 0 {
+		t.Errorf("newPartitionGrace = %s, want 0 (disabled) by default", cfg.NewPartitionGrace)
+	}
+
+	meta["newPartitionGraceSeconds"] = "300"
+	cfg, err = ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.NewPartitionGrace != 5*time.Minute {
+		t.Errorf("newPartitionGrace = %s, want 5m0s", cfg.NewPartitionGrace)
+	}
+
+	meta["newPartitionGraceSeconds"] = "-1"
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error for negative newPartitionGraceSeconds")
+	}
+}
+
+func TestParseFromMetadata_CommitStaleness(t *testing.T) {
+	meta := map[string]string{
+		"topic":         "my-topic",
+		"consumerGroup": "my-group",
+	}
+
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.CommitStaleness != 0 || cfg.StaleCommitWeight != 1 {
+		t.Errorf("got commitStaleness %s weight %g, want disabled with weight 1 by default", cfg.CommitStaleness, cfg.StaleCommitWeight)
+	}
+
+	meta["staleCommitWeight"] = "0.5"
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Error("expected error for staleCommitWeight without commitStalenessSeconds")
+	}
+
+	meta["commitStalenessSeconds"] = "600"
+	cfg, err = ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.CommitStaleness != 10*time.Minute || cfg.StaleCommitWeight != 0.5 {
+		t.Errorf("got commitStaleness %s weight %g, want 10m0s and 0.5", cfg.CommitStaleness, cfg.StaleCommitWeight)
+	}
+
+	for _, weight := range []string{"-0.1", "1.5"} {
+		meta["staleCommitWeight"] = weight
+		if _, err := ParseFromMetadata(meta); err == nil {
+			t.Errorf("expected error for staleCommitWeight %s", weight)
+		}
+	}
+}
+
+func TestParseFromMetadata_WindowStorePath(t *testing.T) {
+	meta := map[string]string{
+		"topic":           "my-topic",
+		"consumerGroup":   "my-group",
+		"windowStorePath": "/data/window.json",
+	}
+
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.WindowStorePath != "/data/window.json" {
+		t.Errorf("windowStorePath = %q, want /data/window.json", cfg.WindowStorePath)
+	}
+}
+
+func TestParseFromMetadata_LagMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		extra   map[string]string
+		wantErr string
+	}{
+		{"consumer", map[string]string{"consumerGroup": "my-group"}, ""},
+		{"replication", map[string]string{"lagMode": "replication", "replicationBrokers": "dr-broker:9092"}, ""},
+		{"replication to another topic", map[string]string{"lagMode": "replication", "replicationTopic": "us-east.my-topic"}, ""},
+		{"replication onto itself", map[string]string{"lagMode": "replication"}, "requires replicationTopic or replicationBrokers"},
+		{"replication with earliest basis", map[string]string{"lagMode": "replication", "replicationTopic": "us-east.my-topic", "lagBasis": "earliest"}, "can't be combined with lagBasis"},
+		{"replication in seconds", map[string]string{"lagMode": "replication", "replicationTopic": "us-east.my-topic", "lagUnit": "seconds"}, "can't be combined with lagUnit"},
+		{"consumer without group", nil, "consumerGroup is required"},
+		{"unknown", map[string]string{"lagMode": "producer", "consumerGroup": "my-group"}, "invalid lagMode"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meta := map[string]string{
+				"bootstrapServers": "broker:9092",
+				"topic":            "my-topic",
+			}
+			maps.Copy(meta, tt.extra)
+
+			cfg, err := ParseFromMetadata(meta)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if cfg.LagMode == LagModeReplication && cfg.ReplicationTopic == cfg.Topic && cfg.ReplicationBrokers == cfg.BootstrapServers {
+				t.Errorf("expected the mirror to differ from the source, got %+v", cfg)
+			}
+		})
+	}
+}
+
+func TestParseFromMetadata_Sink(t *testing.T) {
+	tests := []struct {
+		name    string
+		extra   map[string]string
+		wantErr string
+	}{
+		{"none", nil, ""},
+		{"webhook", map[string]string{"sink": "webhook", "sinkURL": "https://example.com/lag?token=abc"}, ""},
+		{"kafka", map[string]string{"sink": "kafka", "sinkTopic": "lag-samples"}, ""},
+		{"webhook without url", map[string]string{"sink": "webhook"}, "requires sinkURL"},
+		{"kafka without topic", map[string]string{"sink": "kafka"}, "requires sinkTopic"},
+		{"unknown", map[string]string{"sink": "s3"}, "invalid sink"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meta := map[string]string{
+				"topic":         "my-topic",
+				"consumerGroup": "my-group",
+			}
+			maps.Copy(meta, tt.extra)
+
+			cfg, err := ParseFromMetadata(meta)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if cfg.Sink != tt.extra["sink"] || string(cfg.SinkURL) != tt.extra["sinkURL"] || cfg.SinkTopic != tt.extra["sinkTopic"] {
+				t.Errorf("got sink %q url %q topic %q", cfg.Sink, cfg.SinkURL, cfg.SinkTopic)
+			}
+		})
+	}
+}
+
+func TestParseFromMetadata_MetricsExporter(t *testing.T) {
+	tests := []struct {
+		name    string
+		extra   map[string]string
+		want    string
+		wantErr string
+	}{
+		{"default", nil, MetricsExporterPrometheus, ""},
+		{"otlp", map[string]string{"metricsExporter": "otlp", "otlpEndpoint": "http://otel-collector:4317"}, MetricsExporterOTLP, ""},
+		{"otlp from env endpoint", map[string]string{"metricsExporter": "otlp"}, MetricsExporterOTLP, ""},
+		{"none", map[string]string{"metricsExporter": "none"}, MetricsExporterNone, ""},
+		{"otlp endpoint without scheme", map[string]string{"metricsExporter": "otlp", "otlpEndpoint": "otel-collector:4317"}, "", "invalid otlpEndpoint"},
+		{"unknown", map[string]string{"metricsExporter": "statsd"}, "", "invalid metricsExporter"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meta := map[string]string{
+				"topic":         "my-topic",
+				"consumerGroup": "my-group",
+			}
+			maps.Copy(meta, tt.extra)
+
+			cfg, err := ParseFromMetadata(meta)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if cfg.MetricsExporter != tt.want || cfg.OTLPEndpoint != tt.extra["otlpEndpoint"] {
+				t.Errorf("got metricsExporter %q endpoint %q, want %q", cfg.MetricsExporter, cfg.OTLPEndpoint, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFromMetadata_SchemaVersionAliases(t *testing.T) {
+	meta := map[string]string{
+		"topic":          "my-topic",
+		"consumerGroup":  "my-group",
+		"schemaVersion":  "1",
+		"sustainSeconds": "300",
+	}
+
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.SustainDuration != 300*time.Second {
+		t.Errorf("v1 sustainSeconds: SustainDuration = %v, want 5m", cfg.SustainDuration)
+	}
+
+	meta = map[string]string{
+		"topic":         "my-topic",
+		"consumerGroup": "my-group",
+		"schemaVersion": "2",
+		"sustain":       "60",
+	}
+	cfg, err = ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.SustainDuration != 60*time.Second {
+		t.Errorf("v2 sustain: SustainDuration = %v, want 1m", cfg.SustainDuration)
+	}
+	if cfg.SchemaVersion != "2" {
+		t.Errorf("SchemaVersion = %q, want 2", cfg.SchemaVersion)
+	}
+
+	// Under v2 the old name is no longer read.
+	delete(meta, "sustain")
+	meta["sustainSeconds"] = "60"
+	cfg, err = ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.SustainDuration != 120*time.Second {
+		t.Errorf("v2 sustainSeconds: SustainDuration = %v, want default 2m", cfg.SustainDuration)
+	}
+}
+
+func TestParseFromMetadata_UnsupportedSchemaVersion(t *testing.T) {
+	meta := map[string]string{
+		"topic":         "my-topic",
+		"consumerGroup": "my-group",
+		"schemaVersion": "99",
+	}
+
+	_, err := ParseFromMetadata(meta)
+	if err == nil {
+		t.Fatal("expected error for unsupported schemaVersion")
+	}
+	if !strings.Contains(err.Error(), `"99"`) {
+		t.Errorf("error should name the version, got %v", err)
+	}
+}
+
+func TestParseFromMetadata_RequireCurrentAboveThreshold(t *testing.T) {
+	meta := map[string]string{
+		"topic":         "my-topic",
+		"consumerGroup": "my-group",
+	}
+
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.RequireCurrentAboveThreshold {
+		t.Error("expected requireCurrentAboveThreshold to default to false")
+	}
+
+	meta["requireCurrentAboveThreshold"] = "true"
+	cfg, err = ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.RequireCurrentAboveThreshold {
+		t.Error("expected requireCurrentAboveThreshold to be enabled")
+	}
+
+	meta["requireCurrentAboveThreshold"] = "maybe"
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error for invalid requireCurrentAboveThreshold")
+	}
+}
+
+func TestParseFromMetadata_PartitionMetrics(t *testing.T) {
+	meta := map[string]string{
+		"topic":            "my-topic",
+		"consumerGroup":    "my-group",
+		"partitionMetrics": "true",
+	}
+
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.PartitionMetrics {
+		t.Error("expected partitionMetrics to be enabled")
+	}
+
+	meta["partitionMetrics"] = "some"
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error for invalid partitionMetrics")
+	}
+}
+
+func TestParseFromMetadata_NormalizeByPartitions(t *testing.T) {
+	t.Setenv("NORMALIZE_BY_PARTITIONS", "true")
+
+	meta := map[string]string{
+		"topic":         "my-topic",
+		"consumerGroup": "my-group",
+	}
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.NormalizeByPartitions {
+		t.Error("expected normalizeByPartitions from env")
+	}
+
+	for key, value := range map[string]string{
+		"normalizeByPartitions": "halfway",
+		"aggregatePartitions":   "true",
+		"lagUnit":               LagUnitSeconds,
+	} {
+		bad := map[string]string{"topic": "my-topic", "consumerGroup": "my-group", key: value}
+		if _, err := ParseFromMetadata(bad); err == nil {
+			t.Errorf("expected error for %s=%s with normalizeByPartitions", key, value)
+		}
+	}
+}
+
+func TestParseFromMetadata_MetadataCacheTTL(t *testing.T) {
+	meta := map[string]string{
+		"topic":         "my-topic",
+		"consumerGroup": "my-group",
+	}
+
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.MetadataCacheTTL != time.Minute {
+		t.Errorf("expected default metadataCacheTTL 1m, got %s", cfg.MetadataCacheTTL)
+	}
+
+	meta["metadataCacheTTLSeconds"] = "0"
+	cfg, err = ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.MetadataCacheTTL != 0 {
+		t.Errorf("metadataCacheTTL = %s, want 0", cfg.MetadataCacheTTL)
+	}
+
+	meta["metadataCacheTTLSeconds"] = "-5"
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error for negative metadataCacheTTLSeconds")
+	}
+}
+
+func TestParseFromMetadata_StrictOffsets(t *testing.T) {
+	meta := map[string]string{
+		"topic":         "my-topic",
+		"consumerGroup": "my-group",
+		"strictOffsets": "true",
+	}
+
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.StrictOffsets {
+		t.Error("expected strictOffsets to be enabled")
+	}
+
+	meta["strictOffsets"] = "sometimes"
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error for invalid strictOffsets")
+	}
+}
+
+func TestParseFromMetadata_CompactedTopic(t *testing.T) {
+	meta := map[string]string{
+		"topic":         "my-topic",
+		"consumerGroup": "my-group",
+	}
+
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.CompactedTopic || cfg.CompactionRefresh != 5*time.Minute {
+		t.Errorf("defaults = %v/%s, want false/5m", cfg.CompactedTopic, cfg.CompactionRefresh)
+	}
+
+	meta["compactedTopic"] = "true"
+	meta["compactionRefreshSeconds"] = "60"
+	cfg, err = ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.CompactedTopic || cfg.CompactionRefresh != time.Minute {
+		t.Errorf("got %v/%s, want true/1m", cfg.CompactedTopic, cfg.CompactionRefresh)
+	}
+
+	meta["compactionRefreshSeconds"] = "-1"
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error for negative compactionRefreshSeconds")
+	}
+}
+
+func TestParseFromMetadata_SkipDuringRebalance(t *testing.T) {
+	t.Setenv("SKIP_DURING_REBALANCE", "true")
+
+	meta := map[string]string{
+		"topic":         "my-topic",
+		"consumerGroup": "my-group",
+	}
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.SkipDuringRebalance {
+		t.Error("expected skipDuringRebalance from env")
+	}
+
+	meta["skipDuringRebalance"] = "sometimes"
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error for invalid skipDuringRebalance")
+	}
+}
+
+func TestParseFromMetadata_BreadthMode(t *testing.T) {
+	meta := map[string]string{
+		"topic":                      "my-topic",
+		"consumerGroup":              "my-group",
+		"evaluationMode":             "breadth",
+		"laggingPartitionsThreshold": "3",
+	}
+
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.EvaluationMode != EvaluationModeBreadth || cfg.LaggingPartitionsThreshold != 3 {
+		t.Errorf("got mode %q threshold %d, want breadth 3", cfg.EvaluationMode, cfg.LaggingPartitionsThreshold)
+	}
+
+	meta["laggingPartitionsThreshold"] = "-1"
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error for negative laggingPartitionsThreshold")
+	}
+}
+
+func TestParseFromEnv_Ports(t *testing.T) {
+	t.Setenv("KAFKA_TOPIC", "env-topic")
+	t.Setenv("KAFKA_GROUP_ID", "env-group")
+
+	cfg, err := ParseFromEnv()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.GRPCPort != 50051 || cfg.MetricsPort != 9090 {
+		t.Errorf("default ports = %d/%d, want 50051/9090", cfg.GRPCPort, cfg.MetricsPort)
+	}
+
+	t.Setenv("GRPC_PORT", "6000")
+	t.Setenv("METRICS_PORT", "6001")
+	cfg, err = ParseFromEnv()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.GRPCPort != 6000 || cfg.MetricsPort != 6001 {
+		t.Errorf("ports = %d/%d, want 6000/6001", cfg.GRPCPort, cfg.MetricsPort)
+	}
+
+	for _, env := range []struct{ grpc, metrics string }{
+		{"http", "6001"},
+		{"70000", "6001"},
+		{"6001", "6001"},
+	} {
+		t.Setenv("GRPC_PORT", env.grpc)
+		t.Setenv("METRICS_PORT", env.metrics)
+		if _, err := ParseFromEnv(); err == nil {
+			t.Errorf("expected error for GRPC_PORT=%s METRICS_PORT=%s", env.grpc, env.metrics)
+		}
+	}
+}
+
+func TestParseFromMetadata_BindRetries(t *testing.T) {
+	meta := map[string]string{"topic": "my-topic", "consumerGroup": "my-group"}
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.BindRetries != 5 {
+		t.Errorf("default bindRetries = %d, want 5", cfg.BindRetries)
+	}
+
+	meta["bindRetries"] = "0"
+	if cfg, err = ParseFromMetadata(meta); err != nil || cfg.BindRetries != 0 {
+		t.Errorf("expected bindRetries 0, got %v, %v", cfg, err)
+	}
+	meta["bindRetries"] = "-1"
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Error("expected error for negative bindRetries")
+	}
+}
+
+func TestParseFromMetadata_ReportsAllErrors(t *testing.T) {
+	meta := map[string]string{
+		"consumerGroup":     "my-group",
+		"lagThreshold":      "lots",
+		"windowSize":        "0",
+		"samplingInterval":  "0",
+		"metricScale":       "0",
+		"evictionPolicy":    "lru",
+		"includePartitions": "0,x",
+	}
+
+	_, err := ParseFromMetadata(meta)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{
+		"topic is required",
+		"invalid lagThreshold",
+		"samplingInterval must be positive",
+		"windowSize must be positive",
+		"metricScale must be at least 1",
+		`invalid evictionPolicy "lru"`,
+		"invalid includePartitions",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error missing %q:\n%v", want, err)
+		}
+	}
+	if n := strings.Count(err.Error(), "\n") + 1; n != 7 {
+		t.Errorf("expected 7 errors, got %d:\n%v", n, err)
+	}
+}
+
+func TestParseFromMetadata_SingleErrorUnchanged(t *testing.T) {
+	meta := map[string]string{
+		"topic":         "my-topic",
+		"consumerGroup": "my-group",
+		"lagThreshold":  "lots",
+	}
+
+	_, err := ParseFromMetadata(meta)
+	if err == nil || !strings.HasPrefix(err.Error(), "invalid lagThreshold: ") || strings.Contains(err.Error(), "\n") {
+		t.Errorf("expected a single lagThreshold error, got %v", err)
+	}
+}
+
+func TestParseFromMetadata_LagUnit(t *testing.T) {
+	meta := map[string]string{
+		"topic":         "my-topic",
+		"consumerGroup": "my-group",
+	}
+
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.LagUnit != LagUnitMessages || cfg.RecordSizeRefresh != 5*time.Minute {
+		t.Errorf("defaults = %q/%s, want messages/5m", cfg.LagUnit, cfg.RecordSizeRefresh)
+	}
+
+	meta["lagUnit"] = "bytes"
+	meta["recordSizeRefreshSeconds"] = "60"
+	cfg, err = ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.LagUnit != LagUnitBytes || cfg.RecordSizeRefresh != time.Minute {
+		t.Errorf("got %q/%s, want bytes/1m", cfg.LagUnit, cfg.RecordSizeRefresh)
+	}
+
+	meta["lagUnit"] = "seconds"
+	cfg, err = ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.LagUnit != LagUnitSeconds {
+		t.Errorf("got %q, want seconds", cfg.LagUnit)
+	}
+
+	meta["lagUnit"] = "kilobytes"
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error for unknown lagUnit")
+	}
+}
+
+func TestParseFromMetadata_LagUnitSecondsNotSummed(t *testing.T) {
+	tests := []struct {
+		name    string
+		extra   map[string]string
+		wantErr string
+	}{
+		{"total mode", map[string]string{"evaluationMode": "total"}, `can't be combined with evaluationMode "total"`},
+		{"summed groups", map[string]string{"consumerGroup": "a,b"}, `requires multiGroupStrategy "max"`},
+		{"max across groups", map[string]string{"consumerGroup": "a,b", "multiGroupStrategy": "max"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meta := map[string]string{
+				"topic":         "my-topic",
+				"consumerGroup": "my-group",
+				"lagUnit":       "seconds",
+			}
+			maps.Copy(meta, tt.extra)
+
+			_, err := ParseFromMetadata(meta)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestParseFromMetadata_GRPCTLS(t *testing.T) {
+	meta := map[string]string{
+		"topic":         "my-topic",
+		"consumerGroup": "my-group",
+		"grpcTLSCert":   "/certs/tls.crt",
+		"grpcTLSKey":    "/certs/tls.key",
+		"grpcClientCA":  "/certs/ca.crt",
+	}
+
+	cfg, err := ParseFromMetadata(meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.GRPCTLSCert != "/certs/tls.crt" || cfg.GRPCTLSKey != "/certs/tls.key" || cfg.GRPCClientCA != "/certs/ca.crt" {
+		t.Errorf("unexpected gRPC TLS paths: %q %q %q", cfg.GRPCTLSCert, cfg.GRPCTLSKey, cfg.GRPCClientCA)
+	}
+
+	delete(meta, "grpcTLSKey")
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error for grpcTLSCert without grpcTLSKey")
+	}
+
+	delete(meta, "grpcTLSCert")
+	if _, err := ParseFromMetadata(meta); err == nil {
+		t.Fatal("expected error for grpcClientCA without a server certificate")
+	}
+}
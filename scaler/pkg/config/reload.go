@@ -0,0 +1,165 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// restartOnly lists the settings read once at startup, by the Kafka client
+// or while wiring up the process, by field and metadata key. A reload can't
+// change them.
+var restartOnly = []struct{ field, key string }{
+	{"BootstrapServers", "bootstrapServers"},
+	{"Topic", "topic"},
+	{"ConsumerGroup", "consumerGroup"},
+	{"LagMode", "lagMode"},
+	{"ReplicationTopic", "replicationTopic"},
+	{"ReplicationBrokers", "replicationBrokers"},
+	{"ConsumerGroupPattern", "consumerGroupPattern"},
+	{"GroupRefresh", "groupRefreshSeconds"},
+	{"IncludePartitions", "includePartitions"},
+	{"ExcludePartitions", "excludePartitions"},
+	{"MaxPartitions", "maxPartitions"},
+	{"LagSource", "lagSource"},
+	{"OffsetFetchMode", "offsetFetchMode"},
+	{"OffsetRequests", "offsetRequests"},
+	{"LagBasis", "lagBasis"},
+	{"LagUnit", "lagUnit"},
+	{"RecordSizeRefresh", "recordSizeRefreshSeconds"},
+	{"IsolationLevel", "isolationLevel"},
+	{"MissingOffsets", "missingOffsets"},
+	{"MetadataCacheTTL", "metadataCacheTTLSeconds"},
+	{"StrictOffsets", "strictOffsets"},
+	{"SkipDuringRebalance", "skipDuringRebalance"},
+	{"GroupMembers", "groupMembers"},
+	{"CommitStaleness", "commitStalenessSeconds"},
+	{"CompactedTopic", "compactedTopic"},
+	{"CompactionRefresh", "compactionRefreshSeconds"},
+	{"BrokerRateLimit", "brokerRateLimit"},
+	{"SASLMechanism", "sasl"},
+	{"SASLUsername", "username"},
+	{"SASLPassword", "password"},
+	{"TLSEnabled", "tls"},
+	{"TLSCA", "ca"},
+	{"TLSCert", "cert"},
+	{"TLSKey", "key"},
+	{"ReplicationSASLMechanism", "replicationSasl"},
+	{"ReplicationSASLUsername", "replicationUsername"},
+	{"ReplicationSASLPassword", "replicationPassword"},
+	{"ReplicationTLSEnabled", "replicationTls"},
+	{"ReplicationTLSCA", "replicationCa"},
+	{"ReplicationTLSCert", "replicationCert"},
+	{"ReplicationTLSKey", "replicationKey"},
+	{"GRPCPort", "grpcPort"},
+	{"MetricsPort", "metricsPort"},
+	{"BindRetries", "bindRetries"},
+	{"GRPCTLSCert", "grpcTLSCert"},
+	{"GRPCTLSKey", "grpcTLSKey"},
+	{"GRPCClientCA", "grpcClientCA"},
+	{"Exemplars", "exemplars"},
+	{"MetricsExporter", "metricsExporter"},
+	{"OTLPEndpoint", "otlpEndpoint"},
+	{"DebugEndpoints", "debugEndpoints"},
+	{"LogFormat", "logFormat"},
+	{"WindowStorePath", "windowStorePath"},
+	{"Sink", "sink"},
+	{"SinkURL", "sinkURL"},
+	{"SinkTopic", "sinkTopic"},
+	{"EvictionPolicy", "evictionPolicy"},
+	{"EvictionMargin", "evictionMarginSeconds"},
+	{"CompactSamples", "compactSamples"},
+	{"MinSampleSpacing", "minSampleSpacing"},
+	{"CloseSamples", "closeSamples"},
+}
+
+// ParseFile reads metadata from path, one key=value per line using the same
+// keys as ParseFromMetadata, and parses it. Blank lines and lines starting
+// with # are skipped. Keys the file doesn't set fall back to env vars and
+// defaults as usual.
+func ParseFile(path string) (*ScalerConfig, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	metadata := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected key=value", path, n)
+		}
+		metadata[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return ParseFromMetadata(metadata)
+}
+
+// connectionKeys are the restart-only settings the fetcher's connections to
+// the brokers are opened with, by metadata key.
+var connectionKeys = map[string]bool{
+	"bootstrapServers":    true,
+	"replicationBrokers":  true,
+	"sasl":                true,
+	"username":            true,
+	"password":            true,
+	"tls":                 true,
+	"ca":                  true,
+	"cert":                true,
+	"key":                 true,
+	"replicationSasl":     true,
+	"replicationUsername": true,
+	"replicationPassword": true,
+	"replicationTls":      true,
+	"replicationCa":       true,
+	"replicationCert":     true,
+	"replicationKey":      true,
+}
+
+// ConnectionChanges returns the metadata keys of the broker, credential and
+// TLS settings next changes from c. The fetcher keeps its connections until
+// the scaler exits, so a reload changing any of them is rejected as a whole
+// rather than applied against the old brokers.
+func (c *ScalerConfig) ConnectionChanges(next *ScalerConfig) []string {
+	current, other := reflect.ValueOf(c).Elem(), reflect.ValueOf(next).Elem()
+
+	var changed []string
+	for _, f := range restartOnly {
+		if !connectionKeys[f.key] {
+			continue
+		}
+		if !reflect.DeepEqual(current.FieldByName(f.field).Interface(), other.FieldByName(f.field).Interface()) {
+			changed = append(changed, f.key)
+		}
+	}
+	return changed
+}
+
+// Reload returns next with the settings that only take effect on restart
+// kept at c's values, and the metadata keys of those next changed, so a
+// running scaler can switch to it without its components disagreeing on,
+// e.g., the topic.
+func (c *ScalerConfig) Reload(next *ScalerConfig) (*ScalerConfig, []string) {
+	reloaded := *next
+	current, dst := reflect.ValueOf(c).Elem(), reflect.ValueOf(&reloaded).Elem()
+
+	var ignored []string
+	for _, f := range restartOnly {
+		was, now := current.FieldByName(f.field), dst.FieldByName(f.field)
+		if !reflect.DeepEqual(was.Interface(), now.Interface()) {
+			ignored = append(ignored, f.key)
+			now.Set(was)
+		}
+	}
+	return &reloaded, ignored
+}
@@ -0,0 +1,91 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseFile(t *testing.T) {
+	t.Setenv("KAFKA_BROKERS", "env-broker:9092")
+	path := filepath.Join(t.TempDir(), "scaler.conf")
+	contents := `# Reloaded on SIGHUP
+topic = my-topic
+consumerGroup=my-group
+
+lagThreshold=1200
+sustainSeconds=60
+`
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := ParseFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Topic != "my-topic" || cfg.ConsumerGroup != "my-group" || cfg.LagThreshold != 1200 || cfg.SustainDuration != time.Minute {
+		t.Errorf("unexpected config from file: %+v", cfg)
+	}
+	if cfg.BootstrapServers != "env-broker:9092" {
+		t.Errorf("expected keys the file doesn't set to come from env, got bootstrapServers %q", cfg.BootstrapServers)
+	}
+
+	if err := os.WriteFile(path, []byte("topic my-topic\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseFile(path); err == nil {
+		t.Error("expected error for a line without =")
+	}
+	if _, err := ParseFile(filepath.Join(t.TempDir(), "missing.conf")); err == nil {
+		t.Error("expected error for a missing file")
+	}
+}
+
+func TestReload_KeepsRestartOnlySettings(t *testing.T) {
+	current := &ScalerConfig{Topic: "orders", LagThreshold: 500, IncludePartitions: []int{0, 1}}
+	next := &ScalerConfig{Topic: "payments", LagThreshold: 900, IncludePartitions: []int{0, 1}}
+
+	reloaded, ignored := current.Reload(next)
+	if reloaded.LagThreshold != 900 {
+		t.Errorf("lagThreshold = %d, want the reloaded 900", reloaded.LagThreshold)
+	}
+	if reloaded.Topic != "orders" {
+		t.Errorf("topic = %q, want the current %q kept until restart", reloaded.Topic, "orders")
+	}
+	if !reflect.DeepEqual(ignored, []string{"topic"}) {
+		t.Errorf("ignored = %v, want [topic]", ignored)
+	}
+	if next.Topic != "payments" {
+		t.Error("expected Reload not to modify next")
+	}
+}
+
+func TestConnectionChanges(t *testing.T) {
+	current := &ScalerConfig{BootstrapServers: "kafka:9092", Topic: "orders", SASLPassword: "old"}
+	next := &ScalerConfig{BootstrapServers: "kafka:9092", Topic: "payments", SASLPassword: "new"}
+
+	if changed := current.ConnectionChanges(next); !reflect.DeepEqual(changed, []string{"password"}) {
+		t.Errorf("changed = %v, want [password]", changed)
+	}
+	if changed := current.ConnectionChanges(current); changed != nil {
+		t.Errorf("changed = %v, want none for an unchanged config", changed)
+	}
+}
+
+func TestReload_RestartOnlyFieldsExist(t *testing.T) {
+	typ := reflect.TypeOf(ScalerConfig{})
+	for _, f := range restartOnly {
+		if _, ok := typ.FieldByName(f.field); !ok {
+			t.Errorf("restartOnly lists %s, which ScalerConfig doesn't have", f.field)
+		}
+	}
+	for key := range connectionKeys {
+		if !slices.ContainsFunc(restartOnly, func(f struct{ field, key string }) bool { return f.key == key }) {
+			t.Errorf("connectionKeys lists %s, which isn't restart-only", key)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a set of cron-like expressions, separated by semicolons, each
+// of five fields: minute, hour, day of month, month and day of week, e.g.
+// "* 1-4 * * 6,0" for 01:00 to 04:59 on weekends. A time falls within the
+// schedule when its minute matches any expression, evaluated in UTC. Fields
+// take *, a value, a range a-b and a step /n on either, or a comma-separated
+// list of those. As in cron, when both day of month and day of week are
+// restricted a day matching either matches. The zero Schedule matches nothing.
+type Schedule struct {
+	source      string
+	expressions []cronExpression
+}
+
+// cronExpression holds each field's matching values as a bit set.
+type cronExpression struct {
+	minute, hour, dayOfMonth, month, dayOfWeek uint64
+	// anyDay is set when day of month or day of week is *, so the other
+	// alone decides the day.
+	anyDay bool
+}
+
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = [5]cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	// 7 is accepted as Sunday, as in most crons
+	{"day of week", 0, 7},
+}
+
+// ParseSchedule parses a semicolon-separated list of cron-like expressions.
+// An empty string is the zero Schedule.
+func ParseSchedule(v string) (Schedule, error) {
+	schedule := Schedule{source: strings.TrimSpace(v)}
+	for _, expr := range strings.Split(v, ";") {
+		if expr = strings.TrimSpace(expr); expr == "" {
+			continue
+		}
+		fields := strings.Fields(expr)
+		if len(fields) != len(cronFields) {
+			return Schedule{}, fmt.Errorf("%q has %d fields, want minute, hour, day of month, month and day of week", expr, len(fields))
+		}
+
+		var bits [5]uint64
+		for i, field := range fields {
+			b, err := parseCronField(field, cronFields[i])
+			if err != nil {
+				return Schedule{}, fmt.Errorf("%q: %w", expr, err)
+			}
+			bits[i] = b
+		}
+		// Fold Sunday as 7 into 0
+		if bits[4]&(1<<7) != 0 {
+			bits[4] = bits[4]&^(1<<7) | 1
+		}
+		schedule.expressions = append(schedule.expressions, cronExpression{
+			minute:     bits[0],
+			hour:       bits[1],
+			dayOfMonth: bits[2],
+			month:      bits[3],
+			dayOfWeek:  bits[4],
+			anyDay:     fields[2] == "*" || fields[4] == "*",
+		})
+	}
+	if len(schedule.expressions) == 0 {
+		return Schedule{}, nil
+	}
+	return schedule, nil
+}
+
+func parseCronField(v string, f cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(v, ",") {
+		rng, step := part, 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			rng = part[:i]
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step in %s %q", f.name, part)
+			}
+			step = n
+		}
+
+		lo, hi := f.min, f.max
+		if rng != "*" {
+			var err error
+			if i := strings.IndexByte(rng, '-'); i >= 0 {
+				lo, err = parseCronValue(rng[:i], f)
+				if err == nil {
+					hi, err = parseCronValue(rng[i+1:], f)
+				}
+			} else {
+				lo, err = parseCronValue(rng, f)
+				hi = lo
+				// A step on a single value runs to the field's end, as in cron
+				if step > 1 {
+					hi = f.max
+				}
+			}
+			if err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("%s range %q runs backwards", f.name, rng)
+			}
+		}
+		for n := lo; n <= hi; n += step {
+			bits |= 1 << n
+		}
+	}
+	return bits, nil
+}
+
+func parseCronValue(v string, f cronField) (int, error) {
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q", f.name, v)
+	}
+	if n < f.min || n > f.max {
+		return 0, fmt.Errorf("%s %d is outside %d-%d", f.name, n, f.min, f.max)
+	}
+	return n, nil
+}
+
+// Contains reports whether t's minute, in UTC, matches any of the schedule's
+// expressions.
+func (s Schedule) Contains(t time.Time) bool {
+	t = t.UTC()
+	for _, e := range s.expressions {
+		if e.matches(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e cronExpression) matches(t time.Time) bool {
+	if e.minute&(1<<t.Minute()) == 0 || e.hour&(1<<t.Hour()) == 0 || e.month&(1<<int(t.Month())) == 0 {
+		return false
+	}
+	dom := e.dayOfMonth&(1<<t.Day()) != 0
+	dow := e.dayOfWeek&(1<<int(t.Weekday())) != 0
+	if e.anyDay {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// IsZero reports whether the schedule has no expressions.
+func (s Schedule) IsZero() bool {
+	return len(s.expressions) == 0
+}
+
+// String returns the schedule as it was configured.
+func (s Schedule) String() string {
+	return s.source
+}
+
+func (s Schedule) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.source)
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSchedule_Contains(t *testing.T) {
+	// Saturday 7 March 2026
+	saturday := func(hour, minute int) time.Time {
+		return time.Date(2026, 3, 7, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		schedule string
+		at       time.Time
+		want     bool
+	}{
+		{"* 1-4 * * 6,0", saturday(2, 30), true},
+		{"* 1-4 * * 6,0", saturday(4, 59), true},
+		{"* 1-4 * * 6,0", saturday(5, 0), false},
+		{"* 1-4 * * 1-5", saturday(2, 30), false},
+		{"*/15 * * * *", saturday(10, 45), true},
+		{"*/15 * * * *", saturday(10, 46), false},
+		{"0 0 * * 7", time.Date(2026, 3, 8, 0, 0, 0, 0, time.UTC), true},
+		// Day of month or day of week, as both are restricted
+		{"* * 1 * 6", saturday(12, 0), true},
+		{"* * 7 * 1", saturday(12, 0), true},
+		{"* * 1 * 1", saturday(12, 0), false},
+		{"* * * 4-12 *", saturday(12, 0), false},
+		{"0 3 * * *; * 12 * * *", saturday(12, 5), true},
+		// Evaluated in UTC whatever the time's location
+		{"* 2 * * *", saturday(2, 30).In(time.FixedZone("UTC+5", 5*60*60)), true},
+		{"", saturday(2, 30), false},
+	}
+	for _, tt := range tests {
+		s, err := ParseSchedule(tt.schedule)
+		if err != nil {
+			t.Fatalf("ParseSchedule(%q): unexpected error: %v", tt.schedule, err)
+		}
+		if got := s.Contains(tt.at); got != tt.want {
+			t.Errorf("ParseSchedule(%q).Contains(%s) = %v, want %v", tt.schedule, tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestParseSchedule_Invalid(t *testing.T) {
+	for _, v := range []string{
+		"* * * *",
+		"60 * * * *",
+		"* 5-2 * * *",
+		"* * 0 * *",
+		"*/0 * * * *",
+		"* * * jan *",
+		"0 3 * * *; bogus",
+	} {
+		if _, err := ParseSchedule(v); err == nil {
+			t.Errorf("ParseSchedule(%q): expected an error", v)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DefaultSchemaVersion is used when metadata doesn't set schemaVersion, so
+// existing ScaledObjects keep the key names they were written against.
+const DefaultSchemaVersion = "1"
+
+// schemaAliases maps each supported schemaVersion to the keys it renames:
+// the key as written under that version, to the key ParseFromMetadata reads.
+// A renamed key replaces the old one for that version; the old name is
+// ignored rather than silently taking precedence.
+var schemaAliases = map[string]map[string]string{
+	"1": {},
+	"2": {
+		"sustain": "sustainSeconds",
+	},
+}
+
+// applySchema validates metadata's schemaVersion and returns a copy with the
+// version's key aliases resolved to the names the parser reads.
+func applySchema(metadata map[string]string) (map[string]string, string, error) {
+	version := metadata["schemaVersion"]
+	if version == "" {
+		version = DefaultSchemaVersion
+	}
+	aliases, ok := schemaAliases[version]
+	if !ok {
+		return nil, "", fmt.Errorf("unsupported schemaVersion %q (supported: %s)", version, supportedSchemaVersions())
+	}
+
+	resolved := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		resolved[k] = v
+	}
+	for alias, key := range aliases {
+		delete(resolved, key)
+		if v, ok := metadata[alias]; ok {
+			delete(resolved, alias)
+			resolved[key] = v
+		}
+	}
+	return resolved, version, nil
+}
+
+func supportedSchemaVersions() string {
+	versions := make([]string, 0, len(schemaAliases))
+	for v := range schemaAliases {
+		versions = append(versions, v)
+	}
+	sort.Strings(versions)
+	return strings.Join(versions, ", ")
+}
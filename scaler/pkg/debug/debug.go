@@ -0,0 +1,231 @@
+package debug
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/config"
+	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/lag"
+	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/logging"
+)
+
+// Scraper performs a single synchronous scrape into the window, reports the
+// raw samples of the last successful fetch, and measures lag against a past
+// point in time without touching the window.
+type Scraper interface {
+	Scrape(ctx context.Context) ([]lag.LagSample, error)
+	LastFetch() ([]lag.LagSample, time.Time)
+	LagAt(ctx context.Context, at time.Time) ([]lag.LagSample, error)
+}
+
+type Handler struct {
+	window  *lag.SlidingWindow
+	scraper Scraper
+	logger  *slog.Logger
+
+	// mu guards evaluator and config, which Reconfigure replaces.
+	mu        sync.Mutex
+	evaluator lag.Evaluator
+	config    *config.ScalerConfig
+}
+
+func New(window *lag.SlidingWindow, scraper Scraper, evaluator lag.Evaluator, cfg *config.ScalerConfig) *Handler {
+	return &Handler{
+		window:    window,
+		scraper:   scraper,
+		evaluator: evaluator,
+		config:    cfg,
+		logger:    logging.Component("debug"),
+	}
+}
+
+// Reconfigure switches the handler to evaluator and cfg, e.g. on a config
+// reload.
+func (h *Handler) Reconfigure(evaluator lag.Evaluator, cfg *config.ScalerConfig) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.evaluator = evaluator
+	h.config = cfg
+}
+
+func (h *Handler) current() (lag.Evaluator, *config.ScalerConfig) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.evaluator, h.config
+}
+
+// Register mounts the debug endpoints on mux.
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /debug/window", h.handleWindow)
+	mux.HandleFunc("GET /debug/config", h.handleConfig)
+	mux.HandleFunc("POST /debug/scrape", h.handleScrape)
+	mux.HandleFunc("GET /debug/partitions", h.handlePartitions)
+	mux.HandleFunc("GET /debug/lag-at", h.handleLagAt)
+}
+
+type windowResponse struct {
+	Samples   int     `json:"samples"`
+	FillRatio float64 `json:"fillRatio"`
+}
+
+func (h *Handler) handleWindow(w http.ResponseWriter, r *http.Request) {
+	h.writeJSON(w, windowResponse{
+		Samples:   h.window.Len(),
+		FillRatio: h.window.FillRatio(),
+	})
+}
+
+// handleConfig returns the effective configuration after metadata, env and
+// default precedence has been applied. Credentials are redacted.
+func (h *Handler) handleConfig(w http.ResponseWriter, r *http.Request) {
+	_, cfg := h.current()
+	h.writeJSON(w, cfg)
+}
+
+type sampleResponse struct {
+	Timestamp     time.Time `json:"timestamp"`
+	Topic         string    `json:"topic"`
+	Group         string    `json:"group,omitempty"`
+	Partition     int       `json:"partition"`
+	Lag           int64     `json:"lag"`
+	Offset        int64     `json:"offset"`
+	EndOffset     int64     `json:"endOffset"`
+	ConsumeRate   float64   `json:"consumeRate"`
+	ByteLag       int64     `json:"byteLag,omitempty"`
+	TimeLag       int64     `json:"timeLagSeconds,omitempty"`
+	Members       int       `json:"members,omitempty"`
+	OffsetAhead   bool      `json:"offsetAhead,omitempty"`
+	LeaderChanged bool      `json:"leaderChanged,omitempty"`
+	StaleCommit   bool      `json:"staleCommit,omitempty"`
+}
+
+type scrapeResponse struct {
+	Samples    []sampleResponse     `json:"samples"`
+	Evaluation lag.EvaluationResult `json:"evaluation"`
+}
+
+// handleScrape runs a scrape immediately and returns its samples together with
+// an evaluation of the updated window. The evaluation is computed directly, so
+// it doesn't count towards the gRPC server's transition logging or quorum.
+func (h *Handler) handleScrape(w http.ResponseWriter, r *http.Request) {
+	samples, err := h.scraper.Scrape(r.Context())
+	if err != nil {
+		http.Error(w, "scrape failed: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	evaluator, _ := h.current()
+	result := evaluator.Evaluate(h.window.Snapshot())
+	result.EvaluatedAt = time.Now()
+
+	resp := scrapeResponse{
+		Samples:    make([]sampleResponse, len(samples)),
+		Evaluation: result,
+	}
+	for i, s := range samples {
+		resp.Samples[i] = sampleResponse(s)
+	}
+	h.writeJSON(w, resp)
+}
+
+type partitionResponse struct {
+	Topic           string `json:"topic"`
+	Group           string `json:"group,omitempty"`
+	Partition       int    `json:"partition"`
+	EndOffset       int64  `json:"endOffset"`
+	CommittedOffset int64  `json:"committedOffset"`
+	Lag             int64  `json:"lag"`
+}
+
+type partitionsResponse struct {
+	FetchedAt  time.Time           `json:"fetchedAt"`
+	Partitions []partitionResponse `json:"partitions"`
+}
+
+// handlePartitions returns each partition's offsets and lag as of the last
+// successful fetch, before filtering or aggregation, ordered by topic, group
+// and partition, for comparing with kafka-consumer-groups --describe.
+func (h *Handler) handlePartitions(w http.ResponseWriter, r *http.Request) {
+	samples, fetchedAt := h.scraper.LastFetch()
+	if fetchedAt.IsZero() {
+		http.Error(w, "no successful fetch yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	h.writeJSON(w, partitionsResponse{
+		FetchedAt:  fetchedAt,
+		Partitions: partitionResponses(samples),
+	})
+}
+
+// partitionResponses returns samples' offsets and lag ordered by topic, group
+// and partition.
+func partitionResponses(samples []lag.LagSample) []partitionResponse {
+	partitions := make([]partitionResponse, len(samples))
+	for i, s := range samples {
+		partitions[i] = partitionResponse{
+			Topic:           s.Topic,
+			Group:           s.Group,
+			Partition:       s.Partition,
+			EndOffset:       s.EndOffset,
+			CommittedOffset: s.Offset,
+			Lag:             s.Lag,
+		}
+	}
+	sort.Slice(partitions, func(i, j int) bool {
+		a, b := partitions[i], partitions[j]
+		if a.Topic != b.Topic {
+			return a.Topic < b.Topic
+		}
+		if a.Group != b.Group {
+			return a.Group < b.Group
+		}
+		return a.Partition < b.Partition
+	})
+	return partitions
+}
+
+type lagAtResponse struct {
+	At         time.Time           `json:"at"`
+	TotalLag   int64               `json:"totalLag"`
+	Partitions []partitionResponse `json:"partitions"`
+}
+
+// handleLagAt measures lag against the point in time given by the time query
+// parameter, in RFC 3339, e.g. an incident's start. Each partition's end
+// offset is where its log ended then, and its lag how many records produced
+// before then its group, at its current committed offset, has yet to consume.
+func (h *Handler) handleLagAt(w http.ResponseWriter, r *http.Request) {
+	at, err := time.Parse(time.RFC3339, r.URL.Query().Get("time"))
+	if err != nil {
+		http.Error(w, "time must be an RFC 3339 timestamp: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if at.After(time.Now()) {
+		http.Error(w, "time must not be in the future", http.StatusBadRequest)
+		return
+	}
+
+	samples, err := h.scraper.LagAt(r.Context(), at)
+	if err != nil {
+		http.Error(w, "fetch failed: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	resp := lagAtResponse{At: at, Partitions: partitionResponses(samples)}
+	for _, s := range samples {
+		resp.TotalLag += s.Lag
+	}
+	h.writeJSON(w, resp)
+}
+
+func (h *Handler) writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		h.logger.Error("Error writing debug response", "error", err)
+	}
+}
@@ -0,0 +1,295 @@
+package debug
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/config"
+	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/lag"
+)
+
+func defaultConfig() *config.ScalerConfig {
+	return &config.ScalerConfig{
+		BootstrapServers: "localhost:9092",
+		Topic:            "test-topic",
+		ConsumerGroup:    "test-group",
+		LagThreshold:     500,
+		SustainDuration:  120 * time.Second,
+		SamplingInterval: 10 * time.Second,
+		WindowSize:       30,
+	}
+}
+
+// fakeScraper adds its canned samples to the window on each Scrape, and
+// reports them as the last fetch once scraped.
+type fakeScraper struct {
+	window    *lag.SlidingWindow
+	samples   []lag.LagSample
+	err       error
+	calls     int
+	fetchedAt time.Time
+	// lagAt is when LagAt was last asked about
+	lagAt time.Time
+}
+
+func (f *fakeScraper) Scrape(ctx context.Context) ([]lag.LagSample, error) {
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	f.window.Add(f.samples...)
+	f.fetchedAt = time.Now()
+	return f.samples, nil
+}
+
+func (f *fakeScraper) LastFetch() ([]lag.LagSample, time.Time) {
+	if f.fetchedAt.IsZero() {
+		return nil, time.Time{}
+	}
+	return f.samples, f.fetchedAt
+}
+
+func (f *fakeScraper) LagAt(ctx context.Context, at time.Time) ([]lag.LagSample, error) {
+	f.lagAt = at
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.samples, nil
+}
+
+func evaluator(cfg *config.ScalerConfig) lag.Evaluator {
+	return lag.AbsoluteEvaluator{
+		Threshold:       cfg.LagThreshold,
+		SustainDuration: cfg.SustainDuration,
+	}
+}
+
+func serve(h *Handler, method, path string) *httptest.ResponseRecorder {
+	mux := http.NewServeMux()
+	h.Register(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+	return rec
+}
+
+func TestConfigEndpoint_ReturnsResolvedConfig(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.LagThreshold = 750
+	cfg.SASLMechanism = config.SASLPlain
+	cfg.SASLUsername = "scaler"
+	cfg.SASLPassword = "hunter2"
+	cfg.TLSKey = "private-key-pem"
+
+	h := New(lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval), nil, nil, cfg)
+	rec := serve(h, http.MethodGet, "/debug/config")
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	body := rec.Body.String()
+	if strings.Contains(body, "hunter2") || strings.Contains(body, "private-key-pem") {
+		t.Fatalf("config endpoint leaked a secret: %s", body)
+	}
+
+	var got map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if got["lagThreshold"] != float64(750) {
+		t.Errorf("lagThreshold = %v, want 750", got["lagThreshold"])
+	}
+	if got["sustainDuration"] != "2m0s" {
+		t.Errorf("sustainDuration = %v, want 2m0s", got["sustainDuration"])
+	}
+	if got["username"] != "scaler" {
+		t.Errorf("username = %v, want scaler", got["username"])
+	}
+	if got["password"] != "[REDACTED]" {
+		t.Errorf("password = %v, want [REDACTED]", got["password"])
+	}
+}
+
+func TestConfigEndpoint_ReflectsReconfigure(t *testing.T) {
+	cfg := defaultConfig()
+	h := New(lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval), nil, nil, cfg)
+
+	next := *cfg
+	next.LagThreshold = 2500
+	h.Reconfigure(nil, &next)
+
+	var got map[string]any
+	if err := json.Unmarshal(serve(h, http.MethodGet, "/debug/config").Body.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if got["lagThreshold"] != float64(2500) {
+		t.Errorf("lagThreshold = %v, want the reconfigured 2500", got["lagThreshold"])
+	}
+}
+
+func TestWindowEndpoint_ReportsFill(t *testing.T) {
+	cfg := defaultConfig()
+	w := lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+	w.Add(lag.LagSample{Timestamp: time.Now(), Partition: 0, Lag: 10})
+
+	rec := serve(New(w, nil, nil, cfg), http.MethodGet, "/debug/window")
+
+	var got windowResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if got.Samples != 1 {
+		t.Errorf("samples = %d, want 1", got.Samples)
+	}
+}
+
+func TestScrapeEndpoint_ReturnsFreshSamples(t *testing.T) {
+	cfg := defaultConfig()
+	w := lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+	scr := &fakeScraper{window: w, samples: []lag.LagSample{
+		{Timestamp: time.Now(), Topic: "test-topic", Partition: 0, Lag: 700, Offset: 300, EndOffset: 1000},
+		{Timestamp: time.Now(), Topic: "test-topic", Partition: 1, Lag: 50, Offset: 950, EndOffset: 1000},
+	}}
+
+	rec := serve(New(w, scr, evaluator(cfg), cfg), http.MethodPost, "/debug/scrape")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+	if scr.calls != 1 {
+		t.Errorf("expected one synchronous scrape, got %d", scr.calls)
+	}
+
+	var got struct {
+		Samples    []sampleResponse `json:"samples"`
+		Evaluation struct {
+			Persistent      bool  `json:"persistent"`
+			TotalCurrentLag int64 `json:"totalCurrentLag"`
+			MaxLagPartition int   `json:"maxLagPartition"`
+		} `json:"evaluation"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(got.Samples) != 2 || got.Samples[0].Lag != 700 || got.Samples[1].Partition != 1 {
+		t.Errorf("unexpected samples: %+v", got.Samples)
+	}
+	if got.Evaluation.TotalCurrentLag != 750 || got.Evaluation.MaxLagPartition != 0 {
+		t.Errorf("unexpected evaluation: %+v", got.Evaluation)
+	}
+	if got.Evaluation.Persistent {
+		t.Error("expected a single scrape not to be persistent")
+	}
+}
+
+func TestPartitionsEndpoint_ReturnsLastFetchedOffsets(t *testing.T) {
+	cfg := defaultConfig()
+	w := lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+	scr := &fakeScraper{window: w, samples: []lag.LagSample{
+		{Timestamp: time.Now(), Topic: "test-topic", Group: "test-group", Partition: 1, Lag: 50, Offset: 950, EndOffset: 1000},
+		{Timestamp: time.Now(), Topic: "test-topic", Group: "test-group", Partition: 0, Lag: 700, Offset: 300, EndOffset: 1000},
+	}}
+	h := New(w, scr, evaluator(cfg), cfg)
+
+	if rec := serve(h, http.MethodGet, "/debug/partitions"); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status before any fetch = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	if _, err := scr.Scrape(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rec := serve(h, http.MethodGet, "/debug/partitions")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var got partitionsResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	want := []partitionResponse{
+		{Topic: "test-topic", Group: "test-group", Partition: 0, EndOffset: 1000, CommittedOffset: 300, Lag: 700},
+		{Topic: "test-topic", Group: "test-group", Partition: 1, EndOffset: 1000, CommittedOffset: 950, Lag: 50},
+	}
+	if len(got.Partitions) != len(want) {
+		t.Fatalf("partitions = %+v, want %+v", got.Partitions, want)
+	}
+	for i := range want {
+		if got.Partitions[i] != want[i] {
+			t.Errorf("partition %d = %+v, want %+v", i, got.Partitions[i], want[i])
+		}
+	}
+	if got.FetchedAt.IsZero() {
+		t.Error("expected fetchedAt to be set")
+	}
+}
+
+func TestLagAtEndpoint(t *testing.T) {
+	cfg := defaultConfig()
+	w := lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+	at := time.Date(2026, 3, 7, 10, 0, 0, 0, time.UTC)
+	scr := &fakeScraper{window: w, samples: []lag.LagSample{
+		{Timestamp: at, Topic: "test-topic", Group: "test-group", Partition: 1, Lag: 0, Offset: 900, EndOffset: 800},
+		{Timestamp: at, Topic: "test-topic", Group: "test-group", Partition: 0, Lag: 500, Offset: 300, EndOffset: 800},
+	}}
+	h := New(w, scr, evaluator(cfg), cfg)
+
+	rec := serve(h, http.MethodGet, "/debug/lag-at?time=2026-03-07T10:00:00Z")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+	if !scr.lagAt.Equal(at) {
+		t.Errorf("lag measured at %s, want %s", scr.lagAt, at)
+	}
+	var got lagAtResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if got.TotalLag != 500 || len(got.Partitions) != 2 || got.Partitions[0].Partition != 0 || got.Partitions[0].EndOffset != 800 {
+		t.Errorf("unexpected response %+v", got)
+	}
+	if w.Len() != 0 {
+		t.Errorf("expected the window untouched, got %d samples", w.Len())
+	}
+
+	for _, query := range []string{"", "?time=10:00", "?time=" + time.Now().Add(time.Hour).UTC().Format(time.RFC3339)} {
+		if rec := serve(h, http.MethodGet, "/debug/lag-at"+query); rec.Code != http.StatusBadRequest {
+			t.Errorf("query %q: status = %d, want %d", query, rec.Code, http.StatusBadRequest)
+		}
+	}
+
+	scr.err = errors.New("broker unreachable")
+	if rec := serve(h, http.MethodGet, "/debug/lag-at?time=2026-03-07T10:00:00Z"); rec.Code != http.StatusBadGateway {
+		t.Errorf("status on fetch error = %d, want %d", rec.Code, http.StatusBadGateway)
+	}
+}
+
+func TestScrapeEndpoint_FetchError(t *testing.T) {
+	cfg := defaultConfig()
+	w := lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+	scr := &fakeScraper{window: w, err: errors.New("broker unreachable")}
+
+	rec := serve(New(w, scr, evaluator(cfg), cfg), http.MethodPost, "/debug/scrape")
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusBadGateway)
+	}
+}
+
+func TestScrapeEndpoint_RequiresPost(t *testing.T) {
+	cfg := defaultConfig()
+	w := lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+	scr := &fakeScraper{window: w}
+
+	rec := serve(New(w, scr, evaluator(cfg), cfg), http.MethodGet, "/debug/scrape")
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+	if scr.calls != 0 {
+		t.Errorf("expected no scrape for GET, got %d", scr.calls)
+	}
+}
@@ -0,0 +1,79 @@
+package kafka
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+
+	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/config"
+)
+
+// newTransport returns a transport connecting with creds.
+func newTransport(creds config.Credentials) (*kafka.Transport, error) {
+	mechanism, err := saslMechanism(creds)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sasl config: %w", err)
+	}
+	tlsCfg, err := tlsConfig(creds)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tls config: %w", err)
+	}
+	return &kafka.Transport{
+		SASL: mechanism,
+		TLS:  tlsCfg,
+	}, nil
+}
+
+// saslMechanism builds the SASL mechanism described by cfg, or nil when SASL
+// is disabled.
+func saslMechanism(cfg config.Credentials) (sasl.Mechanism, error) {
+	switch cfg.SASLMechanism {
+	case "":
+		return nil, nil
+	case config.SASLPlain:
+		return plain.Mechanism{
+			Username: cfg.SASLUsername,
+			Password: string(cfg.SASLPassword),
+		}, nil
+	case config.SASLScramSHA256:
+		return scram.Mechanism(scram.SHA256, cfg.SASLUsername, string(cfg.SASLPassword))
+	case config.SASLScramSHA512:
+		return scram.Mechanism(scram.SHA512, cfg.SASLUsername, string(cfg.SASLPassword))
+	default:
+		return nil, fmt.Errorf("unsupported sasl mechanism %q", cfg.SASLMechanism)
+	}
+}
+
+// tlsConfig builds the client TLS config described by cfg, or nil when TLS is
+// disabled. CA, cert and key are PEM-encoded contents, as KEDA passes them.
+func tlsConfig(cfg config.Credentials) (*tls.Config, error) {
+	if !cfg.TLSEnabled {
+		return nil, nil
+	}
+
+	tlsCfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if cfg.TLSCA != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(cfg.TLSCA)) {
+			return nil, errors.New("no certificates found in ca")
+		}
+		tlsCfg.RootCAs = pool
+	}
+
+	if cfg.TLSCert != "" {
+		cert, err := tls.X509KeyPair([]byte(cfg.TLSCert), []byte(cfg.TLSKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsCfg, nil
+}
@@ -2,140 +2,810 @@ package kafka
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"net"
+	"regexp"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/segmentio/kafka-go"
 
+	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/config"
 	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/lag"
+	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/logging"
 )
 
-type LagFetcher struct {
-	client        *kafka.Client
-	topic         string
-	consumerGroup string
+// brokerClient is the subset of *kafka.Client the fetcher relies on.
+type brokerClient interface {
+	Metadata(ctx context.Context, req *kafka.MetadataRequest) (*kafka.MetadataResponse, error)
+	ListOffsets(ctx context.Context, req *kafka.ListOffsetsRequest) (*kafka.ListOffsetsResponse, error)
+	OffsetFetch(ctx context.Context, req *kafka.OffsetFetchRequest) (*kafka.OffsetFetchResponse, error)
+	Fetch(ctx context.Context, req *kafka.FetchRequest) (*kafka.FetchResponse, error)
+	DescribeGroups(ctx context.Context, req *kafka.DescribeGroupsRequest) (*kafka.DescribeGroupsResponse, error)
+	ListGroups(ctx context.Context, req *kafka.ListGroupsRequest) (*kafka.ListGroupsResponse, error)
+	DescribeConfigs(ctx context.Context, req *kafka.DescribeConfigsRequest) (*kafka.DescribeConfigsResponse, error)
 }
 
-func NewLagFetcher(brokers string, topic, consumerGroup string) *LagFetcher {
-	return &LagFetcher{
-		client: &kafka.Client{
-			Addr: kafka.TCP(brokers),
-		},
-		topic:         topic,
-		consumerGroup: consumerGroup,
+// connCloser is the part of *kafka.Transport that releases its broker
+// connections.
+type connCloser interface {
+	CloseIdleConnections()
+}
+
+// ConfigError wraps a fetch failure caused by the scaler's configuration, such
+// as a topic that doesn't exist or isn't readable, which retrying won't fix.
+type ConfigError struct {
+	Err error
+}
+
+func (e *ConfigError) Error() string { return e.Err.Error() }
+func (e *ConfigError) Unwrap() error { return e.Err }
+
+// Permanent marks the error as not worth retrying.
+func (e *ConfigError) Permanent() bool { return true }
+
+// EmptyTopicError reports a topic that exists but has no partitions, as
+// while it's being created or deleted. Unlike a missing topic it isn't a
+// ConfigError: it's expected to resolve on its own.
+type EmptyTopicError struct {
+	Topic string
+}
+
+func (e *EmptyTopicError) Error() string {
+	return fmt.Sprintf("topic %s has no partitions", e.Topic)
+}
+
+// EmptyTopic marks the error as a topic without partitions.
+func (e *EmptyTopicError) EmptyTopic() bool { return true }
+
+// configErrors are broker error codes that point at the configuration rather
+// than at a transient broker problem.
+var configErrors = []error{
+	kafka.UnknownTopicOrPartition,
+	kafka.TopicAuthorizationFailed,
+	kafka.GroupAuthorizationFailed,
+	kafka.SASLAuthenticationFailed,
+}
+
+// classify wraps err in a ConfigError when it's caused by configuration.
+func classify(err error) error {
+	for _, target := range configErrors {
+		if errors.Is(err, target) {
+			return &ConfigError{Err: err}
+		}
 	}
+	return err
 }
 
-func (f *LagFetcher) FetchLag(ctx context.Context) ([]lag.LagSample, error) {
-	now := time.Now()
+// isolationLevel maps a configured isolation level to kafka-go's.
+func isolationLevel(level string) kafka.IsolationLevel {
+	if level == config.IsolationReadCommitted {
+		return kafka.ReadCommitted
+	}
+	return kafka.ReadUncommitted
+}
 
-	// Discover partitions via Metadata
-	metaResp, err := f.client.Metadata(ctx, &kafka.MetadataRequest{
-		Addr:   f.client.Addr,
-		Topics: []string{f.topic},
-	})
+// groupSource pairs a consumer group with the source of its commits.
+type groupSource struct {
+	group  string
+	source LagSource
+}
+
+type LagFetcher struct {
+	client   brokerClient
+	addr     net.Addr
+	sources  []groupSource
+	lagBasis string
+	topic    string
+
+	// transport holds client's connections, released once by Close; nil in
+	// tests.
+	transport connCloser
+	closeOnce sync.Once
+
+	// groupPattern, when set, replaces the configured groups: sources are
+	// rebuilt from the groups matching it, listed at most every
+	// groupRefresh, with newSource creating each group's source.
+	groupPattern   *regexp.Regexp
+	groupRefresh   time.Duration
+	groupsListedAt time.Time
+	newSource      func(group string) LagSource
+
+	// metadataCacheTTL is how long cachedPartitions, the topic's partitions
+	// from the last successful Metadata call at partitionsCachedAt, stand in
+	// when a fresh call fails.
+	metadataCacheTTL   time.Duration
+	cachedPartitions   []kafka.Partition
+	partitionsCachedAt time.Time
+
+	// isolationLevel is what end offsets are listed at: the high watermark
+	// for read uncommitted, the last stable offset for read committed.
+	isolationLevel kafka.IsolationLevel
+
+	// include and exclude filter the partitions lag is measured on; an
+	// empty include set means every partition.
+	include map[int]bool
+	exclude map[int]bool
+
+	// maxPartitions fails a scrape selecting more partitions than this,
+	// when positive.
+	maxPartitions int
+
+	// missingOffsets decides what happens to a partition that metadata lists
+	// but ListOffsets omits, e.g. while its leader is unavailable.
+	// lastOffsets holds each partition's most recent offsets for carrying
+	// forward.
+	missingOffsets string
+	lastOffsets    map[int]kafka.PartitionOffsets
+
+	// replica, in replication lag mode, is the mirror whose end offsets lag
+	// is measured against in place of group offsets; nil otherwise.
+	replica *replicaTopic
+
+	// concurrentOffsets requests group offsets alongside end offsets rather
+	// than after them.
+	concurrentOffsets bool
+
+	// leaders is each partition's leader broker ID at the last scrape, to
+	// flag samples taken right after a leader change.
+	leaders map[int]int
+
+	// commitStaleness flags samples whose offset was committed at least this
+	// long ago, when positive. A source that knows commit times says when;
+	// otherwise, as with OffsetFetch, which carries no commit timestamp,
+	// commits holds each group and partition's committed offset and when a
+	// scrape first saw it.
+	commitStaleness time.Duration
+	commits         map[groupPartition]commitSeen
+
+	// strictOffsets flags samples whose committed offset is past the end
+	// offset instead of only clamping their lag to 0.
+	strictOffsets bool
+
+	// skipRebalancing fails the scrape instead of reading committed offsets
+	// while a group is rebalancing.
+	skipRebalancing bool
+
+	// countMembers sets each sample's Members from DescribeGroups.
+	countMembers bool
+
+	// sizer estimates record sizes for ByteLag; nil unless lag is measured
+	// in bytes. timeLag reads record timestamps for TimeLag when lag is
+	// measured in seconds.
+	sizer   *recordSizer
+	timeLag bool
+
+	// compaction discounts lag on a log-compacted topic; nil unless
+	// configured. cleanupPolicyChecked records that the topic's cleanup
+	// policy has been looked up, which happens once.
+	compaction           *compactionSampler
+	cleanupPolicyChecked bool
+
+	logger *slog.Logger
+}
+
+func NewLagFetcher(cfg *config.ScalerConfig) (*LagFetcher, error) {
+	transport, err := newTransport(cfg.Credentials())
 	if err != nil {
-		return nil, fmt.Errorf("metadata request failed: %w", err)
+		return nil, err
 	}
 
-	if len(metaResp.Topics) == 0 {
-		return nil, fmt.Errorf("topic %s not found", f.topic)
+	brokers := splitBrokers(cfg.BootstrapServers)
+	addr := kafka.TCP(brokers...)
+	client := &kafka.Client{
+		Addr:      addr,
+		Transport: transport,
 	}
 
-	topicMeta := metaResp.Topics[0]
-	if topicMeta.Error != nil {
-		return nil, fmt.Errorf("topic metadata error: %w", topicMeta.Error)
+	// Every round-trip from the fetcher and its lag sources shares one
+	// limiter, so the configured rate holds across groups
+	var limiter *rateLimiter
+	if cfg.BrokerRateLimit > 0 {
+		limiter = newRateLimiter(cfg.BrokerRateLimit)
+	}
+	var broker brokerClient = client
+	if limiter != nil {
+		broker = &rateLimitedClient{client: client, limiter: limiter}
 	}
 
-	partitions := topicMeta.Partitions
+	newSource := func(group string) LagSource {
+		switch cfg.LagSource {
+		case config.LagSourceConsumerOffsets:
+			dialer := &kafka.Dialer{
+				Timeout:       10 * time.Second,
+				DualStack:     true,
+				SASLMechanism: transport.SASL,
+				TLS:           transport.TLS,
+			}
+			return newConsumerOffsetsSource(broker, addr, dialer, brokers, cfg.Topic, group)
+		default:
+			return &offsetFetchSource{
+				client:        broker,
+				addr:          addr,
+				topic:         cfg.Topic,
+				consumerGroup: group,
+				mode:          cfg.OffsetFetchMode,
+			}
+		}
+	}
 
-	// Get high water marks (latest offsets)
+	var sources []groupSource
+	var replica *replicaTopic
+	if cfg.LagMode == config.LagModeReplication {
+		// The mirror's cluster gets its own client, connecting with its own
+		// credentials, but shares the limiter
+		replicaTransport, err := newTransport(cfg.ReplicationCredentials())
+		if err != nil {
+			return nil, fmt.Errorf("invalid replication credentials: %w", err)
+		}
+		replicaAddr := kafka.TCP(splitBrokers(cfg.ReplicationBrokers)...)
+		var replicaClient brokerClient = &kafka.Client{
+			Addr:      replicaAddr,
+			Transport: replicaTransport,
+		}
+		if limiter != nil {
+			replicaClient = &rateLimitedClient{client: replicaClient, limiter: limiter}
+		}
+		replica = &replicaTopic{
+			client:    replicaClient,
+			addr:      replicaAddr,
+			transport: replicaTransport,
+			topic:     cfg.ReplicationTopic,
+			logger:    logging.Component("kafka"),
+		}
+	} else {
+		for _, group := range cfg.ConsumerGroups() {
+			sources = append(sources, groupSource{group: group, source: newSource(group)})
+		}
+	}
+
+	var groupPattern *regexp.Regexp
+	if cfg.ConsumerGroupPattern != "" {
+		groupPattern, err = regexp.Compile(cfg.ConsumerGroupPattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid consumer group pattern: %w", err)
+		}
+	}
+
+	var sizer *recordSizer
+	if cfg.LagUnit == config.LagUnitBytes {
+		sizer = newRecordSizer(broker, addr, cfg.Topic, cfg.RecordSizeRefresh)
+	}
+
+	var compaction *compactionSampler
+	if cfg.CompactedTopic {
+		compaction = newCompactionSampler(broker, addr, cfg.Topic, cfg.CompactionRefresh)
+	}
+
+	return &LagFetcher{
+		client:            broker,
+		addr:              addr,
+		transport:         transport,
+		sources:           sources,
+		replica:           replica,
+		groupPattern:      groupPattern,
+		groupRefresh:      cfg.GroupRefresh,
+		newSource:         newSource,
+		lagBasis:          cfg.LagBasis,
+		topic:             cfg.Topic,
+		metadataCacheTTL:  cfg.MetadataCacheTTL,
+		isolationLevel:    isolationLevel(cfg.IsolationLevel),
+		include:           partitionSet(cfg.IncludePartitions),
+		exclude:           partitionSet(cfg.ExcludePartitions),
+		maxPartitions:     cfg.MaxPartitions,
+		missingOffsets:    cfg.MissingOffsets,
+		lastOffsets:       make(map[int]kafka.PartitionOffsets),
+		strictOffsets:     cfg.StrictOffsets,
+		concurrentOffsets: cfg.OffsetRequests == config.OffsetRequestsConcurrent,
+		commitStaleness:   cfg.CommitStaleness,
+		skipRebalancing:   cfg.SkipDuringRebalance,
+		countMembers:      cfg.GroupMembers != config.GroupMembersOff,
+		sizer:             sizer,
+		timeLag:           cfg.LagUnit == config.LagUnitSeconds,
+		compaction:        compaction,
+		logger:            logging.Component("kafka"),
+	}, nil
+}
+
+// Close stops the groups' sources, such as a consumerOffsets tail, and
+// releases the fetcher's connections to the brokers. Those in use by a fetch
+// still in flight are closed once it completes. Calling Close again does
+// nothing.
+func (f *LagFetcher) Close() error {
+	f.closeOnce.Do(func() {
+		for _, gs := range f.sources {
+			closeSource(gs.source)
+		}
+		if f.transport != nil {
+			f.transport.CloseIdleConnections()
+		}
+		if f.replica != nil && f.replica.transport != nil {
+			f.replica.transport.CloseIdleConnections()
+		}
+	})
+	return nil
+}
+
+// closeSource stops source if it holds anything open.
+func closeSource(source LagSource) {
+	if c, ok := source.(io.Closer); ok {
+		c.Close()
+	}
+}
+
+func partitionSet(ids []int) map[int]bool {
+	if len(ids) == 0 {
+		return nil
+	}
+	set := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
+
+// selected reports whether lag should be measured on partition id.
+func (f *LagFetcher) selected(id int) bool {
+	if len(f.include) > 0 && !f.include[id] {
+		return false
+	}
+	return !f.exclude[id]
+}
+
+// splitBrokers turns a comma-separated bootstrap list into individual
+// addresses so the client can fail over when one broker is down.
+func splitBrokers(bootstrapServers string) []string {
+	var brokers []string
+	for _, b := range strings.Split(bootstrapServers, ",") {
+		if b = strings.TrimSpace(b); b != "" {
+			brokers = append(brokers, b)
+		}
+	}
+	return brokers
+}
+
+func (f *LagFetcher) FetchLag(ctx context.Context) ([]lag.LagSample, error) {
+	now := time.Now()
+
+	partitions, err := f.measuredPartitions(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+	f.checkCleanupPolicy(ctx)
+	leaderChanged := f.trackLeaders(partitions)
+
+	// Get high water marks (latest offsets), plus log start offsets when lag
+	// is measured against the earliest offset
+	earliestBasis := f.lagBasis == config.LagBasisEarliest
 	offsetRequests := make(map[string][]kafka.OffsetRequest)
 	for _, p := range partitions {
-		offsetRequests[f.topic] = append(offsetRequests[f.topic], kafka.OffsetRequest{
-			Partition: p.ID,
-			Timestamp: -1, // latest offset
-		})
+		offsetRequests[f.topic] = append(offsetRequests[f.topic], kafka.LastOffsetOf(p.ID))
+		if earliestBasis {
+			offsetRequests[f.topic] = append(offsetRequests[f.topic], kafka.FirstOffsetOf(p.ID))
+		}
 	}
 
+	// Concurrently, group offsets are requested for every measured
+	// partition, since which ListOffsets omits isn't known yet
+	var concurrent <-chan groupOffsetsResult
+	if f.concurrentOffsets && !earliestBasis && f.replica == nil {
+		concurrent = f.fetchGroupOffsetsAsync(ctx, now, partitionIDs(partitions))
+	}
 	listResp, err := f.client.ListOffsets(ctx, &kafka.ListOffsetsRequest{
-		Addr:   f.client.Addr,
-		Topics: offsetRequests,
+		Addr:           f.addr,
+		Topics:         offsetRequests,
+		IsolationLevel: f.isolationLevel,
 	})
+	var groups groupOffsetsResult
+	if concurrent != nil {
+		// Waited on even when ListOffsets failed, so nothing else touches
+		// the fetcher once FetchLag returns
+		groups = <-concurrent
+	}
 	if err != nil {
 		return nil, fmt.Errorf("list offsets failed: %w", err)
 	}
 
 	endOffsets := make(map[int]int64)
+	startOffsets := make(map[int]int64)
 	for _, po := range listResp.Topics[f.topic] {
 		if po.Error != nil {
 			return nil, fmt.Errorf("offset error for partition %d: %w", po.Partition, po.Error)
 		}
 		endOffsets[po.Partition] = po.LastOffset
+		startOffsets[po.Partition] = po.FirstOffset
+		f.lastOffsets[po.Partition] = po
 	}
 
-	// Get committed consumer group offsets
-	coordinator, err := f.client.Metadata(ctx, &kafka.MetadataRequest{
-		Addr: f.client.Addr,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("coordinator lookup failed: %w", err)
+	// A partition missing from the offsets response would otherwise read as
+	// a zero end offset and report no lag
+	available := partitions[:0]
+	for _, p := range partitions {
+		if _, ok := endOffsets[p.ID]; ok {
+			available = append(available, p)
+			continue
+		}
+		if last, ok := f.lastOffsets[p.ID]; ok && f.missingOffsets == config.MissingOffsetsCarryForward {
+			f.logger.Warn("Partition missing from offsets response, carrying forward last offsets",
+				"topic", f.topic, "partition", p.ID, "endOffset", last.LastOffset)
+			endOffsets[p.ID] = last.LastOffset
+			startOffsets[p.ID] = last.FirstOffset
+			available = append(available, p)
+			continue
+		}
+		f.logger.Warn("Partition missing from offsets response, skipping", "topic", f.topic, "partition", p.ID)
+	}
+	partitions = available
+	if len(partitions) == 0 {
+		return nil, fmt.Errorf("no offsets returned for topic %s", f.topic)
 	}
 
-	// Use first broker as coordinator address
-	var coordinatorAddr net.Addr
-	if len(coordinator.Brokers) > 0 {
-		coordinatorAddr = kafka.TCP(fmt.Sprintf("%s:%d", coordinator.Brokers[0].Host, coordinator.Brokers[0].Port))
-	} else {
-		coordinatorAddr = f.client.Addr
+	// Lag is measured from the log start for the entire unconsumed backlog,
+	// which is the same for every group
+	if earliestBasis {
+		samples := f.samples(now, "", partitions, endOffsets, startOffsets)
+		markLeaderChanges(samples, leaderChanged)
+		f.discountCompaction(ctx, samples, now)
+		f.estimateByteLag(ctx, samples, now)
+		f.estimateTimeLag(ctx, samples, now)
+		return samples, nil
+	}
+
+	// In replication mode from the mirror's end offsets instead
+	if f.replica != nil {
+		mirrored, replicaOffsets, err := f.replica.endOffsets(ctx, partitions, f.isolationLevel)
+		if err != nil {
+			return nil, err
+		}
+		samples := f.samples(now, "", mirrored, endOffsets, replicaOffsets)
+		markLeaderChanges(samples, leaderChanged)
+		f.estimateByteLag(ctx, samples, now)
+		return samples, nil
+	}
+
+	// Otherwise from each group's committed offsets, one sample per group
+	// and partition
+	if concurrent == nil {
+		groups.offsets, groups.err = f.fetchGroupOffsets(ctx, now, partitionIDs(partitions))
+	}
+	if groups.err != nil {
+		return nil, groups.err
+	}
+
+	var samples []lag.LagSample
+	for _, g := range groups.offsets {
+		groupSamples := f.samples(now, g.group, partitions, endOffsets, g.committed)
+		for i := range groupSamples {
+			groupSamples[i].Members = g.members
+		}
+		samples = append(samples, groupSamples...)
+	}
+
+	markLeaderChanges(samples, leaderChanged)
+	f.markStaleCommits(samples, groups.offsets, now)
+	f.discountCompaction(ctx, samples, now)
+	f.estimateByteLag(ctx, samples, now)
+	f.estimateTimeLag(ctx, samples, now)
+	return samples, nil
+}
+
+// groupOffsets is a group's committed offsets, with its member count when
+// members are counted.
+type groupOffsets struct {
+	group     string
+	members   int
+	committed map[int]int64
+	// commitTimes is when each offset was committed, where the source
+	// knows; only looked up when commit staleness is tracked.
+	commitTimes map[int]time.Time
+}
+
+type groupOffsetsResult struct {
+	offsets []groupOffsets
+	err     error
+}
+
+// fetchGroupOffsets reads every group's committed offsets for partitionIDs,
+// refreshing the groups matching the pattern first.
+func (f *LagFetcher) fetchGroupOffsets(ctx context.Context, now time.Time, partitionIDs []int) ([]groupOffsets, error) {
+	if err := f.refreshGroups(ctx, now); err != nil {
+		return nil, err
+	}
+
+	offsets := make([]groupOffsets, 0, len(f.sources))
+	for _, gs := range f.sources {
+		// One DescribeGroups call serves both the rebalance check and the
+		// member count
+		var members int
+		if f.skipRebalancing || f.countMembers {
+			g, err := f.describeGroup(ctx, gs.group)
+			if err != nil {
+				return nil, classify(fmt.Errorf("group %s: %w", gs.group, err))
+			}
+			if f.skipRebalancing {
+				if err := checkGroupStable(g); err != nil {
+					return nil, classify(fmt.Errorf("group %s: %w", gs.group, err))
+				}
+			}
+			members = len(g.Members)
+		}
+		committed, err := gs.source.CommittedOffsets(ctx, partitionIDs)
+		if err != nil {
+			return nil, classify(fmt.Errorf("group %s: %w", gs.group, err))
+		}
+		var commitTimes map[int]time.Time
+		if ts, ok := gs.source.(commitTimeSource); ok && f.commitStaleness > 0 {
+			commitTimes = ts.CommitTimes(partitionIDs)
+		}
+		offsets = append(offsets, groupOffsets{group: gs.group, members: members, committed: committed, commitTimes: commitTimes})
 	}
+	return offsets, nil
+}
+
+// fetchGroupOffsetsAsync runs fetchGroupOffsets in its own goroutine, so its
+// round-trips to the group coordinator overlap ListOffsets to the partition
+// leaders. Only group state is touched meanwhile, which the caller leaves
+// alone until it receives the result.
+func (f *LagFetcher) fetchGroupOffsetsAsync(ctx context.Context, now time.Time, partitionIDs []int) <-chan groupOffsetsResult {
+	result := make(chan groupOffsetsResult, 1)
+	go func() {
+		offsets, err := f.fetchGroupOffsets(ctx, now, partitionIDs)
+		result <- groupOffsetsResult{offsets, err}
+	}()
+	return result
+}
 
-	topicPartitions := make(map[string][]int)
+func partitionIDs(partitions []kafka.Partition) []int {
+	ids := make([]int, 0, len(partitions))
 	for _, p := range partitions {
-		topicPartitions[f.topic] = append(topicPartitions[f.topic], p.ID)
+		ids = append(ids, p.ID)
+	}
+	return ids
+}
+
+// measuredPartitions returns the topic's partitions that pass the partition
+// filters and the maxPartitions cap.
+func (f *LagFetcher) measuredPartitions(ctx context.Context, now time.Time) ([]kafka.Partition, error) {
+	topicPartitions, err := f.discoverPartitions(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+	if len(topicPartitions) == 0 {
+		return nil, &EmptyTopicError{Topic: f.topic}
+	}
+
+	return f.selectPartitions(topicPartitions)
+}
+
+// Partitions returns the IDs of the partitions lag is measured on, from a
+// fresh Metadata call. Unlike FetchLag it's safe to call during a scrape.
+func (f *LagFetcher) Partitions(ctx context.Context) ([]int, error) {
+	topicPartitions, err := f.fetchPartitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	partitions, err := f.selectPartitions(topicPartitions)
+	if err != nil {
+		return nil, err
+	}
+	return partitionIDs(partitions), nil
+}
+
+// selectPartitions returns the topicPartitions that pass the partition
+// filters and the maxPartitions cap.
+func (f *LagFetcher) selectPartitions(topicPartitions []kafka.Partition) ([]kafka.Partition, error) {
+	var partitions []kafka.Partition
+	for _, p := range topicPartitions {
+		if f.selected(p.ID) {
+			partitions = append(partitions, p)
+		}
+	}
+	if len(partitions) == 0 {
+		return nil, &ConfigError{Err: fmt.Errorf("no partitions of topic %s match the partition filters", f.topic)}
+	}
+	// Checked before any offset request, so a topic far larger than
+	// expected costs one Metadata call per scrape rather than loading the
+	// cluster
+	if f.maxPartitions > 0 && len(partitions) > f.maxPartitions {
+		f.logger.Error("Topic has more partitions than maxPartitions, not fetching lag",
+			"topic", f.topic,
+			"partitions", len(partitions),
+			"maxPartitions", f.maxPartitions,
+		)
+		return nil, &ConfigError{Err: fmt.Errorf("topic %s has %d partitions to measure, more than maxPartitions %d", f.topic, len(partitions), f.maxPartitions)}
+	}
+	return partitions, nil
+}
+
+// discoverPartitions lists the topic's partitions via Metadata. When the call
+// fails, or briefly reports the topic missing as during a controller
+// election, the partitions from the last successful call are used instead as
+// long as they're no older than metadataCacheTTL.
+func (f *LagFetcher) discoverPartitions(ctx context.Context, now time.Time) ([]kafka.Partition, error) {
+	partitions, err := f.fetchPartitions(ctx)
+	if err == nil {
+		f.cachedPartitions = partitions
+		f.partitionsCachedAt = now
+		return partitions, nil
 	}
 
-	fetchResp, err := f.client.OffsetFetch(ctx, &kafka.OffsetFetchRequest{
-		Addr:    coordinatorAddr,
-		GroupID: f.consumerGroup,
-		Topics:  topicPartitions,
+	age := now.Sub(f.partitionsCachedAt)
+	if f.cachedPartitions == nil || age > f.metadataCacheTTL {
+		return nil, err
+	}
+	f.logger.Warn("Metadata request failed, using cached partitions",
+		"topic", f.topic,
+		"partitions", len(f.cachedPartitions),
+		"cacheAge", age,
+		"error", err,
+	)
+	return f.cachedPartitions, nil
+}
+
+// fetchPartitions returns the topic's partitions from a fresh Metadata call.
+func (f *LagFetcher) fetchPartitions(ctx context.Context) ([]kafka.Partition, error) {
+	metaResp, err := f.client.Metadata(ctx, &kafka.MetadataRequest{
+		Addr:   f.addr,
+		Topics: []string{f.topic},
 	})
 	if err != nil {
-		return nil, fmt.Errorf("offset fetch failed: %w", err)
+		return nil, classify(fmt.Errorf("metadata request failed: %w", err))
 	}
 
-	committedOffsets := make(map[int]int64)
-	for _, po := range fetchResp.Topics[f.topic] {
-		if po.Error != nil {
-			return nil, fmt.Errorf("committed offset error for partition %d: %w", po.Partition, po.Error)
+	if len(metaResp.Topics) == 0 {
+		return nil, &ConfigError{Err: fmt.Errorf("topic %s not found", f.topic)}
+	}
+
+	topicMeta := metaResp.Topics[0]
+	if topicMeta.Error != nil {
+		return nil, classify(fmt.Errorf("topic metadata error: %w", topicMeta.Error))
+	}
+	return topicMeta.Partitions, nil
+}
+
+// estimateByteLag sets each sample's ByteLag from its partition's average
+// record size. A partition whose size can't be sampled keeps its last
+// estimate, or a ByteLag of 0 until one is available.
+func (f *LagFetcher) estimateByteLag(ctx context.Context, samples []lag.LagSample, now time.Time) {
+	if f.sizer == nil {
+		return
+	}
+	for i := range samples {
+		s := &samples[i]
+		avg, err := f.sizer.averageSize(ctx, s.Partition, s.EndOffset, now)
+		if err != nil {
+			f.logger.Warn("Failed to sample record size", "topic", f.topic, "partition", s.Partition, "error", err)
 		}
-		committed := po.CommittedOffset
-		if committed < 0 {
-			committed = 0
+		s.ByteLag = int64(float64(s.Lag) * avg)
+	}
+}
+
+// trackLeaders records each partition's leader from metadata and returns the
+// partitions whose leader differs from the last scrape's. Right after a
+// change the new leader's end offset can briefly disagree with the old one's,
+// so their samples are flagged for evaluators to be lenient with. A partition
+// seen for the first time hasn't changed leader.
+func (f *LagFetcher) trackLeaders(partitions []kafka.Partition) map[int]bool {
+	if f.leaders == nil {
+		f.leaders = make(map[int]int, len(partitions))
+	}
+	var changed map[int]bool
+	for _, p := range partitions {
+		previous, ok := f.leaders[p.ID]
+		f.leaders[p.ID] = p.Leader.ID
+		if !ok || previous == p.Leader.ID {
+			continue
 		}
-		committedOffsets[po.Partition] = committed
+		f.logger.Info("Partition leader changed, flagging its next sample",
+			"topic", f.topic,
+			"partition", p.ID,
+			"previousLeader", previous,
+			"leader", p.Leader.ID,
+		)
+		if changed == nil {
+			changed = make(map[int]bool)
+		}
+		changed[p.ID] = true
 	}
+	return changed
+}
 
-	// Calculate lag per partition
-	var samples []lag.LagSample
+func markLeaderChanges(samples []lag.LagSample, changed map[int]bool) {
+	for i := range samples {
+		samples[i].LeaderChanged = changed[samples[i].Partition]
+	}
+}
+
+type groupPartition struct {
+	group     string
+	partition int
+}
+
+type commitSeen struct {
+	offset int64
+	at     time.Time
+}
+
+// markStaleCommits flags samples with lag whose offset was committed at
+// least commitStaleness ago, by the group's commit time where its source
+// knows it. Otherwise the commit is dated to the scrape that first saw the
+// offset, so after a restart no commit is stale for commitStaleness. Groups
+// and partitions no longer sampled are forgotten.
+func (f *LagFetcher) markStaleCommits(samples []lag.LagSample, groups []groupOffsets, now time.Time) {
+	if f.commitStaleness <= 0 {
+		return
+	}
+	commitTimes := make(map[string]map[int]time.Time, len(groups))
+	for _, g := range groups {
+		commitTimes[g.group] = g.commitTimes
+	}
+
+	commits := make(map[groupPartition]commitSeen, len(samples))
+	for i := range samples {
+		s := &samples[i]
+		key := groupPartition{s.Group, s.Partition}
+		seen, ok := f.commits[key]
+		if !ok || seen.offset != s.Offset {
+			seen = commitSeen{offset: s.Offset, at: now}
+		}
+		commits[key] = seen
+
+		committedAt := seen.at
+		if t, ok := commitTimes[s.Group][s.Partition]; ok {
+			committedAt = t
+		}
+		s.StaleCommit = s.Lag > 0 && now.Sub(committedAt) >= f.commitStaleness
+	}
+	f.commits = commits
+}
+
+// samples calculates lag per partition from the end offsets and the offsets
+// lag is measured from.
+func (f *LagFetcher) samples(now time.Time, group string, partitions []kafka.Partition, endOffsets, baseOffsets map[int]int64) []lag.LagSample {
+	samples := make([]lag.LagSample, 0, len(partitions))
 	for _, p := range partitions {
 		endOffset := endOffsets[p.ID]
-		committed := committedOffsets[p.ID]
+		committed := baseOffsets[p.ID]
+		if committed == unknownOffset {
+			f.logger.Warn("Committed offset unknown, skipping partition",
+				"topic", f.topic,
+				"group", group,
+				"partition", p.ID,
+			)
+			continue
+		}
+		if committed < 0 {
+			committed = 0
+		}
 		lagValue := endOffset - committed
-		if lagValue < 0 {
+		offsetAhead := lagValue < 0
+		if offsetAhead {
+			// Seen with replica desync or uncommitted reads. Clamping keeps the
+			// lag sane but hides the problem, so always log it.
+			f.logger.Warn("Committed offset is past the end offset",
+				"topic", f.topic,
+				"group", group,
+				"partition", p.ID,
+				"committed", committed,
+				"endOffset", endOffset,
+			)
 			lagValue = 0
 		}
 
 		samples = append(samples, lag.LagSample{
-			Timestamp: now,
-			Topic:     f.topic,
-			Partition: p.ID,
-			Lag:       lagValue,
-			Offset:    committed,
-			EndOffset: endOffset,
+			Timestamp:   now,
+			Topic:       f.topic,
+			Group:       group,
+			Partition:   p.ID,
+			Lag:         lagValue,
+			Offset:      committed,
+			EndOffset:   endOffset,
+			OffsetAhead: offsetAhead && f.strictOffsets,
 		})
 	}
-
-	return samples, nil
+	return samples
 }
@@ -0,0 +1,1196 @@
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl/plain"
+
+	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/config"
+	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/lag"
+)
+
+// fakeClient serves canned broker responses for a single topic.
+type fakeClient struct {
+	topic        string
+	partitions   []int
+	endOffsets   map[int]int64
+	startOffsets map[int]int64
+	committed    map[int]int64
+	// omitUncommitted leaves partitions without a committed offset out of
+	// OffsetFetch responses, as newer brokers do, instead of reporting -1
+	omitUncommitted bool
+	// unavailable partitions are left out of ListOffsets responses
+	unavailable map[int]bool
+	// isolationLevel is the level of the last ListOffsets request
+	isolationLevel kafka.IsolationLevel
+	// recordSizes is the value size of every record in a partition, and
+	// fetches counts Fetch calls per partition
+	recordSizes map[int]int
+	fetches     map[int]int
+	// recordTimes is the timestamp of offset 0 in a partition; each later
+	// offset is a second newer
+	recordTimes map[int]time.Time
+	// compactEvery simulates compaction: only offsets that are a multiple
+	// of a partition's value still hold a record
+	compactEvery map[int]int64
+	// cleanupPolicy is the topic's cleanup.policy, and describeConfigCalls
+	// counts DescribeConfigs calls
+	cleanupPolicy       string
+	describeConfigCalls int
+	// metadataErr fails Metadata calls; topicMissing makes them report no
+	// topics, as brokers can during a controller election
+	metadataErr  error
+	topicMissing bool
+	// groupState is what DescribeGroups reports for every group; empty
+	// means Stable. members is how many members it reports for a group
+	groupState string
+	members    map[string]int
+	// groups is what ListGroups returns, and listCalls counts its calls
+	groups    []string
+	listCalls int
+	// leaders is each partition's leader broker ID in Metadata responses
+	leaders map[int]int
+}
+
+func (c *fakeClient) Metadata(ctx context.Context, req *kafka.MetadataRequest) (*kafka.MetadataResponse, error) {
+	if c.metadataErr != nil {
+		return nil, c.metadataErr
+	}
+	if c.topicMissing {
+		return &kafka.MetadataResponse{}, nil
+	}
+	parts := make([]kafka.Partition, len(c.partitions))
+	for i, id := range c.partitions {
+		parts[i] = kafka.Partition{Topic: c.topic, ID: id, Leader: kafka.Broker{ID: c.leaders[id]}}
+	}
+	return &kafka.MetadataResponse{
+		Brokers: []kafka.Broker{{Host: "localhost", Port: 9092}},
+		Topics:  []kafka.Topic{{Name: c.topic, Partitions: parts}},
+	}, nil
+}
+
+// ListOffsets merges first/last offset requests per partition, as the real
+// client does.
+func (c *fakeClient) ListOffsets(ctx context.Context, req *kafka.ListOffsetsRequest) (*kafka.ListOffsetsResponse, error) {
+	c.isolationLevel = req.IsolationLevel
+	var offsets []kafka.PartitionOffsets
+	index := make(map[int]int)
+	for _, r := range req.Topics[c.topic] {
+		if c.unavailable[r.Partition] {
+			continue
+		}
+		i, ok := index[r.Partition]
+		if !ok {
+			i = len(offsets)
+			index[r.Partition] = i
+			offsets = append(offsets, kafka.PartitionOffsets{Partition: r.Partition, FirstOffset: -1, LastOffset: -1})
+		}
+		switch r.Timestamp {
+		case kafka.FirstOffset:
+			offsets[i].FirstOffset = c.startOffsets[r.Partition]
+		case kafka.LastOffset:
+			offsets[i].LastOffset = c.endOffsets[r.Partition]
+		default:
+			// The first offset whose record time, per recordTimes, is at or
+			// after the requested one, or -1 past the newest record
+			at := time.UnixMilli(r.Timestamp)
+			offset := int64(math.Ceil(at.Sub(c.recordTimes[r.Partition]).Seconds()))
+			if offset >= c.endOffsets[r.Partition] {
+				offset = -1
+			}
+			offsets[i].Offsets = map[int64]time.Time{offset: at}
+		}
+	}
+	return &kafka.ListOffsetsResponse{
+		Topics: map[string][]kafka.PartitionOffsets{c.topic: offsets},
+	}, nil
+}
+
+func (c *fakeClient) OffsetFetch(ctx context.Context, req *kafka.OffsetFetchRequest) (*kafka.OffsetFetchResponse, error) {
+	var offsets []kafka.OffsetFetchPartition
+	for _, p := range req.Topics[c.topic] {
+		committed, ok := c.committed[p]
+		if !ok {
+			if c.omitUncommitted {
+				continue
+			}
+			committed = -1
+		}
+		offsets = append(offsets, kafka.OffsetFetchPartition{
+			Partition:       p,
+			CommittedOffset: committed,
+		})
+	}
+	return &kafka.OffsetFetchResponse{
+		Topics: map[string][]kafka.OffsetFetchPartition{c.topic: offsets},
+	}, nil
+}
+
+// Fetch returns the records from the requested offset up to the end offset
+// that compaction left, each with a value of the partition's record size.
+func (c *fakeClient) Fetch(ctx context.Context, req *kafka.FetchRequest) (*kafka.FetchResponse, error) {
+	if c.fetches == nil {
+		c.fetches = make(map[int]int)
+	}
+	c.fetches[req.Partition]++
+
+	var records []kafka.Record
+	for offset := req.Offset; offset < c.endOffsets[req.Partition]; offset++ {
+		if every := c.compactEvery[req.Partition]; every > 1 && offset%every != 0 {
+			continue
+		}
+		records = append(records, kafka.Record{
+			Offset: offset,
+			Time:   c.recordTimes[req.Partition].Add(time.Duration(offset) * time.Second),
+			Value:  kafka.NewBytes(make([]byte, c.recordSizes[req.Partition])),
+		})
+	}
+	return &kafka.FetchResponse{
+		Topic:     req.Topic,
+		Partition: req.Partition,
+		Records:   kafka.NewRecordReader(records...),
+	}, nil
+}
+
+func (c *fakeClient) DescribeConfigs(ctx context.Context, req *kafka.DescribeConfigsRequest) (*kafka.DescribeConfigsResponse, error) {
+	c.describeConfigCalls++
+	policy := c.cleanupPolicy
+	if policy == "" {
+		policy = "delete"
+	}
+	return &kafka.DescribeConfigsResponse{
+		Resources: []kafka.DescribeConfigResponseResource{{
+			ResourceName:  c.topic,
+			ConfigEntries: []kafka.DescribeConfigResponseConfigEntry{{ConfigName: "cleanup.policy", ConfigValue: policy}},
+		}},
+	}, nil
+}
+
+func (c *fakeClient) DescribeGroups(ctx context.Context, req *kafka.DescribeGroupsRequest) (*kafka.DescribeGroupsResponse, error) {
+	state := c.groupState
+	if state == "" {
+		state = "Stable"
+	}
+	var groups []kafka.DescribeGroupsResponseGroup
+	for _, id := range req.GroupIDs {
+		groups = append(groups, kafka.DescribeGroupsResponseGroup{
+			GroupID:    id,
+			GroupState: state,
+			Members:    make([]kafka.DescribeGroupsResponseMember, c.members[id]),
+		})
+	}
+	return &kafka.DescribeGroupsResponse{Groups: groups}, nil
+}
+
+func (c *fakeClient) ListGroups(ctx context.Context, req *kafka.ListGroupsRequest) (*kafka.ListGroupsResponse, error) {
+	c.listCalls++
+	resp := &kafka.ListGroupsResponse{}
+	for _, id := range c.groups {
+		resp.Groups = append(resp.Groups, kafka.ListGroupsResponseGroup{GroupID: id, ProtocolType: "consumer"})
+	}
+	return resp, nil
+}
+
+type fakeSource struct {
+	offsets map[int]int64
+	err     error
+	calls   [][]int
+	closes  int
+}
+
+func (s *fakeSource) CommittedOffsets(ctx context.Context, partitions []int) (map[int]int64, error) {
+	s.calls = append(s.calls, partitions)
+	return s.offsets, s.err
+}
+
+func (s *fakeSource) Close() error {
+	s.closes++
+	return nil
+}
+
+// timedSource is a fakeSource that knows when each offset was committed.
+type timedSource struct {
+	fakeSource
+	times map[int]time.Time
+}
+
+func (s *timedSource) CommitTimes(partitions []int) map[int]time.Time {
+	return s.times
+}
+
+func newTestFetcher(client *fakeClient, source LagSource) *LagFetcher {
+	return &LagFetcher{
+		client:      client,
+		addr:        kafka.TCP("localhost:9092"),
+		sources:     []groupSource{{group: "test-group", source: source}},
+		topic:       client.topic,
+		lastOffsets: make(map[int]kafka.PartitionOffsets),
+		logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+}
+
+type fakeTransport struct {
+	closes int
+}
+
+func (t *fakeTransport) CloseIdleConnections() {
+	t.closes++
+}
+
+func TestClose_ReleasesConnectionsOnce(t *testing.T) {
+	transport := &fakeTransport{}
+	source := &fakeSource{}
+	f := newTestFetcher(&fakeClient{topic: "test-topic"}, source)
+	f.transport = transport
+
+	for range 2 {
+		if err := f.Close(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if transport.closes != 1 {
+		t.Errorf("expected connections to be released once, got %d", transport.closes)
+	}
+	if source.closes != 1 {
+		t.Errorf("expected the source to be closed once, got %d", source.closes)
+	}
+}
+
+func TestClose_ReleasesMirrorConnections(t *testing.T) {
+	transport, replicaTransport := &fakeTransport{}, &fakeTransport{}
+	f := newTestFetcher(&fakeClient{topic: "orders"}, nil)
+	f.sources = nil
+	f.transport = transport
+	f.replica = &replicaTopic{
+		client:    &fakeClient{topic: "us-east.orders"},
+		addr:      kafka.TCP("mirror:9092"),
+		topic:     "us-east.orders",
+		logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		transport: replicaTransport,
+	}
+
+	for range 2 {
+		if err := f.Close(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if transport.closes != 1 || replicaTransport.closes != 1 {
+		t.Errorf("expected each cluster's connections released once, got source %d, mirror %d", transport.closes, replicaTransport.closes)
+	}
+}
+
+func TestFetchLag_PassesIsolationLevel(t *testing.T) {
+	for _, level := range []string{config.IsolationReadUncommitted, config.IsolationReadCommitted} {
+		t.Run(level, func(t *testing.T) {
+			client := &fakeClient{
+				topic:      "test-topic",
+				partitions: []int{0},
+				endOffsets: map[int]int64{0: 1000},
+			}
+			f := newTestFetcher(client, &fakeSource{offsets: map[int]int64{0: 400}})
+			f.isolationLevel = isolationLevel(level)
+
+			if _, err := f.FetchLag(context.Background()); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			want := kafka.ReadUncommitted
+			if level == config.IsolationReadCommitted {
+				want = kafka.ReadCommitted
+			}
+			if client.isolationLevel != want {
+				t.Errorf("ListOffsets isolation level = %d, want %d", client.isolationLevel, want)
+			}
+		})
+	}
+}
+
+func TestFetchLag_FallsBackToCachedPartitions(t *testing.T) {
+	client := &fakeClient{
+		topic:      "test-topic",
+		partitions: []int{0, 1},
+		endOffsets: map[int]int64{0: 1000, 1: 500},
+	}
+	source := &fakeSource{offsets: map[int]int64{0: 400, 1: 500}}
+	f := newTestFetcher(client, source)
+	f.metadataCacheTTL = time.Minute
+
+	if _, err := f.FetchLag(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Metadata fails, then reports the topic missing: both scrapes complete
+	// from the cached partitions
+	client.metadataErr = errors.New("not controller")
+	samples, err := f.FetchLag(context.Background())
+	if err != nil {
+		t.Fatalf("expected the cached partitions to be used, got %v", err)
+	}
+	if len(samples) != 2 || samples[0].Lag != 600 {
+		t.Errorf("unexpected samples from cached partitions: %+v", samples)
+	}
+
+	client.metadataErr = nil
+	client.topicMissing = true
+	if _, err := f.FetchLag(context.Background()); err != nil {
+		t.Fatalf("expected the cached partitions to be used for a missing topic, got %v", err)
+	}
+
+	// Past the TTL the error surfaces
+	f.partitionsCachedAt = f.partitionsCachedAt.Add(-2 * time.Minute)
+	if _, err := f.FetchLag(context.Background()); err == nil {
+		t.Fatal("expected an error once the cache expired")
+	}
+}
+
+func TestFetchLag_NoCachedPartitions(t *testing.T) {
+	tests := []struct {
+		name  string
+		ttl   time.Duration
+		first error
+	}{
+		{"first call fails", time.Minute, errors.New("not controller")},
+		{"cache disabled", 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeClient{
+				topic:       "test-topic",
+				partitions:  []int{0},
+				endOffsets:  map[int]int64{0: 100},
+				metadataErr: tt.first,
+			}
+			f := newTestFetcher(client, &fakeSource{offsets: map[int]int64{0: 0}})
+			f.metadataCacheTTL = tt.ttl
+
+			if tt.first == nil {
+				if _, err := f.FetchLag(context.Background()); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				client.metadataErr = errors.New("not controller")
+			}
+			if _, err := f.FetchLag(context.Background()); err == nil {
+				t.Fatal("expected the metadata error")
+			}
+		})
+	}
+}
+
+func TestFetchLag_UsesLagSource(t *testing.T) {
+	client := &fakeClient{
+		topic:      "test-topic",
+		partitions: []int{0, 1},
+		endOffsets: map[int]int64{0: 1000, 1: 500},
+	}
+	source := &fakeSource{offsets: map[int]int64{0: 400, 1: 500}}
+
+	samples, err := newTestFetcher(client, source).FetchLag(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(source.calls) != 1 || len(source.calls[0]) != 2 {
+		t.Fatalf("expected one source call for 2 partitions, got %v", source.calls)
+	}
+	if len(samples) != 2 {
+		t.Fatalf("expected 2 samples, got %d", len(samples))
+	}
+	if samples[0].Lag != 600 || samples[1].Lag != 0 {
+		t.Errorf("unexpected lag values: %+v", samples)
+	}
+}
+
+func TestFetchLag_MissingCommitCountsFullLag(t *testing.T) {
+	client := &fakeClient{
+		topic:      "test-topic",
+		partitions: []int{0},
+		endOffsets: map[int]int64{0: 300},
+	}
+	source := &fakeSource{offsets: map[int]int64{}}
+
+	samples, err := newTestFetcher(client, source).FetchLag(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if samples[0].Lag != 300 {
+		t.Errorf("expected lag 300 for partition without a commit, got %d", samples[0].Lag)
+	}
+}
+
+func TestFetchLag_CommittedPastEndOffset(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		t.Run(fmt.Sprintf("strict=%v", strict), func(t *testing.T) {
+			client := &fakeClient{
+				topic:      "test-topic",
+				partitions: []int{0, 1},
+				endOffsets: map[int]int64{0: 100, 1: 500},
+			}
+			source := &fakeSource{offsets: map[int]int64{0: 150, 1: 400}}
+
+			var logs bytes.Buffer
+			f := newTestFetcher(client, source)
+			f.strictOffsets = strict
+			f.logger = slog.New(slog.NewTextHandler(&logs, nil))
+
+			samples, err := f.FetchLag(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if samples[0].Lag != 0 {
+				t.Errorf("expected lag clamped to 0, got %d", samples[0].Lag)
+			}
+			if samples[0].OffsetAhead != strict {
+				t.Errorf("partition 0 OffsetAhead = %v, want %v", samples[0].OffsetAhead, strict)
+			}
+			if samples[1].OffsetAhead || samples[1].Lag != 100 {
+				t.Errorf("partition 1 should be unaffected, got %+v", samples[1])
+			}
+			if !strings.Contains(logs.String(), "Committed offset is past the end offset") ||
+				!strings.Contains(logs.String(), "partition=0") {
+				t.Errorf("expected a warning for partition 0, got %q", logs.String())
+			}
+		})
+	}
+}
+
+func TestFetchLag_SourceError(t *testing.T) {
+	client := &fakeClient{
+		topic:      "test-topic",
+		partitions: []int{0},
+		endOffsets: map[int]int64{0: 300},
+	}
+	source := &fakeSource{err: errors.New("not loaded")}
+
+	if _, err := newTestFetcher(client, source).FetchLag(context.Background()); err == nil {
+		t.Fatal("expected error when the lag source fails")
+	}
+}
+
+func TestFetchLag_ClassifiesConfigErrors(t *testing.T) {
+	client := &fakeClient{
+		topic:      "test-topic",
+		partitions: []int{0},
+		endOffsets: map[int]int64{0: 300},
+	}
+
+	var configErr *ConfigError
+	source := &fakeSource{err: kafka.GroupAuthorizationFailed}
+	if _, err := newTestFetcher(client, source).FetchLag(context.Background()); !errors.As(err, &configErr) {
+		t.Errorf("expected an authorization failure to be a ConfigError, got %v", err)
+	}
+
+	source = &fakeSource{err: errors.New("connection refused")}
+	if _, err := newTestFetcher(client, source).FetchLag(context.Background()); err == nil || errors.As(err, &configErr) {
+		t.Errorf("expected a connectivity failure not to be a ConfigError, got %v", err)
+	}
+
+	fetcher := newTestFetcher(client, &fakeSource{})
+	fetcher.include = map[int]bool{7: true}
+	if _, err := fetcher.FetchLag(context.Background()); !errors.As(err, &configErr) {
+		t.Errorf("expected unmatched partition filters to be a ConfigError, got %v", err)
+	}
+}
+
+func TestFetchLag_ZeroPartitionTopic(t *testing.T) {
+	client := &fakeClient{topic: "test-topic"}
+	source := &fakeSource{}
+
+	_, err := newTestFetcher(client, source).FetchLag(context.Background())
+	var emptyErr *EmptyTopicError
+	if !errors.As(err, &emptyErr) {
+		t.Fatalf("expected an EmptyTopicError, got %v", err)
+	}
+	var configErr *ConfigError
+	if errors.As(err, &configErr) {
+		t.Error("expected a topic without partitions not to be a ConfigError")
+	}
+	if len(source.calls) != 0 {
+		t.Errorf("expected no committed offsets to be read, got %d calls", len(source.calls))
+	}
+
+	// A topic missing from metadata altogether is still a ConfigError
+	client.topicMissing = true
+	_, err = newTestFetcher(client, source).FetchLag(context.Background())
+	if !errors.As(err, &configErr) || errors.As(err, &emptyErr) {
+		t.Errorf("expected a missing topic to be a ConfigError, got %v", err)
+	}
+}
+
+func TestOffsetFetchSource_CommittedOffsets(t *testing.T) {
+	client := &fakeClient{
+		topic:      "test-topic",
+		partitions: []int{0, 1},
+		committed:  map[int]int64{0: 42},
+	}
+	source := &offsetFetchSource{
+		client:        client,
+		addr:          kafka.TCP("localhost:9092"),
+		topic:         "test-topic",
+		consumerGroup: "test-group",
+	}
+
+	offsets, err := source.CommittedOffsets(context.Background(), []int{0, 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if offsets[0] != 42 {
+		t.Errorf("partition 0 offset = %d, want 42", offsets[0])
+	}
+	if offsets[1] != -1 {
+		t.Errorf("partition 1 offset = %d, want -1", offsets[1])
+	}
+}
+
+func TestFetchLag_OffsetFetchModes(t *testing.T) {
+	tests := []struct {
+		name            string
+		omitUncommitted bool
+		mode            string
+		// uncommittedLag is partition 1's lag, or -1 for no sample
+		uncommittedLag int64
+	}{
+		{"old broker, auto", false, config.OffsetFetchModeAuto, 1000},
+		{"new broker, auto", true, config.OffsetFetchModeAuto, 1000},
+		{"old broker, negative", false, config.OffsetFetchModeNegative, 1000},
+		{"new broker, omitted", true, config.OffsetFetchModeOmitted, 1000},
+		{"old broker, omitted", false, config.OffsetFetchModeOmitted, -1},
+		{"new broker, negative", true, config.OffsetFetchModeNegative, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeClient{
+				topic:           "test-topic",
+				partitions:      []int{0, 1},
+				endOffsets:      map[int]int64{0: 1000, 1: 1000},
+				committed:       map[int]int64{0: 400},
+				omitUncommitted: tt.omitUncommitted,
+			}
+			source := &offsetFetchSource{
+				client:        client,
+				addr:          kafka.TCP("localhost:9092"),
+				topic:         "test-topic",
+				consumerGroup: "test-group",
+				mode:          tt.mode,
+			}
+			f := newTestFetcher(client, source)
+
+			samples, err := f.FetchLag(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			lags := make(map[int]int64)
+			for _, s := range samples {
+				lags[s.Partition] = s.Lag
+			}
+			if lags[0] != 600 {
+				t.Errorf("partition 0 lag = %d, want 600", lags[0])
+			}
+			got, ok := lags[1]
+			if tt.uncommittedLag < 0 {
+				if ok {
+					t.Errorf("expected partition 1 to be skipped, got lag %d", got)
+				}
+			} else if got != tt.uncommittedLag {
+				t.Errorf("partition 1 lag = %d, want %d", got, tt.uncommittedLag)
+			}
+		})
+	}
+}
+
+func TestNewLagFetcher_UsesCredentials(t *testing.T) {
+	cfg := &config.ScalerConfig{
+		BootstrapServers: "localhost:9092",
+		Topic:            "test-topic",
+		ConsumerGroup:    "test-group",
+		LagSource:        config.LagSourceOffsetFetch,
+		SASLMechanism:    config.SASLPlain,
+		SASLUsername:     "scaler",
+		SASLPassword:     "hunter2",
+		TLSEnabled:       true,
+	}
+
+	f, err := NewLagFetcher(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	transport := f.client.(*kafka.Client).Transport.(*kafka.Transport)
+	mechanism, ok := transport.SASL.(plain.Mechanism)
+	if !ok {
+		t.Fatalf("expected plain SASL mechanism, got %T", transport.SASL)
+	}
+	if mechanism.Username != "scaler" || mechanism.Password != "hunter2" {
+		t.Errorf("mechanism built with %q / %q", mechanism.Username, mechanism.Password)
+	}
+	if transport.TLS == nil {
+		t.Error("expected TLS config on transport")
+	}
+}
+
+func TestNewLagFetcher_ReplicationClient(t *testing.T) {
+	cfg := &config.ScalerConfig{
+		BootstrapServers:         "localhost:9092",
+		Topic:                    "orders",
+		LagMode:                  config.LagModeReplication,
+		ReplicationTopic:         "orders",
+		ReplicationBrokers:       "dr-broker:9092",
+		SASLMechanism:            config.SASLPlain,
+		SASLUsername:             "scaler",
+		SASLPassword:             "hunter2",
+		TLSEnabled:               true,
+		ReplicationSASLMechanism: config.SASLPlain,
+		ReplicationSASLUsername:  "mirror",
+		ReplicationSASLPassword:  "swordfish",
+	}
+
+	f, err := NewLagFetcher(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	source := f.client.(*kafka.Client)
+	mirror, ok := f.replica.client.(*kafka.Client)
+	if !ok || mirror == source {
+		t.Fatalf("expected a separate client for the mirror, got %T", f.replica.client)
+	}
+	transport := mirror.Transport.(*kafka.Transport)
+	if transport == source.Transport || f.replica.transport != transport {
+		t.Fatal("expected the mirror's client to have its own transport, released by Close")
+	}
+	if mirror.Addr.String() != "dr-broker:9092" {
+		t.Errorf("mirror client addr = %s", mirror.Addr)
+	}
+	mechanism, ok := transport.SASL.(plain.Mechanism)
+	if !ok || mechanism.Username != "mirror" || mechanism.Password != "swordfish" {
+		t.Errorf("mirror mechanism = %#v", transport.SASL)
+	}
+	if transport.TLS != nil {
+		t.Error("expected plaintext to the mirror")
+	}
+}
+
+func TestNewLagFetcher_NoCredentials(t *testing.T) {
+	f, err := NewLagFetcher(&config.ScalerConfig{
+		BootstrapServers: "localhost:9092",
+		Topic:            "test-topic",
+		ConsumerGroup:    "test-group",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	transport := f.client.(*kafka.Client).Transport.(*kafka.Transport)
+	if transport.SASL != nil || transport.TLS != nil {
+		t.Errorf("expected plaintext transport, got SASL=%v TLS=%v", transport.SASL, transport.TLS)
+	}
+}
+
+func TestNewLagFetcher_InvalidCA(t *testing.T) {
+	_, err := NewLagFetcher(&config.ScalerConfig{
+		BootstrapServers: "localhost:9092",
+		Topic:            "test-topic",
+		ConsumerGroup:    "test-group",
+		TLSEnabled:       true,
+		TLSCA:            "not a pem",
+	})
+	if err == nil {
+		t.Fatal("expected error for invalid CA")
+	}
+}
+
+func TestNewLagFetcher_RegistersAllBrokers(t *testing.T) {
+	f, err := NewLagFetcher(&config.ScalerConfig{
+		BootstrapServers: "broker1:9092, broker2:9092,broker3:9092",
+		Topic:            "test-topic",
+		ConsumerGroup:    "test-group",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := "broker1:9092,broker2:9092,broker3:9092"
+	if got := f.addr.String(); got != want {
+		t.Errorf("fetcher addr = %q, want %q", got, want)
+	}
+	if got := f.client.(*kafka.Client).Addr.String(); got != want {
+		t.Errorf("client addr = %q, want %q", got, want)
+	}
+}
+
+func TestFetchLag_EarliestBasis(t *testing.T) {
+	client := &fakeClient{
+		topic:        "test-topic",
+		partitions:   []int{0, 1},
+		startOffsets: map[int]int64{0: 100, 1: 0},
+		endOffsets:   map[int]int64{0: 1000, 1: 500},
+	}
+	source := &fakeSource{offsets: map[int]int64{0: 900, 1: 500}}
+
+	committed := newTestFetcher(client, source)
+	samples, err := committed.FetchLag(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if samples[0].Lag != 100 || samples[1].Lag != 0 {
+		t.Errorf("committed basis lag = %d/%d, want 100/0", samples[0].Lag, samples[1].Lag)
+	}
+
+	earliest := newTestFetcher(client, source)
+	earliest.lagBasis = config.LagBasisEarliest
+	samples, err = earliest.FetchLag(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if samples[0].Lag != 900 || samples[1].Lag != 500 {
+		t.Errorf("earliest basis lag = %d/%d, want 900/500", samples[0].Lag, samples[1].Lag)
+	}
+	if len(source.calls) != 1 {
+		t.Errorf("expected earliest basis to skip the lag source, got %d calls", len(source.calls))
+	}
+}
+
+func TestFetchLag_PartitionFilters(t *testing.T) {
+	client := &fakeClient{
+		topic:      "test-topic",
+		partitions: []int{0, 1, 2, 3},
+		endOffsets: map[int]int64{0: 100, 1: 200, 2: 300, 3: 400},
+	}
+	source := &fakeSource{offsets: map[int]int64{}}
+
+	f := newTestFetcher(client, source)
+	f.include = partitionSet([]int{1, 2, 3})
+	f.exclude = partitionSet([]int{3})
+
+	samples, err := f.FetchLag(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(samples) != 2 || samples[0].Partition != 1 || samples[1].Partition != 2 {
+		t.Fatalf("expected samples for partitions 1 and 2 only, got %+v", samples)
+	}
+	if got := source.calls[0]; len(got) != 2 || got[0] != 1 || got[1] != 2 {
+		t.Errorf("expected committed offsets requested for included partitions only, got %v", got)
+	}
+}
+
+func TestFetchLag_NoPartitionsMatchFilters(t *testing.T) {
+	client := &fakeClient{
+		topic:      "test-topic",
+		partitions: []int{0, 1},
+		endOffsets: map[int]int64{0: 100, 1: 200},
+	}
+
+	f := newTestFetcher(client, &fakeSource{})
+	f.include = partitionSet([]int{7})
+
+	if _, err := f.FetchLag(context.Background()); err == nil {
+		t.Fatal("expected error when no partition matches the filters")
+	}
+}
+
+func TestPartitions_AppliesFilters(t *testing.T) {
+	client := &fakeClient{topic: "test-topic", partitions: []int{0, 1, 2, 3}}
+	f := newTestFetcher(client, &fakeSource{})
+	f.exclude = partitionSet([]int{2})
+
+	partitions, err := f.Partitions(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []int{0, 1, 3}; !reflect.DeepEqual(partitions, want) {
+		t.Errorf("partitions = %v, want %v", partitions, want)
+	}
+
+	client.metadataErr = errors.New("broker down")
+	if _, err := f.Partitions(context.Background()); err == nil {
+		t.Error("expected an error when metadata can't be fetched")
+	}
+}
+
+func TestFetchLag_MaxPartitions(t *testing.T) {
+	client := &fakeClient{
+		topic:      "test-topic",
+		partitions: []int{0, 1, 2, 3},
+		endOffsets: map[int]int64{0: 100, 1: 200, 2: 300, 3: 400},
+	}
+	source := &fakeSource{offsets: map[int]int64{}}
+
+	f := newTestFetcher(client, source)
+	f.maxPartitions = 3
+	_, err := f.FetchLag(context.Background())
+	var cfgErr *ConfigError
+	if !errors.As(err, &cfgErr) {
+		t.Fatalf("expected a ConfigError for 4 partitions over a cap of 3, got %v", err)
+	}
+	if len(source.calls) != 0 {
+		t.Errorf("expected no committed offsets requested past the cap, got %v", source.calls)
+	}
+
+	// The cap applies after filtering
+	f.exclude = partitionSet([]int{3})
+	samples, err := f.FetchLag(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(samples) != 3 {
+		t.Errorf("expected 3 samples within the cap, got %d", len(samples))
+	}
+}
+
+func TestFetchLag_SkipsPartitionMissingFromOffsets(t *testing.T) {
+	client := &fakeClient{
+		topic:       "test-topic",
+		partitions:  []int{0, 1},
+		endOffsets:  map[int]int64{0: 1000, 1: 500},
+		unavailable: map[int]bool{1: true},
+	}
+	source := &fakeSource{offsets: map[int]int64{0: 400, 1: 100}}
+
+	samples, err := newTestFetcher(client, source).FetchLag(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(samples) != 1 || samples[0].Partition != 0 {
+		t.Fatalf("expected only partition 0 to produce a sample, got %+v", samples)
+	}
+	if got := source.calls[0]; len(got) != 1 || got[0] != 0 {
+		t.Errorf("expected committed offsets requested for partition 0 only, got %v", got)
+	}
+}
+
+func TestFetchLag_FlagsLeaderChange(t *testing.T) {
+	client := &fakeClient{
+		topic:      "test-topic",
+		partitions: []int{0, 1},
+		endOffsets: map[int]int64{0: 1000, 1: 1000},
+		leaders:    map[int]int{0: 1, 1: 2},
+	}
+	f := newTestFetcher(client, &fakeSource{offsets: map[int]int64{0: 400, 1: 400}})
+
+	flagged := func() []int {
+		t.Helper()
+		samples, err := f.FetchLag(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var partitions []int
+		for _, s := range samples {
+			if s.LeaderChanged {
+				partitions = append(partitions, s.Partition)
+			}
+		}
+		return partitions
+	}
+
+	if got := flagged(); len(got) != 0 {
+		t.Errorf("expected no flags on the first scrape, got %v", got)
+	}
+	// Partition 1's leader moves from broker 2 to broker 3
+	client.leaders = map[int]int{0: 1, 1: 3}
+	if got := flagged(); len(got) != 1 || got[0] != 1 {
+		t.Errorf("expected partition 1 flagged after its leader changed, got %v", got)
+	}
+	if got := flagged(); len(got) != 0 {
+		t.Errorf("expected only the first sample after the change flagged, got %v", got)
+	}
+}
+
+func TestFetchLag_FlagsStaleCommit(t *testing.T) {
+	client := &fakeClient{
+		topic:      "test-topic",
+		partitions: []int{0, 1, 2},
+		endOffsets: map[int]int64{0: 1000, 1: 1000, 2: 1000},
+	}
+	source := &fakeSource{offsets: map[int]int64{0: 400, 1: 400, 2: 1000}}
+	f := newTestFetcher(client, source)
+	// Any commit seen on an earlier scrape is old enough
+	f.commitStaleness = time.Nanosecond
+
+	stale := func() []int {
+		t.Helper()
+		samples, err := f.FetchLag(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var partitions []int
+		for _, s := range samples {
+			if s.StaleCommit {
+				partitions = append(partitions, s.Partition)
+			}
+		}
+		return partitions
+	}
+
+	if got := stale(); len(got) != 0 {
+		t.Errorf("expected no flags on the first scrape, got %v", got)
+	}
+	// Partition 1 commits; partition 2 has no lag, so its commit can't
+	// inflate it
+	source.offsets = map[int]int64{0: 400, 1: 700, 2: 1000}
+	if got := stale(); len(got) != 1 || got[0] != 0 {
+		t.Errorf("expected only partition 0 flagged, got %v", got)
+	}
+}
+
+func TestFetchLag_StaleCommitUsesCommitTime(t *testing.T) {
+	client := &fakeClient{
+		topic:      "test-topic",
+		partitions: []int{0, 1, 2},
+		endOffsets: map[int]int64{0: 1000, 1: 1000, 2: 1000},
+	}
+	// Partition 2's commit time isn't known, so it's dated to this scrape
+	source := &timedSource{
+		fakeSource: fakeSource{offsets: map[int]int64{0: 400, 1: 400, 2: 400}},
+		times:      map[int]time.Time{0: time.Now().Add(-time.Hour), 1: time.Now()},
+	}
+	f := newTestFetcher(client, source)
+	f.commitStaleness = 10 * time.Minute
+
+	samples, err := f.FetchLag(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, s := range samples {
+		if want := s.Partition == 0; s.StaleCommit != want {
+			t.Errorf("partition %d: staleCommit %v, want %v on the first scrape", s.Partition, s.StaleCommit, want)
+		}
+	}
+
+	// Partition 2 leaves the measured set and is forgotten
+	f.exclude = map[int]bool{2: true}
+	if _, err := f.FetchLag(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := f.commits[groupPartition{"test-group", 2}]; ok || len(f.commits) != 2 {
+		t.Errorf("expected only partitions 0 and 1 tracked, got %v", f.commits)
+	}
+}
+
+func TestFetchLag_CarriesForwardMissingPartition(t *testing.T) {
+	client := &fakeClient{
+		topic:      "test-topic",
+		partitions: []int{0, 1},
+		endOffsets: map[int]int64{0: 1000, 1: 500},
+	}
+	source := &fakeSource{offsets: map[int]int64{0: 400, 1: 100}}
+
+	f := newTestFetcher(client, source)
+	f.missingOffsets = config.MissingOffsetsCarryForward
+	if _, err := f.FetchLag(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Partition 1's leader goes away on the next scrape
+	client.unavailable = map[int]bool{1: true}
+	client.endOffsets[1] = 0
+	samples, err := f.FetchLag(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(samples) != 2 {
+		t.Fatalf("expected both partitions to produce samples, got %+v", samples)
+	}
+	if samples[1].EndOffset != 500 || samples[1].Lag != 400 {
+		t.Errorf("expected partition 1 carried forward with end offset 500 and lag 400, got %+v", samples[1])
+	}
+}
+
+func TestFetchLag_CarryForwardWithoutHistorySkips(t *testing.T) {
+	client := &fakeClient{
+		topic:       "test-topic",
+		partitions:  []int{0, 1},
+		endOffsets:  map[int]int64{0: 1000},
+		unavailable: map[int]bool{1: true},
+	}
+
+	f := newTestFetcher(client, &fakeSource{offsets: map[int]int64{}})
+	f.missingOffsets = config.MissingOffsetsCarryForward
+	samples, err := f.FetchLag(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(samples) != 1 {
+		t.Errorf("expected a missing partition with no history to be skipped, got %+v", samples)
+	}
+}
+
+func TestFetchLag_SamplePerGroup(t *testing.T) {
+	client := &fakeClient{
+		topic:      "test-topic",
+		partitions: []int{0, 1},
+		endOffsets: map[int]int64{0: 1000, 1: 500},
+	}
+	groupA := &fakeSource{offsets: map[int]int64{0: 700, 1: 450}}
+	groupB := &fakeSource{offsets: map[int]int64{0: 300, 1: 480}}
+
+	f := newTestFetcher(client, nil)
+	f.sources = []groupSource{{group: "group-a", source: groupA}, {group: "group-b", source: groupB}}
+
+	samples, err := f.FetchLag(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(samples) != 4 {
+		t.Fatalf("expected a sample per group and partition, got %d", len(samples))
+	}
+
+	lags := make(map[string]int64)
+	for _, s := range samples {
+		lags[fmt.Sprintf("%s/%d", s.Group, s.Partition)] = s.Lag
+	}
+	want := map[string]int64{"group-a/0": 300, "group-a/1": 50, "group-b/0": 700, "group-b/1": 20}
+	for k, v := range want {
+		if lags[k] != v {
+			t.Errorf("lag for %s = %d, want %d", k, lags[k], v)
+		}
+	}
+}
+
+// waitingClient only answers ListOffsets once asked is closed, failing if
+// that takes too long.
+type waitingClient struct {
+	*fakeClient
+	asked <-chan struct{}
+}
+
+func (c *waitingClient) ListOffsets(ctx context.Context, req *kafka.ListOffsetsRequest) (*kafka.ListOffsetsResponse, error) {
+	select {
+	case <-c.asked:
+	case <-time.After(5 * time.Second):
+		return nil, errors.New("committed offsets were never requested")
+	}
+	return c.fakeClient.ListOffsets(ctx, req)
+}
+
+// askedSource closes asked on its first CommittedOffsets call.
+type askedSource struct {
+	*fakeSource
+	asked chan struct{}
+}
+
+func (s *askedSource) CommittedOffsets(ctx context.Context, partitions []int) (map[int]int64, error) {
+	if len(s.calls) == 0 {
+		close(s.asked)
+	}
+	return s.fakeSource.CommittedOffsets(ctx, partitions)
+}
+
+func TestFetchLag_ConcurrentOffsetRequestsMatchSequential(t *testing.T) {
+	fetch := func(concurrent bool) []lag.LagSample {
+		t.Helper()
+		client := &fakeClient{
+			topic:       "test-topic",
+			partitions:  []int{0, 1, 2},
+			endOffsets:  map[int]int64{0: 1000, 1: 500, 2: 800},
+			unavailable: map[int]bool{2: true},
+			members:     map[string]int{"group-a": 2, "group-b": 1},
+		}
+		f := newTestFetcher(client, nil)
+		f.countMembers = true
+		f.concurrentOffsets = concurrent
+		f.sources = []groupSource{
+			{group: "group-a", source: &fakeSource{offsets: map[int]int64{0: 700, 1: 450, 2: 100}}},
+			{group: "group-b", source: &fakeSource{offsets: map[int]int64{0: 300, 1: 480, 2: 200}}},
+		}
+
+		samples, err := f.FetchLag(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for i := range samples {
+			samples[i].Timestamp = time.Time{}
+		}
+		return samples
+	}
+
+	sequential, concurrent := fetch(false), fetch(true)
+	if len(sequential) != 4 {
+		t.Fatalf("expected a sample per group and available partition, got %+v", sequential)
+	}
+	if !reflect.DeepEqual(concurrent, sequential) {
+		t.Errorf("concurrent samples differ from sequential:\n got %+v\nwant %+v", concurrent, sequential)
+	}
+}
+
+func TestFetchLag_ConcurrentOffsetRequestsOverlap(t *testing.T) {
+	source := &askedSource{fakeSource: &fakeSource{offsets: map[int]int64{0: 400}}, asked: make(chan struct{})}
+	client := &fakeClient{topic: "test-topic", partitions: []int{0}, endOffsets: map[int]int64{0: 1000}}
+	f := newTestFetcher(client, source)
+	f.client = &waitingClient{fakeClient: client, asked: source.asked}
+	f.concurrentOffsets = true
+
+	// ListOffsets only answers once committed offsets have been requested,
+	// which fetching sequentially would never do
+	samples, err := f.FetchLag(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(samples) != 1 || samples[0].Lag != 600 {
+		t.Errorf("expected lag 600 for partition 0, got %+v", samples)
+	}
+}
+
+func TestFetchLag_ReplicationMeasuresMirrorLag(t *testing.T) {
+	source := &fakeClient{
+		topic:      "orders",
+		partitions: []int{0, 1, 2},
+		endOffsets: map[int]int64{0: 1000, 1: 500, 2: 300},
+	}
+	// Partition 2 hasn't been replicated yet
+	mirror := &fakeClient{
+		topic:       "us-east.orders",
+		partitions:  []int{0, 1, 2},
+		endOffsets:  map[int]int64{0: 850, 1: 500, 2: 0},
+		unavailable: map[int]bool{2: true},
+	}
+	f := newTestFetcher(source, nil)
+	f.sources = nil
+	f.replica = &replicaTopic{
+		client: mirror,
+		addr:   kafka.TCP("mirror:9092"),
+		topic:  mirror.topic,
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	samples, err := f.FetchLag(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(samples) != 2 {
+		t.Fatalf("expected partitions 0 and 1 only, got %+v", samples)
+	}
+	want := map[int]struct{ lag, offset, end int64 }{
+		0: {150, 850, 1000},
+		1: {0, 500, 500},
+	}
+	for _, s := range samples {
+		w := want[s.Partition]
+		if s.Lag != w.lag || s.Offset != w.offset || s.EndOffset != w.end || s.Topic != "orders" {
+			t.Errorf("partition %d: got %+v, want lag %d offset %d endOffset %d", s.Partition, s, w.lag, w.offset, w.end)
+		}
+	}
+}
+
+func TestNewLagFetcher_SourcePerGroup(t *testing.T) {
+	f, err := NewLagFetcher(&config.ScalerConfig{
+		BootstrapServers: "localhost:9092",
+		Topic:            "test-topic",
+		ConsumerGroup:    "group-a,group-b",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(f.sources) != 2 || f.sources[0].group != "group-a" || f.sources[1].group != "group-b" {
+		t.Errorf("expected a source per group, got %+v", f.sources)
+	}
+}
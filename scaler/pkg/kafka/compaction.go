@@ -0,0 +1,186 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/lag"
+)
+
+const (
+	// compactionSampleRecords is how many records from the start of a
+	// partition's backlog are read to estimate its compaction ratio.
+	compactionSampleRecords = 100
+	// compactionFetchBytes caps the sampling fetch.
+	compactionFetchBytes = 1 << 20
+)
+
+type compactionRatio struct {
+	ratio     float64
+	sampledAt time.Time
+}
+
+// compactionSampler estimates, per partition, the fraction of offsets that
+// still hold a record after log compaction, from the gaps between the
+// offsets of a run of records at the start of the backlog. A partition is
+// re-sampled once its estimate is older than refresh.
+type compactionSampler struct {
+	client  brokerClient
+	addr    net.Addr
+	topic   string
+	refresh time.Duration
+	ratios  map[int]compactionRatio
+}
+
+func newCompactionSampler(client brokerClient, addr net.Addr, topic string, refresh time.Duration) *compactionSampler {
+	return &compactionSampler{
+		client:  client,
+		addr:    addr,
+		topic:   topic,
+		refresh: refresh,
+		ratios:  make(map[int]compactionRatio),
+	}
+}
+
+// ratio returns partition's compaction ratio, sampling the records from
+// offset on when there's no estimate or it has expired. Until a partition
+// has been measured its ratio is 1. When sampling fails the previous
+// estimate is returned alongside the error.
+func (c *compactionSampler) ratio(ctx context.Context, partition int, offset, endOffset int64, now time.Time) (float64, error) {
+	cached, ok := c.ratios[partition]
+	if ok && now.Sub(cached.sampledAt) < c.refresh {
+		return cached.ratio, nil
+	}
+	if !ok {
+		cached.ratio = 1
+	}
+
+	ratio, ok, err := c.sample(ctx, partition, offset, endOffset)
+	if err != nil {
+		return cached.ratio, err
+	}
+	if !ok {
+		// Too few records to measure; keep any earlier estimate
+		return cached.ratio, nil
+	}
+	c.ratios[partition] = compactionRatio{ratio: ratio, sampledAt: now}
+	return ratio, nil
+}
+
+// sample reads up to compactionSampleRecords records between offset and
+// endOffset and returns how many records there are per offset spanned. It
+// needs at least two records to measure a span.
+func (c *compactionSampler) sample(ctx context.Context, partition int, offset, endOffset int64) (float64, bool, error) {
+	resp, err := c.client.Fetch(ctx, &kafka.FetchRequest{
+		Addr:      c.addr,
+		Topic:     c.topic,
+		Partition: partition,
+		Offset:    offset,
+		MaxBytes:  compactionFetchBytes,
+	})
+	if err != nil {
+		return 0, false, fmt.Errorf("fetch records of partition %d: %w", partition, err)
+	}
+	if resp.Error != nil {
+		return 0, false, fmt.Errorf("fetch records of partition %d: %w", partition, resp.Error)
+	}
+	if resp.Records == nil {
+		return 0, false, nil
+	}
+	if rc, ok := resp.Records.(io.Closer); ok {
+		defer rc.Close()
+	}
+
+	first, last := int64(-1), int64(-1)
+	n := 0
+	for n < compactionSampleRecords {
+		rec, err := resp.Records.ReadRecord()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return 0, false, fmt.Errorf("read records of partition %d: %w", partition, err)
+		}
+		// Batches may start before the requested offset
+		if rec.Offset < offset {
+			continue
+		}
+		if rec.Offset >= endOffset {
+			break
+		}
+		if first < 0 {
+			first = rec.Offset
+		}
+		last = rec.Offset
+		n++
+	}
+	if n < 2 {
+		return 0, false, nil
+	}
+	return float64(n-1) / float64(last-first), true, nil
+}
+
+// discountCompaction scales each lagging sample's Lag by its partition's
+// compaction ratio, so lag counts the records left to consume rather than
+// the offsets between them.
+func (f *LagFetcher) discountCompaction(ctx context.Context, samples []lag.LagSample, now time.Time) {
+	if f.compaction == nil {
+		return
+	}
+	for i := range samples {
+		s := &samples[i]
+		if s.Lag <= 0 {
+			continue
+		}
+		ratio, err := f.compaction.ratio(ctx, s.Partition, s.Offset, s.EndOffset, now)
+		if err != nil {
+			f.logger.Warn("Failed to sample compaction ratio", "topic", f.topic, "partition", s.Partition, "error", err)
+		}
+		s.Lag = int64(math.Round(float64(s.Lag) * ratio))
+	}
+}
+
+// checkCleanupPolicy warns, once, when the topic is log-compacted but lag
+// isn't being discounted for it, since end offset minus committed offset
+// then overstates the work left. Failing to read the topic's config is only
+// logged: the check is advisory.
+func (f *LagFetcher) checkCleanupPolicy(ctx context.Context) {
+	if f.cleanupPolicyChecked {
+		return
+	}
+	f.cleanupPolicyChecked = true
+
+	resp, err := f.client.DescribeConfigs(ctx, &kafka.DescribeConfigsRequest{
+		Addr: f.addr,
+		Resources: []kafka.DescribeConfigRequestResource{{
+			ResourceType: kafka.ResourceTypeTopic,
+			ResourceName: f.topic,
+			ConfigNames:  []string{"cleanup.policy"},
+		}},
+	})
+	if err != nil {
+		f.logger.Debug("Failed to describe topic config", "topic", f.topic, "error", err)
+		return
+	}
+
+	for _, res := range resp.Resources {
+		if res.Error != nil {
+			f.logger.Debug("Failed to describe topic config", "topic", f.topic, "error", res.Error)
+			continue
+		}
+		for _, entry := range res.ConfigEntries {
+			if entry.ConfigName == "cleanup.policy" && strings.Contains(entry.ConfigValue, "compact") && f.compaction == nil {
+				f.logger.Warn("Topic is log-compacted, so lag counts offsets that compaction removed and may be overstated; set compactedTopic to discount it",
+					"topic", f.topic, "cleanupPolicy", entry.ConfigValue)
+			}
+		}
+	}
+}
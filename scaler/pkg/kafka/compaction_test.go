@@ -0,0 +1,118 @@
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFetchLag_DiscountsCompaction(t *testing.T) {
+	client := &fakeClient{
+		topic:      "test-topic",
+		partitions: []int{0, 1},
+		endOffsets: map[int]int64{0: 2000, 1: 2000},
+		// A quarter of partition 0's offsets survived compaction;
+		// partition 1 isn't compacted
+		compactEvery: map[int]int64{0: 4},
+	}
+	source := &fakeSource{offsets: map[int]int64{0: 1000, 1: 1000}}
+	f := newTestFetcher(client, source)
+	f.compaction = newCompactionSampler(client, f.addr, client.topic, time.Minute)
+
+	samples, err := f.FetchLag(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if samples[0].Lag != 250 {
+		t.Errorf("partition 0 lag = %d, want 250", samples[0].Lag)
+	}
+	if samples[1].Lag != 1000 {
+		t.Errorf("partition 1 lag = %d, want 1000", samples[1].Lag)
+	}
+	// The raw offsets stay as reported
+	if samples[0].EndOffset-samples[0].Offset != 1000 {
+		t.Errorf("unexpected offsets: %+v", samples[0])
+	}
+}
+
+func TestCompactionSampler_Refresh(t *testing.T) {
+	client := &fakeClient{
+		topic:        "test-topic",
+		endOffsets:   map[int]int64{0: 2000},
+		compactEvery: map[int]int64{0: 2},
+	}
+	sampler := newCompactionSampler(client, nil, "test-topic", time.Minute)
+
+	now := time.Now()
+	if r, _ := sampler.ratio(context.Background(), 0, 0, 2000, now); r != 0.5 {
+		t.Fatalf("ratio = %g, want 0.5", r)
+	}
+	client.compactEvery[0] = 10
+
+	if r, _ := sampler.ratio(context.Background(), 0, 0, 2000, now.Add(30*time.Second)); r != 0.5 {
+		t.Errorf("expected cached ratio 0.5 within refresh, got %g", r)
+	}
+	if r, _ := sampler.ratio(context.Background(), 0, 0, 2000, now.Add(time.Minute)); r != 0.1 {
+		t.Errorf("expected re-sampled ratio 0.1 after refresh, got %g", r)
+	}
+}
+
+func TestCompactionSampler_TooFewRecords(t *testing.T) {
+	client := &fakeClient{
+		topic:        "test-topic",
+		endOffsets:   map[int]int64{0: 100},
+		compactEvery: map[int]int64{0: 64},
+	}
+	sampler := newCompactionSampler(client, nil, "test-topic", time.Minute)
+
+	// Only offset 64 is left past offset 10: no span to measure
+	if r, err := sampler.ratio(context.Background(), 0, 10, 100, time.Now()); err != nil || r != 1 {
+		t.Errorf("ratio = %g (err %v), want 1 until measured", r, err)
+	}
+}
+
+func TestCheckCleanupPolicy_WarnsOnceWhenCompacted(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   string
+		discount bool
+		wantWarn bool
+	}{
+		{"delete", "delete", false, false},
+		{"compacted", "compact", false, true},
+		{"compact and delete", "compact,delete", false, true},
+		{"compacted and discounted", "compact", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeClient{
+				topic:         "test-topic",
+				partitions:    []int{0},
+				endOffsets:    map[int]int64{0: 100},
+				cleanupPolicy: tt.policy,
+			}
+			f := newTestFetcher(client, &fakeSource{offsets: map[int]int64{0: 100}})
+			if tt.discount {
+				f.compaction = newCompactionSampler(client, f.addr, client.topic, time.Minute)
+			}
+			var buf bytes.Buffer
+			f.logger = slog.New(slog.NewTextHandler(&buf, nil))
+
+			for range 2 {
+				if _, err := f.FetchLag(context.Background()); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+			if client.describeConfigCalls != 1 {
+				t.Errorf("expected the policy to be checked once, got %d calls", client.describeConfigCalls)
+			}
+			warnings := strings.Count(buf.String(), "log-compacted")
+			if want := map[bool]int{true: 1, false: 0}[tt.wantWarn]; warnings != want {
+				t.Errorf("got %d warnings, want %d; log:\n%s", warnings, want, buf.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,337 @@
+package kafka
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+	"unicode/utf16"
+
+	"github.com/segmentio/kafka-go"
+
+	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/logging"
+)
+
+const consumerOffsetsTopic = "__consumer_offsets"
+
+// offsetsReader is the part of kafka.Reader the consumer offsets tail uses.
+type offsetsReader interface {
+	SetOffset(offset int64) error
+	ReadLag(ctx context.Context) (int64, error)
+	ReadMessage(ctx context.Context) (kafka.Message, error)
+	Lag() int64
+	Close() error
+}
+
+// consumerOffsetsSource tails the __consumer_offsets partition that holds the
+// tracked group's commits and serves committed offsets from memory, so a
+// scrape never has to wait on an OffsetFetch round-trip.
+type consumerOffsetsSource struct {
+	client        brokerClient
+	addr          net.Addr
+	dialer        *kafka.Dialer
+	brokers       []string
+	topic         string
+	consumerGroup string
+	logger        *slog.Logger
+	// newReader opens the tail's reader; kafka.NewReader outside tests.
+	newReader func(kafka.ReaderConfig) offsetsReader
+
+	// stop cancels the tail, which closes done once its reader is closed.
+	stop context.CancelFunc
+	ctx  context.Context
+	done chan struct{}
+
+	startOnce   sync.Once
+	mu          sync.RWMutex
+	offsets     map[int]int64
+	commitTimes map[int]time.Time
+	loaded      bool
+	err         error
+}
+
+func newConsumerOffsetsSource(client brokerClient, addr net.Addr, dialer *kafka.Dialer, brokers []string, topic, consumerGroup string) *consumerOffsetsSource {
+	ctx, stop := context.WithCancel(context.Background())
+	return &consumerOffsetsSource{
+		client:        client,
+		addr:          addr,
+		dialer:        dialer,
+		brokers:       brokers,
+		topic:         topic,
+		consumerGroup: consumerGroup,
+		logger:        logging.Component("kafka"),
+		newReader: func(cfg kafka.ReaderConfig) offsetsReader {
+			return kafka.NewReader(cfg)
+		},
+		stop:        stop,
+		ctx:         ctx,
+		done:        make(chan struct{}),
+		offsets:     make(map[int]int64),
+		commitTimes: make(map[int]time.Time),
+	}
+}
+
+func (s *consumerOffsetsSource) CommittedOffsets(ctx context.Context, partitions []int) (map[int]int64, error) {
+	s.startOnce.Do(func() {
+		go func() {
+			defer close(s.done)
+			s.run(s.ctx)
+		}()
+	})
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.err != nil {
+		return nil, fmt.Errorf("consumer offsets tail failed: %w", s.err)
+	}
+	if !s.loaded {
+		return nil, errors.New("consumer offsets not loaded yet")
+	}
+
+	out := make(map[int]int64, len(partitions))
+	for _, p := range partitions {
+		if offset, ok := s.offsets[p]; ok {
+			out[p] = offset
+		}
+	}
+	return out, nil
+}
+
+// CommitTimes returns when each of partitions' offsets was committed, from
+// the commit timestamp in its OffsetCommit value. Partitions without one are
+// left out.
+func (s *consumerOffsetsSource) CommitTimes(partitions []int) map[int]time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make(map[int]time.Time, len(partitions))
+	for _, p := range partitions {
+		if t, ok := s.commitTimes[p]; ok {
+			out[p] = t
+		}
+	}
+	return out
+}
+
+// Close stops the tail and waits for its reader to close. A source never
+// queried has no tail and won't start one afterwards.
+func (s *consumerOffsetsSource) Close() error {
+	s.stop()
+	s.startOnce.Do(func() {
+		close(s.done)
+	})
+	<-s.done
+	return nil
+}
+
+func (s *consumerOffsetsSource) run(ctx context.Context) {
+	partition, err := s.groupPartition(ctx)
+	if err != nil {
+		s.fail(err)
+		return
+	}
+
+	reader := s.newReader(kafka.ReaderConfig{
+		Brokers:   s.brokers,
+		Topic:     consumerOffsetsTopic,
+		Partition: partition,
+		Dialer:    s.dialer,
+		MaxWait:   time.Second,
+	})
+	defer reader.Close()
+
+	if err := reader.SetOffset(kafka.FirstOffset); err != nil {
+		s.fail(err)
+		return
+	}
+
+	lagAtStart, err := reader.ReadLag(ctx)
+	if err != nil {
+		s.fail(err)
+		return
+	}
+	if lagAtStart == 0 {
+		s.markLoaded()
+	}
+
+	s.logger.Info("Tailing consumer offsets", "topic", consumerOffsetsTopic, "partition", partition, "group", s.consumerGroup)
+	for {
+		msg, err := reader.ReadMessage(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				s.fail(err)
+			}
+			return
+		}
+
+		s.apply(msg.Key, msg.Value)
+		if reader.Lag() == 0 {
+			s.markLoaded()
+		}
+	}
+}
+
+// groupPartition returns the __consumer_offsets partition the broker uses for
+// the tracked group, mirroring the broker's abs(hashCode) % partitions.
+func (s *consumerOffsetsSource) groupPartition(ctx context.Context) (int, error) {
+	resp, err := s.client.Metadata(ctx, &kafka.MetadataRequest{
+		Addr:   s.addr,
+		Topics: []string{consumerOffsetsTopic},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("metadata request for %s failed: %w", consumerOffsetsTopic, err)
+	}
+	if len(resp.Topics) == 0 || len(resp.Topics[0].Partitions) == 0 {
+		return 0, fmt.Errorf("topic %s not found", consumerOffsetsTopic)
+	}
+	return groupPartitionFor(s.consumerGroup, len(resp.Topics[0].Partitions)), nil
+}
+
+func (s *consumerOffsetsSource) apply(key, value []byte) {
+	group, topic, partition, ok := decodeOffsetCommitKey(key)
+	if !ok || group != s.consumerGroup || topic != s.topic {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// A nil value is a tombstone for an expired or deleted commit
+	if value == nil {
+		delete(s.offsets, partition)
+		delete(s.commitTimes, partition)
+		return
+	}
+	if offset, ok := decodeOffsetCommitValue(value); ok {
+		s.offsets[partition] = offset
+	}
+	if t, ok := decodeOffsetCommitTime(value); ok {
+		s.commitTimes[partition] = t
+	} else {
+		delete(s.commitTimes, partition)
+	}
+}
+
+func (s *consumerOffsetsSource) markLoaded() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loaded = true
+}
+
+func (s *consumerOffsetsSource) fail(err error) {
+	s.logger.Error("Error tailing consumer offsets", "topic", consumerOffsetsTopic, "error", err)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+func groupPartitionFor(group string, partitions int) int {
+	var h int32
+	for _, c := range utf16.Encode([]rune(group)) {
+		h = 31*h + int32(c)
+	}
+	if h == -1<<31 {
+		h = 0
+	} else if h < 0 {
+		h = -h
+	}
+	return int(h) % partitions
+}
+
+// decodeOffsetCommitKey parses an OffsetCommit key (versions 0 and 1):
+// version int16, group string, topic string, partition int32. Group metadata
+// keys (version 2) are reported as not ok.
+func decodeOffsetCommitKey(b []byte) (group, topic string, partition int, ok bool) {
+	if len(b) < 2 {
+		return "", "", 0, false
+	}
+	version := int16(binary.BigEndian.Uint16(b))
+	if version != 0 && version != 1 {
+		return "", "", 0, false
+	}
+	b = b[2:]
+
+	group, b, ok = readString(b)
+	if !ok {
+		return "", "", 0, false
+	}
+	topic, b, ok = readString(b)
+	if !ok || len(b) < 4 {
+		return "", "", 0, false
+	}
+	return group, topic, int(int32(binary.BigEndian.Uint32(b))), true
+}
+
+// decodeOffsetCommitValue extracts the committed offset, which directly
+// follows the int16 version in every OffsetCommit value version.
+func decodeOffsetCommitValue(b []byte) (int64, bool) {
+	if len(b) < 10 {
+		return 0, false
+	}
+	return int64(binary.BigEndian.Uint64(b[2:])), true
+}
+
+// decodeOffsetCommitTime extracts the commit timestamp of an OffsetCommit
+// value: after the offset, versions 0 to 2 hold the metadata string, 3 a
+// leader epoch and then the metadata, and 4 the same with the metadata as a
+// compact string. Later versions are reported as not ok.
+func decodeOffsetCommitTime(b []byte) (time.Time, bool) {
+	if len(b) < 10 {
+		return time.Time{}, false
+	}
+	version := int16(binary.BigEndian.Uint16(b))
+	b = b[10:]
+
+	var ok bool
+	switch version {
+	case 0, 1, 2:
+		_, b, ok = readString(b)
+	case 3:
+		if len(b) < 4 {
+			return time.Time{}, false
+		}
+		_, b, ok = readString(b[4:])
+	case 4:
+		if len(b) < 4 {
+			return time.Time{}, false
+		}
+		_, b, ok = readCompactString(b[4:])
+	}
+	if !ok || len(b) < 8 {
+		return time.Time{}, false
+	}
+	millis := int64(binary.BigEndian.Uint64(b))
+	if millis <= 0 {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(millis), true
+}
+
+func readCompactString(b []byte) (string, []byte, bool) {
+	n, size := binary.Uvarint(b)
+	if size <= 0 || n == 0 {
+		return "", nil, false
+	}
+	b = b[size:]
+	if uint64(len(b)) < n-1 {
+		return "", nil, false
+	}
+	return string(b[:n-1]), b[n-1:], true
+}
+
+func readString(b []byte) (string, []byte, bool) {
+	if len(b) < 2 {
+		return "", nil, false
+	}
+	n := int(int16(binary.BigEndian.Uint16(b)))
+	b = b[2:]
+	if n < 0 || len(b) < n {
+		return "", nil, false
+	}
+	return string(b[:n]), b[n:], true
+}
@@ -0,0 +1,196 @@
+package kafka
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func encodeOffsetCommitKey(group, topic string, partition int) []byte {
+	b := binary.BigEndian.AppendUint16(nil, 1)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(group)))
+	b = append(b, group...)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(topic)))
+	b = append(b, topic...)
+	return binary.BigEndian.AppendUint32(b, uint32(partition))
+}
+
+func encodeOffsetCommitValue(offset int64) []byte {
+	return encodeOffsetCommitValueAt(offset, time.Time{})
+}
+
+// encodeOffsetCommitValueAt encodes a version 3 value committed at at, or
+// with a zero commit timestamp when at is zero.
+func encodeOffsetCommitValueAt(offset int64, at time.Time) []byte {
+	var millis int64
+	if !at.IsZero() {
+		millis = at.UnixMilli()
+	}
+	b := binary.BigEndian.AppendUint16(nil, 3)
+	b = binary.BigEndian.AppendUint64(b, uint64(offset))
+	b = binary.BigEndian.AppendUint32(b, 0)                 // leader epoch
+	b = binary.BigEndian.AppendUint16(b, 0)                 // metadata
+	return binary.BigEndian.AppendUint64(b, uint64(millis)) // commit timestamp
+}
+
+func TestDecodeOffsetCommitTime(t *testing.T) {
+	at := time.UnixMilli(1700000000123)
+	millis := binary.BigEndian.AppendUint64(nil, uint64(at.UnixMilli()))
+	head := func(version int16) []byte {
+		b := binary.BigEndian.AppendUint16(nil, uint16(version))
+		return binary.BigEndian.AppendUint64(b, 42)
+	}
+
+	tests := []struct {
+		name  string
+		value []byte
+		ok    bool
+	}{
+		// Expire timestamp follows in version 1
+		{"v1", append(append(append(head(1), 0, 2, 'm', 'd'), millis...), millis...), true},
+		{"v3", encodeOffsetCommitValueAt(42, at), true},
+		// Leader epoch, compact metadata "md", then tagged fields
+		{"v4", append(append(append(head(4), 0, 0, 0, 1, 3, 'm', 'd'), millis...), 0), true},
+		{"zero timestamp", encodeOffsetCommitValue(42), false},
+		{"unknown version", append(head(9), millis...), false},
+		{"truncated", head(3), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := decodeOffsetCommitTime(tt.value)
+			if ok != tt.ok || (ok && !got.Equal(at)) {
+				t.Errorf("got %s, %v, want %s, %v", got, ok, at, tt.ok)
+			}
+		})
+	}
+}
+
+func TestGroupPartitionFor(t *testing.T) {
+	// "a".hashCode() == 97 on the broker
+	if p := groupPartitionFor("a", 50); p != 47 {
+		t.Errorf("expected partition 47, got %d", p)
+	}
+	// "polygenelubricants".hashCode() == Integer.MIN_VALUE, which abs maps to 0
+	if p := groupPartitionFor("polygenelubricants", 50); p != 0 {
+		t.Errorf("expected partition 0, got %d", p)
+	}
+}
+
+func TestDecodeOffsetCommitKey(t *testing.T) {
+	group, topic, partition, ok := decodeOffsetCommitKey(encodeOffsetCommitKey("my-group", "orders", 7))
+	if !ok {
+		t.Fatal("expected key to decode")
+	}
+	if group != "my-group" || topic != "orders" || partition != 7 {
+		t.Errorf("decoded (%s, %s, %d)", group, topic, partition)
+	}
+
+	// Group metadata keys use version 2 and must be ignored
+	metadataKey := binary.BigEndian.AppendUint16(nil, 2)
+	if _, _, _, ok := decodeOffsetCommitKey(metadataKey); ok {
+		t.Error("expected group metadata key to be rejected")
+	}
+}
+
+func TestConsumerOffsetsSource_Apply(t *testing.T) {
+	s := newConsumerOffsetsSource(nil, nil, nil, nil, "orders", "my-group")
+	s.loaded = true
+	// Keep CommittedOffsets from starting the tail goroutine
+	s.startOnce.Do(func() {})
+
+	s.apply(encodeOffsetCommitKey("my-group", "orders", 0), encodeOffsetCommitValue(100))
+	s.apply(encodeOffsetCommitKey("my-group", "orders", 1), encodeOffsetCommitValue(200))
+	s.apply(encodeOffsetCommitKey("my-group", "orders", 0), encodeOffsetCommitValue(150))
+	s.apply(encodeOffsetCommitKey("other-group", "orders", 2), encodeOffsetCommitValue(999))
+	s.apply(encodeOffsetCommitKey("my-group", "orders", 1), nil) // tombstone
+
+	offsets, err := s.CommittedOffsets(context.Background(), []int{0, 1, 2})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(offsets) != 1 || offsets[0] != 150 {
+		t.Errorf("expected only partition 0 at 150, got %v", offsets)
+	}
+}
+
+func TestConsumerOffsetsSource_CommitTimes(t *testing.T) {
+	s := newConsumerOffsetsSource(nil, nil, nil, nil, "orders", "my-group")
+	at := time.UnixMilli(1700000000000)
+
+	s.apply(encodeOffsetCommitKey("my-group", "orders", 0), encodeOffsetCommitValueAt(100, at))
+	s.apply(encodeOffsetCommitKey("my-group", "orders", 1), encodeOffsetCommitValueAt(200, at))
+	s.apply(encodeOffsetCommitKey("my-group", "orders", 2), encodeOffsetCommitValue(300))
+	s.apply(encodeOffsetCommitKey("my-group", "orders", 1), nil) // tombstone
+
+	times := s.CommitTimes([]int{0, 1, 2})
+	if len(times) != 1 || !times[0].Equal(at) {
+		t.Errorf("expected only partition 0 committed at %s, got %v", at, times)
+	}
+}
+
+// fakeOffsetsReader is caught up and waits for messages until its context
+// ends.
+type fakeOffsetsReader struct {
+	closed bool
+}
+
+func (r *fakeOffsetsReader) SetOffset(offset int64) error               { return nil }
+func (r *fakeOffsetsReader) ReadLag(ctx context.Context) (int64, error) { return 0, nil }
+func (r *fakeOffsetsReader) Lag() int64                                 { return 0 }
+
+func (r *fakeOffsetsReader) ReadMessage(ctx context.Context) (kafka.Message, error) {
+	<-ctx.Done()
+	return kafka.Message{}, ctx.Err()
+}
+
+func (r *fakeOffsetsReader) Close() error {
+	r.closed = true
+	return nil
+}
+
+func TestConsumerOffsetsSource_CloseStopsTail(t *testing.T) {
+	client := &fakeClient{topic: consumerOffsetsTopic, partitions: []int{0}}
+	s := newConsumerOffsetsSource(client, nil, nil, nil, "orders", "my-group")
+	reader := &fakeOffsetsReader{}
+	opened := make(chan struct{})
+	s.newReader = func(kafka.ReaderConfig) offsetsReader {
+		close(opened)
+		return reader
+	}
+
+	f := newTestFetcher(&fakeClient{topic: "orders"}, s)
+	s.CommittedOffsets(context.Background(), []int{0})
+	<-opened
+
+	if err := f.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reader.closed {
+		t.Error("expected closing the fetcher to close the consumer offsets reader")
+	}
+}
+
+func TestConsumerOffsetsSource_CloseBeforeQueried(t *testing.T) {
+	s := newConsumerOffsetsSource(nil, nil, nil, nil, "orders", "my-group")
+	s.newReader = func(kafka.ReaderConfig) offsetsReader {
+		t.Error("expected no tail to start after Close")
+		return &fakeOffsetsReader{}
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s.CommittedOffsets(context.Background(), []int{0})
+}
+
+func TestConsumerOffsetsSource_NotLoaded(t *testing.T) {
+	s := newConsumerOffsetsSource(nil, nil, nil, nil, "orders", "my-group")
+	s.startOnce.Do(func() {})
+
+	if _, err := s.CommittedOffsets(context.Background(), []int{0}); err == nil {
+		t.Fatal("expected error before the tail has caught up")
+	}
+}
@@ -0,0 +1,87 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// refreshGroups re-resolves the tracked groups from groupPattern once
+// groupRefresh has passed since they were last listed. Sources of groups that
+// still match are kept. If listing fails after groups were resolved before,
+// the previous set stays in use so a broker hiccup doesn't fail the scrape.
+func (f *LagFetcher) refreshGroups(ctx context.Context, now time.Time) error {
+	if f.groupPattern == nil {
+		return nil
+	}
+	if !f.groupsListedAt.IsZero() && now.Sub(f.groupsListedAt) < f.groupRefresh {
+		return nil
+	}
+
+	groups, err := f.matchingGroups(ctx)
+	if err != nil {
+		if len(f.sources) > 0 {
+			f.logger.Warn("Failed to list consumer groups, keeping the previous set", "topic", f.topic, "error", err)
+			return nil
+		}
+		return err
+	}
+	f.groupsListedAt = now
+
+	existing := make(map[string]LagSource, len(f.sources))
+	for _, gs := range f.sources {
+		existing[gs.group] = gs.source
+	}
+
+	sources := make([]groupSource, 0, len(groups))
+	changed := len(groups) != len(f.sources)
+	for _, group := range groups {
+		source, ok := existing[group]
+		if !ok {
+			source = f.newSource(group)
+			changed = true
+		}
+		delete(existing, group)
+		sources = append(sources, groupSource{group: group, source: source})
+	}
+	for _, source := range existing {
+		closeSource(source)
+	}
+	f.sources = sources
+
+	if changed {
+		f.logger.Info("Consumer groups matching pattern changed",
+			"topic", f.topic,
+			"pattern", f.groupPattern.String(),
+			"groups", groups,
+		)
+	}
+	return nil
+}
+
+// matchingGroups lists the cluster's consumer groups and returns those
+// matching groupPattern, sorted by name.
+func (f *LagFetcher) matchingGroups(ctx context.Context) ([]string, error) {
+	resp, err := f.client.ListGroups(ctx, &kafka.ListGroupsRequest{Addr: f.addr})
+	if err != nil {
+		return nil, fmt.Errorf("list groups failed: %w", err)
+	}
+	if resp.Error != nil {
+		return nil, classify(fmt.Errorf("list groups error: %w", resp.Error))
+	}
+
+	var groups []string
+	for _, g := range resp.Groups {
+		if f.groupPattern.MatchString(g.GroupID) {
+			groups = append(groups, g.GroupID)
+		}
+	}
+	if len(groups) == 0 {
+		return nil, fmt.Errorf("no consumer groups match %q", f.groupPattern.String())
+	}
+	slices.Sort(groups)
+	return groups, nil
+}
@@ -0,0 +1,85 @@
+package kafka
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestFetchLag_GroupPattern(t *testing.T) {
+	client := &fakeClient{
+		topic:      "test-topic",
+		partitions: []int{0},
+		endOffsets: map[int]int64{0: 1000},
+		groups:     []string{"orders-7f9c", "payments-1", "orders-2b1a", "orders"},
+	}
+
+	created := make(map[string]int)
+	sources := make(map[string]*fakeSource)
+	fetcher := newTestFetcher(client, nil)
+	fetcher.sources = nil
+	fetcher.groupPattern = regexp.MustCompile(`^orders-`)
+	fetcher.groupRefresh = time.Minute
+	fetcher.newSource = func(group string) LagSource {
+		created[group]++
+		sources[group] = &fakeSource{offsets: map[int]int64{0: 400}}
+		return sources[group]
+	}
+
+	samples, err := fetcher.FetchLag(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var groups []string
+	for _, s := range samples {
+		groups = append(groups, s.Group)
+	}
+	if !slices.Equal(groups, []string{"orders-2b1a", "orders-7f9c"}) {
+		t.Errorf("expected samples for the matching groups only, got %v", groups)
+	}
+
+	// Within the refresh interval the matched set is reused
+	client.groups = []string{"orders-7f9c", "orders-d00d"}
+	if _, err := fetcher.FetchLag(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if client.listCalls != 1 {
+		t.Errorf("expected groups to be listed once within the refresh interval, got %d", client.listCalls)
+	}
+
+	// Once it passes, new groups are picked up and retained ones keep their
+	// source
+	fetcher.groupsListedAt = fetcher.groupsListedAt.Add(-time.Minute)
+	samples, err = fetcher.FetchLag(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(samples) != 2 || samples[0].Group != "orders-7f9c" || samples[1].Group != "orders-d00d" {
+		t.Errorf("expected samples for the re-listed groups, got %+v", samples)
+	}
+	if created["orders-7f9c"] != 1 || created["orders-d00d"] != 1 {
+		t.Errorf("expected one source per group, created %v", created)
+	}
+	if sources["orders-2b1a"].closes != 1 || sources["orders-7f9c"].closes != 0 {
+		t.Error("expected only the dropped group's source to be closed")
+	}
+}
+
+func TestFetchLag_GroupPatternNoMatch(t *testing.T) {
+	client := &fakeClient{
+		topic:      "test-topic",
+		partitions: []int{0},
+		endOffsets: map[int]int64{0: 1000},
+		groups:     []string{"payments-1"},
+	}
+	fetcher := newTestFetcher(client, nil)
+	fetcher.sources = nil
+	fetcher.groupPattern = regexp.MustCompile(`^orders-`)
+	fetcher.newSource = func(group string) LagSource { return &fakeSource{} }
+
+	if _, err := fetcher.FetchLag(context.Background()); err == nil {
+		t.Fatal("expected an error when no group matches the pattern")
+	}
+}
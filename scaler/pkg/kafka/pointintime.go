@@ -0,0 +1,117 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/lag"
+)
+
+// FetchLagAt measures lag against the point in time at, for correlating lag
+// with a known incident: each sample's EndOffset is the partition's end offset
+// as of at, resolved with ListOffsets by timestamp, and its Lag how many of
+// the records produced before at each group has yet to consume. Kafka keeps
+// no history of committed offsets, so Offset is the group's current one. A
+// group that has consumed past at has a Lag of 0. Samples are timestamped at.
+func (f *LagFetcher) FetchLagAt(ctx context.Context, at time.Time) ([]lag.LagSample, error) {
+	if f.replica != nil {
+		return nil, &ConfigError{Err: fmt.Errorf("point-in-time lag isn't supported in replication lag mode")}
+	}
+	partitions, err := f.measuredPartitions(ctx, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	// Requested apart from the end offsets, as a request may list each
+	// partition only once
+	timeRequests := make([]kafka.OffsetRequest, 0, len(partitions))
+	endRequests := make([]kafka.OffsetRequest, 0, len(partitions))
+	for _, p := range partitions {
+		timeRequests = append(timeRequests, kafka.TimeOffsetOf(p.ID, at))
+		endRequests = append(endRequests, kafka.LastOffsetOf(p.ID))
+	}
+	timeResp, err := f.client.ListOffsets(ctx, &kafka.ListOffsetsRequest{
+		Addr:           f.addr,
+		Topics:         map[string][]kafka.OffsetRequest{f.topic: timeRequests},
+		IsolationLevel: f.isolationLevel,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list offsets by timestamp failed: %w", err)
+	}
+	endResp, err := f.client.ListOffsets(ctx, &kafka.ListOffsetsRequest{
+		Addr:           f.addr,
+		Topics:         map[string][]kafka.OffsetRequest{f.topic: endRequests},
+		IsolationLevel: f.isolationLevel,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list offsets failed: %w", err)
+	}
+
+	endOffsets := make(map[int]int64)
+	for _, po := range endResp.Topics[f.topic] {
+		if po.Error != nil {
+			return nil, fmt.Errorf("offset error for partition %d: %w", po.Partition, po.Error)
+		}
+		endOffsets[po.Partition] = po.LastOffset
+	}
+	offsetsAt := make(map[int]int64)
+	for _, po := range timeResp.Topics[f.topic] {
+		if po.Error != nil {
+			return nil, fmt.Errorf("offset error for partition %d at %s: %w", po.Partition, at, po.Error)
+		}
+		end, ok := endOffsets[po.Partition]
+		if !ok {
+			continue
+		}
+		// The first offset whose record is at or after at is where the log
+		// ended at that time; with no such record, at is after the newest
+		// one and the log still ends where it did then
+		offsetsAt[po.Partition] = end
+		for offset := range po.Offsets {
+			if offset >= 0 && offset < end {
+				offsetsAt[po.Partition] = offset
+			}
+		}
+	}
+
+	partitionIDs := make([]int, 0, len(partitions))
+	for _, p := range partitions {
+		if _, ok := offsetsAt[p.ID]; ok {
+			partitionIDs = append(partitionIDs, p.ID)
+		}
+	}
+	if len(partitionIDs) == 0 {
+		return nil, fmt.Errorf("no offsets returned for topic %s", f.topic)
+	}
+
+	if err := f.refreshGroups(ctx, time.Now()); err != nil {
+		return nil, err
+	}
+	var samples []lag.LagSample
+	for _, gs := range f.sources {
+		committedOffsets, err := gs.source.CommittedOffsets(ctx, partitionIDs)
+		if err != nil {
+			return nil, classify(fmt.Errorf("group %s: %w", gs.group, err))
+		}
+		for _, p := range partitionIDs {
+			committed := committedOffsets[p]
+			if committed == unknownOffset {
+				continue
+			}
+			committed = max(committed, 0)
+			samples = append(samples, lag.LagSample{
+				Timestamp: at,
+				Topic:     f.topic,
+				Group:     gs.group,
+				Partition: p,
+				Lag:       max(offsetsAt[p]-committed, 0),
+				Offset:    committed,
+				EndOffset: offsetsAt[p],
+			})
+		}
+	}
+	return samples, nil
+}
@@ -0,0 +1,67 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestFetchLagAt(t *testing.T) {
+	// One record a second from an hour ago, 100 per partition
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+	client := &fakeClient{
+		topic:       "test-topic",
+		partitions:  []int{0, 1, 2},
+		endOffsets:  map[int]int64{0: 100, 1: 100, 2: 100},
+		recordTimes: map[int]time.Time{0: base, 1: base, 2: base.Add(-time.Hour)},
+	}
+	// Partition 1's group has consumed past the point in time
+	source := &fakeSource{offsets: map[int]int64{0: 30, 1: 80, 2: 60}}
+	f := newTestFetcher(client, source)
+
+	at := base.Add(50 * time.Second)
+	samples, err := f.FetchLagAt(context.Background(), at)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(samples) != 3 {
+		t.Fatalf("expected 3 samples, got %+v", samples)
+	}
+
+	want := []struct {
+		endOffset, lag int64
+	}{
+		{50, 20},
+		{50, 0},
+		// Every record predates the point in time, so the log ended where it
+		// does now
+		{100, 40},
+	}
+	for i, s := range samples {
+		if s.Partition != i || s.EndOffset != want[i].endOffset || s.Lag != want[i].lag {
+			t.Errorf("partition %d: endOffset %d, lag %d, want %d and %d", s.Partition, s.EndOffset, s.Lag, want[i].endOffset, want[i].lag)
+		}
+		if !s.Timestamp.Equal(at) || s.Group != "test-group" {
+			t.Errorf("partition %d: expected a test-group sample at %s, got %+v", s.Partition, at, s)
+		}
+	}
+}
+
+func TestFetchLagAt_SkipsUnknownCommittedOffset(t *testing.T) {
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+	client := &fakeClient{
+		topic:       "test-topic",
+		partitions:  []int{0, 1},
+		endOffsets:  map[int]int64{0: 100, 1: 100},
+		recordTimes: map[int]time.Time{0: base, 1: base},
+	}
+	f := newTestFetcher(client, &fakeSource{offsets: map[int]int64{0: 10, 1: unknownOffset}})
+
+	samples, err := f.FetchLagAt(context.Background(), base.Add(20*time.Second))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(samples) != 1 || samples[0].Partition != 0 || samples[0].Lag != 10 {
+		t.Errorf("expected only partition 0 with lag 10, got %+v", samples)
+	}
+}
@@ -0,0 +1,104 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeClock advances only when the limiter sleeps.
+type fakeClock struct {
+	now    time.Time
+	sleeps []time.Duration
+}
+
+func (c *fakeClock) newLimiter(perSecond float64) *rateLimiter {
+	l := newRateLimiter(perSecond)
+	l.now = func() time.Time { return c.now }
+	l.sleep = func(ctx context.Context, d time.Duration) error {
+		c.sleeps = append(c.sleeps, d)
+		c.now = c.now.Add(d)
+		return nil
+	}
+	return l
+}
+
+func TestRateLimiter_ThrottlesToConfiguredRate(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	l := clock.newLimiter(2)
+
+	start := clock.now
+	for range 5 {
+		if err := l.Wait(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	// 5 calls at 2/s: the first is immediate, then one every 500ms
+	if elapsed := clock.now.Sub(start); elapsed != 2*time.Second {
+		t.Errorf("5 calls took %s, want 2s", elapsed)
+	}
+	for _, d := range clock.sleeps {
+		if d != 500*time.Millisecond {
+			t.Errorf("expected 500ms between calls, slept %s", d)
+		}
+	}
+}
+
+func TestRateLimiter_SkipsWhenPastDeadline(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	l := clock.newLimiter(1)
+
+	ctx, cancel := context.WithDeadline(context.Background(), clock.now.Add(500*time.Millisecond))
+	defer cancel()
+
+	if err := l.Wait(ctx); err != nil {
+		t.Fatalf("first call should be immediate, got %v", err)
+	}
+	if err := l.Wait(ctx); !errors.Is(err, errRateLimited) {
+		t.Fatalf("expected errRateLimited when the wait exceeds the deadline, got %v", err)
+	}
+	if len(clock.sleeps) != 0 {
+		t.Errorf("expected no sleep for a skipped call, slept %v", clock.sleeps)
+	}
+
+	// The skipped call didn't consume a token: the next one waits only 1s
+	if err := l.Wait(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(clock.sleeps) != 1 || clock.sleeps[0] != time.Second {
+		t.Errorf("expected a single 1s wait, got %v", clock.sleeps)
+	}
+}
+
+func TestFetchLag_RateLimitedClient(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	client := &fakeClient{
+		topic:      "test-topic",
+		partitions: []int{0},
+		endOffsets: map[int]int64{0: 100},
+		committed:  map[int]int64{0: 40},
+	}
+	limited := &rateLimitedClient{client: client, limiter: clock.newLimiter(10)}
+	source := &offsetFetchSource{client: limited, addr: nil, topic: "test-topic", consumerGroup: "test-group"}
+
+	f := newTestFetcher(client, source)
+	f.client = limited
+	if _, err := f.FetchLag(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Metadata, the one-off DescribeConfigs, ListOffsets, then the source's
+	// Metadata and OffsetFetch
+	if len(clock.sleeps) != 4 {
+		t.Fatalf("expected 4 throttled waits after the first call, got %d", len(clock.sleeps))
+	}
+	var elapsed time.Duration
+	for _, d := range clock.sleeps {
+		elapsed += d
+	}
+	if elapsed != 400*time.Millisecond {
+		t.Errorf("5 calls at 10/s took %s, want 400ms", elapsed)
+	}
+}
@@ -0,0 +1,51 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Group states reported by DescribeGroups while a rebalance is in progress.
+const (
+	groupStatePreparingRebalance  = "PreparingRebalance"
+	groupStateCompletingRebalance = "CompletingRebalance"
+)
+
+// ErrGroupRebalancing is returned when a consumer group is mid-rebalance, so
+// its committed offsets may mix values from before and after the rebalance.
+var ErrGroupRebalancing = errors.New("consumer group is rebalancing")
+
+// describeGroup returns group's state and members from DescribeGroups.
+func (f *LagFetcher) describeGroup(ctx context.Context, group string) (kafka.DescribeGroupsResponseGroup, error) {
+	resp, err := f.client.DescribeGroups(ctx, &kafka.DescribeGroupsRequest{
+		Addr:     f.addr,
+		GroupIDs: []string{group},
+	})
+	if err != nil {
+		return kafka.DescribeGroupsResponseGroup{}, fmt.Errorf("describe group failed: %w", err)
+	}
+	if len(resp.Groups) == 0 {
+		return kafka.DescribeGroupsResponseGroup{}, fmt.Errorf("group %s not described", group)
+	}
+
+	g := resp.Groups[0]
+	if g.Error != nil {
+		return kafka.DescribeGroupsResponseGroup{}, fmt.Errorf("describe group error: %w", g.Error)
+	}
+	return g, nil
+}
+
+// checkGroupStable returns ErrGroupRebalancing when the described group is in
+// the middle of a rebalance. kafka-go's OffsetFetchRequest can't pin a
+// generation, so the group state is checked just before its offsets are read
+// instead.
+func checkGroupStable(g kafka.DescribeGroupsResponseGroup) error {
+	switch g.GroupState {
+	case groupStatePreparingRebalance, groupStateCompletingRebalance:
+		return fmt.Errorf("%w (state %s)", ErrGroupRebalancing, g.GroupState)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestFetchLag_SkipsRebalancingGroup(t *testing.T) {
+	client := &fakeClient{
+		topic:      "test-topic",
+		partitions: []int{0},
+		endOffsets: map[int]int64{0: 1000},
+		groupState: groupStatePreparingRebalance,
+	}
+	source := &fakeSource{offsets: map[int]int64{0: 400}}
+	fetcher := newTestFetcher(client, source)
+	fetcher.skipRebalancing = true
+
+	_, err := fetcher.FetchLag(context.Background())
+	if !errors.Is(err, ErrGroupRebalancing) {
+		t.Fatalf("expected ErrGroupRebalancing, got %v", err)
+	}
+	if len(source.calls) != 0 {
+		t.Error("expected committed offsets not to be read while rebalancing")
+	}
+
+	client.groupState = "Stable"
+	samples, err := fetcher.FetchLag(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error once stable: %v", err)
+	}
+	if len(samples) != 1 || samples[0].Lag != 600 {
+		t.Errorf("unexpected samples: %+v", samples)
+	}
+}
+
+func TestFetchLag_CountsGroupMembers(t *testing.T) {
+	client := &fakeClient{
+		topic:      "test-topic",
+		partitions: []int{0, 1},
+		endOffsets: map[int]int64{0: 1000, 1: 1000},
+		members:    map[string]int{"test-group": 0},
+	}
+	source := &fakeSource{offsets: map[int]int64{0: 400, 1: 400}}
+	fetcher := newTestFetcher(client, source)
+	fetcher.countMembers = true
+
+	samples, err := fetcher.FetchLag(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, s := range samples {
+		if s.Members != 0 {
+			t.Errorf("partition %d members = %d, want 0", s.Partition, s.Members)
+		}
+	}
+
+	client.members["test-group"] = 3
+	samples, err = fetcher.FetchLag(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(samples) != 2 || samples[0].Members != 3 || samples[1].Members != 3 {
+		t.Errorf("expected 3 members on every sample, got %+v", samples)
+	}
+}
+
+func TestFetchLag_RebalanceCheckDisabled(t *testing.T) {
+	client := &fakeClient{
+		topic:      "test-topic",
+		partitions: []int{0},
+		endOffsets: map[int]int64{0: 1000},
+		groupState: groupStateCompletingRebalance,
+	}
+	source := &fakeSource{offsets: map[int]int64{0: 400}}
+
+	if _, err := newTestFetcher(client, source).FetchLag(context.Background()); err != nil {
+		t.Fatalf("expected the group state to be ignored by default, got %v", err)
+	}
+}
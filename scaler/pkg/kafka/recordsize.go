@@ -0,0 +1,125 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	// recordSizeSampleRecords is how many of a partition's most recent
+	// records are read to estimate its average record size.
+	recordSizeSampleRecords = 10
+	// recordSizeFetchBytes caps the sampling fetch so a partition of very
+	// large records can't pull megabytes every refresh.
+	recordSizeFetchBytes = 1 << 20
+)
+
+type recordSize struct {
+	avg       float64
+	sampledAt time.Time
+}
+
+// recordSizer estimates each partition's average record size (key plus
+// value) from a small fetch of its most recent records, re-sampling a
+// partition once its estimate is older than refresh.
+type recordSizer struct {
+	client  brokerClient
+	addr    net.Addr
+	topic   string
+	refresh time.Duration
+	sizes   map[int]recordSize
+}
+
+func newRecordSizer(client brokerClient, addr net.Addr, topic string, refresh time.Duration) *recordSizer {
+	return &recordSizer{
+		client:  client,
+		addr:    addr,
+		topic:   topic,
+		refresh: refresh,
+		sizes:   make(map[int]recordSize),
+	}
+}
+
+// averageSize returns partition's average record size, sampling the records
+// just before endOffset when there's no estimate or it has expired. When
+// sampling fails the previous estimate is returned alongside the error.
+func (r *recordSizer) averageSize(ctx context.Context, partition int, endOffset int64, now time.Time) (float64, error) {
+	cached, ok := r.sizes[partition]
+	if ok && now.Sub(cached.sampledAt) < r.refresh {
+		return cached.avg, nil
+	}
+
+	avg, n, err := r.sample(ctx, partition, endOffset)
+	if err != nil {
+		return cached.avg, err
+	}
+	if n == 0 {
+		// Nothing to measure yet; keep any earlier estimate
+		return cached.avg, nil
+	}
+	r.sizes[partition] = recordSize{avg: avg, sampledAt: now}
+	return avg, nil
+}
+
+// sample fetches up to recordSizeSampleRecords records ending at endOffset
+// and returns their average size and how many were measured.
+func (r *recordSizer) sample(ctx context.Context, partition int, endOffset int64) (float64, int, error) {
+	from := max(endOffset-recordSizeSampleRecords, 0)
+	if from >= endOffset {
+		return 0, 0, nil
+	}
+
+	resp, err := r.client.Fetch(ctx, &kafka.FetchRequest{
+		Addr:      r.addr,
+		Topic:     r.topic,
+		Partition: partition,
+		Offset:    from,
+		MaxBytes:  recordSizeFetchBytes,
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("fetch records of partition %d: %w", partition, err)
+	}
+	if resp.Error != nil {
+		return 0, 0, fmt.Errorf("fetch records of partition %d: %w", partition, resp.Error)
+	}
+	if c, ok := resp.Records.(io.Closer); ok {
+		defer c.Close()
+	}
+	if resp.Records == nil {
+		return 0, 0, nil
+	}
+
+	var total, n int
+	for n < recordSizeSampleRecords {
+		rec, err := resp.Records.ReadRecord()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return 0, 0, fmt.Errorf("read records of partition %d: %w", partition, err)
+		}
+		// Batches may start before the requested offset
+		if rec.Offset < from || rec.Offset >= endOffset {
+			continue
+		}
+		total += bytesLen(rec.Key) + bytesLen(rec.Value)
+		n++
+	}
+	if n == 0 {
+		return 0, 0, nil
+	}
+	return float64(total) / float64(n), n, nil
+}
+
+func bytesLen(b kafka.Bytes) int {
+	if b == nil {
+		return 0
+	}
+	return b.Len()
+}
@@ -0,0 +1,97 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestRecordSizer_AverageSize(t *testing.T) {
+	client := &fakeClient{
+		topic:       "test-topic",
+		endOffsets:  map[int]int64{0: 500, 1: 4},
+		recordSizes: map[int]int{0: 1024, 1: 100},
+	}
+	sizer := newRecordSizer(client, kafka.TCP("localhost:9092"), "test-topic", time.Minute)
+
+	now := time.Now()
+	avg, err := sizer.averageSize(context.Background(), 0, 500, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if avg != 1024 {
+		t.Errorf("partition 0 average size = %g, want 1024", avg)
+	}
+
+	// Fewer records than the sample size are all measured
+	if avg, _ := sizer.averageSize(context.Background(), 1, 4, now); avg != 100 {
+		t.Errorf("partition 1 average size = %g, want 100", avg)
+	}
+}
+
+func TestRecordSizer_Refresh(t *testing.T) {
+	client := &fakeClient{
+		topic:       "test-topic",
+		endOffsets:  map[int]int64{0: 500},
+		recordSizes: map[int]int{0: 1024},
+	}
+	sizer := newRecordSizer(client, kafka.TCP("localhost:9092"), "test-topic", time.Minute)
+
+	now := time.Now()
+	sizer.averageSize(context.Background(), 0, 500, now)
+	client.recordSizes[0] = 2048
+
+	if avg, _ := sizer.averageSize(context.Background(), 0, 500, now.Add(30*time.Second)); avg != 1024 {
+		t.Errorf("expected cached size 1024 within refresh, got %g", avg)
+	}
+	if avg, _ := sizer.averageSize(context.Background(), 0, 500, now.Add(time.Minute)); avg != 2048 {
+		t.Errorf("expected re-sampled size 2048 after refresh, got %g", avg)
+	}
+	if client.fetches[0] != 2 {
+		t.Errorf("expected 2 fetches, got %d", client.fetches[0])
+	}
+}
+
+func TestFetchLag_ByteLag(t *testing.T) {
+	client := &fakeClient{
+		topic:       "test-topic",
+		partitions:  []int{0, 1},
+		endOffsets:  map[int]int64{0: 1100, 1: 2000},
+		recordSizes: map[int]int{0: 1 << 20, 1: 100},
+	}
+	// Partition 0 is 100 records behind on 1MiB records, partition 1 is
+	// 1000 behind on 100-byte records
+	source := &fakeSource{offsets: map[int]int64{0: 1000, 1: 1000}}
+	f := newTestFetcher(client, source)
+	f.sizer = newRecordSizer(client, f.addr, client.topic, time.Minute)
+
+	samples, err := f.FetchLag(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if samples[0].ByteLag != 100<<20 {
+		t.Errorf("partition 0 byte lag = %d, want %d", samples[0].ByteLag, 100<<20)
+	}
+	if samples[1].ByteLag != 100_000 {
+		t.Errorf("partition 1 byte lag = %d, want 100000", samples[1].ByteLag)
+	}
+}
+
+func TestFetchLag_NoByteLagByDefault(t *testing.T) {
+	client := &fakeClient{
+		topic:      "test-topic",
+		partitions: []int{0},
+		endOffsets: map[int]int64{0: 100},
+	}
+	source := &fakeSource{offsets: map[int]int64{0: 0}}
+
+	samples, err := newTestFetcher(client, source).FetchLag(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if samples[0].ByteLag != 0 || client.fetches[0] != 0 {
+		t.Errorf("expected no record sampling, got byte lag %d after %d fetches", samples[0].ByteLag, client.fetches[0])
+	}
+}
@@ -0,0 +1,66 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// replicaTopic is a mirror of the measured topic, e.g. one MirrorMaker
+// replicates into on another cluster. In replication lag mode a partition's
+// lag is how far the mirror's end offset trails the source's, which assumes
+// the mirror keeps partitions and offsets aligned with the source, as
+// MirrorMaker 2 with an identity replication policy does. Mirroring in both
+// directions takes one scaler per direction.
+type replicaTopic struct {
+	client brokerClient
+	addr   net.Addr
+	topic  string
+	logger *slog.Logger
+
+	// transport holds client's connections to the mirror's cluster,
+	// released by the fetcher's Close; nil in tests.
+	transport connCloser
+}
+
+// endOffsets returns the partitions the mirror also has, and its end offset
+// for each. A partition the mirror lacks, e.g. one added to the source that
+// hasn't been replicated yet, is logged and skipped.
+func (r *replicaTopic) endOffsets(ctx context.Context, partitions []kafka.Partition, isolation kafka.IsolationLevel) ([]kafka.Partition, map[int]int64, error) {
+	requests := make([]kafka.OffsetRequest, 0, len(partitions))
+	for _, p := range partitions {
+		requests = append(requests, kafka.LastOffsetOf(p.ID))
+	}
+	resp, err := r.client.ListOffsets(ctx, &kafka.ListOffsetsRequest{
+		Addr:           r.addr,
+		Topics:         map[string][]kafka.OffsetRequest{r.topic: requests},
+		IsolationLevel: isolation,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("list offsets of replica topic %s failed: %w", r.topic, err)
+	}
+
+	offsets := make(map[int]int64)
+	for _, po := range resp.Topics[r.topic] {
+		if po.Error != nil {
+			return nil, nil, fmt.Errorf("replica topic %s offset error for partition %d: %w", r.topic, po.Partition, po.Error)
+		}
+		offsets[po.Partition] = po.LastOffset
+	}
+
+	var mirrored []kafka.Partition
+	for _, p := range partitions {
+		if _, ok := offsets[p.ID]; ok {
+			mirrored = append(mirrored, p)
+			continue
+		}
+		r.logger.Warn("Partition missing from replica topic, skipping", "replicaTopic", r.topic, "partition", p.ID)
+	}
+	if len(mirrored) == 0 {
+		return nil, nil, fmt.Errorf("no offsets returned for replica topic %s", r.topic)
+	}
+	return mirrored, offsets, nil
+}
@@ -0,0 +1,92 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/config"
+)
+
+// LagSource resolves the committed offsets of the tracked consumer group for
+// the given partitions. Partitions without a committed offset may be omitted
+// from the result; a partition whose committed offset couldn't be determined
+// is reported as unknownOffset.
+type LagSource interface {
+	CommittedOffsets(ctx context.Context, partitions []int) (map[int]int64, error)
+}
+
+// commitTimeSource is a LagSource that also knows when each partition's
+// committed offset was committed. OffsetFetch responses don't carry it, so
+// only the __consumer_offsets source does.
+type commitTimeSource interface {
+	CommitTimes(partitions []int) map[int]time.Time
+}
+
+// unknownOffset is the committed offset of a partition the response left
+// undetermined, as opposed to one the group never committed. Such a partition
+// gets no sample rather than one measured from offset 0.
+const unknownOffset int64 = math.MinInt64
+
+// offsetFetchSource asks the brokers for committed offsets with a synchronous
+// OffsetFetch request on every call. mode is how the brokers report a
+// partition without a committed offset, per config.OffsetFetchMode*; the
+// other form then means the offset is unknown.
+type offsetFetchSource struct {
+	client        brokerClient
+	addr          net.Addr
+	topic         string
+	consumerGroup string
+	mode          string
+}
+
+func (s *offsetFetchSource) CommittedOffsets(ctx context.Context, partitions []int) (map[int]int64, error) {
+	coordinator, err := s.client.Metadata(ctx, &kafka.MetadataRequest{
+		Addr: s.addr,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("coordinator lookup failed: %w", err)
+	}
+
+	// Use first broker as coordinator address
+	var coordinatorAddr net.Addr
+	if len(coordinator.Brokers) > 0 {
+		coordinatorAddr = kafka.TCP(fmt.Sprintf("%s:%d", coordinator.Brokers[0].Host, coordinator.Brokers[0].Port))
+	} else {
+		coordinatorAddr = s.addr
+	}
+
+	fetchResp, err := s.client.OffsetFetch(ctx, &kafka.OffsetFetchRequest{
+		Addr:    coordinatorAddr,
+		GroupID: s.consumerGroup,
+		Topics:  map[string][]int{s.topic: partitions},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("offset fetch failed: %w", err)
+	}
+
+	committedOffsets := make(map[int]int64)
+	for _, po := range fetchResp.Topics[s.topic] {
+		if po.Error != nil {
+			return nil, fmt.Errorf("committed offset error for partition %d: %w", po.Partition, po.Error)
+		}
+		offset := po.CommittedOffset
+		if offset < 0 && s.mode == config.OffsetFetchModeOmitted {
+			offset = unknownOffset
+		}
+		committedOffsets[po.Partition] = offset
+	}
+	if s.mode == config.OffsetFetchModeNegative {
+		for _, p := range partitions {
+			if _, ok := committedOffsets[p]; !ok {
+				committedOffsets[p] = unknownOffset
+			}
+		}
+	}
+
+	return committedOffsets, nil
+}
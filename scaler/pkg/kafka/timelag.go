@@ -0,0 +1,90 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/lag"
+)
+
+// timeLagFetchBytes caps the fetch of a partition's oldest unconsumed record.
+// Brokers still return a whole first batch when it's larger.
+const timeLagFetchBytes = 1 << 20
+
+// estimateTimeLag sets each lagging sample's TimeLag to the age of its oldest
+// unconsumed record, the one at its committed (or, with the earliest basis,
+// log start) offset. Several groups at the same offset share one fetch. A
+// partition whose record can't be read keeps a TimeLag of 0.
+func (f *LagFetcher) estimateTimeLag(ctx context.Context, samples []lag.LagSample, now time.Time) {
+	if !f.timeLag {
+		return
+	}
+
+	type position struct {
+		partition int
+		offset    int64
+	}
+	seen := make(map[position]time.Time)
+	for i := range samples {
+		s := &samples[i]
+		if s.Lag <= 0 {
+			continue
+		}
+		pos := position{s.Partition, s.Offset}
+		ts, ok := seen[pos]
+		if !ok {
+			var err error
+			ts, err = f.recordTime(ctx, s.Partition, s.Offset)
+			if err != nil {
+				f.logger.Warn("Failed to read oldest unconsumed record", "topic", f.topic, "partition", s.Partition, "offset", s.Offset, "error", err)
+			}
+			seen[pos] = ts
+		}
+		if !ts.IsZero() {
+			s.TimeLag = int64(max(now.Sub(ts), 0) / time.Second)
+		}
+	}
+}
+
+// recordTime returns the timestamp of the first record at or after offset in
+// partition, or the zero time when there is none to read.
+func (f *LagFetcher) recordTime(ctx context.Context, partition int, offset int64) (time.Time, error) {
+	resp, err := f.client.Fetch(ctx, &kafka.FetchRequest{
+		Addr:      f.addr,
+		Topic:     f.topic,
+		Partition: partition,
+		Offset:    offset,
+		MaxBytes:  timeLagFetchBytes,
+	})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("fetch record of partition %d: %w", partition, err)
+	}
+	if resp.Error != nil {
+		return time.Time{}, fmt.Errorf("fetch record of partition %d: %w", partition, resp.Error)
+	}
+	if resp.Records == nil {
+		return time.Time{}, nil
+	}
+	if c, ok := resp.Records.(io.Closer); ok {
+		defer c.Close()
+	}
+
+	for {
+		rec, err := resp.Records.ReadRecord()
+		if errors.Is(err, io.EOF) {
+			return time.Time{}, nil
+		}
+		if err != nil {
+			return time.Time{}, fmt.Errorf("read record of partition %d: %w", partition, err)
+		}
+		// Batches may start before the requested offset
+		if rec.Offset >= offset {
+			return rec.Time, nil
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/lag"
+)
+
+func TestFetchLag_TimeLag(t *testing.T) {
+	now := time.Now()
+	client := &fakeClient{
+		topic:       "test-topic",
+		partitions:  []int{0, 1, 2},
+		endOffsets:  map[int]int64{0: 1000, 1: 1000, 2: 1000},
+		recordTimes: map[int]time.Time{0: now.Add(-time.Hour), 1: now.Add(-time.Hour)},
+	}
+	// Partition 0's oldest unconsumed record was written at offset 400,
+	// partition 1's at 900; partition 2 is caught up
+	source := &fakeSource{offsets: map[int]int64{0: 400, 1: 900, 2: 1000}}
+	f := newTestFetcher(client, source)
+	f.timeLag = true
+
+	samples, err := f.FetchLag(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Offset 400 was written 3600-400 seconds ago; allow for the clock
+	// moving on during the test
+	if got := samples[0].TimeLag; got < 3200 || got > 3201 {
+		t.Errorf("partition 0 time lag = %d, want 3200", got)
+	}
+	if got := samples[1].TimeLag; got < 2700 || got > 2701 {
+		t.Errorf("partition 1 time lag = %d, want 2700", got)
+	}
+	if samples[2].TimeLag != 0 || client.fetches[2] != 0 {
+		t.Errorf("expected no fetch for a caught-up partition, got time lag %d after %d fetches", samples[2].TimeLag, client.fetches[2])
+	}
+}
+
+func TestEstimateTimeLag_SharesFetchAcrossGroups(t *testing.T) {
+	now := time.Now()
+	client := &fakeClient{
+		topic:       "test-topic",
+		partitions:  []int{0},
+		endOffsets:  map[int]int64{0: 100},
+		recordTimes: map[int]time.Time{0: now.Add(-time.Minute)},
+	}
+	f := newTestFetcher(client, &fakeSource{})
+	f.timeLag = true
+
+	samples := []lag.LagSample{
+		{Group: "a", Partition: 0, Offset: 10, Lag: 90},
+		{Group: "b", Partition: 0, Offset: 10, Lag: 90},
+	}
+	f.estimateTimeLag(context.Background(), samples, now)
+
+	if client.fetches[0] != 1 {
+		t.Errorf("expected one fetch for groups at the same offset, got %d", client.fetches[0])
+	}
+	for _, s := range samples {
+		if s.TimeLag != 50 {
+			t.Errorf("group %s time lag = %d, want 50", s.Group, s.TimeLag)
+		}
+	}
+}
+
+func TestFetchLag_NoTimeLagByDefault(t *testing.T) {
+	client := &fakeClient{
+		topic:      "test-topic",
+		partitions: []int{0},
+		endOffsets: map[int]int64{0: 100},
+	}
+	source := &fakeSource{offsets: map[int]int64{0: 0}}
+
+	samples, err := newTestFetcher(client, source).FetchLag(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if samples[0].TimeLag != 0 || client.fetches[0] != 0 {
+		t.Errorf("expected no record reads, got time lag %d after %d fetches", samples[0].TimeLag, client.fetches[0])
+	}
+}
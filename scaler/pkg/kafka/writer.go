@@ -0,0 +1,23 @@
+package kafka
+
+import (
+	"github.com/segmentio/kafka-go"
+
+	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/config"
+)
+
+// NewWriter returns a writer producing to topic on cfg's brokers, with the
+// same SASL and TLS settings the LagFetcher uses.
+func NewWriter(cfg *config.ScalerConfig, topic string) (*kafka.Writer, error) {
+	transport, err := newTransport(cfg.Credentials())
+	if err != nil {
+		return nil, err
+	}
+
+	return &kafka.Writer{
+		Addr:      kafka.TCP(splitBrokers(cfg.BootstrapServers)...),
+		Topic:     topic,
+		Balancer:  &kafka.Hash{},
+		Transport: transport,
+	}, nil
+}
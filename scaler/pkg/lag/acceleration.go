@@ -0,0 +1,96 @@
+package lag
+
+import "time"
+
+// AccelerationEvaluator scales on lag that grows faster and faster, which
+// catches runaway growth before the lag itself or its slope looks alarming:
+// it activates when some partition's lag acceleration, the change in its
+// growth rate between consecutive samples, stays at or above Threshold, in
+// lag units per second squared, for SustainDuration. Lag growing at a steady
+// rate has no acceleration however steep it is. MinStretchSamples counts
+// acceleration points, each needing three samples. With RequireCurrent the
+// latest acceleration must still be at or above Threshold. LagThreshold only
+// feeds LaggingPartitions; PanicThreshold, GroupStrategy and Lookback behave
+// as for AbsoluteEvaluator.
+type AccelerationEvaluator struct {
+	Threshold         float64
+	LagThreshold      int64
+	SustainDuration   time.Duration
+	MinStretchSamples int
+	PanicThreshold    int64
+	GroupStrategy     GroupStrategy
+	RequireCurrent    bool
+	Lookback          time.Duration
+}
+
+func (e AccelerationEvaluator) Evaluate(samples []LagSample) EvaluationResult {
+	return e.EvaluateSeries(GroupByPartition(samples))
+}
+
+func (e AccelerationEvaluator) EvaluateSeries(series PartitionSeries) EvaluationResult {
+	series = series.combineGroups(e.GroupStrategy)
+	result := evaluateSeries(series, e.LagThreshold, e.SustainDuration, e.MinStretchSamples, e.Lookback)
+
+	recent := series.withinLookback(e.Lookback)
+	result.Persistent = false
+	result.TriggerPartition = -1
+	for _, p := range recent.partitions() {
+		for _, r := range accelerationStretches(recent[p], e.Threshold) {
+			if r.sustains(e.SustainDuration, e.MinStretchSamples) && (r.current || !e.RequireCurrent) {
+				result.Persistent = true
+				result.TriggerPartition = p
+				break
+			}
+		}
+		if result.Persistent {
+			break
+		}
+	}
+	return ApplyPanicThreshold(result, e.PanicThreshold)
+}
+
+// accelerationStretches returns the runs of consecutive acceleration points
+// at or above threshold in series, which must be ordered by timestamp, oldest
+// first. Each point is taken at the last of the three samples it's computed
+// from; samples sharing a timestamp with the previous one are skipped.
+func accelerationStretches(series []LagSample, threshold float64) []stretch {
+	var runs []stretch
+	inRun := false
+	var prev LagSample
+	var prevRate, prevInterval float64
+	points := 0
+	for i, s := range series {
+		if i > 0 && !s.Timestamp.After(prev.Timestamp) {
+			continue
+		}
+		if i == 0 {
+			prev = s
+			continue
+		}
+
+		interval := s.Timestamp.Sub(prev.Timestamp).Seconds()
+		rate := float64(s.Lag-prev.Lag) / interval
+		points++
+		if points > 1 {
+			// Each rate holds midway between its two samples, so consecutive
+			// rates are half of each of their intervals apart
+			acceleration := (rate - prevRate) / ((interval + prevInterval) / 2)
+			if acceleration < threshold {
+				inRun = false
+			} else {
+				if !inRun {
+					runs = append(runs, stretch{start: s.Timestamp})
+					inRun = true
+				}
+				run := &runs[len(runs)-1]
+				run.end = s.Timestamp
+				run.samples++
+			}
+		}
+		prev, prevRate, prevInterval = s, rate, interval
+	}
+	if inRun {
+		runs[len(runs)-1].current = true
+	}
+	return runs
+}
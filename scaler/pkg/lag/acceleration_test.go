@@ -0,0 +1,91 @@
+package lag
+
+import (
+	"testing"
+	"time"
+)
+
+// growthSamples builds n samples 10s apart on partition 0, ending now, with
+// lag given by growth of the seconds since the first.
+func growthSamples(n int, growth func(t float64) float64) []LagSample {
+	now := time.Now()
+	samples := make([]LagSample, n)
+	for i := range n {
+		t := float64(i * 10)
+		samples[i] = LagSample{
+			Timestamp: now.Add(time.Duration(i-n+1) * 10 * time.Second),
+			Partition: 0,
+			Lag:       int64(growth(t)),
+		}
+	}
+	return samples
+}
+
+func TestAccelerationEvaluator_QuadraticGrowthActivates(t *testing.T) {
+	e := AccelerationEvaluator{Threshold: 1, LagThreshold: 500, SustainDuration: 2 * time.Minute}
+
+	// lag = t², an acceleration of 2/s²
+	result := e.Evaluate(growthSamples(15, func(t float64) float64 { return t * t }))
+	if !result.Persistent {
+		t.Fatal("expected accelerating lag to activate")
+	}
+	if result.TriggerPartition != 0 {
+		t.Errorf("TriggerPartition = %d, want 0", result.TriggerPartition)
+	}
+	if result.TotalCurrentLag != 140*140 {
+		t.Errorf("TotalCurrentLag = %d, want %d", result.TotalCurrentLag, 140*140)
+	}
+
+	// Two points short of spanning the sustain duration
+	if e.Evaluate(growthSamples(13, func(t float64) float64 { return t * t })).Persistent {
+		t.Error("expected acceleration shorter than the sustain duration not to activate")
+	}
+}
+
+func TestAccelerationEvaluator_LinearGrowthDoesNotActivate(t *testing.T) {
+	e := AccelerationEvaluator{Threshold: 1, LagThreshold: 500, SustainDuration: 2 * time.Minute}
+
+	// Steep but steady growth has no acceleration
+	result := e.Evaluate(growthSamples(15, func(t float64) float64 { return 500 * t }))
+	if result.Persistent {
+		t.Error("expected linearly growing lag not to activate")
+	}
+	if result.LaggingPartitions != 1 {
+		t.Errorf("LaggingPartitions = %d, want 1", result.LaggingPartitions)
+	}
+}
+
+func TestAccelerationEvaluator_RequireCurrent(t *testing.T) {
+	e := AccelerationEvaluator{Threshold: 1, SustainDuration: 2 * time.Minute, RequireCurrent: true}
+
+	// Accelerates for 150s, then grows at a steady rate
+	samples := growthSamples(15, func(t float64) float64 { return t * t })
+	last := samples[len(samples)-1]
+	for i := 1; i <= 3; i++ {
+		last.Timestamp = last.Timestamp.Add(10 * time.Second)
+		last.Lag += 2800
+		samples = append(samples, last)
+	}
+	if e.Evaluate(samples).Persistent {
+		t.Error("expected acceleration that has stopped not to count with RequireCurrent")
+	}
+	e.RequireCurrent = false
+	if !e.Evaluate(samples).Persistent {
+		t.Error("expected the earlier acceleration to count without RequireCurrent")
+	}
+}
+
+func TestAccelerationEvaluator_EvaluateSeriesMatchesEvaluate(t *testing.T) {
+	e := AccelerationEvaluator{Threshold: 1, LagThreshold: 500, SustainDuration: time.Minute, PanicThreshold: 100000}
+	samples := growthSamples(15, func(t float64) float64 { return t * t })
+	samples = append(samples, growthSamples(15, func(t float64) float64 { return 20 * t })...)
+	for i := 15; i < len(samples); i++ {
+		samples[i].Partition = 1
+	}
+
+	got := e.EvaluateSeries(GroupByPartition(samples))
+	want := e.Evaluate(samples)
+	if got.Persistent != want.Persistent || got.TriggerPartition != want.TriggerPartition || got.TotalCurrentLag != want.TotalCurrentLag {
+		t.Errorf("EvaluateSeries = %+v, Evaluate = %+v", got, want)
+	}
+}
@@ -0,0 +1,48 @@
+package lag
+
+import "time"
+
+// AggregatePartition is the Partition of a sample that stands for every
+// partition of its topic.
+const AggregatePartition = -1
+
+// AggregatePartitions collapses the samples of one scrape into a single
+// sample per (Topic, Group, Timestamp) holding the totals across partitions,
+// in the order each was first seen. Groups stay separate so CombineGroups can
+// still apply the multi-group strategy. The result has Partition set to
+// AggregatePartition, so per-partition persistence is lost: the evaluator
+// sees one series of total lag.
+func AggregatePartitions(samples []LagSample) []LagSample {
+	type key struct {
+		topic     string
+		group     string
+		timestamp time.Time
+	}
+
+	index := make(map[key]int)
+	var aggregated []LagSample
+	for _, s := range samples {
+		k := key{s.Topic, s.Group, s.Timestamp}
+		i, ok := index[k]
+		if !ok {
+			s.Partition = AggregatePartition
+			index[k] = len(aggregated)
+			aggregated = append(aggregated, s)
+			continue
+		}
+
+		total := &aggregated[i]
+		total.Lag += s.Lag
+		total.Offset += s.Offset
+		total.EndOffset += s.EndOffset
+		total.ConsumeRate += s.ConsumeRate
+		total.ByteLag += s.ByteLag
+		// The aggregate is as old as its oldest partition's backlog
+		total.TimeLag = max(total.TimeLag, s.TimeLag)
+		total.OffsetAhead = total.OffsetAhead || s.OffsetAhead
+		total.LeaderChanged = total.LeaderChanged || s.LeaderChanged
+		// Only stale once every partition's commit is
+		total.StaleCommit = total.StaleCommit && s.StaleCommit
+	}
+	return aggregated
+}
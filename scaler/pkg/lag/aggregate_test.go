@@ -0,0 +1,62 @@
+package lag
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAggregatePartitions_OneSamplePerTick(t *testing.T) {
+	now := time.Now()
+	samples := []LagSample{
+		{Timestamp: now, Topic: "t", Group: "g", Partition: 0, Lag: 100, Offset: 10, EndOffset: 110, ConsumeRate: 1},
+		{Timestamp: now, Topic: "t", Group: "g", Partition: 1, Lag: 200, Offset: 20, EndOffset: 220, ConsumeRate: 2},
+		{Timestamp: now, Topic: "t", Group: "g", Partition: 2, Lag: 300, Offset: 30, EndOffset: 330, ConsumeRate: 3, OffsetAhead: true},
+		{Timestamp: now, Topic: "t", Group: "other", Partition: 0, Lag: 50},
+	}
+
+	got := AggregatePartitions(samples)
+	if len(got) != 2 {
+		t.Fatalf("expected one sample per group, got %d: %+v", len(got), got)
+	}
+
+	total := got[0]
+	if total.Group != "g" || total.Partition != AggregatePartition {
+		t.Errorf("unexpected key: group %q partition %d", total.Group, total.Partition)
+	}
+	if total.Lag != 600 || total.Offset != 60 || total.EndOffset != 660 || total.ConsumeRate != 6 {
+		t.Errorf("unexpected totals: %+v", total)
+	}
+	if !total.OffsetAhead {
+		t.Error("expected OffsetAhead when any partition was ahead")
+	}
+	if got[1].Group != "other" || got[1].Lag != 50 {
+		t.Errorf("unexpected second group sample: %+v", got[1])
+	}
+}
+
+func TestAggregatePartitions_PersistenceOnTotal(t *testing.T) {
+	now := time.Now()
+	// Each of 10 partitions lags 100 for 2 minutes: none crosses the
+	// threshold of 500 alone, but their total of 1000 does.
+	var samples []LagSample
+	for i := range 13 {
+		ts := now.Add(time.Duration(i) * 10 * time.Second)
+		var tick []LagSample
+		for p := range 10 {
+			tick = append(tick, LagSample{Timestamp: ts, Partition: p, Lag: 100})
+		}
+		samples = append(samples, AggregatePartitions(tick)...)
+	}
+
+	if len(samples) != 13 {
+		t.Fatalf("expected 13 aggregate samples, got %d", len(samples))
+	}
+
+	result := EvaluatePersistence(samples, 500, 2*time.Minute, 0)
+	if !result.Persistent {
+		t.Error("expected the aggregate series to be persistent")
+	}
+	if result.TotalCurrentLag != 1000 || result.TriggerPartition != AggregatePartition {
+		t.Errorf("unexpected result: total %d, trigger partition %d", result.TotalCurrentLag, result.TriggerPartition)
+	}
+}
@@ -0,0 +1,54 @@
+package lag
+
+import (
+	"sort"
+	"time"
+)
+
+// BreadthEvaluator scales on how many partitions lag rather than how far: it
+// activates when more than LaggingPartitionsThreshold partitions each hold
+// lag at or above Threshold for SustainDuration. PanicThreshold,
+// GroupStrategy, RequireCurrent and Lookback behave as for AbsoluteEvaluator.
+type BreadthEvaluator struct {
+	Threshold                  int64
+	SustainDuration            time.Duration
+	MinStretchSamples          int
+	PanicThreshold             int64
+	GroupStrategy              GroupStrategy
+	LaggingPartitionsThreshold int
+	RequireCurrent             bool
+	Lookback                   time.Duration
+}
+
+func (e BreadthEvaluator) Evaluate(samples []LagSample) EvaluationResult {
+	return e.EvaluateSeries(GroupByPartition(samples))
+}
+
+func (e BreadthEvaluator) EvaluateSeries(series PartitionSeries) EvaluationResult {
+	series = series.combineGroups(e.GroupStrategy)
+	result := evaluateSeries(series, e.Threshold, e.SustainDuration, e.MinStretchSamples, e.Lookback)
+
+	sustained := persistentPartitions(series.withinLookback(e.Lookback), e.Threshold, e.SustainDuration, e.MinStretchSamples)
+	if e.RequireCurrent {
+		sustained = currentPartitions(sustained, result.PartitionLag, e.Threshold)
+	}
+	result.Persistent = len(sustained) > e.LaggingPartitionsThreshold
+	result.TriggerPartition = -1
+	if result.Persistent {
+		result.TriggerPartition = sustained[0]
+	}
+	return ApplyPanicThreshold(result, e.PanicThreshold)
+}
+
+// persistentPartitions returns every partition with persistent lag, lowest
+// first.
+func persistentPartitions(series PartitionSeries, threshold int64, sustainDuration time.Duration, minStretchSamples int) []int {
+	var partitions []int
+	for p, runs := range seriesStretches(series, threshold) {
+		if anySustains(runs, sustainDuration, minStretchSamples) {
+			partitions = append(partitions, p)
+		}
+	}
+	sort.Ints(partitions)
+	return partitions
+}
@@ -0,0 +1,98 @@
+package lag
+
+import (
+	"testing"
+	"time"
+)
+
+// breadthSamples builds 13 samples 10s apart for each partition, with the
+// first lagging partitions at lag 1000 and the rest at 100.
+func breadthSamples(partitions, lagging int) []LagSample {
+	now := time.Now()
+	var samples []LagSample
+	for i := range 13 {
+		ts := now.Add(time.Duration(i-12) * 10 * time.Second)
+		for p := range partitions {
+			lag := int64(100)
+			if p < lagging {
+				lag = 1000
+			}
+			samples = append(samples, LagSample{Timestamp: ts, Partition: p, Lag: lag})
+		}
+	}
+	return samples
+}
+
+func TestBreadthEvaluator_CountsLaggingPartitions(t *testing.T) {
+	e := BreadthEvaluator{
+		Threshold:                  500,
+		SustainDuration:            2 * time.Minute,
+		LaggingPartitionsThreshold: 2,
+	}
+
+	tests := []struct {
+		lagging    int
+		persistent bool
+	}{
+		{lagging: 0, persistent: false},
+		{lagging: 2, persistent: false},
+		{lagging: 3, persistent: true},
+		{lagging: 6, persistent: true},
+	}
+	for _, tt := range tests {
+		result := e.Evaluate(breadthSamples(6, tt.lagging))
+		if result.LaggingPartitions != tt.lagging {
+			t.Errorf("%d lagging: LaggingPartitions = %d", tt.lagging, result.LaggingPartitions)
+		}
+		if result.Persistent != tt.persistent {
+			t.Errorf("%d lagging: Persistent = %v, want %v", tt.lagging, result.Persistent, tt.persistent)
+		}
+		if tt.persistent && result.TriggerPartition != 0 {
+			t.Errorf("%d lagging: TriggerPartition = %d, want 0", tt.lagging, result.TriggerPartition)
+		}
+		if !tt.persistent && result.TriggerPartition != -1 {
+			t.Errorf("%d lagging: TriggerPartition = %d, want -1", tt.lagging, result.TriggerPartition)
+		}
+	}
+}
+
+func TestBreadthEvaluator_RequiresSustainedLag(t *testing.T) {
+	// Three partitions above threshold, but only for the latest 30s.
+	now := time.Now()
+	var samples []LagSample
+	for i := range 13 {
+		ts := now.Add(time.Duration(i-12) * 10 * time.Second)
+		for p := range 3 {
+			lag := int64(100)
+			if i >= 9 {
+				lag = 1000
+			}
+			samples = append(samples, LagSample{Timestamp: ts, Partition: p, Lag: lag})
+		}
+	}
+
+	e := BreadthEvaluator{Threshold: 500, SustainDuration: 2 * time.Minute, LaggingPartitionsThreshold: 1}
+	result := e.Evaluate(samples)
+	if result.LaggingPartitions != 3 {
+		t.Errorf("LaggingPartitions = %d, want 3", result.LaggingPartitions)
+	}
+	if result.Persistent {
+		t.Error("expected not persistent when lag isn't sustained")
+	}
+}
+
+func TestBreadthEvaluator_RequireCurrent(t *testing.T) {
+	samples := breadthSamples(4, 2)
+	// Partition 1 has drained since its stretch
+	samples = append(samples, LagSample{Timestamp: samples[len(samples)-1].Timestamp.Add(10 * time.Second), Partition: 1, Lag: 0})
+
+	e := BreadthEvaluator{Threshold: 500, SustainDuration: 2 * time.Minute, LaggingPartitionsThreshold: 1}
+	if !e.Evaluate(samples).Persistent {
+		t.Fatal("precondition: two sustained partitions should exceed the breadth threshold")
+	}
+
+	e.RequireCurrent = true
+	if result := e.Evaluate(samples); result.Persistent {
+		t.Errorf("expected only one current partition not to exceed the breadth threshold, got %+v", result)
+	}
+}
@@ -0,0 +1,62 @@
+package lag
+
+import "time"
+
+// LastTickEvaluator re-sums Evaluator's TotalCurrentLag over only the
+// partitions sampled within Interval of the newest sample, i.e. in the most
+// recent tick. A partition whose leader didn't respond that tick keeps an
+// older latest sample, and summing it would mix a stale value into an
+// otherwise fresh total. Persistence and the per-partition results are left
+// as Evaluator computed them.
+type LastTickEvaluator struct {
+	Evaluator Evaluator
+	Interval  time.Duration
+}
+
+func (e LastTickEvaluator) Evaluate(samples []LagSample) EvaluationResult {
+	result := e.Evaluator.Evaluate(samples)
+	if len(samples) == 0 {
+		return result
+	}
+
+	latest := make(map[int]time.Time)
+	var newest time.Time
+	for _, s := range samples {
+		if s.Timestamp.After(latest[s.Partition]) {
+			latest[s.Partition] = s.Timestamp
+		}
+		if s.Timestamp.After(newest) {
+			newest = s.Timestamp
+		}
+	}
+	return e.lastTick(result, latest, newest)
+}
+
+func (e LastTickEvaluator) EvaluateSeries(series PartitionSeries) EvaluationResult {
+	result := EvaluateSeries(e.Evaluator, series)
+	if series.Len() == 0 {
+		return result
+	}
+
+	latest := make(map[int]time.Time, len(series))
+	for p, ss := range series {
+		if len(ss) > 0 {
+			latest[p] = ss[len(ss)-1].Timestamp
+		}
+	}
+	return e.lastTick(result, latest, series.newest())
+}
+
+// lastTick re-sums result's total over the partitions whose latest sample is
+// within Interval of newest.
+func (e LastTickEvaluator) lastTick(result EvaluationResult, latest map[int]time.Time, newest time.Time) EvaluationResult {
+	result.TotalCurrentLag = 0
+	result.TotalPartitions = 0
+	for p, lag := range result.PartitionLag {
+		if newest.Sub(latest[p]) < e.Interval {
+			result.TotalCurrentLag += lag
+			result.TotalPartitions++
+		}
+	}
+	return result
+}
@@ -0,0 +1,48 @@
+package lag
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLastTickEvaluator_ExcludesStalePartition(t *testing.T) {
+	now := time.Now()
+	interval := 10 * time.Second
+	// Partitions 0 and 1 answered every tick; partition 2's leader missed
+	// the last one, so its latest sample is a tick old
+	samples := append(makeSamples(0, now, interval, 3, 100), makeSamples(1, now, interval, 3, 200)...)
+	samples = append(samples, makeSamples(2, now, interval, 2, 5000)...)
+
+	latest := AbsoluteEvaluator{Threshold: 500, SustainDuration: time.Minute}.Evaluate(samples)
+	if latest.TotalCurrentLag != 5300 || latest.TotalPartitions != 3 {
+		t.Fatalf("precondition: expected the stale partition in the latest total, got %d over %d partitions",
+			latest.TotalCurrentLag, latest.TotalPartitions)
+	}
+
+	e := LastTickEvaluator{Evaluator: AbsoluteEvaluator{Threshold: 500, SustainDuration: time.Minute}, Interval: interval}
+	result := e.Evaluate(samples)
+	if result.TotalCurrentLag != 300 {
+		t.Errorf("total lag = %d, want 300 without the stale partition", result.TotalCurrentLag)
+	}
+	if result.TotalPartitions != 2 {
+		t.Errorf("total partitions = %d, want 2", result.TotalPartitions)
+	}
+	// Per-partition results still include it
+	if result.PartitionLag[2] != 5000 || result.MaxLagPartition != 2 {
+		t.Errorf("expected partition 2's lag to still be reported, got %+v", result)
+	}
+}
+
+func TestLastTickEvaluator_AllFresh(t *testing.T) {
+	now := time.Now()
+	samples := append(makeSamples(0, now, 10*time.Second, 3, 100), makeSamples(1, now, 10*time.Second, 3, 200)...)
+
+	result := LastTickEvaluator{Evaluator: AbsoluteEvaluator{Threshold: 500}, Interval: 10 * time.Second}.Evaluate(samples)
+	if result.TotalCurrentLag != 300 || result.TotalPartitions != 2 {
+		t.Errorf("got %d over %d partitions, want 300 over 2", result.TotalCurrentLag, result.TotalPartitions)
+	}
+
+	if result := (LastTickEvaluator{Evaluator: AbsoluteEvaluator{}, Interval: time.Second}).Evaluate(nil); result.TotalPartitions != 0 {
+		t.Errorf("expected no partitions without samples, got %d", result.TotalPartitions)
+	}
+}
@@ -0,0 +1,58 @@
+package lag
+
+import "time"
+
+// CrossingEvaluator scales on lag oscillating around Threshold rather than
+// staying above it, a sign consumers run at the edge of their capacity: it
+// activates when some partition's lag crosses from below Threshold to at or
+// above it at least CrossingCount times. A series that starts above
+// Threshold hasn't crossed it. With RequireCurrent that partition's latest
+// lag must also be at or above Threshold. PanicThreshold, GroupStrategy and
+// Lookback behave as for AbsoluteEvaluator, Lookback bounding the samples
+// crossings are counted among.
+type CrossingEvaluator struct {
+	Threshold      int64
+	CrossingCount  int
+	PanicThreshold int64
+	GroupStrategy  GroupStrategy
+	RequireCurrent bool
+	Lookback       time.Duration
+}
+
+func (e CrossingEvaluator) Evaluate(samples []LagSample) EvaluationResult {
+	return e.EvaluateSeries(GroupByPartition(samples))
+}
+
+func (e CrossingEvaluator) EvaluateSeries(series PartitionSeries) EvaluationResult {
+	series = series.combineGroups(e.GroupStrategy)
+	result := evaluateSeries(series, e.Threshold, 0, 0, e.Lookback)
+
+	recent := series.withinLookback(e.Lookback)
+	var crossed []int
+	for _, p := range recent.partitions() {
+		if crossings(recent[p], e.Threshold) >= e.CrossingCount {
+			crossed = append(crossed, p)
+		}
+	}
+	if e.RequireCurrent {
+		crossed = currentPartitions(crossed, result.PartitionLag, e.Threshold)
+	}
+	result.Persistent = len(crossed) > 0
+	result.TriggerPartition = -1
+	if result.Persistent {
+		result.TriggerPartition = crossed[0]
+	}
+	return ApplyPanicThreshold(result, e.PanicThreshold)
+}
+
+// crossings counts the transitions in series, which must be ordered by
+// timestamp, from a sample below threshold to one at or above it.
+func crossings(series []LagSample, threshold int64) int {
+	n := 0
+	for i := 1; i < len(series); i++ {
+		if series[i-1].Lag < threshold && series[i].Lag >= threshold {
+			n++
+		}
+	}
+	return n
+}
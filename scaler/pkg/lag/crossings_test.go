@@ -0,0 +1,74 @@
+package lag
+
+import (
+	"testing"
+	"time"
+)
+
+// seriesOf builds samples 10s apart on partition, ending now, with the given
+// lags.
+func seriesOf(partition int, lags ...int64) []LagSample {
+	now := time.Now()
+	samples := make([]LagSample, len(lags))
+	for i, l := range lags {
+		samples[i] = LagSample{
+			Timestamp: now.Add(time.Duration(i-len(lags)+1) * 10 * time.Second),
+			Partition: partition,
+			Lag:       l,
+		}
+	}
+	return samples
+}
+
+func TestCrossingEvaluator_OscillatingLagActivates(t *testing.T) {
+	e := CrossingEvaluator{Threshold: 500, CrossingCount: 3}
+
+	// Crosses above 500 three times, never for long
+	oscillating := seriesOf(0, 100, 600, 200, 700, 300, 400, 800, 100)
+	result := e.Evaluate(oscillating)
+	if !result.Persistent {
+		t.Fatal("expected lag crossing the threshold 3 times to activate")
+	}
+	if result.TriggerPartition != 0 {
+		t.Errorf("TriggerPartition = %d, want 0", result.TriggerPartition)
+	}
+
+	e.CrossingCount = 4
+	if e.Evaluate(oscillating).Persistent {
+		t.Error("expected 3 crossings not to reach a count of 4")
+	}
+}
+
+func TestCrossingEvaluator_StableLagDoesNotActivate(t *testing.T) {
+	e := CrossingEvaluator{Threshold: 500, CrossingCount: 2}
+
+	tests := map[string][]LagSample{
+		"stable below":  seriesOf(0, 300, 320, 310, 300, 330, 300),
+		"stable above":  seriesOf(0, 900, 950, 920, 900, 980, 1000),
+		"crossing once": seriesOf(0, 100, 200, 600, 700, 800, 900),
+	}
+	for name, samples := range tests {
+		if e.Evaluate(samples).Persistent {
+			t.Errorf("%s: expected no activation", name)
+		}
+	}
+}
+
+func TestCrossingEvaluator_RequireCurrentAndLookback(t *testing.T) {
+	oscillating := seriesOf(1, 100, 600, 200, 700, 100)
+
+	e := CrossingEvaluator{Threshold: 500, CrossingCount: 2}
+	if !e.Evaluate(oscillating).Persistent {
+		t.Fatal("expected 2 crossings to activate")
+	}
+	e.RequireCurrent = true
+	if e.Evaluate(oscillating).Persistent {
+		t.Error("expected RequireCurrent to need the latest lag above the threshold")
+	}
+
+	// The first crossing is more than 20s before the newest sample
+	e = CrossingEvaluator{Threshold: 500, CrossingCount: 2, Lookback: 20 * time.Second}
+	if e.Evaluate(oscillating).Persistent {
+		t.Error("expected crossings before the lookback not to count")
+	}
+}
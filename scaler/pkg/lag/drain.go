@@ -0,0 +1,22 @@
+package lag
+
+import "time"
+
+// DrainedFor returns how long total lag across samples has continuously been
+// zero, from the first scrape of the current run of zero totals to the
+// newest one. It's 0 when the latest total is above zero or there are no
+// samples, and also for a drain seen by a single scrape; drained reports
+// whether the latest total is zero at all.
+func DrainedFor(samples []LagSample) (d time.Duration, drained bool) {
+	series := totalSeries(samples)
+	if len(series) == 0 || series[len(series)-1].Lag > 0 {
+		return 0, false
+	}
+
+	newest := series[len(series)-1].Timestamp
+	since := newest
+	for i := len(series) - 1; i >= 0 && series[i].Lag <= 0; i-- {
+		since = series[i].Timestamp
+	}
+	return newest.Sub(since), true
+}
@@ -0,0 +1,47 @@
+package lag
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDrainedFor(t *testing.T) {
+	start := time.Now()
+	tick := func(i int, lags ...int64) []LagSample {
+		var samples []LagSample
+		for p, l := range lags {
+			samples = append(samples, LagSample{Timestamp: start.Add(time.Duration(i) * 10 * time.Second), Partition: p, Lag: l})
+		}
+		return samples
+	}
+
+	tests := []struct {
+		name        string
+		samples     []LagSample
+		want        time.Duration
+		wantDrained bool
+	}{
+		{"no samples", nil, 0, false},
+		{"still lagging", append(tick(0, 0, 0), tick(1, 0, 5)...), 0, false},
+		{"single drained scrape", append(tick(0, 3, 0), tick(1, 0, 0)...), 0, true},
+		{"drained after lag", concat(tick(0, 3, 1), tick(1, 0, 0), tick(2, 0, 0), tick(3, 0, 0)), 20 * time.Second, true},
+		{"earlier drain interrupted", concat(tick(0, 0, 0), tick(1, 0, 2), tick(2, 0, 0), tick(3, 0, 0)), 10 * time.Second, true},
+		{"drained throughout", concat(tick(0, 0, 0), tick(1, 0, 0), tick(2, 0, 0)), 20 * time.Second, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, drained := DrainedFor(tt.samples)
+			if got != tt.want || drained != tt.wantDrained {
+				t.Errorf("DrainedFor = %s, %v; want %s, %v", got, drained, tt.want, tt.wantDrained)
+			}
+		})
+	}
+}
+
+func concat(ticks ...[]LagSample) []LagSample {
+	var samples []LagSample
+	for _, t := range ticks {
+		samples = append(samples, t...)
+	}
+	return samples
+}
@@ -1,83 +1,254 @@
 package lag
 
 import (
+	"encoding/json"
+	"log/slog"
 	"sort"
 	"time"
 )
 
+// EvaluationResult is a scaling decision and the figures behind it. Its JSON
+// form, shared by the debug endpoints and structured logs, keeps the field
+// names below stable and renders EstimatedDrainTime as a duration string.
 type EvaluationResult struct {
-	Persistent      bool
-	TotalCurrentLag int64
+	Persistent      bool  `json:"persistent"`
+	TotalCurrentLag int64 `json:"totalCurrentLag"`
+	// TriggerPartition is the partition whose lag satisfied persistence, or
+	// -1 when the result is not persistent.
+	TriggerPartition int `json:"triggerPartition"`
+	// MaxCurrentLag is the highest latest-sample lag of any partition, and
+	// MaxLagPartition the partition it belongs to (-1 with no samples).
+	MaxCurrentLag   int64 `json:"maxCurrentLag"`
+	MaxLagPartition int   `json:"maxLagPartition"`
+	// Panic is set when persistence was bypassed because current lag reached
+	// the panic threshold.
+	Panic bool `json:"panic"`
+	// LaggingPartitions is how many partitions' latest lag is at or above
+	// the threshold.
+	LaggingPartitions int `json:"laggingPartitions"`
+	// ConsumeRate is the summed latest consume rate of every partition, in
+	// messages/sec.
+	ConsumeRate float64 `json:"consumeRate"`
+	// EstimatedDrainTime is how long the backlog takes to clear at the
+	// current consume rate; 0 with no lag and negative when lag isn't being
+	// consumed. It's set by DrainTimeEvaluator.
+	EstimatedDrainTime time.Duration `json:"estimatedDrainTime"`
+	// TotalPartitions is how many partitions TotalCurrentLag sums.
+	TotalPartitions int `json:"totalPartitions"`
+	// PartitionLag is each partition's latest lag.
+	PartitionLag map[int]int64 `json:"partitionLag"`
+	// NewestSample is the timestamp of the newest sample evaluated, zero
+	// with no samples.
+	NewestSample time.Time `json:"newestSample"`
+	// EvaluatedAt is when the evaluation ran. It is set by the caller that
+	// owns the clock, so a cached result keeps its original time.
+	EvaluatedAt time.Time `json:"evaluatedAt"`
+	// WarmingUp is set when the decision was suppressed because the window
+	// hasn't accumulated enough samples yet.
+	WarmingUp bool `json:"warmingUp"`
+	// ScrapedPartitions is how many partitions the latest scrape sampled. It's
+	// set by the caller, only when it normalizes lag by partition count.
+	ScrapedPartitions int `json:"scrapedPartitions"`
+	// NoMembers is set when the decision was suppressed because no consumer
+	// group had active members at the latest scrape.
+	NoMembers bool `json:"noMembers"`
+	// ScheduleSuppressed is set when the decision was suppressed because the
+	// evaluation fell within the suppress schedule.
+	ScheduleSuppressed bool `json:"scheduleSuppressed"`
+	// LeaderChanged holds the partitions whose latest sample was the first
+	// after a leader change, nil when there are none.
+	LeaderChanged map[int]bool `json:"leaderChanged"`
 }
 
-// EvaluatePersistence checks whether lag has exceeded the threshold continuously
-// for at least sustainDuration on any partition. It groups samples by partition
-// and finds the longest continuous stretch where ALL samples have Lag > threshold.
-func EvaluatePersistence(samples []LagSample, threshold int64, sustainDuration time.Duration) EvaluationResult {
-	if len(samples) == 0 {
-		return EvaluationResult{}
+// MarshalJSON renders EstimatedDrainTime as a human-readable string.
+func (r EvaluationResult) MarshalJSON() ([]byte, error) {
+	type plain EvaluationResult
+	return json.Marshal(struct {
+		plain
+		EstimatedDrainTime string `json:"estimatedDrainTime"`
+	}{
+		plain:              plain(r),
+		EstimatedDrainTime: r.EstimatedDrainTime.String(),
+	})
+}
+
+// LogValue logs the result as its JSON, so logs and the debug endpoints
+// agree on its fields.
+func (r EvaluationResult) LogValue() slog.Value {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return slog.StringValue(err.Error())
 	}
+	return slog.AnyValue(json.RawMessage(b))
+}
 
-	// Group samples by partition
-	byPartition := make(map[int][]LagSample)
-	latestByPartition := make(map[int]LagSample)
+// Evaluator turns a window snapshot into a scaling decision.
+type Evaluator interface {
+	Evaluate(samples []LagSample) EvaluationResult
+}
+
+// AbsoluteEvaluator requires absolute lag to stay at or above Threshold for
+// SustainDuration on some partition, with PanicThreshold as an immediate
+// override. Samples from several consumer groups are first combined per
+// GroupStrategy. With RequireCurrent, that partition's latest lag must also
+// still be at or above Threshold, so a stretch that has since drained no
+// longer counts. A positive Lookback only searches for the stretch among
+// samples taken within Lookback of the newest, so an old stretch in a long
+// window can't satisfy persistence.
+type AbsoluteEvaluator struct {
+	Threshold         int64
+	SustainDuration   time.Duration
+	MinStretchSamples int
+	PanicThreshold    int64
+	GroupStrategy     GroupStrategy
+	RequireCurrent    bool
+	Lookback          time.Duration
+}
+
+func (e AbsoluteEvaluator) Evaluate(samples []LagSample) EvaluationResult {
+	return e.EvaluateSeries(GroupByPartition(samples))
+}
 
-	for _, s := range samples {
-		byPartition[s.Partition] = append(byPartition[s.Partition], s)
-		if existing, ok := latestByPartition[s.Partition]; !ok || s.Timestamp.After(existing.Timestamp) {
-			latestByPartition[s.Partition] = s
+func (e AbsoluteEvaluator) EvaluateSeries(series PartitionSeries) EvaluationResult {
+	series = series.combineGroups(e.GroupStrategy)
+	result := evaluateSeries(series, e.Threshold, e.SustainDuration, e.MinStretchSamples, e.Lookback)
+	if e.RequireCurrent {
+		sustained := currentPartitions(persistentPartitions(series.withinLookback(e.Lookback), e.Threshold, e.SustainDuration, e.MinStretchSamples), result.PartitionLag, e.Threshold)
+		result.Persistent = len(sustained) > 0
+		result.TriggerPartition = -1
+		if result.Persistent {
+			result.TriggerPartition = sustained[0]
 		}
 	}
+	return ApplyPanicThreshold(result, e.PanicThreshold)
+}
+
+// currentPartitions keeps the partitions whose latest lag is still at or
+// above threshold.
+func currentPartitions(partitions []int, partitionLag map[int]int64, threshold int64) []int {
+	var current []int
+	for _, p := range partitions {
+		if partitionLag[p] >= threshold {
+			current = append(current, p)
+		}
+	}
+	return current
+}
+
+// EvaluatePersistence checks whether lag has exceeded the threshold continuously
+// for at least sustainDuration on any partition. It groups samples by partition
+// and finds the longest continuous stretch where ALL samples have Lag >= threshold.
+// When minStretchSamples is positive the stretch must also contain at least
+// that many samples, so two far-apart samples can't establish persistence alone.
+// A stretch spans from its first sample to its last, so with a sustainDuration
+// of 0 a single sample at or above the threshold is persistent on its own.
+func EvaluatePersistence(samples []LagSample, threshold int64, sustainDuration time.Duration, minStretchSamples int) EvaluationResult {
+	return evaluatePersistence(samples, threshold, sustainDuration, minStretchSamples, 0)
+}
 
-	// Compute total current lag from latest sample per partition
-	var totalCurrentLag int64
-	for _, s := range latestByPartition {
+// evaluatePersistence is EvaluatePersistence searching for a stretch only
+// among the samples within lookback of the newest, while current lag is still
+// reported from every sample; a lookback of 0 searches them all.
+func evaluatePersistence(samples []LagSample, threshold int64, sustainDuration time.Duration, minStretchSamples int, lookback time.Duration) EvaluationResult {
+	return evaluateSeries(GroupByPartition(samples), threshold, sustainDuration, minStretchSamples, lookback)
+}
+
+// evaluateSeries is evaluatePersistence for samples already grouped by
+// partition.
+func evaluateSeries(series PartitionSeries, threshold int64, sustainDuration time.Duration, minStretchSamples int, lookback time.Duration) EvaluationResult {
+	if series.Len() == 0 {
+		return EvaluationResult{TriggerPartition: -1, MaxLagPartition: -1}
+	}
+
+	// Compute total and max current lag from latest sample per partition
+	var totalCurrentLag, maxCurrentLag int64
+	maxLagPartition := -1
+	laggingPartitions := 0
+	var consumeRate float64
+	var leaderChanged map[int]bool
+	partitionLag := make(map[int]int64, len(series))
+	for p, ss := range series {
+		if len(ss) == 0 {
+			continue
+		}
+		s := latestSample(ss)
+		partitionLag[p] = s.Lag
+		if s.LeaderChanged {
+			if leaderChanged == nil {
+				leaderChanged = make(map[int]bool)
+			}
+			leaderChanged[p] = true
+		}
 		totalCurrentLag += s.Lag
+		consumeRate += s.ConsumeRate
+		if s.Lag >= threshold {
+			laggingPartitions++
+		}
+		if maxLagPartition == -1 || s.Lag > maxCurrentLag || (s.Lag == maxCurrentLag && p < maxLagPartition) {
+			maxCurrentLag = s.Lag
+			maxLagPartition = p
+		}
 	}
 
-	// Check each partition for persistent lag
-	persistent := false
-	for _, partSamples := range byPartition {
-		// Sort by timestamp
-		sort.Slice(partSamples, func(i, j int) bool {
-			return partSamples[i].Timestamp.Before(partSamples[j].Timestamp)
-		})
+	// Check each partition for persistent lag, lowest partition first so the
+	// reported trigger is deterministic
+	runs := seriesStretches(series.withinLookback(lookback), threshold)
+	partitions := make([]int, 0, len(runs))
+	for p := range runs {
+		partitions = append(partitions, p)
+	}
+	sort.Ints(partitions)
 
-		if hasPersistentLag(partSamples, threshold, sustainDuration) {
+	persistent := false
+	triggerPartition := -1
+	for _, p := range partitions {
+		if anySustains(runs[p], sustainDuration, minStretchSamples) {
 			persistent = true
+			triggerPartition = p
 			break
 		}
 	}
 
 	return EvaluationResult{
-		Persistent:      persistent,
-		TotalCurrentLag: totalCurrentLag,
+		Persistent:        persistent,
+		TotalCurrentLag:   totalCurrentLag,
+		TotalPartitions:   len(partitionLag),
+		TriggerPartition:  triggerPartition,
+		MaxCurrentLag:     maxCurrentLag,
+		MaxLagPartition:   maxLagPartition,
+		LaggingPartitions: laggingPartitions,
+		ConsumeRate:       consumeRate,
+		PartitionLag:      partitionLag,
+		NewestSample:      series.newest(),
+		LeaderChanged:     leaderChanged,
 	}
 }
 
-// hasPersistentLag checks if there's a continuous stretch of samples above
-// the threshold that spans at least sustainDuration.
-func hasPersistentLag(samples []LagSample, threshold int64, sustainDuration time.Duration) bool {
-	if len(samples) == 0 {
-		return false
+// ApplyPanicThreshold marks result persistent when any partition's current lag
+// has reached panicThreshold, bypassing the sustain requirement. A partition
+// whose latest sample followed a leader change is left out, so a one-tick
+// spike from leaders disagreeing on the end offset can't panic; sustained lag
+// there still counts. A panicThreshold of 0 disables the check.
+func ApplyPanicThreshold(result EvaluationResult, panicThreshold int64) EvaluationResult {
+	if panicThreshold <= 0 || result.Persistent || result.MaxLagPartition < 0 {
+		return result
 	}
-
-	var stretchStart time.Time
-	inStretch := false
-
-	for _, s := range samples {
-		if s.Lag >= threshold {
-			if !inStretch {
-				stretchStart = s.Timestamp
-				inStretch = true
+	partition, maxLag := result.MaxLagPartition, result.MaxCurrentLag
+	if result.LeaderChanged[partition] {
+		partition = -1
+		for p, l := range result.PartitionLag {
+			if result.LeaderChanged[p] {
+				continue
 			}
-			if s.Timestamp.Sub(stretchStart) >= sustainDuration {
-				return true
+			if partition == -1 || l > maxLag || (l == maxLag && p < partition) {
+				partition, maxLag = p, l
 			}
-		} else {
-			inStretch = false
 		}
 	}
-
-	return false
+	if partition >= 0 && maxLag >= panicThreshold {
+		result.Persistent = true
+		result.Panic = true
+		result.TriggerPartition = partition
+	}
+	return result
 }
@@ -1,12 +1,62 @@
 package lag
 
 import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
 
+func TestEvaluationResult_MarshalJSON(t *testing.T) {
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	result := EvaluationResult{
+		Persistent:         true,
+		TotalCurrentLag:    1500,
+		TriggerPartition:   2,
+		MaxCurrentLag:      1200,
+		MaxLagPartition:    2,
+		LaggingPartitions:  1,
+		ConsumeRate:        12.5,
+		EstimatedDrainTime: 2 * time.Minute,
+		TotalPartitions:    3,
+		PartitionLag:       map[int]int64{0: 100, 1: 200, 2: 1200},
+		NewestSample:       at,
+		EvaluatedAt:        at.Add(time.Second),
+		LeaderChanged:      map[int]bool{1: true},
+	}
+
+	got, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"persistent":true,"totalCurrentLag":1500,"triggerPartition":2,"maxCurrentLag":1200,"maxLagPartition":2,` +
+		`"panic":false,"laggingPartitions":1,"consumeRate":12.5,"totalPartitions":3,"partitionLag":{"0":100,"1":200,"2":1200},` +
+		`"newestSample":"2024-03-01T12:00:00Z","evaluatedAt":"2024-03-01T12:00:01Z","warmingUp":false,"scrapedPartitions":0,` +
+		`"noMembers":false,"scheduleSuppressed":false,"leaderChanged":{"1":true},"estimatedDrainTime":"2m0s"}`
+	if string(got) != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal(got, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if n := reflect.TypeOf(result).NumField(); len(fields) != n {
+		t.Errorf("expected all %d fields, got %d: %s", n, len(fields), got)
+	}
+
+	var buf bytes.Buffer
+	slog.New(slog.NewJSONHandler(&buf, nil)).Info("evaluated", "evaluation", result)
+	if !strings.Contains(buf.String(), `"evaluation":`+want) {
+		t.Errorf("expected logs to share the JSON form, got %s", buf.String())
+	}
+}
+
 func TestEvaluatePersistence_NoSamples(t *testing.T) {
-	result := EvaluatePersistence(nil, 500, 2*time.Minute)
+	result := EvaluatePersistence(nil, 500, 2*time.Minute, 0)
 	if result.Persistent {
 		t.Error("expected not persistent with no samples")
 	}
@@ -19,7 +69,7 @@ func TestEvaluatePersistence_BelowThreshold(t *testing.T) {
 	now := time.Now()
 	samples := makeSamples(0, now, 10*time.Second, 20, 100) // lag=100, threshold=500
 
-	result := EvaluatePersistence(samples, 500, 2*time.Minute)
+	result := EvaluatePersistence(samples, 500, 2*time.Minute, 0)
 	if result.Persistent {
 		t.Error("expected not persistent when lag is below threshold")
 	}
@@ -30,7 +80,7 @@ func TestEvaluatePersistence_ShortStretch(t *testing.T) {
 	// 1 minute of high lag, but sustain requires 2 minutes
 	samples := makeSamples(0, now, 10*time.Second, 6, 1000)
 
-	result := EvaluatePersistence(samples, 500, 2*time.Minute)
+	result := EvaluatePersistence(samples, 500, 2*time.Minute, 0)
 	if result.Persistent {
 		t.Error("expected not persistent for short stretch")
 	}
@@ -41,7 +91,7 @@ func TestEvaluatePersistence_ExactDuration(t *testing.T) {
 	// Exactly 2 minutes of high lag (13 samples at 10s intervals = 120s from first to last)
 	samples := makeSamples(0, now, 10*time.Second, 13, 1000)
 
-	result := EvaluatePersistence(samples, 500, 2*time.Minute)
+	result := EvaluatePersistence(samples, 500, 2*time.Minute, 0)
 	if !result.Persistent {
 		t.Error("expected persistent at exact sustain duration")
 	}
@@ -52,7 +102,7 @@ func TestEvaluatePersistence_LongStretch(t *testing.T) {
 	// 5 minutes of high lag
 	samples := makeSamples(0, now, 10*time.Second, 30, 1000)
 
-	result := EvaluatePersistence(samples, 500, 2*time.Minute)
+	result := EvaluatePersistence(samples, 500, 2*time.Minute, 0)
 	if !result.Persistent {
 		t.Error("expected persistent for long stretch")
 	}
@@ -90,7 +140,7 @@ func TestEvaluatePersistence_GapInMiddle(t *testing.T) {
 		})
 	}
 
-	result := EvaluatePersistence(samples, 500, 2*time.Minute)
+	result := EvaluatePersistence(samples, 500, 2*time.Minute, 0)
 	if result.Persistent {
 		t.Error("expected not persistent when gap breaks the stretch")
 	}
@@ -106,7 +156,7 @@ func TestEvaluatePersistence_MultiPartition(t *testing.T) {
 	p1 := makeSamples(1, now, 10*time.Second, 15, 800)
 
 	all := append(p0, p1...)
-	result := EvaluatePersistence(all, 500, 2*time.Minute)
+	result := EvaluatePersistence(all, 500, 2*time.Minute, 0)
 	if !result.Persistent {
 		t.Error("expected persistent when at least one partition has persistent lag")
 	}
@@ -114,6 +164,9 @@ func TestEvaluatePersistence_MultiPartition(t *testing.T) {
 	if result.TotalCurrentLag != 1800 {
 		t.Errorf("expected total lag 1800, got %d", result.TotalCurrentLag)
 	}
+	if result.TriggerPartition != 1 {
+		t.Errorf("expected partition 1 to trigger, got %d", result.TriggerPartition)
+	}
 }
 
 func TestEvaluatePersistence_LagAtExactThreshold(t *testing.T) {
@@ -121,7 +174,7 @@ func TestEvaluatePersistence_LagAtExactThreshold(t *testing.T) {
 	// Lag == threshold should count (>= not >)
 	samples := makeSamples(0, now, 10*time.Second, 13, 500) // lag=500, threshold=500
 
-	result := EvaluatePersistence(samples, 500, 2*time.Minute)
+	result := EvaluatePersistence(samples, 500, 2*time.Minute, 0)
 	if !result.Persistent {
 		t.Error("expected persistent when lag equals threshold for sustained period")
 	}
@@ -131,7 +184,7 @@ func TestEvaluatePersistence_LagJustBelowThreshold(t *testing.T) {
 	now := time.Now()
 	samples := makeSamples(0, now, 10*time.Second, 13, 499) // lag=499, threshold=500
 
-	result := EvaluatePersistence(samples, 500, 2*time.Minute)
+	result := EvaluatePersistence(samples, 500, 2*time.Minute, 0)
 	if result.Persistent {
 		t.Error("expected not persistent when lag is just below threshold")
 	}
@@ -146,7 +199,7 @@ func TestEvaluatePersistence_TotalLagFromLatest(t *testing.T) {
 		{Timestamp: now.Add(10 * time.Second), Partition: 1, Lag: 400},
 	}
 
-	result := EvaluatePersistence(samples, 500, 2*time.Minute)
+	result := EvaluatePersistence(samples, 500, 2*time.Minute, 0)
 	// Latest for p0 = 200, latest for p1 = 400
 	if result.TotalCurrentLag != 600 {
 		t.Errorf("expected total lag 600, got %d", result.TotalCurrentLag)
@@ -165,3 +218,279 @@ func makeSamples(partition int, start time.Time, interval time.Duration, n int,
 	}
 	return samples
 }
+
+func TestEvaluatePersistence_MaxCurrentLag(t *testing.T) {
+	now := time.Now()
+	samples := []LagSample{
+		{Timestamp: now, Partition: 0, Lag: 300},
+		{Timestamp: now, Partition: 1, Lag: 900},
+		{Timestamp: now, Partition: 2, Lag: 100},
+	}
+
+	result := EvaluatePersistence(samples, 500, 2*time.Minute, 0)
+	if result.MaxCurrentLag != 900 || result.MaxLagPartition != 1 {
+		t.Errorf("expected max lag 900 on partition 1, got %d on %d", result.MaxCurrentLag, result.MaxLagPartition)
+	}
+}
+
+func TestEvaluatePersistence_PartitionLag(t *testing.T) {
+	now := time.Now()
+	samples := []LagSample{
+		{Timestamp: now, Partition: 0, Lag: 300},
+		{Timestamp: now.Add(10 * time.Second), Partition: 0, Lag: 250},
+		{Timestamp: now, Partition: 2, Lag: 900},
+	}
+
+	result := EvaluatePersistence(samples, 500, 2*time.Minute, 0)
+	if len(result.PartitionLag) != 2 || result.PartitionLag[0] != 250 || result.PartitionLag[2] != 900 {
+		t.Errorf("unexpected partition lag: %v", result.PartitionLag)
+	}
+}
+
+func TestApplyPanicThreshold_ActivatesImmediately(t *testing.T) {
+	now := time.Now()
+	// A single sample can never be persistent for a 2 minute sustain
+	samples := []LagSample{
+		{Timestamp: now, Partition: 0, Lag: 100},
+		{Timestamp: now, Partition: 1, Lag: 50000},
+	}
+
+	result := ApplyPanicThreshold(EvaluatePersistence(samples, 500, 2*time.Minute, 0), 10000)
+	if !result.Persistent || !result.Panic {
+		t.Fatalf("expected panic activation, got %+v", result)
+	}
+	if result.TriggerPartition != 1 {
+		t.Errorf("expected partition 1 to trigger, got %d", result.TriggerPartition)
+	}
+	if result.TotalCurrentLag != 50100 {
+		t.Errorf("expected full total lag 50100, got %d", result.TotalCurrentLag)
+	}
+}
+
+func TestApplyPanicThreshold_BelowPanicUsesSustain(t *testing.T) {
+	now := time.Now()
+	short := makeSamples(0, now, 10*time.Second, 6, 5000) // above threshold, too short
+	long := makeSamples(1, now, 10*time.Second, 13, 5000) // above threshold, sustained
+
+	result := ApplyPanicThreshold(EvaluatePersistence(short, 500, 2*time.Minute, 0), 10000)
+	if result.Persistent || result.Panic {
+		t.Errorf("expected no activation below panic threshold without sustain, got %+v", result)
+	}
+
+	result = ApplyPanicThreshold(EvaluatePersistence(long, 500, 2*time.Minute, 0), 10000)
+	if !result.Persistent || result.Panic {
+		t.Errorf("expected normal sustained activation, got %+v", result)
+	}
+}
+
+func TestApplyPanicThreshold_IgnoresLeaderChangeSpike(t *testing.T) {
+	now := time.Now()
+	samples := []LagSample{
+		{Timestamp: now, Partition: 0, Lag: 12000},
+		{Timestamp: now, Partition: 1, Lag: 50000, LeaderChanged: true},
+	}
+
+	result := ApplyPanicThreshold(EvaluatePersistence(samples, 500, 2*time.Minute, 0), 10000)
+	if !result.Persistent || result.TriggerPartition != 0 {
+		t.Errorf("expected partition 0 to panic in place of the flagged partition 1, got %+v", result)
+	}
+
+	samples[0].Lag = 100
+	result = ApplyPanicThreshold(EvaluatePersistence(samples, 500, 2*time.Minute, 0), 10000)
+	if result.Persistent || result.Panic {
+		t.Errorf("expected no panic on a spike right after a leader change, got %+v", result)
+	}
+	if result.MaxCurrentLag != 50000 || !result.LeaderChanged[1] {
+		t.Errorf("expected the spike still reported and flagged, got %+v", result)
+	}
+
+	// The next sample isn't flagged, so a spike that lasts panics
+	samples = append(samples, LagSample{Timestamp: now.Add(10 * time.Second), Partition: 1, Lag: 50000})
+	result = ApplyPanicThreshold(EvaluatePersistence(samples, 500, 2*time.Minute, 0), 10000)
+	if !result.Persistent || !result.Panic || result.TriggerPartition != 1 {
+		t.Errorf("expected panic once the spike outlasts the leader change, got %+v", result)
+	}
+}
+
+func TestApplyPanicThreshold_Disabled(t *testing.T) {
+	samples := []LagSample{{Timestamp: time.Now(), Partition: 0, Lag: 1 << 40}}
+
+	result := ApplyPanicThreshold(EvaluatePersistence(samples, 500, 2*time.Minute, 0), 0)
+	if result.Persistent {
+		t.Error("expected panic threshold of 0 to be disabled")
+	}
+}
+
+func TestEvaluatePersistence_MinStretchSamples(t *testing.T) {
+	now := time.Now()
+	// Two samples three minutes apart span the sustain duration on their own
+	samples := []LagSample{
+		{Timestamp: now, Partition: 0, Lag: 1000},
+		{Timestamp: now.Add(3 * time.Minute), Partition: 0, Lag: 1000},
+	}
+
+	if result := EvaluatePersistence(samples, 500, 2*time.Minute, 0); !result.Persistent {
+		t.Error("expected persistent without a sample-count requirement")
+	}
+	if result := EvaluatePersistence(samples, 500, 2*time.Minute, 5); result.Persistent {
+		t.Error("expected not persistent when the stretch has fewer than minStretchSamples samples")
+	}
+
+	dense := makeSamples(0, now, 10*time.Second, 13, 1000)
+	if result := EvaluatePersistence(dense, 500, 2*time.Minute, 5); !result.Persistent {
+		t.Error("expected persistent when the stretch meets both duration and sample count")
+	}
+}
+
+func TestEvaluatePersistence_NewestSample(t *testing.T) {
+	now := time.Now()
+	// Partition 1 is 30s ahead of partition 0; input order doesn't matter.
+	samples := append(makeSamples(1, now.Add(-90*time.Second), 10*time.Second, 10, 100),
+		makeSamples(0, now.Add(-2*time.Minute), 10*time.Second, 10, 100)...)
+
+	result := EvaluatePersistence(samples, 500, 2*time.Minute, 0)
+	if !result.NewestSample.Equal(now) {
+		t.Errorf("NewestSample = %v, want %v", result.NewestSample, now)
+	}
+
+	if empty := EvaluatePersistence(nil, 500, 2*time.Minute, 0); !empty.NewestSample.IsZero() {
+		t.Errorf("expected zero NewestSample with no samples, got %v", empty.NewestSample)
+	}
+}
+
+func TestAbsoluteEvaluator_RequireCurrent(t *testing.T) {
+	now := time.Now()
+	// Partition 0 sustained 1000 for 2 minutes, then drained to 100
+	samples := append(makeSamples(0, now, 10*time.Second, 13, 1000),
+		LagSample{Timestamp: now.Add(130 * time.Second), Partition: 0, Lag: 100})
+
+	e := AbsoluteEvaluator{Threshold: 500, SustainDuration: 2 * time.Minute}
+	if !e.Evaluate(samples).Persistent {
+		t.Fatal("precondition: the old stretch should be persistent by default")
+	}
+
+	e.RequireCurrent = true
+	result := e.Evaluate(samples)
+	if result.Persistent || result.TriggerPartition != -1 {
+		t.Errorf("expected a drained stretch not to activate, got %+v", result)
+	}
+
+	// A second partition that is still lagging activates on its own
+	samples = append(samples, makeSamples(1, now.Add(10*time.Second), 10*time.Second, 13, 800)...)
+	result = e.Evaluate(samples)
+	if !result.Persistent || result.TriggerPartition != 1 {
+		t.Errorf("expected partition 1 to trigger, got %+v", result)
+	}
+}
+
+func TestEvaluators_LookbackExcludesOldStretch(t *testing.T) {
+	now := time.Now()
+	// 3 minutes at 1000, then 5 minutes at 100: the sustained stretch ended
+	// 5 minutes before the newest sample
+	samples := append(makeSamples(0, now, 10*time.Second, 19, 1000),
+		makeSamples(0, now.Add(190*time.Second), 10*time.Second, 30, 100)...)
+
+	evaluators := map[string]func(lookback time.Duration) Evaluator{
+		"absolute": func(lookback time.Duration) Evaluator {
+			return AbsoluteEvaluator{Threshold: 500, SustainDuration: 2 * time.Minute, Lookback: lookback}
+		},
+		"breadth": func(lookback time.Duration) Evaluator {
+			return BreadthEvaluator{Threshold: 500, SustainDuration: 2 * time.Minute, Lookback: lookback}
+		},
+		"total": func(lookback time.Duration) Evaluator {
+			return TotalEvaluator{Threshold: 500, SustainDuration: 2 * time.Minute, Lookback: lookback}
+		},
+	}
+
+	for name, evaluator := range evaluators {
+		t.Run(name, func(t *testing.T) {
+			if !evaluator(0).Evaluate(samples).Persistent {
+				t.Fatal("precondition: the old stretch should be persistent without a lookback")
+			}
+			if !evaluator(10 * time.Minute).Evaluate(samples).Persistent {
+				t.Error("expected a lookback covering the whole stretch to keep it")
+			}
+
+			// Reaching a minute into the stretch leaves too little of it
+			result := evaluator(6 * time.Minute).Evaluate(samples)
+			if result.Persistent {
+				t.Error("expected a lookback cutting the stretch short to exclude it")
+			}
+
+			result = evaluator(4 * time.Minute).Evaluate(samples)
+			if result.Persistent || result.TriggerPartition != -1 {
+				t.Errorf("expected a lookback past the stretch to exclude it, got %+v", result)
+			}
+			if result.TotalCurrentLag != 100 {
+				t.Errorf("current lag = %d, want 100", result.TotalCurrentLag)
+			}
+		})
+	}
+}
+
+func TestEvaluatePersistence_ZeroSustainSingleSample(t *testing.T) {
+	now := time.Now()
+
+	result := EvaluatePersistence([]LagSample{{Timestamp: now, Partition: 2, Lag: 500}}, 500, 0, 0)
+	if !result.Persistent || result.TriggerPartition != 2 {
+		t.Errorf("expected one sample at the threshold to persist with zero sustain, got %+v", result)
+	}
+
+	result = EvaluatePersistence([]LagSample{{Timestamp: now, Partition: 2, Lag: 499}}, 500, 0, 0)
+	if result.Persistent {
+		t.Error("expected one sample below the threshold not to persist")
+	}
+}
+
+func TestEvaluatePersistence_ZeroSustainTwoSamples(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		samples []LagSample
+		want    bool
+	}{
+		{"both above", makeSamples(0, now, 10*time.Second, 2, 800), true},
+		{"only the newest above", []LagSample{
+			{Timestamp: now, Partition: 0, Lag: 100},
+			{Timestamp: now.Add(10 * time.Second), Partition: 0, Lag: 800},
+		}, true},
+		{"only the oldest above", []LagSample{
+			{Timestamp: now, Partition: 0, Lag: 800},
+			{Timestamp: now.Add(10 * time.Second), Partition: 0, Lag: 100},
+		}, true},
+		{"newest first", []LagSample{
+			{Timestamp: now.Add(10 * time.Second), Partition: 0, Lag: 800},
+			{Timestamp: now, Partition: 0, Lag: 100},
+		}, true},
+		{"both below", makeSamples(0, now, 10*time.Second, 2, 100), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EvaluatePersistence(tt.samples, 500, 0, 0).Persistent; got != tt.want {
+				t.Errorf("persistent = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// RequireCurrent narrows zero sustain to the latest sample
+	e := AbsoluteEvaluator{Threshold: 500, RequireCurrent: true}
+	if e.Evaluate(tests[2].samples).Persistent {
+		t.Error("expected a drained sample not to persist with RequireCurrent")
+	}
+	if !e.Evaluate(tests[1].samples).Persistent {
+		t.Error("expected a current sample to persist with RequireCurrent")
+	}
+}
+
+func TestTotalEvaluator_ZeroSustainSingleTick(t *testing.T) {
+	now := time.Now()
+	// Neither partition reaches the threshold alone, their sum does
+	samples := []LagSample{
+		{Timestamp: now, Partition: 0, Lag: 300},
+		{Timestamp: now, Partition: 1, Lag: 300},
+	}
+	if !(TotalEvaluator{Threshold: 500}).Evaluate(samples).Persistent {
+		t.Error("expected a single tick totalling above the threshold to persist with zero sustain")
+	}
+}
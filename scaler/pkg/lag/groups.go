@@ -0,0 +1,52 @@
+package lag
+
+import "time"
+
+// GroupStrategy controls how samples from several consumer groups on the same
+// partition are combined into one before evaluation.
+type GroupStrategy string
+
+const (
+	// GroupSum adds the lag of every group.
+	GroupSum GroupStrategy = "sum"
+	// GroupMax keeps the sample of the group with the most lag, i.e. the
+	// slowest of several equivalent groups.
+	GroupMax GroupStrategy = "max"
+)
+
+// CombineGroups merges samples that share a topic, partition and timestamp but
+// come from different consumer groups. The result has one sample per
+// (Topic, Partition, Timestamp), in the order each was first seen. Samples
+// from a single group pass through unchanged.
+func CombineGroups(samples []LagSample, strategy GroupStrategy) []LagSample {
+	type key struct {
+		topic     string
+		partition int
+		timestamp time.Time
+	}
+
+	index := make(map[key]int, len(samples))
+	combined := make([]LagSample, 0, len(samples))
+	for _, s := range samples {
+		k := key{s.Topic, s.Partition, s.Timestamp}
+		i, ok := index[k]
+		if !ok {
+			index[k] = len(combined)
+			combined = append(combined, s)
+			continue
+		}
+
+		existing := &combined[i]
+		switch strategy {
+		case GroupMax:
+			if s.Lag > existing.Lag {
+				*existing = s
+			}
+		default:
+			existing.Lag += s.Lag
+			existing.ConsumeRate += s.ConsumeRate
+			existing.Group = ""
+		}
+	}
+	return combined
+}
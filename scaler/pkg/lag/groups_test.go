@@ -0,0 +1,61 @@
+package lag
+
+import (
+	"testing"
+	"time"
+)
+
+func twoGroupSamples(now time.Time) []LagSample {
+	return []LagSample{
+		{Timestamp: now, Topic: "orders", Group: "group-a", Partition: 0, Lag: 300},
+		{Timestamp: now, Topic: "orders", Group: "group-a", Partition: 1, Lag: 50},
+		{Timestamp: now, Topic: "orders", Group: "group-b", Partition: 0, Lag: 700},
+		{Timestamp: now, Topic: "orders", Group: "group-b", Partition: 1, Lag: 20},
+	}
+}
+
+func TestCombineGroups_Sum(t *testing.T) {
+	combined := CombineGroups(twoGroupSamples(time.Now()), GroupSum)
+
+	if len(combined) != 2 {
+		t.Fatalf("expected one sample per partition, got %+v", combined)
+	}
+	if combined[0].Lag != 1000 || combined[1].Lag != 70 {
+		t.Errorf("expected summed lag 1000/70, got %d/%d", combined[0].Lag, combined[1].Lag)
+	}
+}
+
+func TestCombineGroups_Max(t *testing.T) {
+	combined := CombineGroups(twoGroupSamples(time.Now()), GroupMax)
+
+	if len(combined) != 2 {
+		t.Fatalf("expected one sample per partition, got %+v", combined)
+	}
+	if combined[0].Lag != 700 || combined[0].Group != "group-b" {
+		t.Errorf("expected partition 0 to take group-b's lag 700, got %+v", combined[0])
+	}
+	if combined[1].Lag != 50 || combined[1].Group != "group-a" {
+		t.Errorf("expected partition 1 to take group-a's lag 50, got %+v", combined[1])
+	}
+}
+
+func TestCombineGroups_TotalLagByStrategy(t *testing.T) {
+	now := time.Now()
+	var samples []LagSample
+	for i := range 13 {
+		ts := now.Add(time.Duration(i-12) * 10 * time.Second)
+		samples = append(samples, twoGroupSamples(ts)...)
+	}
+
+	sum := EvaluatePersistence(CombineGroups(samples, GroupSum), 500, 2*time.Minute, 0)
+	maxed := EvaluatePersistence(CombineGroups(samples, GroupMax), 500, 2*time.Minute, 0)
+	if sum.TotalCurrentLag != 1070 {
+		t.Errorf("sum strategy total lag = %d, want 1070", sum.TotalCurrentLag)
+	}
+	if maxed.TotalCurrentLag != 750 {
+		t.Errorf("max strategy total lag = %d, want 750", maxed.TotalCurrentLag)
+	}
+	if !sum.Persistent || !maxed.Persistent {
+		t.Errorf("expected both strategies persistent, got sum=%v max=%v", sum.Persistent, maxed.Persistent)
+	}
+}
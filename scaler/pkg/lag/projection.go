@@ -0,0 +1,101 @@
+package lag
+
+import "time"
+
+// DrainTimeEvaluator estimates how long the backlog takes to clear at the
+// current consume rate, and reports Evaluator's result inactive when it
+// clears within Threshold: a backlog that drains on its own doesn't need more
+// consumers. A Threshold of 0 only sets the estimate.
+type DrainTimeEvaluator struct {
+	Evaluator Evaluator
+	Threshold time.Duration
+}
+
+func (e DrainTimeEvaluator) Evaluate(samples []LagSample) EvaluationResult {
+	return e.withDrainTime(e.Evaluator.Evaluate(samples), EstimateDrainTime(samples))
+}
+
+func (e DrainTimeEvaluator) EvaluateSeries(series PartitionSeries) EvaluationResult {
+	return e.withDrainTime(EvaluateSeries(e.Evaluator, series), estimateSeriesDrainTime(series))
+}
+
+// withDrainTime sets result's drain estimate, making it inactive when the
+// backlog clears within Threshold.
+func (e DrainTimeEvaluator) withDrainTime(result EvaluationResult, drainTime time.Duration) EvaluationResult {
+	result.EstimatedDrainTime = drainTime
+
+	if e.Threshold > 0 && result.Persistent && result.EstimatedDrainTime >= 0 && result.EstimatedDrainTime < e.Threshold {
+		result.Persistent = false
+		result.Panic = false
+		result.TriggerPartition = -1
+	}
+	return result
+}
+
+// EstimateDrainTime projects when the lag in samples clears: each consumer
+// group's latest lag summed over its partitions, divided by its summed
+// latest consume rate, taking the slowest group. Lag and rate are in
+// messages whatever unit lag is evaluated in. It's 0 with no lag, and -1
+// when some group has lag but consumed nothing since its previous scrape.
+func EstimateDrainTime(samples []LagSample) time.Duration {
+	latest := make(groupLatest)
+	for _, s := range samples {
+		latest.add(s)
+	}
+	return latest.drainTime()
+}
+
+// estimateSeriesDrainTime is EstimateDrainTime for samples already grouped
+// by partition.
+func estimateSeriesDrainTime(series PartitionSeries) time.Duration {
+	latest := make(groupLatest)
+	for _, ss := range series {
+		for _, s := range ss {
+			latest.add(s)
+		}
+	}
+	return latest.drainTime()
+}
+
+type groupPartition struct {
+	group     string
+	partition int
+}
+
+// groupLatest holds the latest sample of each consumer group's partitions.
+type groupLatest map[groupPartition]LagSample
+
+func (l groupLatest) add(s LagSample) {
+	k := groupPartition{s.Group, s.Partition}
+	if existing, ok := l[k]; !ok || s.Timestamp.After(existing.Timestamp) {
+		l[k] = s
+	}
+}
+
+// drainTime is the slowest group's projected drain time, as described for
+// EstimateDrainTime.
+func (l groupLatest) drainTime() time.Duration {
+	type backlog struct {
+		lag  int64
+		rate float64
+	}
+	groups := make(map[string]backlog)
+	for k, s := range l {
+		b := groups[k.group]
+		b.lag += s.Lag
+		b.rate += s.ConsumeRate
+		groups[k.group] = b
+	}
+
+	var slowest time.Duration
+	for _, b := range groups {
+		if b.lag <= 0 {
+			continue
+		}
+		if b.rate <= 0 {
+			return -1
+		}
+		slowest = max(slowest, time.Duration(float64(b.lag)/b.rate*float64(time.Second)))
+	}
+	return slowest
+}
@@ -0,0 +1,85 @@
+package lag
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEstimateDrainTime(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		samples []LagSample
+		want    time.Duration
+	}{
+		{"no samples", nil, 0},
+		{"no lag", []LagSample{{Timestamp: now, Partition: 0, ConsumeRate: 50}}, 0},
+		{"summed over partitions", []LagSample{
+			{Timestamp: now, Partition: 0, Lag: 3000, ConsumeRate: 40},
+			{Timestamp: now, Partition: 1, Lag: 3000, ConsumeRate: 60},
+		}, time.Minute},
+		{"latest sample per partition", []LagSample{
+			{Timestamp: now, Partition: 0, Lag: 9000, ConsumeRate: 10},
+			{Timestamp: now.Add(10 * time.Second), Partition: 0, Lag: 1000, ConsumeRate: 100},
+		}, 10 * time.Second},
+		{"slowest group", []LagSample{
+			{Timestamp: now, Group: "fast", Partition: 0, Lag: 1000, ConsumeRate: 100},
+			{Timestamp: now, Group: "slow", Partition: 0, Lag: 1000, ConsumeRate: 10},
+		}, 100 * time.Second},
+		{"a partition not consuming", []LagSample{
+			{Timestamp: now, Partition: 0, Lag: 1000, ConsumeRate: 100},
+			{Timestamp: now, Partition: 1, Lag: 1000},
+		}, 20 * time.Second},
+		{"a group not consuming", []LagSample{
+			{Timestamp: now, Group: "a", Partition: 0, Lag: 1000, ConsumeRate: 100},
+			{Timestamp: now, Group: "b", Partition: 0, Lag: 1000},
+		}, -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EstimateDrainTime(tt.samples); got != tt.want {
+				t.Errorf("EstimateDrainTime() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDrainTimeEvaluator_InactiveWhenDrainingSoon(t *testing.T) {
+	now := time.Now()
+	// 2 minutes at 6000 lag, consumed at 100 msg/s: clears in a minute
+	samples := makeSamples(0, now, 10*time.Second, 13, 6000)
+	for i := range samples {
+		samples[i].ConsumeRate = 100
+	}
+
+	inner := AbsoluteEvaluator{Threshold: 500, SustainDuration: 2 * time.Minute}
+	result := DrainTimeEvaluator{Evaluator: inner}.Evaluate(samples)
+	if !result.Persistent || result.EstimatedDrainTime != time.Minute {
+		t.Fatalf("expected persistent lag draining in 1m without a threshold, got persistent=%v drain=%s",
+			result.Persistent, result.EstimatedDrainTime)
+	}
+
+	result = DrainTimeEvaluator{Evaluator: inner, Threshold: 2 * time.Minute}.Evaluate(samples)
+	if result.Persistent || result.TriggerPartition != -1 {
+		t.Errorf("expected inactive while the backlog drains within the threshold, got %+v", result)
+	}
+	if result.TotalCurrentLag != 6000 {
+		t.Errorf("expected the lag to still be reported, got %d", result.TotalCurrentLag)
+	}
+
+	result = DrainTimeEvaluator{Evaluator: inner, Threshold: 30 * time.Second}.Evaluate(samples)
+	if !result.Persistent {
+		t.Error("expected active while the backlog takes longer than the threshold to drain")
+	}
+
+	// Nothing consumed: no estimate, so the threshold never applies
+	for i := range samples {
+		samples[i].ConsumeRate = 0
+	}
+	result = DrainTimeEvaluator{Evaluator: inner, Threshold: time.Hour}.Evaluate(samples)
+	if !result.Persistent || result.EstimatedDrainTime >= 0 {
+		t.Errorf("expected a stalled consumer to stay active, got persistent=%v drain=%s",
+			result.Persistent, result.EstimatedDrainTime)
+	}
+}
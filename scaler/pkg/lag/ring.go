@@ -0,0 +1,113 @@
+package lag
+
+// ring is the SlidingWindow's sample storage: a circular buffer holding
+// samples oldest first. Time-based eviction advances the head instead of
+// re-slicing, so the buffer's memory is reused across ticks rather than
+// reallocated as the window slides. It only grows, by doubling, when a tick
+// adds more samples than it has room for.
+type ring struct {
+	buf  []LagSample
+	head int
+	n    int
+}
+
+func newRing(capacity int) ring {
+	return ring{buf: make([]LagSample, max(capacity, 0))}
+}
+
+func (r *ring) len() int {
+	return r.n
+}
+
+// at returns the i-th oldest sample.
+func (r *ring) at(i int) *LagSample {
+	return &r.buf[(r.head+i)%len(r.buf)]
+}
+
+func (r *ring) push(samples ...LagSample) {
+	if r.n+len(samples) > len(r.buf) {
+		r.grow(r.n + len(samples))
+	}
+	for _, s := range samples {
+		r.buf[(r.head+r.n)%len(r.buf)] = s
+		r.n++
+	}
+}
+
+// grow reallocates the buffer to hold at least need samples, laying them out
+// from index 0.
+func (r *ring) grow(need int) {
+	capacity := max(len(r.buf)*2, 16)
+	for capacity < need {
+		capacity *= 2
+	}
+	buf := make([]LagSample, capacity)
+	r.copyTo(buf)
+	r.buf = buf
+	r.head = 0
+}
+
+// dropFront evicts the k oldest samples.
+func (r *ring) dropFront(k int) {
+	for i := range k {
+		// Zero the slot so evicted samples don't pin their strings
+		*r.at(i) = LagSample{}
+	}
+	r.head = (r.head + k) % max(len(r.buf), 1)
+	r.n -= k
+}
+
+// truncate drops every sample from the n-th oldest on.
+func (r *ring) truncate(n int) {
+	for i := n; i < r.n; i++ {
+		*r.at(i) = LagSample{}
+	}
+	r.n = n
+}
+
+// filter keeps the samples for which keep returns true, in order, and
+// reports how many were dropped.
+func (r *ring) filter(keep func(LagSample) bool) int {
+	kept := 0
+	for i := range r.n {
+		s := *r.at(i)
+		if keep(s) {
+			*r.at(kept) = s
+			kept++
+		}
+	}
+	dropped := r.n - kept
+	r.truncate(kept)
+	return dropped
+}
+
+// copyTo copies the samples, oldest first, into dst, which must have room
+// for them all.
+func (r *ring) copyTo(dst []LagSample) {
+	if r.n == 0 {
+		return
+	}
+	end := r.head + r.n
+	if end <= len(r.buf) {
+		copy(dst, r.buf[r.head:end])
+		return
+	}
+	k := copy(dst, r.buf[r.head:])
+	copy(dst[k:], r.buf[:end-len(r.buf)])
+}
+
+// linear rotates the samples to the start of the buffer and returns them as
+// a slice sharing its memory, for in-place sorting.
+func (r *ring) linear() []LagSample {
+	if r.head+r.n > len(r.buf) {
+		buf := make([]LagSample, len(r.buf))
+		r.copyTo(buf)
+		r.buf = buf
+		r.head = 0
+	} else if r.head != 0 {
+		copy(r.buf, r.buf[r.head:r.head+r.n])
+		clear(r.buf[r.n : r.head+r.n])
+		r.head = 0
+	}
+	return r.buf[:r.n]
+}
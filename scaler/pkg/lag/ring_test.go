@@ -0,0 +1,183 @@
+package lag
+
+import (
+	"math/rand/v2"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// sliceWindow is the SlidingWindow storage the ring replaced: a slice that is
+// appended to and re-sliced on eviction. It's kept as a reference for the
+// ring's semantics and allocations.
+type sliceWindow struct {
+	samples        []LagSample
+	windowSize     int
+	windowDuration time.Duration
+	policy         EvictionPolicy
+}
+
+func (w *sliceWindow) Add(samples ...LagSample) {
+	w.samples = append(w.samples, samples...)
+	if w.policy == EvictByTime || w.policy == EvictHybrid {
+		cutoff := time.Now().Add(-w.windowDuration)
+		i := 0
+		for i < len(w.samples) && w.samples[i].Timestamp.Before(cutoff) {
+			i++
+		}
+		w.samples = w.samples[i:]
+	}
+	if w.policy == EvictByCount || w.policy == EvictHybrid {
+		type key struct {
+			topic     string
+			group     string
+			partition int
+		}
+		seen := make(map[key]int)
+		keep := make([]bool, len(w.samples))
+		for i := len(w.samples) - 1; i >= 0; i-- {
+			k := key{w.samples[i].Topic, w.samples[i].Group, w.samples[i].Partition}
+			seen[k]++
+			keep[i] = seen[k] <= w.windowSize
+		}
+		var kept []LagSample
+		for i, s := range w.samples {
+			if keep[i] {
+				kept = append(kept, s)
+			}
+		}
+		w.samples = kept
+	}
+}
+
+func (w *sliceWindow) Remove(pred func(LagSample) bool) {
+	kept := w.samples[:0]
+	for _, s := range w.samples {
+		if !pred(s) {
+			kept = append(kept, s)
+		}
+	}
+	w.samples = kept
+}
+
+func TestRing_WrapsAround(t *testing.T) {
+	r := newRing(4)
+	for i := range 3 {
+		r.push(LagSample{Lag: int64(i)})
+	}
+	r.dropFront(2)
+	r.push(LagSample{Lag: 3}, LagSample{Lag: 4})
+
+	if len(r.buf) != 4 {
+		t.Fatalf("expected the buffer to be reused, got capacity %d", len(r.buf))
+	}
+	out := make([]LagSample, r.len())
+	r.copyTo(out)
+	for i, want := range []int64{2, 3, 4} {
+		if out[i].Lag != want {
+			t.Errorf("sample %d lag = %d, want %d", i, out[i].Lag, want)
+		}
+	}
+
+	// Growing while wrapped keeps the order
+	r.push(LagSample{Lag: 5}, LagSample{Lag: 6})
+	out = make([]LagSample, r.len())
+	r.copyTo(out)
+	for i, want := range []int64{2, 3, 4, 5, 6} {
+		if out[i].Lag != want {
+			t.Errorf("after growing, sample %d lag = %d, want %d", i, out[i].Lag, want)
+		}
+	}
+}
+
+func TestRing_LinearWhileWrapped(t *testing.T) {
+	r := newRing(4)
+	r.push(LagSample{Lag: 0}, LagSample{Lag: 1}, LagSample{Lag: 2}, LagSample{Lag: 3})
+	r.dropFront(3)
+	r.push(LagSample{Lag: 4}, LagSample{Lag: 5})
+
+	got := r.linear()
+	if len(got) != 3 || got[0].Lag != 3 || got[1].Lag != 4 || got[2].Lag != 5 {
+		t.Errorf("unexpected linear samples: %+v", got)
+	}
+}
+
+func TestRing_EvictedSlotsAreCleared(t *testing.T) {
+	r := newRing(4)
+	r.push(LagSample{Topic: "a"}, LagSample{Topic: "b"}, LagSample{Topic: "c"})
+	r.dropFront(1)
+	r.filter(func(s LagSample) bool { return s.Topic != "b" })
+
+	for i, s := range r.buf {
+		if i != r.head && s.Topic != "" {
+			t.Errorf("slot %d still holds %q", i, s.Topic)
+		}
+	}
+}
+
+// TestSlidingWindow_MatchesSliceStorage drives the window and the slice
+// reference through the same random ticks, removals and evictions.
+func TestSlidingWindow_MatchesSliceStorage(t *testing.T) {
+	for _, policy := range []EvictionPolicy{EvictByTime, EvictByCount, EvictHybrid} {
+		t.Run(string(policy), func(t *testing.T) {
+			rng := rand.New(rand.NewPCG(1, 2))
+			w := NewSlidingWindow(6, 10*time.Second, WithEvictionPolicy(policy))
+			ref := &sliceWindow{windowSize: 6, windowDuration: time.Minute, policy: policy}
+
+			// Ticks 7s apart, so the window's edge never lands near a
+			// sample while the test runs
+			start := time.Now().Add(-10 * time.Minute)
+			for tick := range 80 {
+				ts := start.Add(time.Duration(tick) * 7 * time.Second)
+				var batch []LagSample
+				for p := range rng.IntN(12) {
+					batch = append(batch, LagSample{Timestamp: ts, Partition: p, Lag: rng.Int64N(1000)})
+				}
+				w.Add(batch...)
+				ref.Add(batch...)
+
+				if rng.IntN(10) == 0 {
+					p := rng.IntN(12)
+					pred := func(s LagSample) bool { return s.Partition == p }
+					w.Remove(pred)
+					ref.Remove(pred)
+				}
+
+				got := w.Snapshot()
+				if len(got) == 0 && len(ref.samples) == 0 {
+					continue
+				}
+				if !reflect.DeepEqual(got, ref.samples) {
+					t.Fatalf("tick %d: window holds %d samples, slice storage %d", tick, len(got), len(ref.samples))
+				}
+			}
+		})
+	}
+}
+
+func benchmarkWindowTicks(b *testing.B, add func(...LagSample)) {
+	const partitions = 256
+	batch := make([]LagSample, partitions)
+	// The last ticks land inside the window, so it's full rather than
+	// evicting everything
+	start := time.Now().Add(-time.Duration(b.N) * time.Second)
+
+	b.ReportAllocs()
+	for i := range b.N {
+		ts := start.Add(time.Duration(i) * time.Second)
+		for p := range batch {
+			batch[p] = LagSample{Timestamp: ts, Partition: p, Lag: int64(i)}
+		}
+		add(batch...)
+	}
+}
+
+func BenchmarkSlidingWindow_Add(b *testing.B) {
+	w := NewSlidingWindow(30, time.Second, WithPartitionsHint(256))
+	benchmarkWindowTicks(b, w.Add)
+}
+
+func BenchmarkSliceWindow_Add(b *testing.B) {
+	w := &sliceWindow{windowSize: 30, windowDuration: 30 * time.Second, policy: EvictByTime}
+	benchmarkWindowTicks(b, w.Add)
+}
@@ -5,8 +5,36 @@ import "time"
 type LagSample struct {
 	Timestamp time.Time
 	Topic     string
+	// Group is the consumer group the lag was measured for; empty when lag
+	// doesn't depend on a group (the earliest lag basis).
+	Group     string
 	Partition int
 	Lag       int64
 	Offset    int64
 	EndOffset int64
+	// ConsumeRate is the committed-offset throughput in messages/sec since
+	// the previous scrape of this partition; 0 on the first scrape.
+	ConsumeRate float64
+	// ByteLag estimates the lag in bytes from the partition's average record
+	// size; 0 unless lag is measured in bytes.
+	ByteLag int64
+	// TimeLag is the age in seconds of the oldest unconsumed record; 0
+	// unless lag is measured in seconds.
+	TimeLag int64
+	// Members is how many active members Group had when the sample was
+	// taken. It's only looked up when group members are tracked, and 0
+	// otherwise.
+	Members int
+	// OffsetAhead marks a sample whose committed offset was past the end
+	// offset, so its Lag of 0 was clamped rather than measured. Only set in
+	// strict offsets mode.
+	OffsetAhead bool
+	// LeaderChanged marks the first sample taken after the partition's
+	// leader changed, whose end offset may briefly disagree with the old
+	// leader's. The panic threshold doesn't act on it.
+	LeaderChanged bool
+	// StaleCommit marks a sample with lag whose committed offset hasn't
+	// moved for at least the configured commit staleness, as with a
+	// consumer that commits rarely. StaleCommitEvaluator can down-weight it.
+	StaleCommit bool
 }
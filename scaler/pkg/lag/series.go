@@ -0,0 +1,189 @@
+package lag
+
+import (
+	"sort"
+	"time"
+)
+
+// PartitionSeries holds samples grouped by partition, each partition's series
+// ordered by timestamp, oldest first, with samples sharing a timestamp kept in
+// the order they were added. Evaluating one skips the grouping and sorting a
+// flat snapshot needs on every call; SlidingWindow.Series maintains one as
+// samples are added. Series are shared and must not be modified.
+type PartitionSeries map[int][]LagSample
+
+// SeriesEvaluator is an Evaluator that can also evaluate samples already
+// grouped by partition.
+type SeriesEvaluator interface {
+	Evaluator
+	EvaluateSeries(series PartitionSeries) EvaluationResult
+}
+
+// EvaluateSeries evaluates series with e, handing it over grouped when e is a
+// SeriesEvaluator and flattened otherwise. The result is the same as e's
+// Evaluate on the samples series was built from.
+func EvaluateSeries(e Evaluator, series PartitionSeries) EvaluationResult {
+	if se, ok := e.(SeriesEvaluator); ok {
+		return se.EvaluateSeries(series)
+	}
+	return e.Evaluate(series.Samples())
+}
+
+// GroupByPartition groups samples into a PartitionSeries. A partition's
+// samples are only sorted when they aren't already in time order, which they
+// are when taken from a window filled by Add.
+func GroupByPartition(samples []LagSample) PartitionSeries {
+	series := make(PartitionSeries)
+	for _, s := range samples {
+		series[s.Partition] = append(series[s.Partition], s)
+	}
+	for _, ss := range series {
+		sortByTime(ss)
+	}
+	return series
+}
+
+// sortByTime stably orders samples by timestamp unless they already are.
+func sortByTime(samples []LagSample) {
+	for i := 1; i < len(samples); i++ {
+		if samples[i].Timestamp.Before(samples[i-1].Timestamp) {
+			sort.SliceStable(samples, func(i, j int) bool {
+				return samples[i].Timestamp.Before(samples[j].Timestamp)
+			})
+			return
+		}
+	}
+}
+
+// Len returns how many samples series holds.
+func (series PartitionSeries) Len() int {
+	n := 0
+	for _, ss := range series {
+		n += len(ss)
+	}
+	return n
+}
+
+// Samples flattens series into a new slice, partition by partition.
+func (series PartitionSeries) Samples() []LagSample {
+	out := make([]LagSample, 0, series.Len())
+	for _, ss := range series {
+		out = append(out, ss...)
+	}
+	return out
+}
+
+// partitions returns the partitions in series, lowest first.
+func (series PartitionSeries) partitions() []int {
+	partitions := make([]int, 0, len(series))
+	for p := range series {
+		partitions = append(partitions, p)
+	}
+	sort.Ints(partitions)
+	return partitions
+}
+
+// newest returns the timestamp of the newest sample in series.
+func (series PartitionSeries) newest() time.Time {
+	var newest time.Time
+	for _, ss := range series {
+		if len(ss) > 0 && ss[len(ss)-1].Timestamp.After(newest) {
+			newest = ss[len(ss)-1].Timestamp
+		}
+	}
+	return newest
+}
+
+// withinLookback is withinLookback for series, reslicing each partition's
+// series rather than copying samples. Partitions left without samples are
+// dropped.
+func (series PartitionSeries) withinLookback(lookback time.Duration) PartitionSeries {
+	if lookback <= 0 {
+		return series
+	}
+	cutoff := series.newest().Add(-lookback)
+
+	recent := make(PartitionSeries, len(series))
+	for p, ss := range series {
+		i := sort.Search(len(ss), func(i int) bool {
+			return !ss[i].Timestamp.Before(cutoff)
+		})
+		if i < len(ss) {
+			recent[p] = ss[i:]
+		}
+	}
+	return recent
+}
+
+// latestSample returns the latest sample of a time-ordered series: of several
+// sharing the newest timestamp, the first added.
+func latestSample(series []LagSample) LagSample {
+	i := len(series) - 1
+	for i > 0 && series[i-1].Timestamp.Equal(series[i].Timestamp) {
+		i--
+	}
+	return series[i]
+}
+
+// combineGroups is CombineGroups for series. Samples sharing a timestamp are
+// adjacent in a partition's series, so only those need comparing, and a
+// series without any is reused as is.
+func (series PartitionSeries) combineGroups(strategy GroupStrategy) PartitionSeries {
+	combined := make(PartitionSeries, len(series))
+	for p, ss := range series {
+		if !sharesTimestamp(ss) {
+			combined[p] = ss
+			continue
+		}
+
+		out := make([]LagSample, 0, len(ss))
+		tick := 0
+		for _, s := range ss {
+			if len(out) > 0 && !out[len(out)-1].Timestamp.Equal(s.Timestamp) {
+				tick = len(out)
+			}
+			i := tick
+			for i < len(out) && out[i].Topic != s.Topic {
+				i++
+			}
+			if i == len(out) {
+				out = append(out, s)
+				continue
+			}
+
+			existing := &out[i]
+			switch strategy {
+			case GroupMax:
+				if s.Lag > existing.Lag {
+					*existing = s
+				}
+			default:
+				existing.Lag += s.Lag
+				existing.ConsumeRate += s.ConsumeRate
+				existing.Group = ""
+			}
+		}
+		combined[p] = out
+	}
+	return combined
+}
+
+// sharesTimestamp reports whether any two adjacent samples of a time-ordered
+// series share a timestamp.
+func sharesTimestamp(series []LagSample) bool {
+	for i := 1; i < len(series); i++ {
+		if series[i].Timestamp.Equal(series[i-1].Timestamp) {
+			return true
+		}
+	}
+	return false
+}
+
+// withLag is withLag for series.
+func (series PartitionSeries) withLag(lag func(LagSample) int64) PartitionSeries {
+	out := make(PartitionSeries, len(series))
+	for p, ss := range series {
+		out[p] = withLag(ss, lag)
+	}
+	return out
+}
@@ -0,0 +1,308 @@
+package lag
+
+import (
+	"math/rand/v2"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// referencePersistence is evaluatePersistence as it was before evaluation
+// moved onto PartitionSeries: it groups samples into maps and sorts every
+// partition on each call. It's kept as a reference for the optimized path's
+// results and cost.
+func referencePersistence(samples []LagSample, threshold int64, sustainDuration time.Duration, minStretchSamples int, lookback time.Duration) EvaluationResult {
+	if len(samples) == 0 {
+		return EvaluationResult{TriggerPartition: -1, MaxLagPartition: -1}
+	}
+
+	latestByPartition := make(map[int]LagSample)
+	var newestSample time.Time
+	for _, s := range samples {
+		if s.Timestamp.After(newestSample) {
+			newestSample = s.Timestamp
+		}
+		if existing, ok := latestByPartition[s.Partition]; !ok || s.Timestamp.After(existing.Timestamp) {
+			latestByPartition[s.Partition] = s
+		}
+	}
+
+	result := EvaluationResult{
+		TriggerPartition: -1,
+		MaxLagPartition:  -1,
+		TotalPartitions:  len(latestByPartition),
+		PartitionLag:     make(map[int]int64, len(latestByPartition)),
+		NewestSample:     newestSample,
+	}
+	for p, s := range latestByPartition {
+		result.PartitionLag[p] = s.Lag
+		result.TotalCurrentLag += s.Lag
+		result.ConsumeRate += s.ConsumeRate
+		if s.Lag >= threshold {
+			result.LaggingPartitions++
+		}
+		if result.MaxLagPartition == -1 || s.Lag > result.MaxCurrentLag || (s.Lag == result.MaxCurrentLag && p < result.MaxLagPartition) {
+			result.MaxCurrentLag = s.Lag
+			result.MaxLagPartition = p
+		}
+	}
+
+	sustained := referencePersistentPartitions(withinLookback(samples, lookback), threshold, sustainDuration, minStretchSamples)
+	if len(sustained) > 0 {
+		result.Persistent = true
+		result.TriggerPartition = sustained[0]
+	}
+	return result
+}
+
+func referencePersistentPartitions(samples []LagSample, threshold int64, sustainDuration time.Duration, minStretchSamples int) []int {
+	byPartition := make(map[int][]LagSample)
+	for _, s := range samples {
+		byPartition[s.Partition] = append(byPartition[s.Partition], s)
+	}
+
+	var partitions []int
+	for p, series := range byPartition {
+		sort.Slice(series, func(i, j int) bool {
+			return series[i].Timestamp.Before(series[j].Timestamp)
+		})
+		if anySustains(stretches(series, threshold), sustainDuration, minStretchSamples) {
+			partitions = append(partitions, p)
+		}
+	}
+	sort.Ints(partitions)
+	return partitions
+}
+
+// referenceAbsolute is AbsoluteEvaluator.Evaluate on referencePersistence.
+func referenceAbsolute(e AbsoluteEvaluator, samples []LagSample) EvaluationResult {
+	samples = CombineGroups(samples, e.GroupStrategy)
+	result := referencePersistence(samples, e.Threshold, e.SustainDuration, e.MinStretchSamples, e.Lookback)
+	if e.RequireCurrent {
+		sustained := currentPartitions(referencePersistentPartitions(withinLookback(samples, e.Lookback), e.Threshold, e.SustainDuration, e.MinStretchSamples), result.PartitionLag, e.Threshold)
+		result.Persistent = len(sustained) > 0
+		result.TriggerPartition = -1
+		if result.Persistent {
+			result.TriggerPartition = sustained[0]
+		}
+	}
+	return ApplyPanicThreshold(result, e.PanicThreshold)
+}
+
+// referenceBreadth is BreadthEvaluator.Evaluate on referencePersistence.
+func referenceBreadth(e BreadthEvaluator, samples []LagSample) EvaluationResult {
+	samples = CombineGroups(samples, e.GroupStrategy)
+	result := referencePersistence(samples, e.Threshold, e.SustainDuration, e.MinStretchSamples, e.Lookback)
+	sustained := referencePersistentPartitions(withinLookback(samples, e.Lookback), e.Threshold, e.SustainDuration, e.MinStretchSamples)
+	if e.RequireCurrent {
+		sustained = currentPartitions(sustained, result.PartitionLag, e.Threshold)
+	}
+	result.Persistent = len(sustained) > e.LaggingPartitionsThreshold
+	result.TriggerPartition = -1
+	if result.Persistent {
+		result.TriggerPartition = sustained[0]
+	}
+	return ApplyPanicThreshold(result, e.PanicThreshold)
+}
+
+// randomSamples returns up to one sample per (tick, partition, group), in
+// shuffled order. Consume rates are whole numbers so their sums don't depend
+// on the order they're added in.
+func randomSamples(rng *rand.Rand, start time.Time) []LagSample {
+	var samples []LagSample
+	for tick := range rng.IntN(20) {
+		ts := start.Add(time.Duration(tick) * 10 * time.Second)
+		for p := range 6 {
+			for _, g := range []string{"a", "b", "c"} {
+				if rng.IntN(4) == 0 {
+					continue
+				}
+				samples = append(samples, LagSample{
+					Timestamp:   ts,
+					Topic:       "orders",
+					Partition:   p,
+					Group:       g,
+					Lag:         rng.Int64N(1000),
+					ByteLag:     rng.Int64N(1000),
+					TimeLag:     rng.Int64N(1000),
+					ConsumeRate: float64(rng.IntN(20)),
+				})
+			}
+		}
+	}
+	rng.Shuffle(len(samples), func(i, j int) {
+		samples[i], samples[j] = samples[j], samples[i]
+	})
+	return samples
+}
+
+func TestEvaluateSeries_MatchesReference(t *testing.T) {
+	rng := rand.New(rand.NewPCG(3, 4))
+	start := time.Now()
+
+	for i := range 500 {
+		samples := randomSamples(rng, start)
+		absolute := AbsoluteEvaluator{
+			Threshold:         500,
+			SustainDuration:   time.Duration(rng.IntN(6)) * 10 * time.Second,
+			MinStretchSamples: rng.IntN(4),
+			PanicThreshold:    int64(rng.IntN(2)) * 950,
+			GroupStrategy:     []GroupStrategy{GroupSum, GroupMax}[rng.IntN(2)],
+			RequireCurrent:    rng.IntN(2) == 0,
+			Lookback:          time.Duration(rng.IntN(4)) * 30 * time.Second,
+		}
+		breadth := BreadthEvaluator{
+			Threshold:                  absolute.Threshold,
+			SustainDuration:            absolute.SustainDuration,
+			MinStretchSamples:          absolute.MinStretchSamples,
+			PanicThreshold:             absolute.PanicThreshold,
+			GroupStrategy:              absolute.GroupStrategy,
+			LaggingPartitionsThreshold: rng.IntN(3),
+			RequireCurrent:             absolute.RequireCurrent,
+			Lookback:                   absolute.Lookback,
+		}
+
+		want := referenceAbsolute(absolute, samples)
+		if got := absolute.Evaluate(samples); !reflect.DeepEqual(got, want) {
+			t.Fatalf("case %d: absolute Evaluate = %+v, reference %+v", i, got, want)
+		}
+		if got := absolute.EvaluateSeries(GroupByPartition(samples)); !reflect.DeepEqual(got, want) {
+			t.Fatalf("case %d: absolute EvaluateSeries = %+v, reference %+v", i, got, want)
+		}
+
+		want = referenceBreadth(breadth, samples)
+		if got := breadth.Evaluate(samples); !reflect.DeepEqual(got, want) {
+			t.Fatalf("case %d: breadth Evaluate = %+v, reference %+v", i, got, want)
+		}
+		if got := breadth.EvaluateSeries(GroupByPartition(samples)); !reflect.DeepEqual(got, want) {
+			t.Fatalf("case %d: breadth EvaluateSeries = %+v, reference %+v", i, got, want)
+		}
+	}
+}
+
+// TestEvaluateSeries_DecoratorsMatchEvaluate checks the decorators give the
+// same result on a PartitionSeries as on the flat samples, including around
+// an evaluator that doesn't implement SeriesEvaluator.
+func TestEvaluateSeries_DecoratorsMatchEvaluate(t *testing.T) {
+	rng := rand.New(rand.NewPCG(5, 6))
+	start := time.Now()
+
+	modes := []Evaluator{
+		AbsoluteEvaluator{Threshold: 500, SustainDuration: 30 * time.Second},
+		BreadthEvaluator{Threshold: 500, SustainDuration: 30 * time.Second, GroupStrategy: GroupMax},
+		TotalEvaluator{Threshold: 1500, SustainDuration: 30 * time.Second},
+	}
+	for i := range 200 {
+		samples := randomSamples(rng, start)
+		for _, mode := range modes {
+			for _, e := range []Evaluator{
+				DrainTimeEvaluator{Evaluator: BytesEvaluator{Evaluator: mode}, Threshold: time.Minute},
+				DrainTimeEvaluator{Evaluator: SecondsEvaluator{Evaluator: LastTickEvaluator{Evaluator: mode, Interval: 10 * time.Second}}},
+			} {
+				want := e.Evaluate(samples)
+				if got := EvaluateSeries(e, GroupByPartition(samples)); !reflect.DeepEqual(got, want) {
+					t.Fatalf("case %d, %T: EvaluateSeries = %+v, Evaluate %+v", i, mode, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestSlidingWindow_SeriesMatchesSnapshot(t *testing.T) {
+	for _, policy := range []EvictionPolicy{EvictByTime, EvictByCount, EvictHybrid} {
+		for _, compact := range []bool{false, true} {
+			name := string(policy)
+			if compact {
+				name += "+compaction"
+			}
+			t.Run(name, func(t *testing.T) {
+				rng := rand.New(rand.NewPCG(7, 8))
+				opts := []WindowOption{WithEvictionPolicy(policy)}
+				if compact {
+					opts = append(opts, WithCompaction())
+				}
+				w := NewSlidingWindow(6, 10*time.Second, opts...)
+
+				// Ticks 7s apart, so the window's edge never lands near a
+				// sample while the test runs
+				start := time.Now().Add(-10 * time.Minute)
+				for tick := range 120 {
+					ts := start.Add(time.Duration(tick) * 7 * time.Second)
+					var batch []LagSample
+					for p := range rng.IntN(8) {
+						s := LagSample{Timestamp: ts, Partition: p, Group: "a", Lag: rng.Int64N(1000)}
+						if rng.IntN(20) == 0 {
+							// A late sample from a few ticks back
+							s.Timestamp = ts.Add(-time.Duration(rng.IntN(4)) * 7 * time.Second)
+						}
+						batch = append(batch, s)
+					}
+					switch rng.IntN(20) {
+					case 0:
+						w.Restore(batch)
+					case 1:
+						p := rng.IntN(8)
+						w.Remove(func(s LagSample) bool { return s.Partition == p })
+					default:
+						w.Add(batch...)
+					}
+
+					// Hold on to one series across the next Add, which must
+					// not change it
+					series := w.Series()
+					held := GroupByPartition(series.Samples())
+					if want := GroupByPartition(w.Snapshot()); !reflect.DeepEqual(series, want) {
+						t.Fatalf("tick %d: series %v, want %v", tick, series, want)
+					}
+					w.Add(LagSample{Timestamp: ts.Add(time.Second), Partition: rng.IntN(8), Group: "b"})
+					if !reflect.DeepEqual(series, held) {
+						t.Fatalf("tick %d: series changed by a later Add", tick)
+					}
+				}
+			})
+		}
+	}
+}
+
+// largeWindow is a window of 256 partitions by 360 ticks, about the size of
+// an hour at a 10s sampling interval on a busy topic.
+func largeWindow(b *testing.B) *SlidingWindow {
+	const partitions, ticks = 256, 360
+	w := NewSlidingWindow(ticks, time.Second, WithPartitionsHint(partitions))
+	start := time.Now().Add(-ticks * time.Second)
+	batch := make([]LagSample, partitions)
+	for i := range ticks {
+		for p := range batch {
+			batch[p] = LagSample{Timestamp: start.Add(time.Duration(i) * time.Second), Partition: p, Lag: int64(i * p % 1000)}
+		}
+		w.Add(batch...)
+	}
+	return w
+}
+
+var benchmarkEvaluator = AbsoluteEvaluator{Threshold: 500, SustainDuration: time.Minute, Lookback: 5 * time.Minute}
+
+func BenchmarkEvaluatePersistence_Reference(b *testing.B) {
+	w := largeWindow(b)
+	b.ReportAllocs()
+	for b.Loop() {
+		referenceAbsolute(benchmarkEvaluator, w.Snapshot())
+	}
+}
+
+func BenchmarkEvaluatePersistence_Snapshot(b *testing.B) {
+	w := largeWindow(b)
+	b.ReportAllocs()
+	for b.Loop() {
+		benchmarkEvaluator.Evaluate(w.Snapshot())
+	}
+}
+
+func BenchmarkEvaluatePersistence_Series(b *testing.B) {
+	w := largeWindow(b)
+	b.ReportAllocs()
+	for b.Loop() {
+		benchmarkEvaluator.EvaluateSeries(w.Series())
+	}
+}
@@ -0,0 +1,47 @@
+package lag
+
+import "time"
+
+// StaleCommitEvaluator down-weights samples flagged StaleCommit: it scales
+// their Lag by Weight, between 0 and 1, before handing the samples to
+// Evaluator, so lag inflated by a consumer that commits rarely counts for
+// less. A consumer that has stopped doesn't commit either, so a Weight well
+// below 1 also slows activation for it.
+type StaleCommitEvaluator struct {
+	Evaluator Evaluator
+	Weight    float64
+}
+
+func (e StaleCommitEvaluator) Evaluate(samples []LagSample) EvaluationResult {
+	return e.Evaluator.Evaluate(withLag(samples, e.weighted))
+}
+
+func (e StaleCommitEvaluator) EvaluateSeries(series PartitionSeries) EvaluationResult {
+	return EvaluateSeries(e.Evaluator, series.withLag(e.weighted))
+}
+
+func (e StaleCommitEvaluator) weighted(s LagSample) int64 {
+	if !s.StaleCommit {
+		return s.Lag
+	}
+	return int64(float64(s.Lag) * e.Weight)
+}
+
+// PartitionStaleness returns, for each partition in samples, how long before
+// now its newest sample was taken. A partition whose leader is stuck stops
+// producing samples while the others keep flowing, so its staleness grows
+// while the rest stay near the sampling interval.
+func PartitionStaleness(samples []LagSample, now time.Time) map[int]time.Duration {
+	newest := make(map[int]time.Time)
+	for _, s := range samples {
+		if t, ok := newest[s.Partition]; !ok || s.Timestamp.After(t) {
+			newest[s.Partition] = s.Timestamp
+		}
+	}
+
+	staleness := make(map[int]time.Duration, len(newest))
+	for partition, t := range newest {
+		staleness[partition] = now.Sub(t)
+	}
+	return staleness
+}
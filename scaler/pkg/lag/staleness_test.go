@@ -0,0 +1,75 @@
+package lag
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStaleCommitEvaluator_DownWeightsStaleCommits(t *testing.T) {
+	now := time.Now()
+	var samples []LagSample
+	for i := range 6 {
+		ts := now.Add(time.Duration(i-5) * 10 * time.Second)
+		samples = append(samples,
+			LagSample{Timestamp: ts, Partition: 0, Lag: 1000, StaleCommit: i > 0},
+			LagSample{Timestamp: ts, Partition: 1, Lag: 200},
+		)
+	}
+	inner := AbsoluteEvaluator{Threshold: 500, SustainDuration: 30 * time.Second}
+
+	if result := inner.Evaluate(samples); !result.Persistent || result.TotalCurrentLag != 1200 {
+		t.Fatalf("expected persistent lag of 1200 unweighted, got %+v", result)
+	}
+
+	e := StaleCommitEvaluator{Evaluator: inner, Weight: 0.25}
+	result := e.Evaluate(samples)
+	if result.Persistent {
+		t.Error("expected down-weighted stale commits not to sustain")
+	}
+	if result.TotalCurrentLag != 450 {
+		t.Errorf("total lag = %d, want 250 weighted plus 200", result.TotalCurrentLag)
+	}
+	if series := EvaluateSeries(e, GroupByPartition(samples)); series.TotalCurrentLag != 450 || series.Persistent {
+		t.Errorf("expected EvaluateSeries to agree, got %+v", series)
+	}
+	if samples[2].Lag != 1000 {
+		t.Error("expected Evaluate not to modify samples")
+	}
+}
+
+func TestPartitionStaleness_StalledPartition(t *testing.T) {
+	w := NewSlidingWindow(30, 10*time.Second)
+
+	now := time.Now()
+	for i := range 6 {
+		ts := now.Add(time.Duration(i-5) * 10 * time.Second)
+		w.Add(LagSample{Timestamp: ts, Partition: 0, Lag: 100})
+		// Partition 1 stops updating after the second scrape.
+		if i < 2 {
+			w.Add(LagSample{Timestamp: ts, Partition: 1, Lag: 200})
+		}
+	}
+
+	staleness := PartitionStaleness(w.Snapshot(), now)
+	if len(staleness) != 2 {
+		t.Fatalf("expected staleness for 2 partitions, got %v", staleness)
+	}
+	if staleness[0] != 0 {
+		t.Errorf("partition 0 staleness = %v, want 0", staleness[0])
+	}
+	if staleness[1] != 40*time.Second {
+		t.Errorf("partition 1 staleness = %v, want 40s", staleness[1])
+	}
+}
+
+func TestPartitionStaleness_UsesNewestAcrossGroups(t *testing.T) {
+	now := time.Now()
+	samples := []LagSample{
+		{Timestamp: now.Add(-30 * time.Second), Group: "group-a", Partition: 0},
+		{Timestamp: now.Add(-10 * time.Second), Group: "group-b", Partition: 0},
+	}
+
+	if got := PartitionStaleness(samples, now)[0]; got != 10*time.Second {
+		t.Errorf("staleness = %v, want 10s", got)
+	}
+}
@@ -0,0 +1,101 @@
+package lag
+
+import "time"
+
+// stretch is a maximal run of consecutive samples in one series whose lag is
+// at or above the threshold. It's the primitive every evaluation mode builds
+// persistence on.
+type stretch struct {
+	start   time.Time
+	end     time.Time
+	samples int
+	// current is set when the run ends with the series' latest sample, i.e.
+	// lag is still at or above the threshold.
+	current bool
+}
+
+func (s stretch) duration() time.Duration {
+	return s.end.Sub(s.start)
+}
+
+// sustains reports whether the stretch spans at least sustainDuration and
+// holds at least minSamples samples.
+func (s stretch) sustains(sustainDuration time.Duration, minSamples int) bool {
+	return s.duration() >= sustainDuration && s.samples >= minSamples
+}
+
+// stretches returns the runs of samples at or above threshold in series,
+// which must be ordered by timestamp, oldest first. A single sample at or
+// above threshold is a run of zero duration.
+func stretches(series []LagSample, threshold int64) []stretch {
+	var runs []stretch
+	inRun := false
+	for _, s := range series {
+		if s.Lag < threshold {
+			inRun = false
+			continue
+		}
+		if !inRun {
+			runs = append(runs, stretch{start: s.Timestamp})
+			inRun = true
+		}
+		run := &runs[len(runs)-1]
+		run.end = s.Timestamp
+		run.samples++
+	}
+	if inRun {
+		runs[len(runs)-1].current = true
+	}
+	return runs
+}
+
+// partitionStretches orders each partition's samples by time and returns its
+// stretches. Every partition in samples has an entry, without stretches if
+// its lag never reached threshold.
+func partitionStretches(samples []LagSample, threshold int64) map[int][]stretch {
+	return seriesStretches(GroupByPartition(samples), threshold)
+}
+
+// seriesStretches is partitionStretches for samples already grouped by
+// partition.
+func seriesStretches(series PartitionSeries, threshold int64) map[int][]stretch {
+	runs := make(map[int][]stretch, len(series))
+	for p, ss := range series {
+		runs[p] = stretches(ss, threshold)
+	}
+	return runs
+}
+
+// anySustains reports whether any of runs sustains.
+func anySustains(runs []stretch, sustainDuration time.Duration, minSamples int) bool {
+	for _, r := range runs {
+		if r.sustains(sustainDuration, minSamples) {
+			return true
+		}
+	}
+	return false
+}
+
+// withinLookback returns the samples taken at most lookback before the newest
+// one, i.e. the last scrape, so persistence is only searched for in recent
+// history. A lookback of 0 keeps every sample.
+func withinLookback(samples []LagSample, lookback time.Duration) []LagSample {
+	if lookback <= 0 || len(samples) == 0 {
+		return samples
+	}
+	var newest time.Time
+	for _, s := range samples {
+		if s.Timestamp.After(newest) {
+			newest = s.Timestamp
+		}
+	}
+	cutoff := newest.Add(-lookback)
+
+	recent := make([]LagSample, 0, len(samples))
+	for _, s := range samples {
+		if !s.Timestamp.Before(cutoff) {
+			recent = append(recent, s)
+		}
+	}
+	return recent
+}
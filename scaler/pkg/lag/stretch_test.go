@@ -0,0 +1,116 @@
+package lag
+
+import (
+	"testing"
+	"time"
+)
+
+// series builds one partition's samples, one per interval from start, with
+// the given lags.
+func series(start time.Time, interval time.Duration, partition int, lags ...int64) []LagSample {
+	samples := make([]LagSample, len(lags))
+	for i, l := range lags {
+		samples[i] = LagSample{Timestamp: start.Add(time.Duration(i) * interval), Partition: partition, Lag: l}
+	}
+	return samples
+}
+
+func TestStretches_SplitsOnGaps(t *testing.T) {
+	start := time.Now()
+	runs := stretches(series(start, 10*time.Second, 0, 600, 700, 100, 800, 900, 900, 50), 500)
+
+	if len(runs) != 2 {
+		t.Fatalf("expected 2 stretches, got %d: %+v", len(runs), runs)
+	}
+	if runs[0].duration() != 10*time.Second || runs[0].samples != 2 || runs[0].current {
+		t.Errorf("unexpected first stretch: %+v", runs[0])
+	}
+	if !runs[1].start.Equal(start.Add(30*time.Second)) || runs[1].duration() != 20*time.Second || runs[1].samples != 3 {
+		t.Errorf("unexpected second stretch: %+v", runs[1])
+	}
+	if runs[1].current {
+		t.Error("expected the second stretch not to be current after lag dropped")
+	}
+}
+
+func TestStretches_CurrentStretch(t *testing.T) {
+	runs := stretches(series(time.Now(), 10*time.Second, 0, 100, 600, 600), 500)
+	if len(runs) != 1 || !runs[0].current || runs[0].duration() != 10*time.Second {
+		t.Errorf("expected one current 10s stretch, got %+v", runs)
+	}
+}
+
+func TestStretches_SingleSample(t *testing.T) {
+	now := time.Now()
+
+	runs := stretches(series(now, time.Second, 0, 500), 500)
+	if len(runs) != 1 || runs[0].duration() != 0 || runs[0].samples != 1 || !runs[0].current {
+		t.Fatalf("expected a single zero-length current stretch, got %+v", runs)
+	}
+	if !runs[0].sustains(0, 0) {
+		t.Error("expected a zero-length stretch to sustain a zero duration")
+	}
+	if runs[0].sustains(time.Nanosecond, 0) {
+		t.Error("expected a zero-length stretch not to sustain any positive duration")
+	}
+
+	if runs := stretches(series(now, time.Second, 0, 499), 500); len(runs) != 0 {
+		t.Errorf("expected no stretch below threshold, got %+v", runs)
+	}
+	if runs := stretches(nil, 500); len(runs) != 0 {
+		t.Errorf("expected no stretch without samples, got %+v", runs)
+	}
+}
+
+func TestStretch_SustainsAtBoundary(t *testing.T) {
+	// 13 samples 10s apart span exactly 2 minutes
+	runs := stretches(series(time.Now(), 10*time.Second, 0, 600, 600, 600, 600, 600, 600, 600, 600, 600, 600, 600, 600, 600), 500)
+	if len(runs) != 1 {
+		t.Fatalf("expected one stretch, got %d", len(runs))
+	}
+	r := runs[0]
+
+	if !r.sustains(2*time.Minute, 0) {
+		t.Error("expected a stretch of exactly the sustain duration to sustain it")
+	}
+	if r.sustains(2*time.Minute+time.Nanosecond, 0) {
+		t.Error("expected a stretch just short of the sustain duration not to sustain it")
+	}
+	if !r.sustains(2*time.Minute, 13) || r.sustains(2*time.Minute, 14) {
+		t.Error("expected minSamples to count the stretch's samples")
+	}
+}
+
+func TestPartitionStretches_SortsEachPartition(t *testing.T) {
+	start := time.Now()
+	// Partition 0's samples arrive out of order; partition 1 never lags
+	samples := []LagSample{
+		{Timestamp: start.Add(20 * time.Second), Partition: 0, Lag: 600},
+		{Timestamp: start, Partition: 0, Lag: 600},
+		{Timestamp: start.Add(10 * time.Second), Partition: 0, Lag: 600},
+		{Timestamp: start, Partition: 1, Lag: 10},
+	}
+
+	runs := partitionStretches(samples, 500)
+	if len(runs) != 2 {
+		t.Fatalf("expected an entry per partition, got %d", len(runs))
+	}
+	if len(runs[0]) != 1 || runs[0][0].duration() != 20*time.Second || !runs[0][0].current {
+		t.Errorf("unexpected partition 0 stretches: %+v", runs[0])
+	}
+	if r, ok := runs[1]; !ok || len(r) != 0 {
+		t.Errorf("expected partition 1 present without stretches, got %+v (present %v)", r, ok)
+	}
+}
+
+func TestAnySustains_EarlierStretchCounts(t *testing.T) {
+	// A sustained stretch that has since drained still counts; the current
+	// one is too short
+	runs := stretches(series(time.Now(), time.Minute, 0, 600, 600, 600, 100, 600), 500)
+	if !anySustains(runs, 2*time.Minute, 0) {
+		t.Error("expected the earlier 2m stretch to sustain")
+	}
+	if anySustains(runs[1:], 2*time.Minute, 0) {
+		t.Error("expected the current stretch alone not to sustain")
+	}
+}
@@ -0,0 +1,61 @@
+package lag
+
+import (
+	"sort"
+	"time"
+)
+
+// TotalEvaluator sustains on the lag summed across partitions rather than on
+// any one partition, catching many partitions that are each under Threshold
+// but together hold a large backlog. Samples are bucketed into scrape ticks by
+// timestamp and the per-tick totals must stay at or above Threshold for
+// SustainDuration. When persistent, TriggerPartition is the partition with the
+// most current lag. PanicThreshold, GroupStrategy and Lookback behave as for
+// AbsoluteEvaluator. With RequireCurrent, the latest tick's total must also
+// still be at or above Threshold.
+type TotalEvaluator struct {
+	Threshold         int64
+	SustainDuration   time.Duration
+	MinStretchSamples int
+	PanicThreshold    int64
+	GroupStrategy     GroupStrategy
+	RequireCurrent    bool
+	Lookback          time.Duration
+}
+
+func (e TotalEvaluator) Evaluate(samples []LagSample) EvaluationResult {
+	samples = CombineGroups(samples, e.GroupStrategy)
+	result := evaluatePersistence(samples, e.Threshold, e.SustainDuration, e.MinStretchSamples, e.Lookback)
+
+	series := totalSeries(withinLookback(samples, e.Lookback))
+	result.Persistent = anySustains(stretches(series, e.Threshold), e.SustainDuration, e.MinStretchSamples)
+	if e.RequireCurrent && len(series) > 0 && series[len(series)-1].Lag < e.Threshold {
+		result.Persistent = false
+	}
+	result.TriggerPartition = -1
+	if result.Persistent {
+		result.TriggerPartition = result.MaxLagPartition
+	}
+	return ApplyPanicThreshold(result, e.PanicThreshold)
+}
+
+// totalSeries sums samples sharing a timestamp, i.e. taken in the same
+// scrape, into one sample per tick ordered by time.
+func totalSeries(samples []LagSample) []LagSample {
+	index := make(map[time.Time]int)
+	var ticks []LagSample
+	for _, s := range samples {
+		i, ok := index[s.Timestamp]
+		if !ok {
+			index[s.Timestamp] = len(ticks)
+			ticks = append(ticks, LagSample{Timestamp: s.Timestamp, Topic: s.Topic, Partition: -1})
+			i = len(ticks) - 1
+		}
+		ticks[i].Lag += s.Lag
+	}
+
+	sort.Slice(ticks, func(i, j int) bool {
+		return ticks[i].Timestamp.Before(ticks[j].Timestamp)
+	})
+	return ticks
+}
@@ -0,0 +1,82 @@
+package lag
+
+import (
+	"testing"
+	"time"
+)
+
+// spreadSamples builds 13 ticks 10s apart with the same lag on each partition.
+func spreadSamples(partitions int, lag int64) []LagSample {
+	now := time.Now()
+	var samples []LagSample
+	for i := range 13 {
+		ts := now.Add(time.Duration(i-12) * 10 * time.Second)
+		for p := range partitions {
+			samples = append(samples, LagSample{Timestamp: ts, Partition: p, Lag: lag})
+		}
+	}
+	return samples
+}
+
+func TestTotalEvaluator_SumCrossesWhenNoPartitionDoes(t *testing.T) {
+	samples := spreadSamples(8, 100) // 800 in total, 100 per partition
+
+	if EvaluatePersistence(samples, 500, 2*time.Minute, 0).Persistent {
+		t.Fatal("precondition: no single partition should be persistent")
+	}
+
+	e := TotalEvaluator{Threshold: 500, SustainDuration: 2 * time.Minute}
+	result := e.Evaluate(samples)
+	if !result.Persistent {
+		t.Errorf("expected persistent on summed lag, got %+v", result)
+	}
+	if result.TotalCurrentLag != 800 {
+		t.Errorf("TotalCurrentLag = %d, want 800", result.TotalCurrentLag)
+	}
+	if result.TriggerPartition != 0 {
+		t.Errorf("TriggerPartition = %d, want 0", result.TriggerPartition)
+	}
+}
+
+func TestTotalEvaluator_SumBelowThreshold(t *testing.T) {
+	e := TotalEvaluator{Threshold: 500, SustainDuration: 2 * time.Minute}
+	result := e.Evaluate(spreadSamples(4, 100)) // 400 in total
+	if result.Persistent || result.TriggerPartition != -1 {
+		t.Errorf("expected not persistent, got %+v", result)
+	}
+}
+
+func TestTotalEvaluator_DipInTotalBreaksStretch(t *testing.T) {
+	samples := spreadSamples(8, 100)
+	// Drop every partition at the middle tick, taking that tick's total to 0
+	mid := samples[6*8].Timestamp
+	for i := range samples {
+		if samples[i].Timestamp.Equal(mid) {
+			samples[i].Lag = 0
+		}
+	}
+
+	e := TotalEvaluator{Threshold: 500, SustainDuration: 2 * time.Minute}
+	if e.Evaluate(samples).Persistent {
+		t.Error("expected a dip in the total to break the sustained stretch")
+	}
+}
+
+func TestTotalEvaluator_RequireCurrent(t *testing.T) {
+	samples := spreadSamples(8, 100)
+	// Every partition drains on the latest tick
+	latest := samples[len(samples)-1].Timestamp.Add(10 * time.Second)
+	for p := range 8 {
+		samples = append(samples, LagSample{Timestamp: latest, Partition: p, Lag: 10})
+	}
+
+	e := TotalEvaluator{Threshold: 500, SustainDuration: 2 * time.Minute}
+	if !e.Evaluate(samples).Persistent {
+		t.Fatal("precondition: the old total stretch should be persistent by default")
+	}
+
+	e.RequireCurrent = true
+	if result := e.Evaluate(samples); result.Persistent {
+		t.Errorf("expected a drained total not to activate, got %+v", result)
+	}
+}
@@ -0,0 +1,45 @@
+package lag
+
+// BytesEvaluator evaluates lag in bytes: it replaces each sample's Lag with
+// its ByteLag before handing the samples to Evaluator, so thresholds and the
+// reported total are in bytes.
+type BytesEvaluator struct {
+	Evaluator Evaluator
+}
+
+func (e BytesEvaluator) Evaluate(samples []LagSample) EvaluationResult {
+	return e.Evaluator.Evaluate(withLag(samples, byteLag))
+}
+
+func (e BytesEvaluator) EvaluateSeries(series PartitionSeries) EvaluationResult {
+	return EvaluateSeries(e.Evaluator, series.withLag(byteLag))
+}
+
+// SecondsEvaluator evaluates lag in seconds: it replaces each sample's Lag
+// with its TimeLag before handing the samples to Evaluator, so thresholds
+// and the reported lag are in seconds.
+type SecondsEvaluator struct {
+	Evaluator Evaluator
+}
+
+func (e SecondsEvaluator) Evaluate(samples []LagSample) EvaluationResult {
+	return e.Evaluator.Evaluate(withLag(samples, timeLag))
+}
+
+func (e SecondsEvaluator) EvaluateSeries(series PartitionSeries) EvaluationResult {
+	return EvaluateSeries(e.Evaluator, series.withLag(timeLag))
+}
+
+func byteLag(s LagSample) int64 { return s.ByteLag }
+
+func timeLag(s LagSample) int64 { return s.TimeLag }
+
+// withLag returns a copy of samples with each Lag replaced by lag(sample).
+func withLag(samples []LagSample, lag func(LagSample) int64) []LagSample {
+	out := make([]LagSample, len(samples))
+	for i, s := range samples {
+		s.Lag = lag(s)
+		out[i] = s
+	}
+	return out
+}
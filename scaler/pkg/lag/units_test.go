@@ -0,0 +1,60 @@
+package lag
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBytesEvaluator_UsesByteLag(t *testing.T) {
+	now := time.Now()
+	var samples []LagSample
+	for i := range 13 {
+		ts := now.Add(time.Duration(i-12) * 10 * time.Second)
+		samples = append(samples,
+			// Few messages, large records
+			LagSample{Timestamp: ts, Partition: 0, Lag: 100, ByteLag: 100 << 20},
+			// Many messages, small records
+			LagSample{Timestamp: ts, Partition: 1, Lag: 1000, ByteLag: 100_000},
+		)
+	}
+
+	e := BytesEvaluator{Evaluator: AbsoluteEvaluator{Threshold: 1 << 20, SustainDuration: 2 * time.Minute}}
+	result := e.Evaluate(samples)
+	if !result.Persistent || result.TriggerPartition != 0 {
+		t.Errorf("expected partition 0 to trigger on bytes, got %+v", result)
+	}
+	if result.TotalCurrentLag != 100<<20+100_000 {
+		t.Errorf("TotalCurrentLag = %d, want byte total %d", result.TotalCurrentLag, 100<<20+100_000)
+	}
+	if samples[0].Lag != 100 {
+		t.Error("expected the caller's samples to be left unchanged")
+	}
+}
+
+func TestSecondsEvaluator_UsesTimeLag(t *testing.T) {
+	now := time.Now()
+	var samples []LagSample
+	for i := range 13 {
+		ts := now.Add(time.Duration(i-12) * 10 * time.Second)
+		samples = append(samples,
+			// A small backlog that has been waiting ten minutes
+			LagSample{Timestamp: ts, Partition: 0, Lag: 20, TimeLag: 600},
+			// A large backlog that is only seconds old
+			LagSample{Timestamp: ts, Partition: 1, Lag: 50_000, TimeLag: 5},
+		)
+	}
+
+	e := SecondsEvaluator{Evaluator: AbsoluteEvaluator{Threshold: 300, SustainDuration: 2 * time.Minute}}
+	result := e.Evaluate(samples)
+	if !result.Persistent || result.TriggerPartition != 0 {
+		t.Errorf("expected partition 0 to trigger on age, got %+v", result)
+	}
+	if result.MaxCurrentLag != 600 {
+		t.Errorf("MaxCurrentLag = %d, want 600 seconds", result.MaxCurrentLag)
+	}
+
+	e = SecondsEvaluator{Evaluator: AbsoluteEvaluator{Threshold: 1000, SustainDuration: 2 * time.Minute}}
+	if result := e.Evaluate(samples); result.Persistent {
+		t.Errorf("expected no activation when every partition is younger than the threshold, got %+v", result)
+	}
+}
@@ -1,27 +1,229 @@
 package lag
 
 import (
+	"sort"
 	"sync"
 	"time"
 )
 
+// EvictionPolicy controls how the window bounds the samples it retains.
+type EvictionPolicy string
+
+const (
+	// EvictByTime drops samples older than windowSize * samplingInterval,
+	// plus any eviction margin.
+	EvictByTime EvictionPolicy = "time"
+	// EvictByCount keeps only the newest windowSize samples per partition.
+	EvictByCount EvictionPolicy = "count"
+	// EvictHybrid applies both the time and the count bound.
+	EvictHybrid EvictionPolicy = "hybrid"
+)
+
+// SpacingPolicy controls what Add does with a sample that arrives closer than
+// the minimum spacing to the previous one of its series.
+type SpacingPolicy string
+
+const (
+	// SpacingReject drops the new sample, keeping the previous one.
+	SpacingReject SpacingPolicy = "reject"
+	// SpacingMerge replaces the previous sample with the new one.
+	SpacingMerge SpacingPolicy = "merge"
+)
+
 type SlidingWindow struct {
 	mu             sync.RWMutex
-	samples        []LagSample
+	samples        ring
+	windowSize     int
 	windowDuration time.Duration
+	margin         time.Duration
+	interval       time.Duration
+	policy         EvictionPolicy
+	compact        bool
+	minSpacing     time.Duration
+	spacing        SpacingPolicy
+	partitionsHint int
+	version        uint64
+	// series indexes samples by partition for evaluation. Add keeps it up to
+	// date while each partition's samples arrive in time order; anything else
+	// that reorders or removes samples marks it stale for Series to rebuild.
+	series      PartitionSeries
+	seriesStale bool
+}
+
+// WindowOption customizes a SlidingWindow at construction.
+type WindowOption func(*SlidingWindow)
+
+// WithEvictionPolicy selects how old samples are evicted. The default is
+// EvictByTime.
+func WithEvictionPolicy(policy EvictionPolicy) WindowOption {
+	return func(w *SlidingWindow) {
+		w.policy = policy
+	}
+}
+
+// WithEvictionMargin keeps samples for margin beyond windowSize *
+// samplingInterval under time-based eviction, so the sample at exactly
+// now - sustainDuration survives long enough to be evaluated when the window
+// and the sustain duration are the same length.
+func WithEvictionMargin(margin time.Duration) WindowOption {
+	return func(w *SlidingWindow) {
+		w.margin = margin
+		w.windowDuration += margin
+	}
+}
+
+// WithCompaction collapses samples for the same (Topic, Partition) that fall
+// in the same sampling-interval bucket down to the latest one, so retries or
+// overlapping scrapes don't add redundant samples.
+func WithCompaction() WindowOption {
+	return func(w *SlidingWindow) {
+		w.compact = true
+	}
+}
+
+// WithMinSpacing makes Add hold each (Topic, Group, Partition) series to at
+// most one sample per spacing: a sample taken less than spacing after the
+// latest one held for its series, e.g. from a retried fetch, is rejected or
+// merged into it according to policy. Without it, or with spacing 0, every
+// sample is added, and evaluations that count samples per tick can count a
+// tick twice.
+func WithMinSpacing(spacing time.Duration, policy SpacingPolicy) WindowOption {
+	return func(w *SlidingWindow) {
+		w.minSpacing = spacing
+		w.spacing = policy
+	}
+}
+
+// WithPartitionsHint sizes the window's storage up front for windowSize
+// samples of n series, avoiding the reallocations of growing into it over the
+// first ticks. Storage still grows if more series show up.
+func WithPartitionsHint(n int) WindowOption {
+	return func(w *SlidingWindow) {
+		w.partitionsHint = n
+	}
 }
 
-func NewSlidingWindow(windowSize int, samplingInterval time.Duration) *SlidingWindow {
-	return &SlidingWindow{
+func NewSlidingWindow(windowSize int, samplingInterval time.Duration, opts ...WindowOption) *SlidingWindow {
+	w := &SlidingWindow{
+		windowSize:     windowSize,
 		windowDuration: time.Duration(windowSize) * samplingInterval,
+		interval:       samplingInterval,
+		policy:         EvictByTime,
+		series:         make(PartitionSeries),
+	}
+	for _, opt := range opts {
+		opt(w)
 	}
+	w.samples = newRing(windowSize * w.partitionsHint)
+	return w
 }
 
 func (w *SlidingWindow) Add(samples ...LagSample) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
-	w.samples = append(w.samples, samples...)
+	if w.minSpacing > 0 {
+		w.addSpaced(samples)
+	} else {
+		w.indexSeries(samples)
+		w.samples.push(samples...)
+	}
+	w.version++
+	if w.compact {
+		w.compactSamples()
+	}
+	w.evict()
+}
+
+// addSpaced adds samples one at a time, rejecting or merging each that falls
+// within minSpacing of the latest sample already held for its series.
+func (w *SlidingWindow) addSpaced(samples []LagSample) {
+	for _, s := range samples {
+		j := w.closeSample(s)
+		if j < 0 {
+			w.indexSeries([]LagSample{s})
+			w.samples.push(s)
+			continue
+		}
+		if w.spacing == SpacingMerge {
+			*w.samples.at(j) = s
+			w.seriesStale = true
+		}
+	}
+}
+
+// closeSample returns the index of the latest sample held for s's series if
+// s was taken less than minSpacing after it, or -1. Samples are searched from
+// the newest back, stopping at the first too old to be that close.
+func (w *SlidingWindow) closeSample(s LagSample) int {
+	cutoff := s.Timestamp.Add(-w.minSpacing)
+	for i := w.samples.len() - 1; i >= 0; i-- {
+		held := w.samples.at(i)
+		if !held.Timestamp.After(cutoff) {
+			return -1
+		}
+		if held.Topic == s.Topic && held.Group == s.Group && held.Partition == s.Partition {
+			if s.Timestamp.Before(held.Timestamp) {
+				return -1
+			}
+			return i
+		}
+	}
+	return -1
+}
+
+// indexSeries appends samples to their partitions' series, or marks the index
+// stale if one is older than the latest sample already held for its
+// partition.
+func (w *SlidingWindow) indexSeries(samples []LagSample) {
+	if w.seriesStale {
+		return
+	}
+	for _, s := range samples {
+		ss := w.series[s.Partition]
+		if len(ss) > 0 && s.Timestamp.Before(ss[len(ss)-1].Timestamp) {
+			w.seriesStale = true
+			return
+		}
+		w.series[s.Partition] = append(ss, s)
+	}
+}
+
+// Resize changes the window's size and sampling interval, e.g. on a config
+// reload, keeping the eviction margin and the minimum spacing's fraction of the
+// interval. Samples outside the new bounds are evicted straight away; a
+// larger window keeps everything already held and fills the rest as samples
+// arrive.
+func (w *SlidingWindow) Resize(windowSize int, samplingInterval time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.interval > 0 {
+		w.minSpacing = time.Duration(float64(w.minSpacing) * float64(samplingInterval) / float64(w.interval))
+	}
+	w.windowSize = windowSize
+	w.interval = samplingInterval
+	w.windowDuration = time.Duration(windowSize)*samplingInterval + w.margin
+	w.version++
+	w.evict()
+}
+
+// Restore bulk-loads samples with arbitrary timestamps, e.g. from history
+// replayed out of an external store. Unlike Add it sorts the merged window by
+// timestamp and keeps one sample per (Topic, Partition, sampling tick) before
+// evicting, so the result is the same regardless of input order.
+func (w *SlidingWindow) Restore(samples []LagSample) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.samples.push(samples...)
+	merged := w.samples.linear()
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].Timestamp.Before(merged[j].Timestamp)
+	})
+	w.version++
+	w.seriesStale = true
+	w.compactSamples()
 	w.evict()
 }
 
@@ -29,24 +231,239 @@ func (w *SlidingWindow) Snapshot() []LagSample {
 	w.mu.RLock()
 	defer w.mu.RUnlock()
 
-	out := make([]LagSample, len(w.samples))
-	copy(out, w.samples)
+	out := make([]LagSample, w.samples.len())
+	w.samples.copyTo(out)
+	return out
+}
+
+// Series returns the samples Snapshot would, grouped by partition. Evaluating
+// it avoids regrouping and resorting the whole window on every call: the
+// window keeps the grouping up to date as samples are added, rebuilding it
+// only after samples arrive out of order or are removed other than by
+// time-based eviction. The returned series share storage with the window and
+// must not be modified.
+func (w *SlidingWindow) Series() PartitionSeries {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.seriesStale {
+		samples := make([]LagSample, w.samples.len())
+		w.samples.copyTo(samples)
+		w.series = GroupByPartition(samples)
+		w.seriesStale = false
+	}
+
+	// Cap each series so later appends by Add go to storage the caller can't
+	// see
+	series := make(PartitionSeries, len(w.series))
+	for p, ss := range w.series {
+		series[p] = ss[:len(ss):len(ss)]
+	}
+	return series
+}
+
+// SnapshotSorted is Snapshot ordered by (Timestamp, Topic, Partition, Group)
+// rather than insertion order, which concurrent Adds make nondeterministic.
+// It's meant for display, persistence and tests; evaluation doesn't depend on
+// order and should use the cheaper Snapshot.
+func (w *SlidingWindow) SnapshotSorted() []LagSample {
+	out := w.Snapshot()
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if !a.Timestamp.Equal(b.Timestamp) {
+			return a.Timestamp.Before(b.Timestamp)
+		}
+		if a.Topic != b.Topic {
+			return a.Topic < b.Topic
+		}
+		if a.Partition != b.Partition {
+			return a.Partition < b.Partition
+		}
+		return a.Group < b.Group
+	})
+	return out
+}
+
+// SnapshotFiltered returns a copy of only the samples for which pred returns
+// true, avoiding a full copy of the window for targeted queries.
+func (w *SlidingWindow) SnapshotFiltered(pred func(LagSample) bool) []LagSample {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	var out []LagSample
+	for i := range w.samples.len() {
+		if s := *w.samples.at(i); pred(s) {
+			out = append(out, s)
+		}
+	}
 	return out
 }
 
+// SnapshotForPartition returns a copy of the samples for a single partition.
+func (w *SlidingWindow) SnapshotForPartition(partition int) []LagSample {
+	return w.SnapshotFiltered(func(s LagSample) bool {
+		return s.Partition == partition
+	})
+}
+
+// Remove deletes every sample for which pred returns true and reports how
+// many were removed.
+func (w *SlidingWindow) Remove(pred func(LagSample) bool) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	removed := w.samples.filter(func(s LagSample) bool {
+		return !pred(s)
+	})
+	if removed > 0 {
+		w.version++
+		w.seriesStale = true
+	}
+	return removed
+}
+
+// Version increases every time the window's contents change, so callers can
+// cheaply tell whether a previous snapshot is still current.
+func (w *SlidingWindow) Version() uint64 {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.version
+}
+
 func (w *SlidingWindow) Len() int {
 	w.mu.RLock()
 	defer w.mu.RUnlock()
-	return len(w.samples)
+	return w.samples.len()
+}
+
+// FillRatio reports how full the window is relative to the number of samples
+// expected once every (Group, Partition) series has windowSize samples. Series
+// are counted from the samples currently held, and the ratio is capped at 1.
+func (w *SlidingWindow) FillRatio() float64 {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	n := w.samples.len()
+	if n == 0 || w.windowSize <= 0 {
+		return 0
+	}
+
+	type series struct {
+		group     string
+		partition int
+	}
+	seen := make(map[series]struct{})
+	for i := range n {
+		s := w.samples.at(i)
+		seen[series{s.Group, s.Partition}] = struct{}{}
+	}
+
+	ratio := float64(n) / float64(w.windowSize*len(seen))
+	if ratio > 1 {
+		ratio = 1
+	}
+	return ratio
 }
 
 func (w *SlidingWindow) evict() {
+	switch w.policy {
+	case EvictByCount:
+		w.evictByCount()
+	case EvictHybrid:
+		w.evictByTime()
+		w.evictByCount()
+	default:
+		w.evictByTime()
+	}
+}
+
+func (w *SlidingWindow) evictByTime() {
 	cutoff := time.Now().Add(-w.windowDuration)
 	i := 0
-	for i < len(w.samples) && w.samples[i].Timestamp.Before(cutoff) {
+	for i < w.samples.len() && w.samples.at(i).Timestamp.Before(cutoff) {
 		i++
 	}
-	if i > 0 {
-		w.samples = w.samples[i:]
+	w.dropSeriesFront(i)
+	w.samples.dropFront(i)
+}
+
+// dropSeriesFront drops the first n samples from the series index. With every
+// partition's samples in time order, those are the oldest of each partition
+// they belong to.
+func (w *SlidingWindow) dropSeriesFront(n int) {
+	if w.seriesStale || n == 0 {
+		return
+	}
+	dropped := make(map[int]int)
+	for i := range n {
+		dropped[w.samples.at(i).Partition]++
+	}
+	for p, k := range dropped {
+		if k == len(w.series[p]) {
+			delete(w.series, p)
+			continue
+		}
+		w.series[p] = w.series[p][k:]
+	}
+}
+
+// evictByCount keeps the newest windowSize samples of each (Topic, Group,
+// Partition) series, preserving the order of the survivors.
+func (w *SlidingWindow) evictByCount() {
+	type key struct {
+		topic     string
+		group     string
+		partition int
+	}
+
+	// Count each series from the newest sample back; the first windowSize
+	// seen of each are kept
+	remaining := make(map[key]int)
+	for i := range w.samples.len() {
+		s := w.samples.at(i)
+		remaining[key{s.Topic, s.Group, s.Partition}]++
+	}
+	removed := w.samples.filter(func(s LagSample) bool {
+		k := key{s.Topic, s.Group, s.Partition}
+		remaining[k]--
+		return remaining[k] < w.windowSize
+	})
+	if removed > 0 {
+		w.seriesStale = true
+	}
+}
+
+// compactSamples keeps one sample per (Topic, Group, Partition, interval
+// bucket), preferring the one with the latest timestamp.
+func (w *SlidingWindow) compactSamples() {
+	if w.interval <= 0 {
+		return
+	}
+
+	type key struct {
+		topic     string
+		group     string
+		partition int
+		bucket    time.Time
+	}
+
+	index := make(map[key]int, w.samples.len())
+	compacted := 0
+	for i := range w.samples.len() {
+		s := *w.samples.at(i)
+		k := key{s.Topic, s.Group, s.Partition, s.Timestamp.Truncate(w.interval)}
+		if j, ok := index[k]; ok {
+			if kept := w.samples.at(j); !s.Timestamp.Before(kept.Timestamp) {
+				*kept = s
+			}
+			continue
+		}
+		index[k] = compacted
+		*w.samples.at(compacted) = s
+		compacted++
+	}
+	if compacted < w.samples.len() {
+		w.seriesStale = true
 	}
+	w.samples.truncate(compacted)
 }
@@ -67,6 +67,38 @@ func TestSlidingWindow_EvictsOldSamples(t *testing.T) {
 	}
 }
 
+func TestSlidingWindow_ResizeReEvicts(t *testing.T) {
+	w := NewSlidingWindow(10, time.Second, WithEvictionMargin(time.Second)) // 11s window
+
+	now := time.Now()
+	for i := range 10 {
+		w.Add(LagSample{Timestamp: now.Add(time.Duration(i-9) * time.Second), Partition: 0, Lag: int64(i)})
+	}
+	if w.Len() != 10 {
+		t.Fatalf("expected all 10 samples in the window, got %d", w.Len())
+	}
+	version := w.Version()
+
+	// 2 x 2s plus the 1s margin: samples older than 5s are evicted
+	w.Resize(2, 2*time.Second)
+	if w.Len() != 5 {
+		t.Fatalf("expected 5 samples after shrinking the window, got %d", w.Len())
+	}
+	if w.Version() == version {
+		t.Error("expected Resize to change the version")
+	}
+	if series := w.Series(); len(series[0]) != 5 {
+		t.Errorf("expected the series index to match the resized window, got %d samples", len(series[0]))
+	}
+
+	// Growing keeps what's held
+	w.Resize(30, 2*time.Second)
+	w.Add(LagSample{Timestamp: now.Add(time.Second), Partition: 0, Lag: 10})
+	if w.Len() != 6 {
+		t.Errorf("expected 6 samples after growing the window, got %d", w.Len())
+	}
+}
+
 func TestSlidingWindow_KeepsFreshSamples(t *testing.T) {
 	w := NewSlidingWindow(30, time.Second) // 30s window
 
@@ -158,3 +190,375 @@ func TestSlidingWindow_ConcurrentAccess(t *testing.T) {
 		t.Errorf("expected 1000 samples, got %d", w.Len())
 	}
 }
+
+func TestSlidingWindow_SnapshotSortedUnderConcurrentWrites(t *testing.T) {
+	w := NewSlidingWindow(60, time.Second)
+
+	now := time.Now()
+	var wg sync.WaitGroup
+	for p := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 20 {
+				w.Add(LagSample{
+					Timestamp: now.Add(time.Duration(j) * time.Millisecond),
+					Topic:     "t",
+					Partition: p,
+					Lag:       int64(j),
+				})
+			}
+		}()
+	}
+	wg.Wait()
+
+	got := w.SnapshotSorted()
+	if len(got) != 200 {
+		t.Fatalf("expected 200 samples, got %d", len(got))
+	}
+	for i, s := range got {
+		wantTimestamp := now.Add(time.Duration(i/10) * time.Millisecond)
+		if !s.Timestamp.Equal(wantTimestamp) || s.Partition != i%10 {
+			t.Fatalf("sample %d is partition %d at %v, want partition %d at %v", i, s.Partition, s.Timestamp, i%10, wantTimestamp)
+		}
+	}
+}
+
+func TestSlidingWindow_FillRatio(t *testing.T) {
+	w := NewSlidingWindow(10, time.Second)
+
+	if r := w.FillRatio(); r != 0 {
+		t.Fatalf("expected 0 fill ratio for empty window, got %f", r)
+	}
+
+	now := time.Now()
+	// 4 ticks across 2 partitions: 8 of the 20 samples a full window holds
+	for i := range 4 {
+		ts := now.Add(time.Duration(-i) * time.Second)
+		w.Add(
+			LagSample{Timestamp: ts, Partition: 0, Lag: 10},
+			LagSample{Timestamp: ts, Partition: 1, Lag: 20},
+		)
+	}
+
+	if r := w.FillRatio(); r != 0.4 {
+		t.Errorf("expected fill ratio 0.4, got %f", r)
+	}
+}
+
+func TestSlidingWindow_SnapshotFiltered(t *testing.T) {
+	w := NewSlidingWindow(10, time.Second)
+
+	now := time.Now()
+	w.Add(
+		LagSample{Timestamp: now, Topic: "orders", Partition: 0, Lag: 10},
+		LagSample{Timestamp: now, Topic: "orders", Partition: 1, Lag: 20},
+		LagSample{Timestamp: now, Topic: "payments", Partition: 0, Lag: 30},
+	)
+
+	snap := w.SnapshotFiltered(func(s LagSample) bool { return s.Topic == "payments" })
+	if len(snap) != 1 || snap[0].Lag != 30 {
+		t.Fatalf("expected only the payments sample, got %+v", snap)
+	}
+
+	snap = w.SnapshotForPartition(0)
+	if len(snap) != 2 {
+		t.Fatalf("expected 2 samples for partition 0, got %d", len(snap))
+	}
+	for _, s := range snap {
+		if s.Partition != 0 {
+			t.Errorf("unexpected partition %d in filtered snapshot", s.Partition)
+		}
+	}
+
+	if snap := w.SnapshotForPartition(7); len(snap) != 0 {
+		t.Errorf("expected no samples for unknown partition, got %d", len(snap))
+	}
+}
+
+func TestSlidingWindow_SnapshotFilteredIsACopy(t *testing.T) {
+	w := NewSlidingWindow(10, time.Second)
+
+	now := time.Now()
+	w.Add(LagSample{Timestamp: now, Partition: 0, Lag: 100})
+
+	snap := w.SnapshotForPartition(0)
+	snap[0].Lag = 999
+
+	if w.SnapshotForPartition(0)[0].Lag != 100 {
+		t.Error("SnapshotFiltered should return a copy; modifying it should not affect the window")
+	}
+}
+
+func TestSlidingWindow_EvictByCount(t *testing.T) {
+	w := NewSlidingWindow(3, time.Second, WithEvictionPolicy(EvictByCount))
+
+	now := time.Now()
+	// Samples far older than 3s survive because only the count bound applies
+	for i := range 5 {
+		ts := now.Add(time.Duration(i-60) * time.Second)
+		w.Add(
+			LagSample{Timestamp: ts, Partition: 0, Lag: int64(i)},
+			LagSample{Timestamp: ts, Partition: 1, Lag: int64(i * 10)},
+		)
+	}
+
+	if w.Len() != 6 {
+		t.Fatalf("expected 3 samples per partition (6), got %d", w.Len())
+	}
+	p0 := w.SnapshotForPartition(0)
+	if p0[0].Lag != 2 || p0[2].Lag != 4 {
+		t.Errorf("expected newest 3 samples for partition 0, got %+v", p0)
+	}
+}
+
+func TestSlidingWindow_EvictByTimeIgnoresCount(t *testing.T) {
+	w := NewSlidingWindow(3, time.Second, WithEvictionPolicy(EvictByTime))
+
+	now := time.Now()
+	for i := range 5 {
+		w.Add(LagSample{Timestamp: now.Add(time.Duration(i) * time.Millisecond), Partition: 0, Lag: int64(i)})
+	}
+
+	if w.Len() != 5 {
+		t.Fatalf("expected all 5 fresh samples retained under time policy, got %d", w.Len())
+	}
+}
+
+func TestSlidingWindow_EvictHybrid(t *testing.T) {
+	w := NewSlidingWindow(3, time.Second, WithEvictionPolicy(EvictHybrid))
+
+	now := time.Now()
+	w.Add(
+		LagSample{Timestamp: now.Add(-10 * time.Second), Partition: 0, Lag: 1}, // too old
+		LagSample{Timestamp: now.Add(-4 * time.Millisecond), Partition: 0, Lag: 2},
+		LagSample{Timestamp: now.Add(-3 * time.Millisecond), Partition: 0, Lag: 3},
+		LagSample{Timestamp: now.Add(-2 * time.Millisecond), Partition: 0, Lag: 4},
+		LagSample{Timestamp: now.Add(-1 * time.Millisecond), Partition: 0, Lag: 5},
+	)
+
+	snap := w.Snapshot()
+	if len(snap) != 3 {
+		t.Fatalf("expected 3 samples after time and count eviction, got %d", len(snap))
+	}
+	if snap[0].Lag != 3 || snap[2].Lag != 5 {
+		t.Errorf("unexpected surviving samples: %+v", snap)
+	}
+}
+
+func TestSlidingWindow_CompactionCollapsesDuplicates(t *testing.T) {
+	w := NewSlidingWindow(30, 10*time.Second, WithCompaction())
+
+	tick := time.Now().Truncate(10 * time.Second)
+	w.Add(
+		LagSample{Timestamp: tick.Add(1 * time.Second), Topic: "orders", Partition: 0, Lag: 100},
+		LagSample{Timestamp: tick.Add(1 * time.Second), Topic: "orders", Partition: 1, Lag: 200},
+	)
+	// A retry within the same tick
+	w.Add(
+		LagSample{Timestamp: tick.Add(4 * time.Second), Topic: "orders", Partition: 0, Lag: 150},
+		LagSample{Timestamp: tick.Add(4 * time.Second), Topic: "orders", Partition: 1, Lag: 250},
+	)
+
+	snap := w.Snapshot()
+	if len(snap) != 2 {
+		t.Fatalf("expected duplicates to collapse to 2 samples, got %d", len(snap))
+	}
+	if snap[0].Lag != 150 || snap[1].Lag != 250 {
+		t.Errorf("expected latest sample per partition to win, got %+v", snap)
+	}
+
+	// The next tick is a separate bucket
+	w.Add(LagSample{Timestamp: tick.Add(-9 * time.Second), Topic: "orders", Partition: 0, Lag: 50})
+	if w.Len() != 3 {
+		t.Errorf("expected sample from a different tick to be kept, got %d samples", w.Len())
+	}
+}
+
+func TestSlidingWindow_NoCompactionByDefault(t *testing.T) {
+	w := NewSlidingWindow(30, 10*time.Second)
+
+	tick := time.Now().Truncate(10 * time.Second)
+	w.Add(LagSample{Timestamp: tick.Add(1 * time.Second), Partition: 0, Lag: 100})
+	w.Add(LagSample{Timestamp: tick.Add(2 * time.Second), Partition: 0, Lag: 150})
+
+	if w.Len() != 2 {
+		t.Errorf("expected duplicates to be kept without compaction, got %d", w.Len())
+	}
+}
+
+func TestSlidingWindow_MinSpacingRejectsCloseSamples(t *testing.T) {
+	w := NewSlidingWindow(30, 10*time.Second, WithMinSpacing(5*time.Second, SpacingReject))
+
+	now := time.Now().Add(-time.Minute)
+	w.Add(
+		LagSample{Timestamp: now, Topic: "orders", Partition: 0, Lag: 100},
+		LagSample{Timestamp: now, Topic: "orders", Partition: 1, Lag: 200},
+	)
+	// A retried fetch 2s later, with a sample for another group that isn't
+	// close to anything
+	w.Add(
+		LagSample{Timestamp: now.Add(2 * time.Second), Topic: "orders", Partition: 0, Lag: 150},
+		LagSample{Timestamp: now.Add(2 * time.Second), Topic: "orders", Group: "audit", Partition: 0, Lag: 10},
+	)
+	// The next regular tick
+	w.Add(LagSample{Timestamp: now.Add(10 * time.Second), Topic: "orders", Partition: 0, Lag: 300})
+
+	snap := w.SnapshotForPartition(0)
+	if len(snap) != 3 {
+		t.Fatalf("expected the close sample to be rejected, got %+v", snap)
+	}
+	if snap[0].Lag != 100 || snap[1].Group != "audit" || snap[2].Lag != 300 {
+		t.Errorf("expected the earlier sample to be kept, got %+v", snap)
+	}
+	if got := w.Series()[0]; len(got) != 3 {
+		t.Errorf("expected the series to hold 3 samples, got %+v", got)
+	}
+}
+
+func TestSlidingWindow_MinSpacingMergesCloseSamples(t *testing.T) {
+	w := NewSlidingWindow(30, 10*time.Second, WithMinSpacing(5*time.Second, SpacingMerge))
+
+	now := time.Now().Add(-time.Minute)
+	w.Add(
+		LagSample{Timestamp: now, Topic: "orders", Partition: 0, Lag: 100},
+		LagSample{Timestamp: now, Topic: "orders", Partition: 1, Lag: 200},
+	)
+	w.Series()
+	w.Add(
+		LagSample{Timestamp: now.Add(2 * time.Second), Topic: "orders", Partition: 0, Lag: 150},
+		// Close to the sample just merged, not only to the first
+		LagSample{Timestamp: now.Add(4 * time.Second), Topic: "orders", Partition: 0, Lag: 175},
+	)
+	w.Add(LagSample{Timestamp: now.Add(10 * time.Second), Topic: "orders", Partition: 0, Lag: 300})
+
+	snap := w.SnapshotForPartition(0)
+	if len(snap) != 2 {
+		t.Fatalf("expected the close samples to be merged, got %+v", snap)
+	}
+	if snap[0].Lag != 175 || snap[1].Lag != 300 {
+		t.Errorf("expected the latest close sample to win, got %+v", snap)
+	}
+	if got := w.Series()[0]; len(got) != 2 || got[0].Lag != 175 {
+		t.Errorf("expected the series to reflect the merge, got %+v", got)
+	}
+	if w.Len() != 3 {
+		t.Errorf("expected partition 1 to be untouched, got %d samples", w.Len())
+	}
+}
+
+func TestSlidingWindow_NoMinSpacingByDefault(t *testing.T) {
+	w := NewSlidingWindow(30, 10*time.Second)
+
+	now := time.Now()
+	w.Add(LagSample{Timestamp: now, Partition: 0, Lag: 100})
+	w.Add(LagSample{Timestamp: now.Add(time.Second), Partition: 0, Lag: 150})
+
+	if w.Len() != 2 {
+		t.Errorf("expected close samples to be kept without a minimum spacing, got %d", w.Len())
+	}
+}
+
+func TestSlidingWindow_Remove(t *testing.T) {
+	w := NewSlidingWindow(10, time.Second)
+
+	now := time.Now()
+	w.Add(
+		LagSample{Timestamp: now.Add(-2 * time.Second), Partition: 0, Lag: 10},
+		LagSample{Timestamp: now.Add(-2 * time.Second), Partition: 1, Lag: 20},
+		LagSample{Timestamp: now, Partition: 0, Lag: 30},
+	)
+
+	removed := w.Remove(func(s LagSample) bool {
+		return s.Partition == 0 && s.Timestamp.Before(now)
+	})
+	if removed != 1 {
+		t.Fatalf("expected 1 sample removed, got %d", removed)
+	}
+
+	snap := w.Snapshot()
+	if len(snap) != 2 || snap[0].Lag != 20 || snap[1].Lag != 30 {
+		t.Errorf("unexpected samples after Remove: %+v", snap)
+	}
+}
+
+func TestSlidingWindow_VersionChangesOnMutation(t *testing.T) {
+	w := NewSlidingWindow(10, time.Second)
+	v0 := w.Version()
+
+	now := time.Now()
+	w.Add(LagSample{Timestamp: now, Partition: 0, Lag: 1})
+	v1 := w.Version()
+	if v1 == v0 {
+		t.Fatal("expected Add to change the version")
+	}
+
+	_ = w.Snapshot()
+	if w.Version() != v1 {
+		t.Error("expected reads to leave the version unchanged")
+	}
+
+	w.Remove(func(LagSample) bool { return false })
+	if w.Version() != v1 {
+		t.Error("expected a no-op Remove to leave the version unchanged")
+	}
+
+	w.Remove(func(LagSample) bool { return true })
+	if w.Version() == v1 {
+		t.Error("expected Remove to change the version")
+	}
+}
+
+func TestSlidingWindow_RestoreSortsDedupesAndEvicts(t *testing.T) {
+	// 6 samples * 10s = 60s window
+	w := NewSlidingWindow(6, 10*time.Second)
+
+	tick := time.Now().Truncate(10 * time.Second)
+	w.Restore([]LagSample{
+		{Timestamp: tick.Add(-20 * time.Second), Partition: 0, Lag: 300},
+		{Timestamp: tick.Add(-2 * time.Minute), Partition: 0, Lag: 999}, // outside the window
+		{Timestamp: tick.Add(-40 * time.Second), Partition: 0, Lag: 100},
+		{Timestamp: tick.Add(-18 * time.Second), Partition: 0, Lag: 350}, // same tick as -20s, newer
+		{Timestamp: tick.Add(-30 * time.Second), Partition: 0, Lag: 200},
+	})
+
+	snap := w.Snapshot()
+	if len(snap) != 3 {
+		t.Fatalf("expected 3 samples after dedupe and eviction, got %d: %+v", len(snap), snap)
+	}
+	for i := 1; i < len(snap); i++ {
+		if snap[i].Timestamp.Before(snap[i-1].Timestamp) {
+			t.Fatalf("expected samples sorted by timestamp, got %+v", snap)
+		}
+	}
+	if snap[0].Lag != 100 || snap[1].Lag != 200 || snap[2].Lag != 350 {
+		t.Errorf("unexpected restored lags: %d, %d, %d", snap[0].Lag, snap[1].Lag, snap[2].Lag)
+	}
+}
+
+func TestSlidingWindow_EvictionMarginKeepsBoundarySample(t *testing.T) {
+	// A 60s window evaluated against a 60s sustain duration
+	const sustain = 60 * time.Second
+
+	fill := func(w *SlidingWindow) {
+		now := time.Now()
+		for i := 6; i >= 0; i-- {
+			w.Add(LagSample{Timestamp: now.Add(-time.Duration(i) * 10 * time.Second), Partition: 0, Lag: 1000})
+		}
+	}
+
+	exact := NewSlidingWindow(6, 10*time.Second)
+	fill(exact)
+	if EvaluatePersistence(exact.Snapshot(), 500, sustain, 0).Persistent {
+		t.Fatal("expected the boundary sample to be evicted without a margin")
+	}
+
+	margin := NewSlidingWindow(6, 10*time.Second, WithEvictionMargin(10*time.Second))
+	fill(margin)
+	if margin.Len() != 7 {
+		t.Errorf("expected the boundary sample to survive, got %d samples", margin.Len())
+	}
+	if !EvaluatePersistence(margin.Snapshot(), 500, sustain, 0).Persistent {
+		t.Error("expected persistence to be reachable at the exact boundary with a margin")
+	}
+}
@@ -0,0 +1,40 @@
+package logging
+
+import (
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/config"
+)
+
+// New returns a logger writing to w in the given format. The JSON format uses
+// the field names expected by the cluster logging stack: level, ts and msg,
+// with levels in lower case.
+func New(format string, w io.Writer) *slog.Logger {
+	if format != config.LogFormatJSON {
+		return slog.New(slog.NewTextHandler(w, nil))
+	}
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{
+		ReplaceAttr: renameJSONAttrs,
+	}))
+}
+
+// Component returns the default logger tagged with the emitting package, so
+// log lines can be filtered per component.
+func Component(name string) *slog.Logger {
+	return slog.Default().With("component", name)
+}
+
+func renameJSONAttrs(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) > 0 {
+		return a
+	}
+	switch a.Key {
+	case slog.TimeKey:
+		a.Key = "ts"
+	case slog.LevelKey:
+		a.Value = slog.StringValue(strings.ToLower(a.Value.String()))
+	}
+	return a
+}
@@ -0,0 +1,52 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/config"
+)
+
+func TestNew_JSONFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(config.LogFormatJSON, &buf).With("component", "scraper")
+	logger.Info("Collected lag sample", "topic", "orders", "partition", 3, "lag", int64(1200), "persistent", true)
+
+	var got map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("log line is not JSON: %v: %s", err, buf.String())
+	}
+
+	want := map[string]any{
+		"level":      "info",
+		"msg":        "Collected lag sample",
+		"component":  "scraper",
+		"topic":      "orders",
+		"partition":  float64(3),
+		"lag":        float64(1200),
+		"persistent": true,
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %v, want %v", k, got[k], v)
+		}
+	}
+	if _, ok := got["ts"]; !ok {
+		t.Error("expected a ts field")
+	}
+	if _, ok := got["time"]; ok {
+		t.Error("expected time to be renamed to ts")
+	}
+}
+
+func TestNew_TextByDefault(t *testing.T) {
+	var buf bytes.Buffer
+	New("", &buf).Info("hello", "component", "server")
+
+	line := buf.String()
+	if strings.HasPrefix(line, "{") || !strings.Contains(line, "component=server") {
+		t.Errorf("expected a text log line, got %q", line)
+	}
+}
@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"strconv"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var exemplars atomic.Bool
+
+// EnableExemplars makes ObserveLag attach exemplars. They're only exposed
+// when /metrics is served in the OpenMetrics format.
+func EnableExemplars() {
+	exemplars.Store(true)
+}
+
+// ObserveLag records a partition sample's lag in PartitionLag, with the
+// partition and committed offset as an exemplar when exemplars are enabled,
+// so a spike can be traced to where it came from.
+func ObserveLag(partition int, offset, lag int64) {
+	observeLag(PartitionLag, partition, offset, lag)
+}
+
+func observeLag(h prometheus.Histogram, partition int, offset, lag int64) {
+	eo, ok := h.(prometheus.ExemplarObserver)
+	if !ok || !exemplars.Load() {
+		h.Observe(float64(lag))
+		return
+	}
+	eo.ObserveWithExemplar(float64(lag), prometheus.Labels{
+		"partition": strconv.Itoa(partition),
+		"offset":    strconv.FormatInt(offset, 10),
+	})
+}
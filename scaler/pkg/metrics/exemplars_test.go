@@ -0,0 +1,70 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func newTestHistogram() prometheus.Histogram {
+	return prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "test_partition_lag",
+		Buckets: prometheus.ExponentialBuckets(10, 10, 7),
+	})
+}
+
+// bucketExemplars returns the exemplars attached to h's buckets.
+func bucketExemplars(t *testing.T, h prometheus.Histogram) []*dto.Exemplar {
+	t.Helper()
+	var m dto.Metric
+	if err := h.Write(&m); err != nil {
+		t.Fatalf("write histogram: %v", err)
+	}
+	var found []*dto.Exemplar
+	for _, b := range m.GetHistogram().GetBucket() {
+		if e := b.GetExemplar(); e != nil {
+			found = append(found, e)
+		}
+	}
+	return found
+}
+
+func TestObserveLag_AttachesPartitionExemplar(t *testing.T) {
+	EnableExemplars()
+	t.Cleanup(func() { exemplars.Store(false) })
+
+	h := newTestHistogram()
+	observeLag(h, 3, 41200, 750)
+
+	found := bucketExemplars(t, h)
+	if len(found) != 1 {
+		t.Fatalf("expected 1 exemplar, got %d", len(found))
+	}
+	labels := make(map[string]string)
+	for _, l := range found[0].GetLabel() {
+		labels[l.GetName()] = l.GetValue()
+	}
+	if labels["partition"] != "3" || labels["offset"] != "41200" {
+		t.Errorf("exemplar labels = %v, want partition 3 and offset 41200", labels)
+	}
+	if found[0].GetValue() != 750 {
+		t.Errorf("exemplar value = %g, want 750", found[0].GetValue())
+	}
+}
+
+func TestObserveLag_NoExemplarWhenDisabled(t *testing.T) {
+	h := newTestHistogram()
+	observeLag(h, 3, 41200, 750)
+
+	if found := bucketExemplars(t, h); len(found) != 0 {
+		t.Errorf("expected no exemplars while disabled, got %d", len(found))
+	}
+	var m dto.Metric
+	if err := h.Write(&m); err != nil {
+		t.Fatalf("write histogram: %v", err)
+	}
+	if m.GetHistogram().GetSampleCount() != 1 {
+		t.Errorf("expected the observation to be recorded, got count %d", m.GetHistogram().GetSampleCount())
+	}
+}
@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	WindowSamples = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "kpkls_window_samples",
+		Help: "Number of lag samples currently held in the sliding window.",
+	})
+
+	WindowFillRatio = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "kpkls_window_fill_ratio",
+		Help: "Samples in the window divided by the samples expected for a full window.",
+	})
+
+	ConsumeRate = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "kpkls_consume_rate",
+		Help: "Committed-offset throughput across all partitions in messages/sec, from the last two scrapes.",
+	})
+
+	PartitionStaleness = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kpkls_partition_staleness_seconds",
+		Help: "Seconds since the newest sample in the window for each partition. A stuck partition leader shows as a value that keeps growing.",
+	}, []string{"partition"})
+
+	PartitionLag = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "kpkls_partition_lag",
+		Help:    "Lag in messages of each scraped partition sample. With exemplars enabled, observations carry the partition and committed offset.",
+		Buckets: prometheus.ExponentialBuckets(10, 10, 7),
+	})
+
+	TotalLag = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "kpkls_total_lag",
+		Help: "Total lag across all partitions at the last successful scrape.",
+	})
+
+	LaggingPartitions = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "kpkls_lagging_partitions",
+		Help: "Number of partitions whose latest lag is at or above the lag threshold.",
+	})
+
+	ScrapeErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "kpkls_scrape_errors_total",
+		Help: "Number of scrapes that failed, including ones that panicked.",
+	})
+
+	ScraperBreakerOpen = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "kpkls_scraper_breaker_open",
+		Help: "1 while the scraper's circuit breaker is open after repeated failed scrapes, 0 otherwise.",
+	})
+
+	EstimatedDrainSeconds = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "kpkls_estimated_drain_seconds",
+		Help: "Projected seconds until the backlog clears at the current consume rate; +Inf while lag isn't being consumed.",
+	})
+
+	LagDrainedSeconds = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "kpkls_lag_drained_seconds",
+		Help: "Seconds total lag has continuously been zero within the window; 0 while any lag remains.",
+	})
+
+	GroupMembers = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kpkls_consumer_group_members",
+		Help: "Active members of each consumer group at the last scrape. Only set when groupMembers is enabled.",
+	}, []string{"group"})
+
+	NoMembersSuppressed = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "kpkls_no_members_suppressed",
+		Help: "1 while activation is suppressed because no consumer group has active members, 0 otherwise.",
+	})
+
+	ScheduleSuppressed = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "kpkls_schedule_suppressed",
+		Help: "1 while activation is suppressed because suppressSchedule matches the current time, 0 otherwise.",
+	})
+
+	Persistent = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "kpkls_persistent",
+		Help: "1 while the persistence verdict is active, 0 otherwise.",
+	})
+
+	PersistenceTransitions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kpkls_persistence_transitions_total",
+		Help: "Number of times the persistence verdict changed, by the state transitioned to.",
+	}, []string{"to"})
+)
@@ -0,0 +1,36 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	prombridge "go.opentelemetry.io/contrib/bridges/prometheus"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+// StartOTLP pushes every metric in the default Prometheus registry, the ones
+// above included, to an OTLP/gRPC collector at endpoint, so the definitions
+// are shared with /metrics rather than duplicated as OTel instruments. An
+// empty endpoint falls back to OTEL_EXPORTER_OTLP_ENDPOINT; the other
+// standard OTEL_ env vars, e.g. OTEL_METRIC_EXPORT_INTERVAL and
+// OTEL_RESOURCE_ATTRIBUTES, apply as usual. Shut the returned provider down
+// to flush the last export.
+func StartOTLP(ctx context.Context, endpoint string) (*sdkmetric.MeterProvider, error) {
+	var opts []otlpmetricgrpc.Option
+	if endpoint != "" {
+		opts = append(opts, otlpmetricgrpc.WithEndpointURL(endpoint))
+	}
+	exporter, err := otlpmetricgrpc.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("create OTLP exporter: %w", err)
+	}
+	reader := sdkmetric.NewPeriodicReader(exporter, sdkmetric.WithProducer(producer(prometheus.DefaultGatherer)))
+	return sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)), nil
+}
+
+// producer converts what gatherer collects to OTel metrics on each export.
+func producer(gatherer prometheus.Gatherer) sdkmetric.Producer {
+	return prombridge.NewMetricProducer(prombridge.WithGatherer(gatherer))
+}
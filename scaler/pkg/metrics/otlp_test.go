@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestProducer_ExportsRegisteredMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader(sdkmetric.WithProducer(producer(prometheus.DefaultGatherer)))
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	t.Cleanup(func() { provider.Shutdown(context.Background()) })
+
+	TotalLag.Set(1234)
+	Persistent.Set(1)
+	ScrapeErrors.Inc()
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	got := make(map[string]metricdata.Aggregation)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			got[m.Name] = m.Data
+		}
+	}
+
+	for name, want := range map[string]float64{"kpkls_total_lag": 1234, "kpkls_persistent": 1} {
+		g, ok := got[name].(metricdata.Gauge[float64])
+		if !ok || len(g.DataPoints) != 1 || g.DataPoints[0].Value != want {
+			t.Errorf("%s = %+v, want a gauge of %g", name, got[name], want)
+		}
+	}
+	s, ok := got["kpkls_scrape_errors_total"].(metricdata.Sum[float64])
+	if !ok || !s.IsMonotonic || len(s.DataPoints) != 1 || s.DataPoints[0].Value < 1 {
+		t.Errorf("kpkls_scrape_errors_total = %+v, want a monotonic sum of at least 1", got["kpkls_scrape_errors_total"])
+	}
+}
@@ -0,0 +1,79 @@
+package scraper
+
+import (
+	"math/rand/v2"
+	"time"
+
+	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/metrics"
+)
+
+// breaker is the state of the scraper's circuit breaker, guarded by
+// healthMu. It opens after BreakerThreshold consecutive failed scrapes; while
+// open, ticks before retryAt are skipped and every further failure doubles
+// backoff. A successful scrape closes it.
+type breaker struct {
+	failures int
+	open     bool
+	backoff  time.Duration
+	retryAt  time.Time
+}
+
+// equalJitter spreads a backoff of d uniformly over [d/2, d], so scalers
+// that lost the same brokers don't all retry in lockstep.
+func equalJitter(d time.Duration) time.Duration {
+	if d < 2 {
+		return d
+	}
+	return d/2 + rand.N(d/2)
+}
+
+// breakerAllows reports whether a tick should scrape: always while the
+// breaker is closed, and once its backoff has elapsed while it's open.
+func (s *MetricsScraper) breakerAllows() bool {
+	s.healthMu.Lock()
+	defer s.healthMu.Unlock()
+	return !s.breaker.open || !s.now().Before(s.breaker.retryAt)
+}
+
+// recordResult updates the breaker with the outcome of a scrape. Only the
+// transitions and each backoff are logged, so a long broker outage doesn't
+// log an error every tick.
+func (s *MetricsScraper) recordResult(err error) {
+	if s.config().BreakerThreshold <= 0 {
+		return
+	}
+	s.healthMu.Lock()
+	defer s.healthMu.Unlock()
+
+	b := &s.breaker
+	if err == nil {
+		if b.open {
+			s.logger.Info("Circuit breaker closed", "topic", s.config().Topic, "failures", b.failures)
+			metrics.ScraperBreakerOpen.Set(0)
+		}
+		*b = breaker{}
+		return
+	}
+
+	b.failures++
+	if b.failures < s.config().BreakerThreshold {
+		return
+	}
+	if !b.open {
+		// The first backoff skips one tick; each failure after doubles it
+		b.open = true
+		b.backoff = 2 * s.config().SamplingInterval
+		metrics.ScraperBreakerOpen.Set(1)
+	} else {
+		b.backoff *= 2
+	}
+	b.backoff = min(b.backoff, max(s.config().BreakerMaxBackoff, s.config().SamplingInterval))
+
+	wait := s.jitter(b.backoff)
+	b.retryAt = s.now().Add(wait)
+	s.logger.Warn("Circuit breaker open, backing off",
+		"topic", s.config().Topic,
+		"failures", b.failures,
+		"retryIn", wait,
+	)
+}
@@ -0,0 +1,121 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/lag"
+)
+
+func TestBreaker_OpensBacksOffAndCloses(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.BreakerThreshold = 3
+	cfg.BreakerMaxBackoff = time.Minute
+	down := errors.New("brokers unreachable")
+	fetcher := &fakeFetcher{errs: []error{down, down, down, down, down, down}}
+	s := New(fetcher, lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval), cfg)
+
+	now := time.Now()
+	s.now = func() time.Time { return now }
+	s.jitter = func(d time.Duration) time.Duration { return d }
+	// As if an earlier scrape had succeeded
+	s.scraped = true
+
+	// Below the threshold every tick still scrapes
+	for range 2 {
+		s.fetch(context.Background())
+	}
+	if !s.breakerAllows() || s.Ready() != nil {
+		t.Fatalf("expected the breaker closed after 2 failures, ready: %v", s.Ready())
+	}
+
+	// Each failure while open doubles the backoff, up to the cap
+	for _, want := range []time.Duration{20 * time.Second, 40 * time.Second, time.Minute, time.Minute} {
+		s.fetch(context.Background())
+		if s.Ready() == nil {
+			t.Fatal("expected Ready to report the open breaker")
+		}
+		if s.breaker.backoff != want {
+			t.Errorf("backoff = %s, want %s", s.breaker.backoff, want)
+		}
+
+		now = now.Add(want - time.Second)
+		if s.breakerAllows() {
+			t.Errorf("expected ticks skipped before the %s backoff elapsed", want)
+		}
+		now = now.Add(time.Second)
+		if !s.breakerAllows() {
+			t.Errorf("expected a retry once the %s backoff elapsed", want)
+		}
+	}
+
+	// The retry succeeds
+	s.fetch(context.Background())
+	if err := s.Ready(); err != nil {
+		t.Errorf("expected ready after a successful scrape, got %v", err)
+	}
+	if s.breaker.open || s.breaker.failures != 0 || !s.breakerAllows() {
+		t.Errorf("expected the breaker closed and reset, got %+v", s.breaker)
+	}
+}
+
+func TestBreaker_OpenBreakerKeepsLivenessHealthy(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.BreakerThreshold = 1
+	cfg.BreakerMaxBackoff = 10 * time.Minute
+	down := errors.New("brokers unreachable")
+	fetcher := &fakeFetcher{}
+	for range 60 {
+		fetcher.errs = append(fetcher.errs, down)
+	}
+	s := New(fetcher, lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval), cfg)
+
+	now := time.Now()
+	s.now = func() time.Time { return now }
+	s.jitter = func(d time.Duration) time.Duration { return d }
+	s.recordIteration(nil)
+
+	// A broker outage of ten minutes, far past the liveness limit, with
+	// most ticks skipped by the breaker
+	for range 60 {
+		s.tick(context.Background())
+		if err := s.Healthy(); err != nil {
+			t.Fatalf("expected liveness to stay healthy while backing off, got %v", err)
+		}
+		now = now.Add(cfg.SamplingInterval)
+	}
+	if !s.breaker.open {
+		t.Fatal("expected the breaker open")
+	}
+	if s.Ready() == nil {
+		t.Error("expected Ready to report the open breaker")
+	}
+	if fetcher.calls >= 60 {
+		t.Errorf("expected the breaker to skip ticks, got %d fetches", fetcher.calls)
+	}
+}
+
+func TestBreaker_Disabled(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.BreakerThreshold = 0
+	down := errors.New("brokers unreachable")
+	fetcher := &fakeFetcher{errs: []error{down, down, down, down, down, down, down, down}}
+	s := New(fetcher, lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval), cfg)
+
+	for range 8 {
+		s.fetch(context.Background())
+	}
+	if !s.breakerAllows() || s.Healthy() != nil {
+		t.Errorf("expected no breaker with a threshold of 0, healthy: %v", s.Healthy())
+	}
+}
+
+func TestEqualJitter_WithinHalfAndFull(t *testing.T) {
+	for range 100 {
+		if d := equalJitter(time.Minute); d < 30*time.Second || d > time.Minute {
+			t.Fatalf("jittered backoff %s outside [30s, 1m]", d)
+		}
+	}
+}
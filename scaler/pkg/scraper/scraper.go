@@ -2,52 +2,680 @@ package scraper
 
 import (
 	"context"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/kafka"
+	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/config"
 	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/lag"
+	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/logging"
+	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/metrics"
 )
 
+// Fetcher produces one lag sample per partition for the current instant.
+type Fetcher interface {
+	FetchLag(ctx context.Context) ([]lag.LagSample, error)
+}
+
+// PointInTimeFetcher is a Fetcher that can also measure lag against a past
+// point in time.
+type PointInTimeFetcher interface {
+	FetchLagAt(ctx context.Context, at time.Time) ([]lag.LagSample, error)
+}
+
+// Saver persists the window's samples, e.g. to survive a restart.
+type Saver interface {
+	Save(ctx context.Context, samples []lag.LagSample) error
+}
+
+// LagSink receives each scrape's samples after they're added to the window,
+// e.g. to feed them into an external system.
+type LagSink interface {
+	Send(ctx context.Context, samples []lag.LagSample) error
+}
+
+// saveTimeout bounds the final Save on shutdown.
+const saveTimeout = 5 * time.Second
+
+// initialRetryBackoff is the wait before the first retry of a failed initial
+// fetch; it doubles per retry, capped at the sampling interval.
+const initialRetryBackoff = time.Second
+
+// livenessIntervals is how many sampling intervals may pass without a
+// completed loop iteration before Healthy reports the scraper as stuck.
+const livenessIntervals = 3
+
+// permanent is implemented by fetch errors that retrying can't fix, such as
+// a topic that doesn't exist.
+type permanent interface {
+	Permanent() bool
+}
+
+func isPermanent(err error) bool {
+	var p permanent
+	return errors.As(err, &p) && p.Permanent()
+}
+
+// emptyTopic is implemented by fetch errors for a topic that exists but has
+// no partitions, e.g. while it's being created or deleted.
+type emptyTopic interface {
+	EmptyTopic() bool
+}
+
+func isEmptyTopic(err error) bool {
+	var e emptyTopic
+	return errors.As(err, &e) && e.EmptyTopic()
+}
+
+type partitionKey struct {
+	topic     string
+	group     string
+	partition int
+}
+
+type topicPartition struct {
+	topic     string
+	partition int
+}
+
+type committedOffset struct {
+	offset    int64
+	timestamp time.Time
+}
+
 type MetricsScraper struct {
-	fetcher  *kafka.LagFetcher
-	window   *lag.SlidingWindow
-	interval time.Duration
+	fetcher Fetcher
+	window  *lag.SlidingWindow
+	// cfg is swapped whole by Reconfigure; reconfigured wakes Run to reset
+	// its ticker to the new sampling interval.
+	cfg          atomic.Pointer[config.ScalerConfig]
+	reconfigured chan struct{}
+	logger       *slog.Logger
+	saver        Saver
+	sink         LagSink
+
+	// mu serializes scrapes so an on-demand Scrape can't interleave with a
+	// tick.
+	mu sync.Mutex
+	// lastCommitted is the committed offset seen on the previous scrape,
+	// used to detect offset resets and compute consume rates.
+	lastCommitted map[partitionKey]committedOffset
+	// firstSeen is when each topic partition first showed up in a scrape,
+	// zero for those in the first successful one, for NewPartitionGrace.
+	firstSeen map[topicPartition]time.Time
+
+	// now is the clock Healthy judges liveness by. healthMu guards the time
+	// the Run loop last completed an iteration, the panic, if any, it
+	// recovered from, whether any scrape has succeeded yet, the circuit
+	// breaker and, while the topic has no partitions, the error saying so;
+	// it's separate from mu so a stuck scrape can't block health checks.
+	now           func() time.Time
+	healthMu      sync.Mutex
+	lastIteration time.Time
+	lastPanic     any
+	scraped       bool
+	breaker       breaker
+	emptyTopicErr error
+
+	// lastFetch is a copy of the most recent successful fetch's samples,
+	// before any filtering or aggregation, taken at lastFetchAt; lastMu
+	// guards them apart from mu so reading them doesn't wait for a scrape.
+	lastMu      sync.Mutex
+	lastFetch   []lag.LagSample
+	lastFetchAt time.Time
+
+	// jitter randomizes each circuit breaker backoff.
+	jitter func(time.Duration) time.Duration
+
+	// retryBackoff is the first wait between initial fetch attempts.
+	retryBackoff time.Duration
+
+	// subscribers receive each scrape's samples; subMu guards them apart
+	// from mu so subscribing doesn't wait for a scrape in flight.
+	subMu       sync.Mutex
+	subscribers map[chan []lag.LagSample]struct{}
 }
 
-func New(fetcher *kafka.LagFetcher, window *lag.SlidingWindow, interval time.Duration) *MetricsScraper {
-	return &MetricsScraper{
-		fetcher:  fetcher,
-		window:   window,
-		interval: interval,
+// Option customizes a MetricsScraper at construction.
+type Option func(*MetricsScraper)
+
+// WithSaver makes Run save the window when it stops.
+func WithSaver(saver Saver) Option {
+	return func(s *MetricsScraper) {
+		s.saver = saver
 	}
 }
 
+// WithSink makes every scrape send its samples to sink once they're in the
+// window. A failed send is logged and doesn't fail the scrape.
+func WithSink(sink LagSink) Option {
+	return func(s *MetricsScraper) {
+		s.sink = sink
+	}
+}
+
+func New(fetcher Fetcher, window *lag.SlidingWindow, cfg *config.ScalerConfig, opts ...Option) *MetricsScraper {
+	s := &MetricsScraper{
+		fetcher:       fetcher,
+		window:        window,
+		reconfigured:  make(chan struct{}, 1),
+		logger:        logging.Component("scraper"),
+		lastCommitted: make(map[partitionKey]committedOffset),
+		now:           time.Now,
+		retryBackoff:  initialRetryBackoff,
+		jitter:        equalJitter,
+	}
+	s.cfg.Store(cfg)
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *MetricsScraper) config() *config.ScalerConfig {
+	return s.cfg.Load()
+}
+
+// Reconfigure switches to cfg, e.g. on a config reload, once any scrape in
+// flight finishes. Run's next tick follows cfg's sampling interval. The
+// fetcher isn't rebuilt, so settings it reads only apply on restart.
+func (s *MetricsScraper) Reconfigure(cfg *config.ScalerConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := s.cfg.Swap(cfg)
+	if previous.SamplingInterval != cfg.SamplingInterval {
+		select {
+		case s.reconfigured <- struct{}{}:
+		default:
+		}
+	}
+	s.logger.Info("Scraper reconfigured", "topic", cfg.Topic, "samplingInterval", cfg.SamplingInterval)
+}
+
+// Run scrapes every sampling interval until ctx is cancelled. A scrape in
+// flight when ctx is cancelled still completes, and the window is then saved
+// if a Saver is configured, so Run returning means shutdown can proceed.
 func (s *MetricsScraper) Run(ctx context.Context) {
-	ticker := time.NewTicker(s.interval)
+	ticker := time.NewTicker(s.config().SamplingInterval)
 	defer ticker.Stop()
 
+	// Scrapes are bounded by the sampling interval, not by shutdown
+	fetchCtx := context.WithoutCancel(ctx)
+	s.recordIteration(nil)
+
 	// Fetch immediately on start
-	s.fetch(ctx)
+	s.initialFetch(ctx, fetchCtx)
 
 	for {
 		select {
 		case <-ctx.Done():
-			log.Println("Metrics scraper stopped")
+			s.save()
+			s.closeSubscribers()
+			s.logger.Info("Metrics scraper stopped")
 			return
 		case <-ticker.C:
-			s.fetch(ctx)
+			s.tick(fetchCtx)
+		case <-s.reconfigured:
+			ticker.Reset(s.config().SamplingInterval)
 		}
 	}
 }
 
-func (s *MetricsScraper) fetch(ctx context.Context) {
+// tick scrapes unless the circuit breaker is backing off. A skipped tick
+// still counts as a loop iteration, so liveness follows the loop rather than
+// the brokers.
+func (s *MetricsScraper) tick(ctx context.Context) {
+	if s.breakerAllows() {
+		s.fetch(ctx)
+		return
+	}
+	s.healthMu.Lock()
+	s.lastIteration = s.now()
+	s.healthMu.Unlock()
+}
+
+// save writes the current window to the Saver, bounded by saveTimeout.
+func (s *MetricsScraper) save() {
+	if s.saver == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), saveTimeout)
+	defer cancel()
+
+	samples := s.window.SnapshotSorted()
+	if err := s.saver.Save(ctx, samples); err != nil {
+		s.logger.Error("Error saving window", "topic", s.config().Topic, "error", err)
+		return
+	}
+	s.logger.Info("Saved window", "topic", s.config().Topic, "samples", len(samples))
+}
+
+// initialFetch runs the first scrape, retrying a failure up to
+// InitialFetchRetries times with exponential backoff so the window starts
+// filling as soon as the brokers are reachable rather than a full sampling
+// interval later. A permanent error, e.g. a misconfigured topic, isn't
+// retried. Waiting between attempts stops when ctx is cancelled.
+func (s *MetricsScraper) initialFetch(ctx, fetchCtx context.Context) {
+	backoff := s.retryBackoff
+	for attempt := 1; ; attempt++ {
+		err := s.fetch(fetchCtx)
+		if err == nil || attempt > s.config().InitialFetchRetries {
+			return
+		}
+		if isPermanent(err) {
+			s.logger.Error("Initial fetch failed with a configuration error, not retrying", "topic", s.config().Topic, "error", err)
+			return
+		}
+
+		s.logger.Warn("Initial fetch failed, retrying",
+			"topic", s.config().Topic,
+			"attempt", attempt,
+			"backoff", backoff,
+		)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, s.config().SamplingInterval)
+	}
+}
+
+// fetch runs one scrape for the Run loop and returns its error, which also
+// feeds the circuit breaker. A panic, e.g. from a buggy fetcher, is logged and
+// recorded for Healthy rather than killing the loop.
+func (s *MetricsScraper) fetch(ctx context.Context) (err error) {
+	defer func() {
+		p := recover()
+		if p != nil {
+			s.logger.Error("Recovered from panic while fetching lag",
+				"topic", s.config().Topic,
+				"panic", p,
+				"stack", string(debug.Stack()),
+			)
+			err = fmt.Errorf("panic while fetching lag: %v", p)
+		}
+		if err != nil {
+			metrics.ScrapeErrors.Inc()
+		}
+		s.recordIteration(p)
+		s.recordResult(err)
+	}()
+
+	if _, err := s.Scrape(ctx); err != nil {
+		s.logger.Error("Error fetching lag", "topic", s.config().Topic, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (s *MetricsScraper) recordIteration(panicked any) {
+	s.healthMu.Lock()
+	defer s.healthMu.Unlock()
+	s.lastIteration = s.now()
+	s.lastPanic = panicked
+}
+
+// Healthy returns an error when Run hasn't started, its last scrape panicked,
+// the topic has no partitions and EmptyTopicUnhealthy is set, or no loop
+// iteration has completed within livenessIntervals sampling intervals, e.g.
+// because a fetch is deadlocked. A scrape that merely returns an error, or a
+// tick the open circuit breaker skips, still counts as an iteration: a
+// restart would only lose the window, not bring the brokers back.
+func (s *MetricsScraper) Healthy() error {
+	s.healthMu.Lock()
+	defer s.healthMu.Unlock()
+
+	if s.lastIteration.IsZero() {
+		return errors.New("scraper is not running")
+	}
+	if s.lastPanic != nil {
+		return fmt.Errorf("last scrape panicked: %v", s.lastPanic)
+	}
+	if s.emptyTopicErr != nil && s.config().EmptyTopicUnhealthy {
+		return s.emptyTopicErr
+	}
+	if since := s.now().Sub(s.lastIteration); since > livenessIntervals*s.config().SamplingInterval {
+		return fmt.Errorf("no scrape completed in %s", since.Round(time.Second))
+	}
+	return nil
+}
+
+// Ready returns an error until a scrape has succeeded, i.e. until the window
+// holds data to evaluate, and while the circuit breaker is open.
+func (s *MetricsScraper) Ready() error {
+	s.healthMu.Lock()
+	defer s.healthMu.Unlock()
+
+	if !s.scraped {
+		return errors.New("no successful scrape yet")
+	}
+	if s.breaker.open {
+		return fmt.Errorf("circuit breaker open after %d consecutive failed scrapes", s.breaker.failures)
+	}
+	return nil
+}
+
+// Scrape fetches lag once, adds the samples to the window and returns them.
+// It runs synchronously and leaves the Run ticker's cadence untouched. The
+// fetch is bounded by the sampling interval so it can't overlap the next tick.
+// A fetch whose ctx is cancelled or times out before it returns is dropped
+// whole, even if the fetcher reports success, so the window never holds a
+// partial scrape.
+func (s *MetricsScraper) Scrape(ctx context.Context) ([]lag.LagSample, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.config().SamplingInterval > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.config().SamplingInterval)
+		defer cancel()
+	}
+
 	samples, err := s.fetcher.FetchLag(ctx)
+	if isEmptyTopic(err) {
+		s.markEmptyTopic(err)
+		return nil, nil
+	}
 	if err != nil {
-		log.Printf("Error fetching lag: %v", err)
-		return
+		return nil, err
+	}
+	// Best-effort steps, e.g. byte lag estimation, swallow their errors, so a
+	// fetch cancelled partway through can still return incomplete samples
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("fetch cancelled, dropping %d samples: %w", len(samples), err)
+	}
+	s.recordFetch(samples)
+	s.healthMu.Lock()
+	s.scraped = true
+	wasEmpty := s.emptyTopicErr != nil
+	s.emptyTopicErr = nil
+	s.healthMu.Unlock()
+	if wasEmpty {
+		s.logger.Info("Topic has partitions again", "topic", s.config().Topic)
 	}
 
+	samples = s.dropImplausible(samples)
+	samples = s.dropNewPartitions(samples)
+	s.checkUnitPopulated(samples)
+	s.compareWithPrevious(samples)
+	if s.config().AggregatePartitions {
+		samples = lag.AggregatePartitions(samples)
+	}
 	s.window.Add(samples...)
-	log.Printf("Collected %d lag samples (window size: %d)", len(samples), s.window.Len())
+	if s.sink != nil {
+		if err := s.sink.Send(ctx, samples); err != nil {
+			s.logger.Warn("Failed to send samples to sink", "topic", s.config().Topic, "error", err)
+		}
+	}
+	s.publish(samples)
+
+	var totalRate float64
+	var totalLag int64
+	for _, sample := range samples {
+		totalRate += sample.ConsumeRate
+		totalLag += sample.Lag
+		metrics.ObserveLag(sample.Partition, sample.Offset, sample.Lag)
+	}
+	metrics.ConsumeRate.Set(totalRate)
+	metrics.TotalLag.Set(float64(totalLag))
+	s.updateGroupMembers(samples)
+
+	windowLen := s.window.Len()
+	fillRatio := s.window.FillRatio()
+	metrics.WindowSamples.Set(float64(windowLen))
+	metrics.WindowFillRatio.Set(fillRatio)
+	s.updateStaleness()
+
+	s.logger.Info("Collected lag samples",
+		"topic", s.config().Topic,
+		"samples", len(samples),
+		"lag", totalLag,
+		"windowSamples", windowLen,
+		"fillRatio", fillRatio,
+	)
+	return samples, nil
+}
+
+// LagAt measures lag against the point in time at, for debugging, leaving the
+// window untouched. Like Scrape it waits for any scrape in flight and is
+// bounded by the sampling interval.
+func (s *MetricsScraper) LagAt(ctx context.Context, at time.Time) ([]lag.LagSample, error) {
+	fetcher, ok := s.fetcher.(PointInTimeFetcher)
+	if !ok {
+		return nil, errors.New("the lag fetcher can't measure point-in-time lag")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if interval := s.config().SamplingInterval; interval > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, interval)
+		defer cancel()
+	}
+	return fetcher.FetchLagAt(ctx, at)
+}
+
+// recordFetch keeps a copy of a fetch's samples for LastFetch, before later
+// steps modify or drop any.
+func (s *MetricsScraper) recordFetch(samples []lag.LagSample) {
+	fetched := make([]lag.LagSample, len(samples))
+	copy(fetched, samples)
+
+	s.lastMu.Lock()
+	defer s.lastMu.Unlock()
+	s.lastFetch = fetched
+	s.lastFetchAt = s.now()
+}
+
+// LastFetch returns the samples of the most recent successful fetch, as the
+// fetcher returned them, and when it completed; nil and the zero time before
+// the first. The samples must not be modified.
+func (s *MetricsScraper) LastFetch() ([]lag.LagSample, time.Time) {
+	s.lastMu.Lock()
+	defer s.lastMu.Unlock()
+	return s.lastFetch, s.lastFetchAt
+}
+
+// markEmptyTopic handles a topic that exists but has no partitions. It isn't
+// a failed scrape, so it doesn't count towards the circuit breaker, but there
+// is no lag to measure: the window is emptied so samples from before the
+// topic lost its partitions can't keep the scaler active, and committed
+// offsets are forgotten since a recreated topic starts over. It's warned
+// about once, when the topic becomes empty. Callers must hold s.mu.
+func (s *MetricsScraper) markEmptyTopic(err error) {
+	s.healthMu.Lock()
+	wasEmpty := s.emptyTopicErr != nil
+	s.emptyTopicErr = err
+	s.healthMu.Unlock()
+
+	removed := s.window.Remove(func(lag.LagSample) bool { return true })
+	clear(s.lastCommitted)
+	metrics.WindowSamples.Set(0)
+	if !wasEmpty {
+		s.logger.Warn("Topic has no partitions, keeping the scaler inactive",
+			"topic", s.config().Topic,
+			"error", err,
+			"droppedSamples", removed,
+		)
+	}
+}
+
+// updateGroupMembers sets each group's member count gauge from the scrape,
+// when member counts are looked up.
+func (s *MetricsScraper) updateGroupMembers(samples []lag.LagSample) {
+	if s.config().GroupMembers == config.GroupMembersOff {
+		return
+	}
+	for _, sample := range samples {
+		metrics.GroupMembers.WithLabelValues(sample.Group).Set(float64(sample.Members))
+	}
+}
+
+// updateStaleness sets the per-partition staleness gauge from the window.
+// The gauge is reset first so partitions evicted from the window disappear.
+func (s *MetricsScraper) updateStaleness() {
+	metrics.PartitionStaleness.Reset()
+	for partition, d := range lag.PartitionStaleness(s.window.Snapshot(), time.Now()) {
+		metrics.PartitionStaleness.WithLabelValues(strconv.Itoa(partition)).Set(d.Seconds())
+	}
+}
+
+// checkUnitPopulated warns when lag is measured in bytes or seconds but no
+// lagging sample carries a value in that unit, i.e. the fetcher isn't
+// populating it, for example because record sizes or timestamps can't be
+// read. Every partition would then evaluate as having no lag. Individual
+// zeros are expected: a backlog under a second old has a TimeLag of 0.
+func (s *MetricsScraper) checkUnitPopulated(samples []lag.LagSample) {
+	unitLag := func(sample lag.LagSample) int64 {
+		switch s.config().LagUnit {
+		case config.LagUnitBytes:
+			return sample.ByteLag
+		case config.LagUnitSeconds:
+			return sample.TimeLag
+		}
+		return sample.Lag
+	}
+
+	lagging := 0
+	for _, sample := range samples {
+		if sample.Lag <= 0 {
+			continue
+		}
+		if unitLag(sample) != 0 {
+			return
+		}
+		lagging++
+	}
+	if lagging > 0 {
+		s.logger.Warn("Lag unit not populated for any lagging partition",
+			"topic", s.config().Topic,
+			"lagUnit", s.config().LagUnit,
+			"laggingSamples", lagging,
+		)
+	}
+}
+
+// dropImplausible discards samples whose lag exceeds MaxPlausibleLag. Such
+// spikes come from a bogus high-water mark reported during leader election
+// and would otherwise trip the threshold or panic logic.
+func (s *MetricsScraper) dropImplausible(samples []lag.LagSample) []lag.LagSample {
+	limit := s.config().MaxPlausibleLag
+	if limit <= 0 {
+		return samples
+	}
+
+	kept := samples[:0]
+	for _, sample := range samples {
+		if sample.Lag > limit {
+			s.logger.Warn("Discarding implausible lag sample",
+				"topic", sample.Topic,
+				"group", sample.Group,
+				"partition", sample.Partition,
+				"lag", sample.Lag,
+				"endOffset", sample.EndOffset,
+				"maxPlausibleLag", limit,
+			)
+			continue
+		}
+		kept = append(kept, sample)
+	}
+	return kept
+}
+
+// dropNewPartitions discards samples of partitions first seen less than
+// NewPartitionGrace ago. Every partition in the first scrape is taken as
+// established, since the scaler can't tell how long it has existed. A new
+// partition is logged when it's first seen.
+func (s *MetricsScraper) dropNewPartitions(samples []lag.LagSample) []lag.LagSample {
+	grace := s.config().NewPartitionGrace
+	if grace <= 0 {
+		return samples
+	}
+
+	now := s.now()
+	established := s.firstSeen == nil
+	if established {
+		s.firstSeen = make(map[topicPartition]time.Time)
+	}
+	kept := samples[:0]
+	for _, sample := range samples {
+		key := topicPartition{sample.Topic, sample.Partition}
+		seen, ok := s.firstSeen[key]
+		if !ok {
+			if !established {
+				seen = now
+				s.logger.Info("New partition seen, ignoring its lag during the grace period",
+					"topic", sample.Topic,
+					"partition", sample.Partition,
+					"lag", sample.Lag,
+					"grace", grace,
+				)
+			}
+			s.firstSeen[key] = seen
+		}
+		if !seen.IsZero() && now.Sub(seen) < grace {
+			continue
+		}
+		kept = append(kept, sample)
+	}
+	return kept
+}
+
+// compareWithPrevious compares each sample with the previous scrape of its
+// partition. It fills in ConsumeRate from the committed-offset delta, and drops
+// the partition's older window samples when its committed offset moved backward
+// by at least OffsetResetThreshold. After a reset or compaction the old
+// high-lag samples no longer describe the partition and would otherwise keep
+// the scaler active. With aggregated partitions the older totals include the
+// stale lag too, so they're dropped instead.
+func (s *MetricsScraper) compareWithPrevious(samples []lag.LagSample) {
+	threshold := s.config().OffsetResetThreshold
+
+	for i := range samples {
+		sample := &samples[i]
+		key := partitionKey{sample.Topic, sample.Group, sample.Partition}
+		previous, seen := s.lastCommitted[key]
+		s.lastCommitted[key] = committedOffset{sample.Offset, sample.Timestamp}
+
+		if seen {
+			sample.ConsumeRate = consumeRate(previous, sample)
+		}
+
+		if threshold <= 0 || !seen || previous.offset-sample.Offset < threshold {
+			continue
+		}
+
+		removed := s.window.Remove(func(w lag.LagSample) bool {
+			partition := w.Partition == sample.Partition || w.Partition == lag.AggregatePartition
+			return w.Topic == sample.Topic && w.Group == sample.Group && partition && w.Timestamp.Before(sample.Timestamp)
+		})
+		s.logger.Warn("Committed offset moved back, trimmed stale samples",
+			"topic", sample.Topic,
+			"group", sample.Group,
+			"partition", sample.Partition,
+			"previousOffset", previous.offset,
+			"offset", sample.Offset,
+			"trimmed", removed,
+		)
+	}
+}
+
+// consumeRate is the committed-offset throughput between two scrapes. A
+// backward move (reset) or a non-advancing clock yields 0.
+func consumeRate(previous committedOffset, sample *lag.LagSample) float64 {
+	elapsed := sample.Timestamp.Sub(previous.timestamp).Seconds()
+	delta := sample.Offset - previous.offset
+	if elapsed <= 0 || delta < 0 {
+		return 0
+	}
+	return float64(delta) / elapsed
 }
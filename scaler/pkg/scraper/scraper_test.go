@@ -0,0 +1,694 @@
+package scraper
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/config"
+	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/lag"
+	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/metrics"
+)
+
+// fakeFetcher returns the queued batches in order, one per FetchLag call.
+type fakeFetcher struct {
+	batches [][]lag.LagSample
+	errs    []error
+	calls   int
+}
+
+func (f *fakeFetcher) FetchLag(ctx context.Context) ([]lag.LagSample, error) {
+	i := f.calls
+	f.calls++
+	if i < len(f.errs) && f.errs[i] != nil {
+		return nil, f.errs[i]
+	}
+	if i < len(f.batches) {
+		return f.batches[i], nil
+	}
+	return nil, nil
+}
+
+func defaultConfig() *config.ScalerConfig {
+	return &config.ScalerConfig{
+		Topic:            "test-topic",
+		ConsumerGroup:    "test-group",
+		LagThreshold:     500,
+		SustainDuration:  120 * time.Second,
+		SamplingInterval: 10 * time.Second,
+		WindowSize:       30,
+	}
+}
+
+func sample(ts time.Time, partition int, committed, end int64) lag.LagSample {
+	return lag.LagSample{
+		Timestamp: ts,
+		Topic:     "test-topic",
+		Partition: partition,
+		Lag:       end - committed,
+		Offset:    committed,
+		EndOffset: end,
+	}
+}
+
+func TestFetch_TrimsStaleSamplesOnOffsetReset(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.OffsetResetThreshold = 1000
+
+	now := time.Now()
+	fetcher := &fakeFetcher{batches: [][]lag.LagSample{
+		{sample(now.Add(-20*time.Second), 0, 5000, 9000), sample(now.Add(-20*time.Second), 1, 5000, 9000)},
+		{sample(now.Add(-10*time.Second), 0, 5100, 9000), sample(now.Add(-10*time.Second), 1, 5100, 9000)},
+		// Partition 0 was reset to earliest; partition 1 keeps consuming
+		{sample(now, 0, 0, 100), sample(now, 1, 5200, 9000)},
+	}}
+
+	w := lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+	s := New(fetcher, w, cfg)
+	for range 3 {
+		s.fetch(context.Background())
+	}
+
+	p0 := w.SnapshotForPartition(0)
+	if len(p0) != 1 || p0[0].Offset != 0 {
+		t.Errorf("expected only the post-reset sample for partition 0, got %+v", p0)
+	}
+	if p1 := w.SnapshotForPartition(1); len(p1) != 3 {
+		t.Errorf("expected partition 1 untouched with 3 samples, got %d", len(p1))
+	}
+}
+
+func TestFetch_AggregatesPartitions(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.AggregatePartitions = true
+
+	now := time.Now()
+	var batches [][]lag.LagSample
+	for i := range 3 {
+		ts := now.Add(time.Duration(i-2) * 10 * time.Second)
+		var batch []lag.LagSample
+		for p := range 8 {
+			batch = append(batch, sample(ts, p, 1000, 1100))
+		}
+		batches = append(batches, batch)
+	}
+
+	w := lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+	s := New(&fakeFetcher{batches: batches}, w, cfg)
+	for range 3 {
+		s.fetch(context.Background())
+	}
+
+	snapshot := w.Snapshot()
+	if len(snapshot) != 3 {
+		t.Fatalf("expected one sample per scrape, got %d", len(snapshot))
+	}
+	for _, got := range snapshot {
+		if got.Partition != lag.AggregatePartition || got.Lag != 800 {
+			t.Errorf("expected an aggregate sample with lag 800, got %+v", got)
+		}
+	}
+}
+
+func TestScrape_WarnsWhenLagUnitNotPopulated(t *testing.T) {
+	now := time.Now()
+	withTimeLag := sample(now, 1, 100, 400)
+	withTimeLag.TimeLag = 30
+
+	tests := []struct {
+		name    string
+		unit    string
+		samples []lag.LagSample
+		warn    bool
+	}{
+		{"messages", config.LagUnitMessages, []lag.LagSample{sample(now, 0, 100, 400)}, false},
+		{"seconds missing", config.LagUnitSeconds, []lag.LagSample{sample(now, 0, 100, 400)}, true},
+		{"seconds populated", config.LagUnitSeconds, []lag.LagSample{sample(now, 0, 100, 400), withTimeLag}, false},
+		{"bytes missing", config.LagUnitBytes, []lag.LagSample{sample(now, 0, 100, 400)}, true},
+		{"no lag", config.LagUnitBytes, []lag.LagSample{sample(now, 0, 400, 400)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := defaultConfig()
+			cfg.LagUnit = tt.unit
+			fetcher := &fakeFetcher{batches: [][]lag.LagSample{tt.samples}}
+			s := New(fetcher, lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval), cfg)
+
+			var buf bytes.Buffer
+			s.logger = slog.New(slog.NewTextHandler(&buf, nil))
+			if _, err := s.Scrape(context.Background()); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if warned := strings.Contains(buf.String(), "not populated"); warned != tt.warn {
+				t.Errorf("warned = %v, want %v; log:\n%s", warned, tt.warn, buf.String())
+			}
+		})
+	}
+}
+
+func TestFetch_SmallRegressionBelowThresholdKeepsSamples(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.OffsetResetThreshold = 1000
+
+	now := time.Now()
+	fetcher := &fakeFetcher{batches: [][]lag.LagSample{
+		{sample(now.Add(-10*time.Second), 0, 5000, 9000)},
+		{sample(now, 0, 4500, 9000)},
+	}}
+
+	w := lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+	s := New(fetcher, w, cfg)
+	s.fetch(context.Background())
+	s.fetch(context.Background())
+
+	if w.Len() != 2 {
+		t.Errorf("expected both samples kept for a small regression, got %d", w.Len())
+	}
+}
+
+func TestFetch_OffsetResetDetectionDisabledByDefault(t *testing.T) {
+	cfg := defaultConfig()
+
+	now := time.Now()
+	fetcher := &fakeFetcher{batches: [][]lag.LagSample{
+		{sample(now.Add(-10*time.Second), 0, 5000, 9000)},
+		{sample(now, 0, 0, 100)},
+	}}
+
+	w := lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+	s := New(fetcher, w, cfg)
+	s.fetch(context.Background())
+	s.fetch(context.Background())
+
+	if w.Len() != 2 {
+		t.Errorf("expected no trimming without a threshold, got %d samples", w.Len())
+	}
+}
+
+func TestFetch_ComputesConsumeRate(t *testing.T) {
+	cfg := defaultConfig()
+
+	now := time.Now()
+	fetcher := &fakeFetcher{batches: [][]lag.LagSample{
+		{sample(now.Add(-10*time.Second), 0, 1000, 5000), sample(now.Add(-10*time.Second), 1, 2000, 5000)},
+		{sample(now, 0, 1500, 5500), sample(now, 1, 2200, 5500)},
+	}}
+
+	w := lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+	s := New(fetcher, w, cfg)
+	s.fetch(context.Background())
+	s.fetch(context.Background())
+
+	first := w.SnapshotFiltered(func(x lag.LagSample) bool { return x.Timestamp.Before(now) })
+	for _, x := range first {
+		if x.ConsumeRate != 0 {
+			t.Errorf("expected no rate on the first scrape, got %f", x.ConsumeRate)
+		}
+	}
+
+	// 500 offsets in 10s and 200 offsets in 10s
+	if r := w.SnapshotForPartition(0)[1].ConsumeRate; r != 50 {
+		t.Errorf("partition 0 rate = %f, want 50", r)
+	}
+	if r := w.SnapshotForPartition(1)[1].ConsumeRate; r != 20 {
+		t.Errorf("partition 1 rate = %f, want 20", r)
+	}
+	if got := testutil.ToFloat64(metrics.ConsumeRate); got != 70 {
+		t.Errorf("aggregate consume rate gauge = %f, want 70", got)
+	}
+}
+
+func TestFetch_DiscardsImplausibleLag(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.MaxPlausibleLag = 1_000_000
+
+	now := time.Now()
+	fetcher := &fakeFetcher{batches: [][]lag.LagSample{
+		{sample(now.Add(-10*time.Second), 0, 5000, 9000), sample(now.Add(-10*time.Second), 1, 5000, 9000)},
+		// A bogus high-water mark on partition 1 during leader election
+		{sample(now, 0, 5100, 9100), sample(now, 1, 5100, 50_000_000)},
+	}}
+
+	w := lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+	s := New(fetcher, w, cfg)
+	s.fetch(context.Background())
+	s.fetch(context.Background())
+
+	if p0 := w.SnapshotForPartition(0); len(p0) != 2 {
+		t.Errorf("expected normal samples to pass, got %d for partition 0", len(p0))
+	}
+	p1 := w.SnapshotForPartition(1)
+	if len(p1) != 1 || p1[0].Lag != 4000 {
+		t.Errorf("expected the implausible spike to be discarded, got %+v", p1)
+	}
+}
+
+func TestFetch_IgnoresNewPartitionDuringGrace(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.NewPartitionGrace = time.Minute
+
+	now := time.Now()
+	fetcher := &fakeFetcher{batches: [][]lag.LagSample{
+		{sample(now, 0, 100, 200), sample(now, 1, 100, 200)},
+		// Partition 2 is added to the topic, its whole log unconsumed
+		{sample(now.Add(10*time.Second), 0, 100, 200), sample(now.Add(10*time.Second), 1, 100, 200), sample(now.Add(10*time.Second), 2, 0, 80_000)},
+		{sample(now.Add(40*time.Second), 2, 0, 80_000)},
+		{sample(now.Add(80*time.Second), 2, 0, 80_000)},
+	}}
+
+	w := lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+	s := New(fetcher, w, cfg)
+	clock := now
+	s.now = func() time.Time { return clock }
+
+	s.fetch(context.Background())
+	if got := len(w.SnapshotForPartition(0)); got != 1 {
+		t.Fatalf("expected partitions in the first scrape to count straight away, got %d samples for partition 0", got)
+	}
+
+	for _, step := range []time.Duration{10 * time.Second, 40 * time.Second} {
+		clock = now.Add(step)
+		s.fetch(context.Background())
+		if p2 := w.SnapshotForPartition(2); len(p2) != 0 {
+			t.Fatalf("expected partition 2 to be ignored %s in, got %+v", step, p2)
+		}
+	}
+
+	// 70s after partition 2 was first seen
+	clock = now.Add(80 * time.Second)
+	s.fetch(context.Background())
+	p2 := w.SnapshotForPartition(2)
+	if len(p2) != 1 || p2[0].Lag != 80_000 {
+		t.Errorf("expected partition 2's lag to count after the grace period, got %+v", p2)
+	}
+}
+
+type fakeSaver struct {
+	saved [][]lag.LagSample
+}
+
+func (f *fakeSaver) Save(ctx context.Context, samples []lag.LagSample) error {
+	f.saved = append(f.saved, samples)
+	return nil
+}
+
+type fakeSink struct {
+	sent [][]lag.LagSample
+	err  error
+}
+
+func (f *fakeSink) Send(ctx context.Context, samples []lag.LagSample) error {
+	f.sent = append(f.sent, samples)
+	return f.err
+}
+
+func TestScrape_KeepsLastFetchBeforeAggregation(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.AggregatePartitions = true
+	now := time.Now()
+	fetcher := &fakeFetcher{
+		batches: [][]lag.LagSample{{sample(now, 0, 100, 400), sample(now, 1, 100, 200)}},
+		errs:    []error{nil, errors.New("broker unreachable")},
+	}
+	s := New(fetcher, lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval), cfg)
+
+	if samples, at := s.LastFetch(); samples != nil || !at.IsZero() {
+		t.Errorf("expected no last fetch before scraping, got %+v at %s", samples, at)
+	}
+	if _, err := s.Scrape(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// A failed fetch leaves the last successful one in place
+	if _, err := s.Scrape(context.Background()); err == nil {
+		t.Fatal("expected the second scrape to fail")
+	}
+
+	samples, at := s.LastFetch()
+	if len(samples) != 2 || samples[0].Partition != 0 || samples[0].Lag != 300 || samples[1].Lag != 100 {
+		t.Errorf("expected the per-partition samples as fetched, got %+v", samples)
+	}
+	if at.IsZero() {
+		t.Error("expected the fetch time to be set")
+	}
+}
+
+// cancellingFetcher cancels the scrape's context mid-fetch and still returns
+// its samples, as a fetcher whose best-effort steps swallow the error would.
+type cancellingFetcher struct {
+	cancel  context.CancelFunc
+	samples []lag.LagSample
+}
+
+func (f *cancellingFetcher) FetchLag(ctx context.Context) ([]lag.LagSample, error) {
+	f.cancel()
+	return f.samples, nil
+}
+
+func TestScrape_DropsSamplesOnCancellation(t *testing.T) {
+	cfg := defaultConfig()
+	now := time.Now()
+	ctx, cancel := context.WithCancel(context.Background())
+	fetcher := &cancellingFetcher{cancel: cancel, samples: []lag.LagSample{sample(now, 0, 100, 900)}}
+
+	w := lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+	s := New(fetcher, w, cfg)
+	samples, err := s.Scrape(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected a cancellation error, got %v", err)
+	}
+	if samples != nil {
+		t.Errorf("expected no samples returned, got %+v", samples)
+	}
+	if w.Len() != 0 {
+		t.Errorf("expected no samples added to the window, got %d", w.Len())
+	}
+	if last, _ := s.LastFetch(); last != nil {
+		t.Errorf("expected the cancelled fetch not to be recorded, got %+v", last)
+	}
+	if err := s.Ready(); err == nil {
+		t.Error("expected a cancelled fetch not to make the scraper ready")
+	}
+}
+
+// pointInTimeFetcher also serves FetchLagAt, recording the time asked for.
+type pointInTimeFetcher struct {
+	fakeFetcher
+	samples []lag.LagSample
+	at      time.Time
+}
+
+func (f *pointInTimeFetcher) FetchLagAt(ctx context.Context, at time.Time) ([]lag.LagSample, error) {
+	f.at = at
+	return f.samples, nil
+}
+
+func TestLagAt(t *testing.T) {
+	cfg := defaultConfig()
+	at := time.Now().Add(-time.Hour)
+	w := lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+
+	fetcher := &pointInTimeFetcher{samples: []lag.LagSample{sample(at, 0, 100, 400)}}
+	samples, err := New(fetcher, w, cfg).LagAt(context.Background(), at)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(samples) != 1 || !fetcher.at.Equal(at) {
+		t.Errorf("expected the fetcher's samples for %s, got %+v for %s", at, samples, fetcher.at)
+	}
+	if w.Len() != 0 {
+		t.Errorf("expected the window untouched, got %d samples", w.Len())
+	}
+
+	if _, err := New(&fakeFetcher{}, w, cfg).LagAt(context.Background(), at); err == nil {
+		t.Error("expected an error from a fetcher without point-in-time support")
+	}
+}
+
+func TestScrape_SendsWindowSamplesToSink(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.AggregatePartitions = true
+	now := time.Now()
+	fetcher := &fakeFetcher{batches: [][]lag.LagSample{
+		{sample(now, 0, 100, 400), sample(now, 1, 100, 200)},
+		{sample(now.Add(10*time.Second), 0, 100, 500), sample(now.Add(10*time.Second), 1, 100, 200)},
+	}}
+	sink := &fakeSink{err: errors.New("webhook down")}
+	w := lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+	s := New(fetcher, w, cfg, WithSink(sink))
+
+	// A failing sink doesn't fail the scrape
+	for range 2 {
+		if _, err := s.Scrape(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if len(sink.sent) != 2 {
+		t.Fatalf("expected one send per scrape, got %d", len(sink.sent))
+	}
+	var sent []lag.LagSample
+	for _, batch := range sink.sent {
+		sent = append(sent, batch...)
+	}
+	// The sink gets what the window got: here the aggregated samples
+	if !reflect.DeepEqual(sent, w.Snapshot()) {
+		t.Errorf("sink received %+v, window holds %+v", sent, w.Snapshot())
+	}
+}
+
+func TestRun_SavesWindowOnShutdown(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.SamplingInterval = time.Hour
+
+	now := time.Now()
+	fetcher := &fakeFetcher{batches: [][]lag.LagSample{
+		{sample(now, 0, 100, 400), sample(now, 1, 200, 400)},
+	}}
+	saver := &fakeSaver{}
+
+	w := lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+	s := New(fetcher, w, cfg, WithSaver(saver))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+
+	// Wait for the initial scrape, then shut down
+	for w.Len() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after cancellation")
+	}
+
+	if len(saver.saved) != 1 {
+		t.Fatalf("expected one final save, got %d", len(saver.saved))
+	}
+	if got := saver.saved[0]; len(got) != 2 || got[0].Lag != 300 || got[1].Lag != 200 {
+		t.Errorf("expected the current window to be saved, got %+v", got)
+	}
+}
+
+func TestRun_ReconfigureResetsInterval(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.SamplingInterval = time.Hour
+
+	now := time.Now()
+	fetcher := &fakeFetcher{batches: [][]lag.LagSample{
+		{sample(now, 0, 100, 400)},
+		{sample(now, 1, 200, 400)},
+	}}
+	w := lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+	s := New(fetcher, w, cfg)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+	for w.Len() < 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Without the reload the next scrape would be an hour away
+	next := *cfg
+	next.SamplingInterval = 10 * time.Millisecond
+	s.Reconfigure(&next)
+
+	deadline := time.After(time.Second)
+	for w.Len() < 2 {
+		select {
+		case <-deadline:
+			t.Fatal("expected a scrape at the reconfigured interval")
+		case <-time.After(time.Millisecond):
+		}
+	}
+	if got := s.config().SamplingInterval; got != next.SamplingInterval {
+		t.Errorf("SamplingInterval = %s, want %s", got, next.SamplingInterval)
+	}
+}
+
+func TestRun_RetriesInitialFetch(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.InitialFetchRetries = 3
+
+	// Brokers aren't ready for the first two attempts
+	fetcher := &fakeFetcher{
+		errs:    []error{errors.New("connection refused"), errors.New("connection refused")},
+		batches: [][]lag.LagSample{nil, nil, {sample(time.Now(), 0, 100, 400)}},
+	}
+	w := lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+	s := New(fetcher, w, cfg)
+	s.retryBackoff = time.Millisecond
+
+	if err := s.Ready(); err == nil {
+		t.Fatal("expected not ready before any scrape")
+	}
+
+	s.initialFetch(context.Background(), context.Background())
+	if fetcher.calls != 3 {
+		t.Errorf("expected 3 attempts, got %d", fetcher.calls)
+	}
+	if err := s.Ready(); err != nil {
+		t.Errorf("expected ready after the retry succeeded, got %v", err)
+	}
+	if w.Len() != 1 {
+		t.Errorf("expected the retried scrape in the window, got %d samples", w.Len())
+	}
+}
+
+// permanentError is a fetch error retrying can't fix.
+type permanentError struct{}
+
+func (permanentError) Error() string   { return "topic not found" }
+func (permanentError) Permanent() bool { return true }
+
+func TestRun_DoesNotRetryPermanentError(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.InitialFetchRetries = 3
+
+	fetcher := &fakeFetcher{errs: []error{fmt.Errorf("fetch: %w", permanentError{})}}
+	s := New(fetcher, lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval), cfg)
+	s.retryBackoff = time.Millisecond
+
+	s.initialFetch(context.Background(), context.Background())
+	if fetcher.calls != 1 {
+		t.Errorf("expected a permanent error not to be retried, got %d attempts", fetcher.calls)
+	}
+	if err := s.Ready(); err == nil {
+		t.Error("expected not ready after a failed initial fetch")
+	}
+}
+
+// emptyTopicError is a fetch error for a topic that has no partitions.
+type emptyTopicError struct{}
+
+func (emptyTopicError) Error() string    { return "topic test-topic has no partitions" }
+func (emptyTopicError) EmptyTopic() bool { return true }
+
+func TestScrape_ZeroPartitionTopic(t *testing.T) {
+	cfg := defaultConfig()
+	now := time.Now()
+	fetcher := &fakeFetcher{
+		batches: [][]lag.LagSample{{sample(now, 0, 100, 900)}, nil, nil, {sample(now, 0, 0, 50)}},
+		errs:    []error{nil, emptyTopicError{}, emptyTopicError{}, nil},
+	}
+	w := lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+	s := New(fetcher, w, cfg)
+
+	if err := s.fetch(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The empty topic isn't a failed scrape, but clears the window so the
+	// earlier lag can't keep the scaler active
+	if err := s.fetch(context.Background()); err != nil {
+		t.Fatalf("expected an empty topic not to fail the scrape, got %v", err)
+	}
+	if w.Len() != 0 {
+		t.Errorf("expected the window to be emptied, got %d samples", w.Len())
+	}
+	if s.breaker.failures != 0 {
+		t.Errorf("expected the circuit breaker not to count an empty topic, got %d failures", s.breaker.failures)
+	}
+	if err := s.Healthy(); err != nil {
+		t.Errorf("expected healthy by default, got %v", err)
+	}
+	cfg.EmptyTopicUnhealthy = true
+	if err := s.Healthy(); err == nil || !strings.Contains(err.Error(), "no partitions") {
+		t.Errorf("expected health to report the empty topic, got %v", err)
+	}
+
+	s.fetch(context.Background())
+	if err := s.fetch(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := s.Healthy(); err != nil {
+		t.Errorf("expected healthy once the topic has partitions again, got %v", err)
+	}
+	if samples := w.Snapshot(); len(samples) != 1 || samples[0].Lag != 50 {
+		t.Errorf("expected only the new sample in the window, got %+v", samples)
+	}
+}
+
+// panickingFetcher panics on its first call, then returns batch.
+type panickingFetcher struct {
+	batch []lag.LagSample
+	calls int
+}
+
+func (f *panickingFetcher) FetchLag(ctx context.Context) ([]lag.LagSample, error) {
+	f.calls++
+	if f.calls == 1 {
+		panic("broken fetcher")
+	}
+	return f.batch, nil
+}
+
+func TestRun_SurvivesFetchPanic(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.SamplingInterval = 20 * time.Millisecond
+
+	fetcher := &panickingFetcher{batch: []lag.LagSample{sample(time.Now(), 0, 100, 400)}}
+	w := lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+	s := New(fetcher, w, cfg)
+
+	// The panic is recovered and reported as unhealthy
+	s.fetch(context.Background())
+	if err := s.Healthy(); err == nil || !strings.Contains(err.Error(), "broken fetcher") {
+		t.Fatalf("expected health to report the panic, got %v", err)
+	}
+
+	// The loop keeps scraping, and health recovers with it
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	deadline := time.Now().Add(time.Second)
+	for w.Len() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("scraper did not keep running after the panic")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := s.Healthy(); err != nil {
+		t.Errorf("expected healthy after a successful scrape, got %v", err)
+	}
+}
+
+func TestHealthy_DetectsStuckLoop(t *testing.T) {
+	cfg := defaultConfig()
+	w := lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+	s := New(&fakeFetcher{}, w, cfg)
+
+	if err := s.Healthy(); err == nil {
+		t.Error("expected an error before Run has started")
+	}
+
+	now := time.Now()
+	s.now = func() time.Time { return now }
+	s.recordIteration(nil)
+
+	now = now.Add(29 * time.Second)
+	if err := s.Healthy(); err != nil {
+		t.Errorf("expected healthy within 3 sampling intervals, got %v", err)
+	}
+
+	now = now.Add(2 * time.Second)
+	if err := s.Healthy(); err == nil {
+		t.Error("expected an error after 3 sampling intervals without an iteration")
+	}
+}
@@ -0,0 +1,41 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/config"
+)
+
+// SelfTest runs a single fetch, i.e. one metadata and one offset lookup, and
+// writes whether it succeeded to out, so a wrong broker address, credentials
+// or ACL fails fast instead of showing up later as an empty window. The fetch
+// gets one sampling interval, like a scrape. A topic that exists but has no
+// partitions passes with a warning: the brokers answered.
+func SelfTest(ctx context.Context, fetcher Fetcher, cfg *config.ScalerConfig, out io.Writer) error {
+	fetchCtx, cancel := context.WithTimeout(ctx, cfg.SamplingInterval)
+	defer cancel()
+
+	samples, err := fetcher.FetchLag(fetchCtx)
+	switch {
+	case isEmptyTopic(err):
+		fmt.Fprintf(out, "Self-test passed with a warning: %v\n", err)
+		return nil
+	case isPermanent(err):
+		fmt.Fprintf(out, "Self-test failed with a configuration error, check the topic, consumer group, credentials and ACLs: %v\n", err)
+		return fmt.Errorf("self-test: %w", err)
+	case err != nil:
+		fmt.Fprintf(out, "Self-test failed, check the brokers are reachable: %v\n", err)
+		return fmt.Errorf("self-test: %w", err)
+	}
+
+	partitions := make(map[int]struct{})
+	var total int64
+	for _, s := range samples {
+		partitions[s.Partition] = struct{}{}
+		total += s.Lag
+	}
+	fmt.Fprintf(out, "Self-test passed: topic %s, %d partitions, %d samples, total lag %d\n", cfg.Topic, len(partitions), len(samples), total)
+	return nil
+}
@@ -0,0 +1,65 @@
+package scraper
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/lag"
+)
+
+// authError is the fetch error for credentials the brokers reject.
+type authError struct{}
+
+func (authError) Error() string   { return "SASL Authentication Failed" }
+func (authError) Permanent() bool { return true }
+
+func TestSelfTest_Success(t *testing.T) {
+	cfg := defaultConfig()
+	now := time.Now()
+	fetcher := &fakeFetcher{batches: [][]lag.LagSample{
+		{sample(now, 0, 100, 400), sample(now, 1, 50, 60)},
+	}}
+
+	var out bytes.Buffer
+	if err := SelfTest(context.Background(), fetcher, cfg, &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fetcher.calls != 1 {
+		t.Errorf("expected a single fetch, got %d", fetcher.calls)
+	}
+	if got := out.String(); !strings.Contains(got, "passed") || !strings.Contains(got, "2 partitions") || !strings.Contains(got, "total lag 310") {
+		t.Errorf("unexpected output %q", got)
+	}
+}
+
+func TestSelfTest_AuthFailure(t *testing.T) {
+	cfg := defaultConfig()
+	fetcher := &fakeFetcher{errs: []error{fmt.Errorf("describe topic: %w", authError{})}}
+
+	var out bytes.Buffer
+	err := SelfTest(context.Background(), fetcher, cfg, &out)
+	if !errors.As(err, new(authError)) {
+		t.Fatalf("expected the auth error, got %v", err)
+	}
+	if got := out.String(); !strings.Contains(got, "configuration error") || !strings.Contains(got, "SASL Authentication Failed") {
+		t.Errorf("expected the output to name the auth failure, got %q", got)
+	}
+}
+
+func TestSelfTest_Unreachable(t *testing.T) {
+	cfg := defaultConfig()
+	fetcher := &fakeFetcher{errs: []error{errors.New("dial tcp: connection refused")}}
+
+	var out bytes.Buffer
+	if err := SelfTest(context.Background(), fetcher, cfg, &out); err == nil {
+		t.Fatal("expected an error")
+	}
+	if got := out.String(); !strings.Contains(got, "reachable") || !strings.Contains(got, "connection refused") {
+		t.Errorf("unexpected output %q", got)
+	}
+}
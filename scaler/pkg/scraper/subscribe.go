@@ -0,0 +1,61 @@
+package scraper
+
+import (
+	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/lag"
+)
+
+// Subscribe returns a channel that receives every later scrape's samples,
+// once they're in the window, and a function that ends the subscription and
+// closes the channel. The channel is also closed when Run stops. Batches are
+// shared between subscribers and must not be modified.
+//
+// A scrape never waits on a subscriber: a batch that doesn't fit in the
+// channel's buffer of size buffer is dropped for that subscriber and logged.
+func (s *MetricsScraper) Subscribe(buffer int) (<-chan []lag.LagSample, func()) {
+	ch := make(chan []lag.LagSample, buffer)
+
+	s.subMu.Lock()
+	defer s.subMu.Unlock()
+	if s.subscribers == nil {
+		s.subscribers = make(map[chan []lag.LagSample]struct{})
+	}
+	s.subscribers[ch] = struct{}{}
+
+	return ch, func() {
+		s.subMu.Lock()
+		defer s.subMu.Unlock()
+		if _, ok := s.subscribers[ch]; ok {
+			delete(s.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// publish hands samples to every subscriber whose buffer has room.
+func (s *MetricsScraper) publish(samples []lag.LagSample) {
+	s.subMu.Lock()
+	defer s.subMu.Unlock()
+
+	for ch := range s.subscribers {
+		select {
+		case ch <- samples:
+		default:
+			s.logger.Warn("Subscriber not keeping up, dropping scraped batch",
+				"topic", s.config().Topic,
+				"samples", len(samples),
+				"buffer", cap(ch),
+			)
+		}
+	}
+}
+
+// closeSubscribers ends every subscription, e.g. when Run stops.
+func (s *MetricsScraper) closeSubscribers() {
+	s.subMu.Lock()
+	defer s.subMu.Unlock()
+
+	for ch := range s.subscribers {
+		delete(s.subscribers, ch)
+		close(ch)
+	}
+}
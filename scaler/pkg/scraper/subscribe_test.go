@@ -0,0 +1,92 @@
+package scraper
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/lag"
+)
+
+func TestSubscribe_ReceivesEachBatch(t *testing.T) {
+	cfg := defaultConfig()
+	now := time.Now()
+	batches := [][]lag.LagSample{
+		{sample(now, 0, 100, 400), sample(now, 1, 0, 50)},
+		{sample(now.Add(10*time.Second), 0, 200, 400)},
+		{sample(now.Add(20*time.Second), 1, 50, 60)},
+	}
+	s := New(&fakeFetcher{batches: batches}, lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval), cfg)
+
+	ch, unsubscribe := s.Subscribe(len(batches))
+	for range batches {
+		if _, err := s.Scrape(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	for i, want := range batches {
+		got := <-ch
+		if len(got) != len(want) || got[0].Partition != want[0].Partition || got[0].Lag != want[0].Lag {
+			t.Errorf("batch %d = %+v, want %+v", i, got, want)
+		}
+	}
+
+	unsubscribe()
+	if _, ok := <-ch; ok {
+		t.Error("expected the channel to be closed after unsubscribing")
+	}
+	unsubscribe()
+}
+
+func TestSubscribe_SlowSubscriberDoesNotBlockScrape(t *testing.T) {
+	cfg := defaultConfig()
+	now := time.Now()
+	fetcher := &fakeFetcher{batches: [][]lag.LagSample{
+		{sample(now, 0, 100, 400)},
+		{sample(now.Add(10*time.Second), 0, 200, 400)},
+	}}
+	w := lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+	s := New(fetcher, w, cfg)
+
+	slow, _ := s.Subscribe(0)
+	fast, _ := s.Subscribe(2)
+	for range 2 {
+		if _, err := s.Scrape(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if w.Len() != 2 {
+		t.Errorf("expected both scrapes in the window, got %d samples", w.Len())
+	}
+	if len(fast) != 2 {
+		t.Errorf("expected the buffered subscriber to hold both batches, got %d", len(fast))
+	}
+	select {
+	case got := <-slow:
+		t.Errorf("expected the unbuffered subscriber's batches to be dropped, got %+v", got)
+	default:
+	}
+}
+
+func TestSubscribe_ClosedWhenRunStops(t *testing.T) {
+	cfg := defaultConfig()
+	s := New(&fakeFetcher{}, lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval), cfg)
+	ch, unsubscribe := s.Subscribe(1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+	cancel()
+	<-done
+
+	// The empty initial scrape may have been published before the channel
+	// closed
+	for range ch {
+	}
+	unsubscribe()
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/logging"
+)
+
+// Listen listens on the TCP address addr. While the port is in use, e.g. by
+// the pod a rolling restart is replacing, it tries up to retries more times,
+// waiting backoff before the first retry and twice as long before each
+// after. Any other error, or ctx ending, fails at once.
+func Listen(ctx context.Context, addr string, retries int, backoff time.Duration) (net.Listener, error) {
+	logger := logging.Component("server")
+	for attempt := 0; ; attempt++ {
+		lis, err := net.Listen("tcp", addr)
+		if err == nil {
+			if attempt > 0 {
+				logger.Info("Listening after port was freed", "addr", addr, "attempts", attempt+1)
+			}
+			return lis, nil
+		}
+		if !errors.Is(err, syscall.EADDRINUSE) || attempt >= retries {
+			return nil, err
+		}
+
+		logger.Warn("Port in use, retrying listen",
+			"addr", addr,
+			"attempt", attempt+1,
+			"retries", retries,
+			"backoff", backoff,
+		)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestListen_RetriesUntilPortIsFreed(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := busy.Addr().String()
+	time.AfterFunc(50*time.Millisecond, func() { busy.Close() })
+
+	lis, err := Listen(context.Background(), addr, 5, 20*time.Millisecond)
+	if err != nil {
+		t.Fatalf("expected to bind once the port was freed, got %v", err)
+	}
+	defer lis.Close()
+	if lis.Addr().String() != addr {
+		t.Errorf("listening on %s, want %s", lis.Addr(), addr)
+	}
+}
+
+func TestListen_GivesUpAfterRetries(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+
+	start := time.Now()
+	_, err = Listen(context.Background(), busy.Addr().String(), 2, 10*time.Millisecond)
+	if !errors.Is(err, syscall.EADDRINUSE) {
+		t.Fatalf("expected address in use, got %v", err)
+	}
+	// Waits of 10ms and 20ms between the three attempts
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("gave up after %s, before both retries", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Listen(ctx, busy.Addr().String(), 5, time.Hour); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a canceled context to stop retrying, got %v", err)
+	}
+}
@@ -3,37 +3,229 @@ package server
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
 	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/config"
 	pb "github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/externalscaler"
 	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/lag"
+	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/logging"
+	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/metrics"
 )
 
 type ExternalScalerServer struct {
 	pb.UnimplementedExternalScalerServer
 	window *lag.SlidingWindow
-	config *config.ScalerConfig
+	// cfg is swapped whole by Reconfigure, along with evaluator under mu.
+	cfg       atomic.Pointer[config.ScalerConfig]
+	evaluator lag.Evaluator
+	logger    *slog.Logger
+	now       func() time.Time
+
+	mu         sync.Mutex
+	persistent bool
+	cache      *cachedEvaluation
+
+	// activeSince is when the reported state last became active, for
+	// holding it for MinActiveDuration.
+	activeSince time.Time
+
+	// confirmedAt is the newest sample behind the last evaluation that found
+	// lag persistent before any hold, for expiring the reported verdict
+	// after VerdictTTL; expired is set while it's expired.
+	confirmedAt time.Time
+	expired     bool
+
+	// verdicts is a ring buffer of the most recent raw Persistent verdicts,
+	// sized to ActivationQuorum; next is the slot to overwrite once full.
+	// votedVersion is the window version of the newest, set once voted, so
+	// repeated polls of one scrape record a single verdict.
+	verdicts     []bool
+	next         int
+	voted        bool
+	votedVersion uint64
+
+	// warm is set once the window first holds WarmupSamples samples.
+	warm         bool
+	warmupLogged bool
+
+	// noMembers is set while activation is suppressed for lack of consumer
+	// group members.
+	noMembers bool
+
+	// scheduled is set while activation is suppressed by SuppressSchedule.
+	scheduled bool
+
+	// partitions lists the partitions GetMetricSpec reports per-partition
+	// metrics for; nil reports none.
+	partitions PartitionLister
+}
+
+// PartitionLister lists the partitions lag is measured on, from the topic's
+// metadata.
+type PartitionLister interface {
+	Partitions(ctx context.Context) ([]int, error)
+}
+
+// Option customizes an ExternalScalerServer at construction.
+type Option func(*ExternalScalerServer)
+
+// WithPartitions makes GetMetricSpec list a per-partition metric, with
+// PartitionMetrics, for each partition partitions returns.
+func WithPartitions(partitions PartitionLister) Option {
+	return func(s *ExternalScalerServer) {
+		s.partitions = partitions
+	}
+}
+
+// cachedEvaluation is the last result along with the window version it was
+// computed from, so rapid KEDA polls don't re-evaluate an unchanged window.
+type cachedEvaluation struct {
+	result    lag.EvaluationResult
+	version   uint64
+	expiresAt time.Time
+}
+
+func New(window *lag.SlidingWindow, cfg *config.ScalerConfig, opts ...Option) *ExternalScalerServer {
+	s := &ExternalScalerServer{
+		window:    window,
+		evaluator: NewEvaluator(cfg),
+		logger:    logging.Component("server"),
+		now:       time.Now,
+	}
+	s.cfg.Store(cfg)
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *ExternalScalerServer) config() *config.ScalerConfig {
+	return s.cfg.Load()
+}
+
+// Reconfigure switches to cfg, e.g. on a config reload: the next evaluation
+// uses its thresholds and mode on the samples already in the window. The
+// reported state, and any hold on it, carries over; debouncing starts over
+// if the activation quorum changed.
+func (s *ExternalScalerServer) Reconfigure(cfg *config.ScalerConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := s.cfg.Swap(cfg)
+	s.evaluator = NewEvaluator(cfg)
+	s.cache = nil
+	if cfg.ActivationQuorum != previous.ActivationQuorum {
+		s.verdicts = nil
+		s.next = 0
+		s.voted = false
+	}
+	s.logger.Info("Server reconfigured",
+		"topic", cfg.Topic,
+		"evaluationMode", cfg.EvaluationMode,
+		"lagThreshold", cfg.LagThreshold,
+		"sustainDuration", cfg.SustainDuration,
+	)
 }
 
-func New(window *lag.SlidingWindow, cfg *config.ScalerConfig) *ExternalScalerServer {
-	return &ExternalScalerServer{
-		window: window,
-		config: cfg,
+// NewEvaluator returns the Evaluator for cfg's EvaluationMode, evaluating
+// lag in cfg's LagUnit and totalling it per cfg's TotalLagConsistency. It
+// estimates the backlog's drain time, reporting inactive below
+// cfg's DrainTimeThreshold.
+func NewEvaluator(cfg *config.ScalerConfig) lag.Evaluator {
+	evaluator := newModeEvaluator(cfg)
+	// Inside the unit conversions, so the weight applies to the lag they
+	// substitute
+	if cfg.StaleCommitWeight < 1 {
+		evaluator = lag.StaleCommitEvaluator{Evaluator: evaluator, Weight: cfg.StaleCommitWeight}
+	}
+	switch cfg.LagUnit {
+	case config.LagUnitBytes:
+		evaluator = lag.BytesEvaluator{Evaluator: evaluator}
+	case config.LagUnitSeconds:
+		evaluator = lag.SecondsEvaluator{Evaluator: evaluator}
+	}
+	if cfg.TotalLagConsistency == config.TotalLagLastTick {
+		evaluator = lag.LastTickEvaluator{Evaluator: evaluator, Interval: cfg.SamplingInterval}
+	}
+	return lag.DrainTimeEvaluator{Evaluator: evaluator, Threshold: cfg.DrainTimeThreshold}
+}
+
+func newModeEvaluator(cfg *config.ScalerConfig) lag.Evaluator {
+	switch cfg.EvaluationMode {
+	case config.EvaluationModeBreadth:
+		return lag.BreadthEvaluator{
+			Threshold:                  cfg.LagThreshold,
+			SustainDuration:            cfg.SustainDuration,
+			MinStretchSamples:          cfg.MinStretchSamples,
+			PanicThreshold:             cfg.PanicThreshold,
+			GroupStrategy:              lag.GroupStrategy(cfg.MultiGroupStrategy),
+			LaggingPartitionsThreshold: cfg.LaggingPartitionsThreshold,
+			RequireCurrent:             cfg.RequireCurrentAboveThreshold,
+			Lookback:                   cfg.PersistenceLookback,
+		}
+	case config.EvaluationModeAcceleration:
+		return lag.AccelerationEvaluator{
+			Threshold:         cfg.AccelerationThreshold,
+			LagThreshold:      cfg.LagThreshold,
+			SustainDuration:   cfg.SustainDuration,
+			MinStretchSamples: cfg.MinStretchSamples,
+			PanicThreshold:    cfg.PanicThreshold,
+			GroupStrategy:     lag.GroupStrategy(cfg.MultiGroupStrategy),
+			RequireCurrent:    cfg.RequireCurrentAboveThreshold,
+			Lookback:          cfg.PersistenceLookback,
+		}
+	case config.EvaluationModeCrossings:
+		return lag.CrossingEvaluator{
+			Threshold:      cfg.LagThreshold,
+			CrossingCount:  cfg.CrossingCount,
+			PanicThreshold: cfg.PanicThreshold,
+			GroupStrategy:  lag.GroupStrategy(cfg.MultiGroupStrategy),
+			RequireCurrent: cfg.RequireCurrentAboveThreshold,
+			Lookback:       cfg.PersistenceLookback,
+		}
+	case config.EvaluationModeTotal:
+		return lag.TotalEvaluator{
+			Threshold:         cfg.LagThreshold,
+			SustainDuration:   cfg.SustainDuration,
+			MinStretchSamples: cfg.MinStretchSamples,
+			PanicThreshold:    cfg.PanicThreshold,
+			GroupStrategy:     lag.GroupStrategy(cfg.MultiGroupStrategy),
+			RequireCurrent:    cfg.RequireCurrentAboveThreshold,
+			Lookback:          cfg.PersistenceLookback,
+		}
+	default:
+		return lag.AbsoluteEvaluator{
+			Threshold:         cfg.LagThreshold,
+			SustainDuration:   cfg.SustainDuration,
+			MinStretchSamples: cfg.MinStretchSamples,
+			PanicThreshold:    cfg.PanicThreshold,
+			GroupStrategy:     lag.GroupStrategy(cfg.MultiGroupStrategy),
+			RequireCurrent:    cfg.RequireCurrentAboveThreshold,
+			Lookback:          cfg.PersistenceLookback,
+		}
 	}
 }
 
 func (s *ExternalScalerServer) IsActive(ctx context.Context, ref *pb.ScaledObjectRef) (*pb.IsActiveResponse, error) {
 	result := s.evaluate()
-	log.Printf("IsActive: persistent=%v, totalLag=%d", result.Persistent, result.TotalCurrentLag)
+	s.logger.Info("IsActive", "topic", s.config().Topic, "persistent", result.Persistent, "totalLag", result.TotalCurrentLag, "warmingUp", result.WarmingUp, "noMembers", result.NoMembers)
 	return &pb.IsActiveResponse{
 		Result: result.Persistent,
 	}, nil
 }
 
 func (s *ExternalScalerServer) StreamIsActive(ref *pb.ScaledObjectRef, stream pb.ExternalScaler_StreamIsActiveServer) error {
-	ticker := time.NewTicker(s.config.SamplingInterval)
+	ticker := time.NewTicker(s.config().SamplingInterval)
 	defer ticker.Stop()
 
 	for {
@@ -42,7 +234,7 @@ func (s *ExternalScalerServer) StreamIsActive(ref *pb.ScaledObjectRef, stream pb
 			return nil
 		case <-ticker.C:
 			result := s.evaluate()
-			log.Printf("StreamIsActive: persistent=%v, totalLag=%d", result.Persistent, result.TotalCurrentLag)
+			s.logger.Info("StreamIsActive", "topic", s.config().Topic, "persistent", result.Persistent, "totalLag", result.TotalCurrentLag)
 			err := stream.Send(&pb.IsActiveResponse{
 				Result: result.Persistent,
 			})
@@ -53,37 +245,535 @@ func (s *ExternalScalerServer) StreamIsActive(ref *pb.ScaledObjectRef, stream pb
 	}
 }
 
+// defaultMetricName is reported when the trigger doesn't name its metric.
+const defaultMetricName = "persistent_kafka_lag"
+
+// metricName is the trigger's metricName metadata, falling back to
+// triggerName, so several triggers pointed at this scaler from one
+// ScaledObject each get a distinct metric.
+func metricName(ref *pb.ScaledObjectRef) string {
+	if name := ref.GetScalerMetadata()["metricName"]; name != "" {
+		return name
+	}
+	if name := ref.GetScalerMetadata()["triggerName"]; name != "" {
+		return name
+	}
+	return defaultMetricName
+}
+
+// scopedName prefixes name with ref's namespace and ScaledObject name when
+// NamespaceScopedMetrics is set, e.g. team_a_orders_persistent_kafka_lag, so
+// scalers sharing one KEDA can't report colliding metrics. Characters other
+// than letters, digits and underscores become underscores.
+func (s *ExternalScalerServer) scopedName(ref *pb.ScaledObjectRef, name string) string {
+	if !s.config().NamespaceScopedMetrics {
+		return name
+	}
+	return sanitizeMetricName(fmt.Sprintf("%s_%s_%s", ref.GetNamespace(), ref.GetName(), name))
+}
+
+func sanitizeMetricName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9') {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// GetMetricSpec reports lagThreshold as the target. The external scaler proto
+// has no field for the target type: KEDA takes it from the trigger's
+// metricType, so whether HPA treats the target as total lag (Value) or lag
+// per replica (AverageValue) is decided in the ScaledObject.
+//
+// Both the target and every reported value are multiplied by MetricScale, so
+// the HPA ratio is unchanged while fractional values keep their resolution in
+// the int64 metric.
+//
+// With Metrics configured, each of them is reported with its own target in
+// place of the total. With PartitionMetrics, a spec per partition in the
+// topic's metadata follows, with the lagThreshold target, so partitions
+// without samples yet, e.g. right after startup, are listed too.
 func (s *ExternalScalerServer) GetMetricSpec(ctx context.Context, ref *pb.ScaledObjectRef) (*pb.GetMetricSpecResponse, error) {
-	return &pb.GetMetricSpecResponse{
-		MetricSpecs: []*pb.MetricSpec{
-			{
-				MetricName: "persistent_kafka_lag",
-				TargetSize: s.config.LagThreshold,
-			},
-		},
-	}, nil
+	name := s.scopedName(ref, metricName(ref))
+	var specs []*pb.MetricSpec
+	for _, m := range s.reportedMetrics(ref, name) {
+		specs = append(specs, &pb.MetricSpec{MetricName: m.Name, TargetSize: m.Target * s.metricScale()})
+	}
+
+	if s.config().PartitionMetrics && s.partitions != nil {
+		partitions, err := s.partitions.Partitions(ctx)
+		if err != nil {
+			s.logger.Warn("Failed to list partitions for the metric spec", "topic", s.config().Topic, "error", err)
+			return nil, status.Errorf(codes.Unavailable, "failed to list partitions of topic %s: %v", s.config().Topic, err)
+		}
+		sort.Ints(partitions)
+		target := s.config().LagThreshold * s.metricScale()
+		for _, p := range partitions {
+			specs = append(specs, &pb.MetricSpec{MetricName: partitionMetricName(name, p), TargetSize: target})
+		}
+	}
+	return &pb.GetMetricSpecResponse{MetricSpecs: specs}, nil
+}
+
+// reportedMetrics returns the metrics to report for ref, named: the
+// configured Metrics, an unnamed one taking name and its aggregation, e.g.
+// persistent_kafka_lag_rate; or total lag alone under name. name is already
+// scoped to ref; configured names are scoped here.
+func (s *ExternalScalerServer) reportedMetrics(ref *pb.ScaledObjectRef, name string) []config.Metric {
+	if len(s.config().Metrics) == 0 {
+		return []config.Metric{{Aggregation: config.MetricTotal, Name: name, Target: s.config().LagThreshold}}
+	}
+	metrics := make([]config.Metric, len(s.config().Metrics))
+	for i, m := range s.config().Metrics {
+		if m.Name == "" {
+			m.Name = fmt.Sprintf("%s_%s", name, m.Aggregation)
+		} else {
+			m.Name = s.scopedName(ref, m.Name)
+		}
+		metrics[i] = m
+	}
+	return metrics
+}
+
+// aggregate is the value of the aggregation named by aggregation in result,
+// before scaling.
+func (s *ExternalScalerServer) aggregate(aggregation string, result lag.EvaluationResult) float64 {
+	switch aggregation {
+	case config.MetricMax:
+		return float64(result.MaxCurrentLag)
+	case config.MetricLaggingPartitions:
+		return float64(result.LaggingPartitions)
+	case config.MetricRate:
+		return result.ConsumeRate
+	}
+	// Ages don't add up across partitions, so in seconds the total is the
+	// oldest partition's backlog
+	if s.config().LagUnit == config.LagUnitSeconds {
+		return float64(result.MaxCurrentLag)
+	}
+	if s.config().NormalizeByPartitions {
+		if result.ScrapedPartitions == 0 {
+			return 0
+		}
+		return float64(result.TotalCurrentLag) / float64(result.ScrapedPartitions)
+	}
+	return float64(result.TotalCurrentLag)
+}
+
+// partitionMetricName names the per-partition metric derived from name, e.g.
+// persistent_kafka_lag_p3. It depends only on the partition ID, so it's
+// stable across scrapes.
+func partitionMetricName(name string, partition int) string {
+	return fmt.Sprintf("%s_p%d", name, partition)
+}
+
+// isPartitionMetric reports whether metricName is one of name's
+// per-partition metrics.
+func isPartitionMetric(metricName, name string) bool {
+	suffix, ok := strings.CutPrefix(metricName, name+"_p")
+	if !ok {
+		return false
+	}
+	p, err := strconv.Atoi(suffix)
+	return err == nil && p >= 0 && partitionMetricName(name, p) == metricName
+}
+
+// metricPartitions returns the partitions to report metrics for, lowest
+// first. The aggregate partition of aggregated samples has no metric of its
+// own: its lag is the total.
+func metricPartitions(partitionLag map[int]int64) []int {
+	partitions := make([]int, 0, len(partitionLag))
+	for p := range partitionLag {
+		if p >= 0 {
+			partitions = append(partitions, p)
+		}
+	}
+	sort.Ints(partitions)
+	return partitions
 }
 
 func (s *ExternalScalerServer) GetMetrics(ctx context.Context, req *pb.GetMetricsRequest) (*pb.GetMetricsResponse, error) {
 	result := s.evaluate()
 
-	var metricValue int64
-	if result.Persistent {
-		metricValue = result.TotalCurrentLag
+	ref := req.GetScaledObjectRef()
+	name := s.scopedName(ref, metricName(ref))
+	reported := s.reportedMetrics(ref, name)
+
+	// Every metric reports 0 unless persistent, then is clamped
+	var values []*pb.MetricValue
+	for _, m := range reported {
+		var value float64
+		if result.Persistent {
+			value = s.aggregate(m.Aggregation, result)
+		}
+		scaled := int64(math.Round(s.clampMetric(value) * float64(s.metricScale())))
+		values = append(values, &pb.MetricValue{MetricName: m.Name, MetricValue: scaled})
 	}
+	metricValue := values[0].MetricValue
 
-	log.Printf("GetMetrics: persistent=%v, metricValue=%d", result.Persistent, metricValue)
-	return &pb.GetMetricsResponse{
-		MetricValues: []*pb.MetricValue{
-			{
-				MetricName:  "persistent_kafka_lag",
-				MetricValue: metricValue,
-			},
-		},
-	}, nil
+	// Per-partition values follow the same rule as the total: each
+	// partition's latest lag while persistent, 0 otherwise
+	if s.config().PartitionMetrics {
+		for _, p := range metricPartitions(result.PartitionLag) {
+			var value int64
+			if result.Persistent {
+				value = result.PartitionLag[p] * s.metricScale()
+			}
+			values = append(values, &pb.MetricValue{MetricName: partitionMetricName(name, p), MetricValue: value})
+		}
+	}
+
+	// A partition in the spec without samples in the window yet has no lag
+	// to report
+	if requested := req.GetMetricName(); s.config().PartitionMetrics && !hasMetric(values, requested) && isPartitionMetric(requested, name) {
+		values = append(values, &pb.MetricValue{MetricName: requested})
+	}
+
+	// KEDA asks for a name GetMetricSpec returned. Anything else means the
+	// ScaledObject and this scaler disagree on the metric, which would
+	// otherwise go unnoticed as a mismatched value
+	if requested := req.GetMetricName(); requested != "" && !hasMetric(values, requested) {
+		s.logger.Warn("GetMetrics requested an unknown metric", "topic", s.config().Topic, "metricName", requested, "reported", metricNames(values))
+		return nil, status.Errorf(codes.InvalidArgument, "unknown metric %q, this scaler reports %s", requested, strings.Join(metricNames(values), ", "))
+	}
+
+	s.logger.Info("GetMetrics", "topic", s.config().Topic, "persistent", result.Persistent, "metricValue", metricValue, "totalPartitions", result.TotalPartitions, "warmingUp", result.WarmingUp)
+	return &pb.GetMetricsResponse{MetricValues: values}, nil
+}
+
+func hasMetric(values []*pb.MetricValue, name string) bool {
+	for _, v := range values {
+		if v.MetricName == name {
+			return true
+		}
+	}
+	return false
+}
+
+func metricNames(values []*pb.MetricValue) []string {
+	names := make([]string, len(values))
+	for i, v := range values {
+		names[i] = v.MetricName
+	}
+	return names
+}
+
+// clampMetric bounds a reported value to MetricFloor and MetricCeiling, so a
+// single enormous reading can't demand an absurd replica count.
+func (s *ExternalScalerServer) clampMetric(value float64) float64 {
+	cfg := s.config()
+	if cfg.MetricCeiling > 0 {
+		value = min(value, float64(cfg.MetricCeiling))
+	}
+	return max(value, float64(cfg.MetricFloor))
+}
+
+// metricScale is the configured MetricScale, treating an unset scale as 1.
+func (s *ExternalScalerServer) metricScale() int64 {
+	return max(s.config().MetricScale, 1)
 }
 
 func (s *ExternalScalerServer) evaluate() lag.EvaluationResult {
-	samples := s.window.Snapshot()
-	return lag.EvaluatePersistence(samples, s.config.LagThreshold, s.config.SustainDuration)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	version := s.window.Version()
+	if c := s.cache; c != nil && c.version == version && now.Before(c.expiresAt) {
+		return c.result
+	}
+
+	series := s.window.Series()
+	samples := series.Samples()
+	result := lag.EvaluateSeries(s.evaluator, series)
+	result.EvaluatedAt = now
+	if s.config().NormalizeByPartitions {
+		result.ScrapedPartitions = scrapedPartitions(samples)
+	}
+	metrics.LaggingPartitions.Set(float64(result.LaggingPartitions))
+	metrics.EstimatedDrainSeconds.Set(drainSeconds(result.EstimatedDrainTime))
+	drainedFor, drained := lag.DrainedFor(samples)
+	metrics.LagDrainedSeconds.Set(drainedFor.Seconds())
+	result = s.applyWarmup(result, len(samples))
+	result = s.suppressWithoutMembers(result, samples)
+	if result.Persistent {
+		s.confirmedAt = result.NewestSample
+	}
+	result.Persistent = s.debounce(result.Persistent, version)
+	result.Persistent = s.holdActive(result.Persistent, now)
+	result.Persistent = s.holdUntilDrained(result.Persistent, drainedFor, drained)
+	result = s.expireVerdict(result, now)
+	result = s.suppressOnSchedule(result, now)
+	s.recordTransition(result)
+
+	if s.config().EvaluationCacheTTL > 0 {
+		s.cache = &cachedEvaluation{
+			result:    result,
+			version:   version,
+			expiresAt: now.Add(s.config().EvaluationCacheTTL),
+		}
+	}
+	return result
+}
+
+// applyWarmup suppresses the decision until the window has held WarmupSamples
+// samples, so a single high sample right after startup can't activate the
+// scaler. Once reached, warmup doesn't apply again. Callers must hold s.mu.
+func (s *ExternalScalerServer) applyWarmup(result lag.EvaluationResult, samples int) lag.EvaluationResult {
+	if s.warm {
+		return result
+	}
+	if samples >= s.config().WarmupSamples {
+		s.warm = true
+		if s.config().WarmupSamples > 0 {
+			s.logger.Info("Window warmed up, decisions enabled", "topic", s.config().Topic, "samples", samples)
+		}
+		return result
+	}
+
+	if !s.warmupLogged {
+		s.warmupLogged = true
+		s.logger.Info("Window warming up, decisions suppressed",
+			"topic", s.config().Topic,
+			"samples", samples,
+			"warmupSamples", s.config().WarmupSamples,
+		)
+	}
+	result.Persistent = false
+	result.Panic = false
+	result.TriggerPartition = -1
+	result.WarmingUp = true
+	return result
+}
+
+// debounce records verdict, the evaluation of window version, and returns
+// the state to report: the new verdict once the last ActivationQuorum
+// verdicts all agree on it, otherwise the previously reported state. Only the
+// first verdict per version is recorded, so IsActive, GetMetrics and
+// GetMetricSpec polling one scrape count as one vote. Callers must hold s.mu.
+func (s *ExternalScalerServer) debounce(verdict bool, version uint64) bool {
+	quorum := s.config().ActivationQuorum
+	if quorum <= 1 {
+		return verdict
+	}
+
+	if !s.voted || version != s.votedVersion {
+		if len(s.verdicts) < quorum {
+			s.verdicts = append(s.verdicts, verdict)
+		} else {
+			s.verdicts[s.next] = verdict
+			s.next = (s.next + 1) % quorum
+		}
+		s.voted, s.votedVersion = true, version
+	}
+
+	if len(s.verdicts) < quorum {
+		return s.persistent
+	}
+	for _, v := range s.verdicts {
+		if v != verdict {
+			return s.persistent
+		}
+	}
+	return verdict
+}
+
+// drainSeconds is the drain estimate for the metric, with +Inf for a
+// backlog that isn't being consumed.
+func drainSeconds(d time.Duration) float64 {
+	if d < 0 {
+		return math.Inf(1)
+	}
+	return d.Seconds()
+}
+
+// holdActive keeps reporting active until MinActiveDuration has passed since
+// activation, so a momentary drain mid-recovery doesn't scale consumers back
+// down straight away. Callers must hold s.mu.
+func (s *ExternalScalerServer) holdActive(verdict bool, now time.Time) bool {
+	if verdict || !s.persistent {
+		return verdict
+	}
+	return now.Sub(s.activeSince) < s.config().MinActiveDuration
+}
+
+// suppressWithoutMembers reports inactive when GroupMembers is suppress and
+// no consumer group had active members at the latest scrape: the backlog is
+// growing because every consumer is down, which more replicas can't fix.
+// It's logged as a warning once per episode. Callers must hold s.mu.
+func (s *ExternalScalerServer) suppressWithoutMembers(result lag.EvaluationResult, samples []lag.LagSample) lag.EvaluationResult {
+	if s.config().GroupMembers != config.GroupMembersSuppress {
+		return result
+	}
+
+	suppressed := noMembers(samples)
+	if suppressed && !s.noMembers {
+		s.logger.Warn("No consumer group has active members, suppressing activation",
+			"topic", s.config().Topic,
+			"persistent", result.Persistent,
+			"totalLag", result.TotalCurrentLag,
+		)
+	}
+	s.noMembers = suppressed
+	if !suppressed {
+		metrics.NoMembersSuppressed.Set(0)
+		return result
+	}
+
+	metrics.NoMembersSuppressed.Set(1)
+	result.Persistent = false
+	result.Panic = false
+	result.TriggerPartition = -1
+	result.NoMembers = true
+	return result
+}
+
+// noMembers reports whether every group sampled in the latest scrape had no
+// active members.
+func noMembers(samples []lag.LagSample) bool {
+	var newest time.Time
+	for _, s := range samples {
+		if s.Timestamp.After(newest) {
+			newest = s.Timestamp
+		}
+	}
+
+	seen := false
+	for _, s := range samples {
+		if !s.Timestamp.Equal(newest) {
+			continue
+		}
+		if s.Members > 0 {
+			return false
+		}
+		seen = true
+	}
+	return seen
+}
+
+// scrapedPartitions counts the distinct partitions sampled at the newest
+// timestamp, i.e. by the latest scrape, so a partition added to or removed
+// from the topic is reflected as soon as it's scraped.
+func scrapedPartitions(samples []lag.LagSample) int {
+	var newest time.Time
+	for _, s := range samples {
+		if s.Timestamp.After(newest) {
+			newest = s.Timestamp
+		}
+	}
+
+	type key struct {
+		topic     string
+		partition int
+	}
+	seen := make(map[key]struct{})
+	for _, s := range samples {
+		if s.Timestamp.Equal(newest) {
+			seen[key{s.Topic, s.Partition}] = struct{}{}
+		}
+	}
+	return len(seen)
+}
+
+// holdUntilDrained keeps reporting active after persistence clears until
+// total lag has been zero for DrainConfirmDuration, so a consumer isn't scaled
+// to zero while lag is only momentarily drained or still trickling in.
+// Callers must hold s.mu.
+func (s *ExternalScalerServer) holdUntilDrained(verdict bool, drainedFor time.Duration, drained bool) bool {
+	if verdict || !s.persistent || s.config().DrainConfirmDuration <= 0 {
+		return verdict
+	}
+	return !drained || drainedFor < s.config().DrainConfirmDuration
+}
+
+// expireVerdict reports inactive once an active verdict hasn't been confirmed
+// on a sample taken within VerdictTTL, e.g. while scraping has stalled and a
+// hold, or persistence found on the stale window, would otherwise keep it
+// active indefinitely. Evaluation resumes as normal once fresh samples
+// confirm it again. Callers must hold s.mu.
+func (s *ExternalScalerServer) expireVerdict(result lag.EvaluationResult, now time.Time) lag.EvaluationResult {
+	ttl := s.config().VerdictTTL
+	if ttl <= 0 || !result.Persistent || now.Sub(s.confirmedAt) <= ttl {
+		s.expired = false
+		return result
+	}
+
+	if !s.expired {
+		s.expired = true
+		s.logger.Warn("Persistent verdict not confirmed within its TTL, reporting inactive",
+			"topic", s.config().Topic,
+			"verdictTTL", ttl,
+			"confirmedAt", s.confirmedAt,
+		)
+	}
+	result.Persistent = false
+	result.Panic = false
+	result.TriggerPartition = -1
+	return result
+}
+
+// suppressOnSchedule reports inactive while SuppressSchedule matches now,
+// overriding any hold, so a backlog expected during a maintenance window
+// doesn't scale consumers up. Verdicts are still recorded for debouncing, so
+// a backlog that outlasts the window activates as soon as it ends. Entering
+// and leaving the window are logged once each. Callers must hold s.mu.
+func (s *ExternalScalerServer) suppressOnSchedule(result lag.EvaluationResult, now time.Time) lag.EvaluationResult {
+	scheduled := s.config().SuppressSchedule.Contains(now)
+	if scheduled != s.scheduled {
+		s.scheduled = scheduled
+		if scheduled {
+			s.logger.Info("Suppress schedule started, suppressing activation",
+				"topic", s.config().Topic,
+				"schedule", s.config().SuppressSchedule.String(),
+				"persistent", result.Persistent,
+			)
+		} else {
+			s.logger.Info("Suppress schedule ended, decisions enabled", "topic", s.config().Topic)
+		}
+	}
+	if !scheduled {
+		metrics.ScheduleSuppressed.Set(0)
+		return result
+	}
+
+	metrics.ScheduleSuppressed.Set(1)
+	result.Persistent = false
+	result.Panic = false
+	result.TriggerPartition = -1
+	result.ScheduleSuppressed = true
+	return result
+}
+
+// recordTransition logs once whenever the persistence verdict flips, so
+// operators get a single clear line instead of inferring it from polls.
+// Callers must hold s.mu.
+func (s *ExternalScalerServer) recordTransition(result lag.EvaluationResult) {
+	if result.Persistent == s.persistent {
+		return
+	}
+	s.persistent = result.Persistent
+
+	if result.Persistent {
+		s.activeSince = result.EvaluatedAt
+		metrics.Persistent.Set(1)
+		metrics.PersistenceTransitions.WithLabelValues("active").Inc()
+		s.logger.Info("Persistent lag detected, scaler is now active",
+			"topic", s.config().Topic,
+			"persistent", true,
+			"totalLag", result.TotalCurrentLag,
+			"partition", result.TriggerPartition,
+			"panic", result.Panic,
+			"evaluation", result,
+		)
+	} else {
+		metrics.Persistent.Set(0)
+		metrics.PersistenceTransitions.WithLabelValues("inactive").Inc()
+		s.logger.Info("Persistent lag cleared, scaler is now inactive",
+			"topic", s.config().Topic,
+			"persistent", false,
+			"totalLag", result.TotalCurrentLag,
+			"evaluation", result,
+		)
+	}
 }
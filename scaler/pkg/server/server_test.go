@@ -1,24 +1,37 @@
 package server
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
 	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/config"
 	pb "github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/externalscaler"
 	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/lag"
+	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/metrics"
 )
 
 func defaultConfig() *config.ScalerConfig {
 	return &config.ScalerConfig{
-		BootstrapServers: "localhost:9092",
-		Topic:            "test-topic",
-		ConsumerGroup:    "test-group",
-		LagThreshold:     500,
-		SustainDuration:  120 * time.Second,
-		SamplingInterval: 10 * time.Second,
-		WindowSize:       30,
+		BootstrapServers:   "localhost:9092",
+		Topic:              "test-topic",
+		ConsumerGroup:      "test-group",
+		LagThreshold:       500,
+		SustainDuration:    120 * time.Second,
+		SamplingInterval:   10 * time.Second,
+		WindowSize:         30,
+		EvaluationCacheTTL: 5 * time.Second,
+		ActivationQuorum:   1,
 	}
 }
 
@@ -185,6 +198,254 @@ func TestGetMetrics_ReturnsLagWhenPersistent(t *testing.T) {
 	}
 }
 
+func TestGetMetrics_UnknownMetricName(t *testing.T) {
+	cfg := defaultConfig()
+	w := lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+	srv := New(w, cfg)
+	simulateScraper(w, time.Now().Add(-3*time.Minute), cfg.SamplingInterval, 18, 1, 1000)
+
+	_, err := srv.GetMetrics(context.Background(), &pb.GetMetricsRequest{
+		ScaledObjectRef: ref(),
+		MetricName:      "orders-lag",
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument for an unknown metric, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "persistent_kafka_lag") {
+		t.Errorf("expected the error to name the reported metric, got %v", err)
+	}
+
+	resp, err := srv.GetMetrics(context.Background(), &pb.GetMetricsRequest{
+		ScaledObjectRef: ref(),
+		MetricName:      "persistent_kafka_lag",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error for the reported metric: %v", err)
+	}
+	if mv := resp.MetricValues[0]; mv.MetricName != "persistent_kafka_lag" || mv.MetricValue != 1000 {
+		t.Errorf("metric = %q/%d, want persistent_kafka_lag/1000", mv.MetricName, mv.MetricValue)
+	}
+
+	// Per-partition names are known metrics too
+	cfg.PartitionMetrics = true
+	if _, err := srv.GetMetrics(context.Background(), &pb.GetMetricsRequest{
+		ScaledObjectRef: ref(),
+		MetricName:      "persistent_kafka_lag_p0",
+	}); err != nil {
+		t.Errorf("unexpected error for a partition metric: %v", err)
+	}
+}
+
+func TestGetMetrics_SecondsReportsOldestPartition(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.LagUnit = config.LagUnitSeconds
+	cfg.LagThreshold = 60
+	w := lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+	srv := New(w, cfg)
+
+	// 3 minutes of 1000 messages per partition, the oldest 90s and 300s old
+	start := time.Now().Add(-3 * time.Minute)
+	for i := range 18 {
+		ts := start.Add(time.Duration(i) * cfg.SamplingInterval)
+		w.Add(lag.LagSample{Timestamp: ts, Topic: "test-topic", Partition: 0, Lag: 1000, TimeLag: 90})
+		w.Add(lag.LagSample{Timestamp: ts, Topic: "test-topic", Partition: 1, Lag: 1000, TimeLag: 300})
+	}
+
+	resp, err := srv.GetMetrics(context.Background(), &pb.GetMetricsRequest{
+		ScaledObjectRef: ref(),
+		MetricName:      "persistent_kafka_lag",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Ages aren't summed: the metric is the oldest partition's
+	if got := resp.MetricValues[0].MetricValue; got != 300 {
+		t.Errorf("expected metric value 300, got %d", got)
+	}
+}
+
+func TestGetMetrics_NormalizeByPartitions(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.NormalizeByPartitions = true
+	cfg.TotalLagConsistency = config.TotalLagLastTick
+	w := lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+	srv := New(w, cfg)
+
+	start := time.Now().Add(-3 * time.Minute)
+	simulateScraper(w, start, cfg.SamplingInterval, 18, 2, 1000)
+
+	req := &pb.GetMetricsRequest{ScaledObjectRef: ref(), MetricName: "persistent_kafka_lag"}
+	for i, tc := range []struct {
+		name       string
+		partitions int
+		lag        int64
+		want       int64
+	}{
+		{"two partitions", 2, 1000, 1000},
+		{"partitions added", 4, 1500, 1500},
+		{"partition removed", 3, 900, 900},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// Each case is the next scrape
+			ts := start.Add(time.Duration(18+i) * cfg.SamplingInterval)
+			for p := range tc.partitions {
+				w.Add(lag.LagSample{Timestamp: ts, Topic: "test-topic", Partition: p, Lag: tc.lag})
+			}
+
+			resp, err := srv.GetMetrics(context.Background(), req)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := resp.MetricValues[0].MetricValue; got != tc.want {
+				t.Errorf("expected lag per partition %d, got %d", tc.want, got)
+			}
+		})
+	}
+}
+
+// fakePartitions lists a fixed set of partitions, or fails with err.
+type fakePartitions struct {
+	partitions []int
+	err        error
+}
+
+func (f fakePartitions) Partitions(ctx context.Context) ([]int, error) {
+	return f.partitions, f.err
+}
+
+func TestGetMetrics_PartitionMetrics(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.PartitionMetrics = true
+	w := lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+	srv := New(w, cfg, WithPartitions(fakePartitions{partitions: []int{0, 1, 2}}))
+
+	start := time.Now().Add(-3 * time.Minute)
+	simulateScraper(w, start, cfg.SamplingInterval, 18, 3, 1000)
+	// The latest tick has a distinct lag on each partition
+	for p, l := range []int64{1200, 700, 900} {
+		w.Add(lag.LagSample{Timestamp: start.Add(18 * cfg.SamplingInterval), Topic: "test-topic", Partition: p, Lag: l})
+	}
+
+	req := &pb.GetMetricsRequest{ScaledObjectRef: ref(), MetricName: "persistent_kafka_lag"}
+	want := map[string]int64{
+		"persistent_kafka_lag":    2800,
+		"persistent_kafka_lag_p0": 1200,
+		"persistent_kafka_lag_p1": 700,
+		"persistent_kafka_lag_p2": 900,
+	}
+	for range 2 {
+		resp, err := srv.GetMetrics(context.Background(), req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(resp.MetricValues) != len(want) {
+			t.Fatalf("expected %d metric values, got %d", len(want), len(resp.MetricValues))
+		}
+		for i, mv := range resp.MetricValues {
+			if mv.MetricValue != want[mv.MetricName] {
+				t.Errorf("%s = %d, want %d", mv.MetricName, mv.MetricValue, want[mv.MetricName])
+			}
+			if i > 0 && mv.MetricName != fmt.Sprintf("persistent_kafka_lag_p%d", i-1) {
+				t.Errorf("metric %d is %s, expected partitions in order", i, mv.MetricName)
+			}
+		}
+	}
+
+	spec, err := srv.GetMetricSpec(context.Background(), ref())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(spec.MetricSpecs) != 4 || spec.MetricSpecs[3].MetricName != "persistent_kafka_lag_p2" || spec.MetricSpecs[3].TargetSize != 500 {
+		t.Errorf("unexpected metric specs: %v", spec.MetricSpecs)
+	}
+}
+
+func TestGetMetricSpec_PartitionsFromMetadata(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.PartitionMetrics = true
+	w := lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+	srv := New(w, cfg, WithPartitions(fakePartitions{partitions: []int{2, 0, 1}}))
+
+	// Before the first scrape the window is empty, but every partition is
+	// already listed
+	spec, err := srv.GetMetricSpec(context.Background(), ref())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var names []string
+	for _, m := range spec.MetricSpecs {
+		names = append(names, m.MetricName)
+	}
+	want := []string{"persistent_kafka_lag", "persistent_kafka_lag_p0", "persistent_kafka_lag_p1", "persistent_kafka_lag_p2"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("metric names = %v, want %v", names, want)
+	}
+
+	// Each listed metric can be fetched, at 0 until its partition has samples
+	resp, err := srv.GetMetrics(context.Background(), &pb.GetMetricsRequest{ScaledObjectRef: ref(), MetricName: "persistent_kafka_lag_p2"})
+	if err != nil {
+		t.Fatalf("unexpected error for a listed partition: %v", err)
+	}
+	if mv := resp.MetricValues[len(resp.MetricValues)-1]; mv.MetricName != "persistent_kafka_lag_p2" || mv.MetricValue != 0 {
+		t.Errorf("partition metric = %q/%d, want persistent_kafka_lag_p2/0", mv.MetricName, mv.MetricValue)
+	}
+	if _, err := srv.GetMetrics(context.Background(), &pb.GetMetricsRequest{ScaledObjectRef: ref(), MetricName: "persistent_kafka_lag_pX"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument for a malformed partition metric, got %v", err)
+	}
+
+	failing := New(w, cfg, WithPartitions(fakePartitions{err: errors.New("metadata request failed")}))
+	if _, err := failing.GetMetricSpec(context.Background(), ref()); status.Code(err) != codes.Unavailable {
+		t.Errorf("expected Unavailable when partitions can't be listed, got %v", err)
+	}
+}
+
+func TestServer_NamedTriggers(t *testing.T) {
+	cfg := defaultConfig()
+	w := lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+	srv := New(w, cfg)
+	simulateScraper(w, time.Now().Add(-3*time.Minute), cfg.SamplingInterval, 18, 3, 1000)
+
+	triggers := []struct {
+		metadata map[string]string
+		name     string
+	}{
+		{metadata: map[string]string{"metricName": "orders-lag"}, name: "orders-lag"},
+		{metadata: map[string]string{"triggerName": "payments"}, name: "payments"},
+		{metadata: nil, name: "persistent_kafka_lag"},
+	}
+	for _, tr := range triggers {
+		r := ref()
+		r.ScalerMetadata = tr.metadata
+
+		spec, err := srv.GetMetricSpec(context.Background(), r)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := spec.MetricSpecs[0].MetricName; got != tr.name {
+			t.Errorf("spec metric name = %q, want %q", got, tr.name)
+		}
+
+		resp, err := srv.GetMetrics(context.Background(), &pb.GetMetricsRequest{ScaledObjectRef: r, MetricName: tr.name})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if mv := resp.MetricValues[0]; mv.MetricName != tr.name || mv.MetricValue != 3000 {
+			t.Errorf("metric = %q/%d, want %q/3000", mv.MetricName, mv.MetricValue, tr.name)
+		}
+	}
+
+	// Without a requested name the trigger's metadata decides
+	r := ref()
+	r.ScalerMetadata = map[string]string{"triggerName": "payments"}
+	resp, err := srv.GetMetrics(context.Background(), &pb.GetMetricsRequest{ScaledObjectRef: r})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := resp.MetricValues[0].MetricName; got != "payments" {
+		t.Errorf("metric name = %q, want payments", got)
+	}
+}
+
 func TestGetMetrics_ReturnsZeroWhenNotPersistent(t *testing.T) {
 	cfg := defaultConfig()
 	w := lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
@@ -228,6 +489,196 @@ func TestGetMetricSpec_ReturnsThreshold(t *testing.T) {
 	}
 }
 
+func TestMetrics_ReportsConfiguredAggregations(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.MetricScale = 10
+	cfg.Metrics = []config.Metric{
+		{Aggregation: config.MetricTotal, Name: "lag_total", Target: 1000},
+		{Aggregation: config.MetricMax, Target: 800},
+		{Aggregation: config.MetricLaggingPartitions, Name: "lagging", Target: 2},
+		{Aggregation: config.MetricRate, Target: 50},
+	}
+	w := lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+	srv := New(w, cfg)
+
+	// 3 minutes of lag 300, 600 and 900 consumed at 12.5, 25 and 37.5 msg/s
+	start := time.Now().Add(-3 * time.Minute)
+	for i := range 18 {
+		for p := range 3 {
+			w.Add(lag.LagSample{
+				Timestamp:   start.Add(time.Duration(i) * cfg.SamplingInterval),
+				Topic:       "test-topic",
+				Partition:   p,
+				Lag:         int64(p+1) * 300,
+				ConsumeRate: float64(p+1) * 12.5,
+			})
+		}
+	}
+
+	spec, err := srv.GetMetricSpec(context.Background(), ref())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	gotSpecs := make(map[string]int64)
+	for _, m := range spec.MetricSpecs {
+		gotSpecs[m.MetricName] = m.TargetSize
+	}
+	wantSpecs := map[string]int64{
+		"lag_total":                 10000,
+		"persistent_kafka_lag_max":  8000,
+		"lagging":                   20,
+		"persistent_kafka_lag_rate": 500,
+	}
+	if !reflect.DeepEqual(gotSpecs, wantSpecs) {
+		t.Errorf("metric specs = %v, want %v", gotSpecs, wantSpecs)
+	}
+
+	resp, err := srv.GetMetrics(context.Background(), &pb.GetMetricsRequest{
+		ScaledObjectRef: ref(),
+		MetricName:      "lagging",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	gotValues := make(map[string]int64)
+	for _, m := range resp.MetricValues {
+		gotValues[m.MetricName] = m.MetricValue
+	}
+	wantValues := map[string]int64{
+		"lag_total":                 18000,
+		"persistent_kafka_lag_max":  9000,
+		"lagging":                   20,
+		"persistent_kafka_lag_rate": 750,
+	}
+	if !reflect.DeepEqual(gotValues, wantValues) {
+		t.Errorf("metric values = %v, want %v", gotValues, wantValues)
+	}
+}
+
+func TestNamespaceScopedMetrics_DistinctPerScaledObject(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.NamespaceScopedMetrics = true
+	w := lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+	srv := New(w, cfg, WithPartitions(fakePartitions{partitions: []int{0}}))
+	simulateScraper(w, time.Now().Add(-3*time.Minute), cfg.SamplingInterval, 18, 1, 1000)
+
+	refs := []*pb.ScaledObjectRef{
+		{Name: "orders", Namespace: "team-a"},
+		{Name: "orders", Namespace: "team-b"},
+	}
+	want := []string{"team_a_orders_persistent_kafka_lag", "team_b_orders_persistent_kafka_lag"}
+
+	for i, r := range refs {
+		spec, err := srv.GetMetricSpec(context.Background(), r)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := spec.MetricSpecs[0].MetricName; got != want[i] {
+			t.Errorf("%s/%s: spec metric name = %q, want %q", r.Namespace, r.Name, got, want[i])
+		}
+
+		resp, err := srv.GetMetrics(context.Background(), &pb.GetMetricsRequest{ScaledObjectRef: r})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := resp.MetricValues[0].MetricName; got != want[i] {
+			t.Errorf("%s/%s: value metric name = %q, want %q", r.Namespace, r.Name, got, want[i])
+		}
+	}
+
+	// Configured and per-partition names are scoped too
+	cfg.PartitionMetrics = true
+	cfg.Metrics = []config.Metric{{Aggregation: config.MetricMax, Name: "max.lag", Target: 100}}
+	spec, err := srv.GetMetricSpec(context.Background(), refs[0])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var names []string
+	for _, m := range spec.MetricSpecs {
+		names = append(names, m.MetricName)
+	}
+	if want := []string{"team_a_orders_max_lag", "team_a_orders_persistent_kafka_lag_p0"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("metric names = %v, want %v", names, want)
+	}
+}
+
+func TestNamespaceScopedMetrics_DisabledByDefault(t *testing.T) {
+	cfg := defaultConfig()
+	srv := New(lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval), cfg)
+
+	spec, err := srv.GetMetricSpec(context.Background(), &pb.ScaledObjectRef{Name: "orders", Namespace: "team-a"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := spec.MetricSpecs[0].MetricName; got != "persistent_kafka_lag" {
+		t.Errorf("metric name = %q, want persistent_kafka_lag", got)
+	}
+}
+
+func TestMetricScale_ScalesValueAndTarget(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.MetricScale = 100
+	w := lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+	srv := New(w, cfg)
+
+	simulateScraper(w, time.Now().Add(-3*time.Minute), cfg.SamplingInterval, 18, 3, 1000)
+
+	spec, err := srv.GetMetricSpec(context.Background(), ref())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := spec.MetricSpecs[0].TargetSize; got != 50000 {
+		t.Errorf("target size = %d, want 50000", got)
+	}
+
+	resp, err := srv.GetMetrics(context.Background(), &pb.GetMetricsRequest{ScaledObjectRef: ref(), MetricName: "persistent_kafka_lag"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := resp.MetricValues[0].MetricValue; got != 300000 {
+		t.Errorf("metric value = %d, want 300000", got)
+	}
+}
+
+func TestGetMetrics_ClampsToFloorAndCeiling(t *testing.T) {
+	tests := []struct {
+		name           string
+		floor, ceiling int64
+		persistent     bool
+		want           int64
+	}{
+		{"within range", 100, 10000, true, 3000},
+		{"ceiling", 0, 2000, true, 2000},
+		{"floor", 5000, 0, true, 5000},
+		{"floor while not persistent", 100, 10000, false, 100},
+		{"disabled while not persistent", 0, 0, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := defaultConfig()
+			cfg.MetricFloor = tt.floor
+			cfg.MetricCeiling = tt.ceiling
+			w := lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+			srv := New(w, cfg)
+
+			// 3000 total lag, sustained long enough only when persistent
+			ticks := 3
+			if tt.persistent {
+				ticks = 18
+			}
+			simulateScraper(w, time.Now().Add(-time.Duration(ticks)*cfg.SamplingInterval), cfg.SamplingInterval, ticks, 3, 1000)
+
+			resp, err := srv.GetMetrics(context.Background(), &pb.GetMetricsRequest{ScaledObjectRef: ref(), MetricName: "persistent_kafka_lag"})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := resp.MetricValues[0].MetricValue; got != tt.want {
+				t.Errorf("metric value = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestIsActive_RealisticScraperSimulation(t *testing.T) {
 	// Simulates exactly what happens in production:
 	// scraper adds samples every 10s, KEDA polls IsActive periodically
@@ -263,3 +714,690 @@ func TestIsActive_RealisticScraperSimulation(t *testing.T) {
 		t.Errorf("expected ACTIVE after 3 minutes of high lag; window has %d samples", len(snap))
 	}
 }
+
+func TestEvaluate_LogsOnlyOnTransition(t *testing.T) {
+	cfg := defaultConfig()
+	// The test swaps windows, which the version-keyed cache can't see
+	cfg.EvaluationCacheTTL = 0
+	w := lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+	srv := New(w, cfg)
+
+	var buf bytes.Buffer
+	srv.logger = slog.New(slog.NewTextHandler(&buf, nil))
+
+	countTransitions := func() int {
+		return strings.Count(buf.String(), "scaler is now")
+	}
+
+	// Inactive while lag is low: no transition from the initial state
+	simulateScraper(w, time.Now().Add(-3*time.Minute), cfg.SamplingInterval, 18, 3, 100)
+	srv.IsActive(context.Background(), ref())
+	srv.IsActive(context.Background(), ref())
+	if n := countTransitions(); n != 0 {
+		t.Fatalf("expected no transition logs while inactive, got %d", n)
+	}
+
+	// Becomes persistent: exactly one activation line across repeated polls
+	w2 := lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+	srv.window = w2
+	simulateScraper(w2, time.Now().Add(-3*time.Minute), cfg.SamplingInterval, 18, 3, 1000)
+	srv.IsActive(context.Background(), ref())
+	srv.GetMetrics(context.Background(), &pb.GetMetricsRequest{ScaledObjectRef: ref(), MetricName: "persistent_kafka_lag"})
+	srv.IsActive(context.Background(), ref())
+	if n := countTransitions(); n != 1 {
+		t.Fatalf("expected 1 transition log after activation, got %d:\n%s", n, buf.String())
+	}
+	if !strings.Contains(buf.String(), "partition=0") || !strings.Contains(buf.String(), "totalLag=3000") {
+		t.Errorf("expected transition log to include trigger partition and total lag, got:\n%s", buf.String())
+	}
+
+	// Clears: exactly one deactivation line
+	srv.window = lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+	srv.IsActive(context.Background(), ref())
+	srv.IsActive(context.Background(), ref())
+	if n := countTransitions(); n != 2 {
+		t.Fatalf("expected 2 transition logs after deactivation, got %d:\n%s", n, buf.String())
+	}
+}
+
+func TestIsActive_PanicThresholdBypassesSustain(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.PanicThreshold = 10000
+	w := lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+	srv := New(w, cfg)
+
+	// A single tick of extreme lag
+	simulateScraper(w, time.Now(), cfg.SamplingInterval, 1, 3, 20000)
+
+	resp, err := srv.IsActive(context.Background(), ref())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !resp.Result {
+		t.Error("expected ACTIVE immediately when lag reaches the panic threshold")
+	}
+
+	metricsResp, err := srv.GetMetrics(context.Background(), &pb.GetMetricsRequest{
+		ScaledObjectRef: ref(),
+		MetricName:      "persistent_kafka_lag",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if metricsResp.MetricValues[0].MetricValue != 60000 {
+		t.Errorf("expected full total 60000 at panic level, got %d", metricsResp.MetricValues[0].MetricValue)
+	}
+}
+
+func TestIsActive_BelowPanicThresholdNeedsSustain(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.PanicThreshold = 10000
+	w := lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+	srv := New(w, cfg)
+
+	// High lag, but under panic level and too short to be persistent
+	simulateScraper(w, time.Now().Add(-1*time.Minute), cfg.SamplingInterval, 6, 3, 5000)
+
+	resp, err := srv.IsActive(context.Background(), ref())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Result {
+		t.Error("expected inactive below the panic threshold without sustained lag")
+	}
+}
+
+// stubEvaluator returns a fixed result and counts how often it was asked.
+type stubEvaluator struct {
+	result lag.EvaluationResult
+	calls  int
+}
+
+func (e *stubEvaluator) Evaluate(samples []lag.LagSample) lag.EvaluationResult {
+	e.calls++
+	return e.result
+}
+
+func TestEvaluate_CachesWithinTTL(t *testing.T) {
+	cfg := defaultConfig()
+	w := lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+	srv := New(w, cfg)
+	stub := &stubEvaluator{result: lag.EvaluationResult{Persistent: true, TotalCurrentLag: 3000}}
+	srv.evaluator = stub
+
+	now := time.Now()
+	srv.now = func() time.Time { return now }
+
+	simulateScraper(w, now.Add(-3*time.Minute), cfg.SamplingInterval, 18, 3, 1000)
+	first := srv.evaluate()
+
+	now = now.Add(2 * time.Second)
+	if second := srv.evaluate(); !reflect.DeepEqual(second, first) || stub.calls != 1 {
+		t.Fatalf("expected cached result within TTL, got %+v then %+v after %d evaluations", first, second, stub.calls)
+	}
+
+	// Once the TTL passes the result is recomputed
+	now = now.Add(5 * time.Second)
+	srv.evaluate()
+	if stub.calls != 2 {
+		t.Errorf("expected a fresh evaluation after TTL, got %d evaluations", stub.calls)
+	}
+}
+
+func TestEvaluate_Timestamps(t *testing.T) {
+	cfg := defaultConfig()
+	w := lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+	srv := New(w, cfg)
+
+	now := time.Now()
+	srv.now = func() time.Time { return now }
+
+	start := now.Add(-3 * time.Minute)
+	simulateScraper(w, start, cfg.SamplingInterval, 18, 3, 1000)
+	newest := start.Add(17 * cfg.SamplingInterval)
+
+	first := srv.evaluate()
+	if !first.EvaluatedAt.Equal(now) {
+		t.Errorf("EvaluatedAt = %v, want %v", first.EvaluatedAt, now)
+	}
+	if !first.NewestSample.Equal(newest) {
+		t.Errorf("NewestSample = %v, want %v", first.NewestSample, newest)
+	}
+
+	// A cached result reports when it was computed, not when it was served
+	evaluatedAt := now
+	now = now.Add(2 * time.Second)
+	if cached := srv.evaluate(); !cached.EvaluatedAt.Equal(evaluatedAt) {
+		t.Errorf("cached EvaluatedAt = %v, want %v", cached.EvaluatedAt, evaluatedAt)
+	}
+}
+
+func TestServer_ForwardsEvaluatorResult(t *testing.T) {
+	cfg := defaultConfig()
+	srv := New(lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval), cfg)
+	srv.evaluator = &stubEvaluator{result: lag.EvaluationResult{Persistent: true, TotalCurrentLag: 4242, TriggerPartition: 1}}
+
+	active, err := srv.IsActive(context.Background(), ref())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !active.Result {
+		t.Error("expected IsActive to report the evaluator's verdict")
+	}
+
+	resp, err := srv.GetMetrics(context.Background(), &pb.GetMetricsRequest{ScaledObjectRef: ref(), MetricName: "persistent_kafka_lag"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := resp.MetricValues[0].MetricValue; got != 4242 {
+		t.Errorf("metric value = %d, want the evaluator's 4242", got)
+	}
+}
+
+func TestServer_BreadthMode(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.EvaluationMode = config.EvaluationModeBreadth
+	cfg.LaggingPartitionsThreshold = 3
+	w := lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+	srv := New(w, cfg)
+
+	// Three partitions with sustained lag don't exceed the threshold of 3.
+	now := time.Now()
+	simulateScraper(w, now.Add(-3*time.Minute), cfg.SamplingInterval, 18, 3, 1000)
+	active, err := srv.IsActive(context.Background(), ref())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if active.Result {
+		t.Error("expected inactive with 3 lagging partitions and threshold 3")
+	}
+
+	w = lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+	srv = New(w, cfg)
+	simulateScraper(w, now.Add(-3*time.Minute), cfg.SamplingInterval, 18, 4, 1000)
+	active, err = srv.IsActive(context.Background(), ref())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !active.Result {
+		t.Error("expected active with 4 lagging partitions and threshold 3")
+	}
+}
+
+func TestEvaluate_NewSampleInvalidatesCache(t *testing.T) {
+	cfg := defaultConfig()
+	w := lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+	srv := New(w, cfg)
+
+	now := time.Now()
+	srv.now = func() time.Time { return now }
+
+	simulateScraper(w, now.Add(-3*time.Minute), cfg.SamplingInterval, 18, 3, 1000)
+	if first := srv.evaluate(); first.TotalCurrentLag != 3000 {
+		t.Fatalf("expected total lag 3000, got %d", first.TotalCurrentLag)
+	}
+
+	// A new tick within the TTL must be reflected immediately
+	for p := range 3 {
+		w.Add(lag.LagSample{Timestamp: now, Partition: p, Lag: 2000, Topic: "test-topic"})
+	}
+	if second := srv.evaluate(); second.TotalCurrentLag != 6000 {
+		t.Errorf("expected new sample to invalidate the cache (total 6000), got %d", second.TotalCurrentLag)
+	}
+}
+
+func TestEvaluate_ReusesResultUntilWindowVersionChanges(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.EvaluationCacheTTL = time.Hour
+	w := lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+	srv := New(w, cfg)
+	stub := &stubEvaluator{result: lag.EvaluationResult{TriggerPartition: -1}}
+	srv.evaluator = stub
+
+	now := time.Now()
+	srv.now = func() time.Time { return now }
+	simulateScraper(w, now.Add(-time.Minute), cfg.SamplingInterval, 6, 3, 1000)
+
+	for range 5 {
+		srv.evaluate()
+	}
+	if stub.calls != 1 {
+		t.Fatalf("expected polls at the same window version to share one evaluation, got %d", stub.calls)
+	}
+
+	w.Add(lag.LagSample{Timestamp: now, Partition: 0, Lag: 1000, Topic: "test-topic"})
+	srv.evaluate()
+	srv.evaluate()
+	if stub.calls != 2 {
+		t.Errorf("expected one fresh evaluation after Add, got %d evaluations", stub.calls)
+	}
+}
+
+func TestDebounce_LoneVerdictDoesNotFlipState(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.ActivationQuorum = 3
+	srv := New(lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval), cfg)
+
+	steps := []struct {
+		verdict bool
+		want    bool
+	}{
+		{true, false},
+		{true, false},
+		{true, true},  // three in a row activates
+		{false, true}, // a lone dissent is ignored
+		{true, true},
+		{false, true},
+		{false, true},
+		{false, false}, // three in a row deactivates
+		{true, false},
+	}
+
+	for i, step := range steps {
+		got := srv.debounce(step.verdict, uint64(i+1))
+		srv.persistent = got
+		if got != step.want {
+			t.Fatalf("step %d: verdict %v reported %v, want %v", i, step.verdict, got, step.want)
+		}
+	}
+}
+
+func TestDebounce_OneVotePerScrape(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.ActivationQuorum = 3
+	cfg.EvaluationCacheTTL = 0
+	w := lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+	srv := New(w, cfg)
+
+	// One anomalous scrape's worth of persistent lag, polled over and over
+	simulateScraper(w, time.Now().Add(-3*time.Minute), cfg.SamplingInterval, 19, 3, 1000)
+	for i := range 5 {
+		resp, err := srv.IsActive(context.Background(), ref())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if resp.Result {
+			t.Fatalf("poll %d: expected repeated polls of one scrape not to reach the quorum", i)
+		}
+	}
+	if _, err := srv.GetMetrics(context.Background(), &pb.GetMetricsRequest{ScaledObjectRef: ref()}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Two more scrapes agreeing make three votes
+	now := time.Now()
+	for i := range 2 {
+		w.Add(lag.LagSample{Timestamp: now.Add(time.Duration(i) * time.Second), Partition: 0, Lag: 1000, Topic: "test-topic"})
+	}
+	if _, err := srv.IsActive(context.Background(), ref()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp, err := srv.IsActive(context.Background(), ref())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Result {
+		t.Fatal("expected two agreeing scrapes not to reach the quorum of 3")
+	}
+
+	w.Add(lag.LagSample{Timestamp: now.Add(2 * time.Second), Partition: 0, Lag: 1000, Topic: "test-topic"})
+	resp, err = srv.IsActive(context.Background(), ref())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !resp.Result {
+		t.Error("expected the third agreeing scrape to activate")
+	}
+}
+
+func TestDebounce_QuorumOfOnePassesThrough(t *testing.T) {
+	cfg := defaultConfig()
+	srv := New(lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval), cfg)
+
+	for i, v := range []bool{true, false, true} {
+		if got := srv.debounce(v, uint64(i+1)); got != v {
+			t.Errorf("expected verdict %v passed through, got %v", v, got)
+		}
+	}
+}
+
+func TestEvaluate_RetentionBeyondEvaluationHorizon(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.WindowSize = 18
+	cfg.RetentionSize = 60
+	cfg.PersistenceLookback = time.Duration(cfg.WindowSize) * cfg.SamplingInterval
+	w := lag.NewSlidingWindow(cfg.RetentionSize, cfg.SamplingInterval)
+	srv := New(w, cfg)
+
+	// 3 minutes of high lag 8 minutes ago, then 5 minutes of low lag
+	start := time.Now().Add(-8 * time.Minute)
+	simulateScraper(w, start, cfg.SamplingInterval, 19, 1, 1000)
+	simulateScraper(w, start.Add(190*time.Second), cfg.SamplingInterval, 30, 1, 100)
+
+	// Retention keeps the old stretch stored...
+	if n := w.Len(); n != 49 {
+		t.Fatalf("expected retention to keep all 49 samples, got %d", n)
+	}
+	snapshot := w.Snapshot()
+	if snapshot[0].Lag != 1000 {
+		t.Errorf("expected the oldest stored sample to be from the old stretch, got lag %d", snapshot[0].Lag)
+	}
+
+	// ...but it's outside the 3 minute horizon decisions are made over
+	result := srv.evaluate()
+	if result.Persistent {
+		t.Error("expected the stretch outside the evaluation horizon not to activate")
+	}
+	if result.TotalCurrentLag != 100 {
+		t.Errorf("total lag = %d, want 100", result.TotalCurrentLag)
+	}
+
+	// A window sized to the horizon alone would have evicted it
+	short := lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+	short.Add(snapshot...)
+	if short.Len() >= len(snapshot) {
+		t.Errorf("expected a horizon-sized window to evict old samples, holds %d of %d", short.Len(), len(snapshot))
+	}
+}
+
+func TestEvaluate_HoldsActiveForMinActiveDuration(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.EvaluationCacheTTL = 0
+	cfg.MinActiveDuration = 5 * time.Minute
+	w := lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+	srv := New(w, cfg)
+
+	start := time.Now()
+	clock := start
+	srv.now = func() time.Time { return clock }
+
+	// 2 minutes of high lag activates the scaler
+	simulateScraper(w, start.Add(-2*time.Minute), cfg.SamplingInterval, 13, 1, 1000)
+	if !srv.evaluate().Persistent {
+		t.Fatal("expected the scaler to activate")
+	}
+
+	// Lag drains and the high samples leave the window straight away, but
+	// the state is held
+	w.Remove(func(s lag.LagSample) bool { return s.Lag > 0 })
+	simulateScraper(w, start.Add(cfg.SamplingInterval), cfg.SamplingInterval, 1, 1, 0)
+	for _, elapsed := range []time.Duration{10 * time.Second, 2 * time.Minute, 5*time.Minute - time.Second} {
+		clock = start.Add(elapsed)
+		if !srv.evaluate().Persistent {
+			t.Fatalf("expected active to be held %s after activation", elapsed)
+		}
+	}
+
+	clock = start.Add(5 * time.Minute)
+	if srv.evaluate().Persistent {
+		t.Error("expected deactivation once minActiveDuration has passed")
+	}
+}
+
+func TestEvaluate_HeldVerdictExpiresAfterTTL(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.EvaluationCacheTTL = 0
+	cfg.MinActiveDuration = 10 * time.Minute
+	cfg.VerdictTTL = time.Minute
+	w := lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+	srv := New(w, cfg)
+
+	start := time.Now()
+	clock := start
+	srv.now = func() time.Time { return clock }
+
+	simulateScraper(w, start.Add(-2*time.Minute), cfg.SamplingInterval, 13, 1, 1000)
+	if !srv.evaluate().Persistent {
+		t.Fatal("expected the scaler to activate")
+	}
+
+	// Lag drains; minActiveDuration holds the verdict until the TTL runs out
+	w.Remove(func(s lag.LagSample) bool { return s.Lag > 0 })
+	simulateScraper(w, start.Add(cfg.SamplingInterval), cfg.SamplingInterval, 1, 1, 0)
+	clock = start.Add(50 * time.Second)
+	if !srv.evaluate().Persistent {
+		t.Fatal("expected active to be held within the verdict TTL")
+	}
+	clock = start.Add(90 * time.Second)
+	if srv.evaluate().Persistent {
+		t.Fatal("expected the held verdict to expire after the verdict TTL")
+	}
+
+	// Fresh persistent lag activates as normal
+	simulateScraper(w, start.Add(100*time.Second), cfg.SamplingInterval, 13, 1, 1000)
+	clock = start.Add(220 * time.Second)
+	if !srv.evaluate().Persistent {
+		t.Error("expected evaluation to resume once fresh samples confirm persistence")
+	}
+}
+
+func TestEvaluate_VerdictExpiresWhenScrapingStalls(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.EvaluationCacheTTL = 0
+	cfg.VerdictTTL = time.Minute
+	w := lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+	srv := New(w, cfg)
+
+	start := time.Now()
+	clock := start
+	srv.now = func() time.Time { return clock }
+
+	simulateScraper(w, start.Add(-2*time.Minute), cfg.SamplingInterval, 13, 1, 1000)
+	if !srv.evaluate().Persistent {
+		t.Fatal("expected the scaler to activate")
+	}
+
+	// No scrapes arrive: the stale window still shows persistence, but it's
+	// older than the TTL
+	clock = start.Add(2 * time.Minute)
+	if srv.evaluate().Persistent {
+		t.Error("expected a verdict on samples older than the TTL to expire")
+	}
+}
+
+func TestEvaluate_HoldsActiveUntilDrainConfirmed(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.EvaluationCacheTTL = 0
+	cfg.DrainConfirmDuration = time.Minute
+	w := lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+	srv := New(w, cfg)
+
+	start := time.Now().Add(-2 * time.Minute)
+	simulateScraper(w, start.Add(-2*time.Minute), cfg.SamplingInterval, 13, 2, 1000)
+	if !srv.evaluate().Persistent {
+		t.Fatal("expected the scaler to activate")
+	}
+	w.Remove(func(s lag.LagSample) bool { return s.Lag > 0 })
+
+	// Lag hits zero for 20s, then a little comes back: still active
+	tick := func(elapsed time.Duration, lagPerPartition int64) bool {
+		simulateScraper(w, start.Add(elapsed), cfg.SamplingInterval, 1, 2, lagPerPartition)
+		return srv.evaluate().Persistent
+	}
+	for _, elapsed := range []time.Duration{10 * time.Second, 20 * time.Second, 30 * time.Second} {
+		if !tick(elapsed, 0) {
+			t.Fatalf("expected active %s into a brief drain", elapsed)
+		}
+	}
+	if !tick(40*time.Second, 100) {
+		t.Fatal("expected active while lag trickles back in")
+	}
+
+	// Zero from 50s on: active until it's held for the full minute
+	for elapsed := 50 * time.Second; elapsed < 110*time.Second; elapsed += cfg.SamplingInterval {
+		if !tick(elapsed, 0) {
+			t.Fatalf("expected active after %s of drain", elapsed-50*time.Second)
+		}
+	}
+	if tick(110*time.Second, 0) {
+		t.Error("expected inactive once lag has been zero for drainConfirmDuration")
+	}
+}
+
+func TestEvaluate_SuppressedWithoutGroupMembers(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.EvaluationCacheTTL = 0
+	cfg.GroupMembers = config.GroupMembersSuppress
+	w := lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+	srv := New(w, cfg)
+
+	// Sustained lag with every consumer crashed
+	start := time.Now().Add(-3 * time.Minute)
+	simulateScraper(w, start, cfg.SamplingInterval, 16, 2, 1000)
+	result := srv.evaluate()
+	if result.Persistent || !result.NoMembers {
+		t.Fatalf("expected activation suppressed without members, got %+v", result)
+	}
+	if got := testutil.ToFloat64(metrics.NoMembersSuppressed); got != 1 {
+		t.Errorf("kpkls_no_members_suppressed = %v, want 1", got)
+	}
+
+	// Consumers rejoin: the same lag activates
+	for p := range 2 {
+		w.Add(lag.LagSample{Timestamp: start.Add(16 * cfg.SamplingInterval), Topic: "test-topic", Partition: p, Lag: 1000, Members: 2})
+	}
+	result = srv.evaluate()
+	if !result.Persistent || result.NoMembers {
+		t.Errorf("expected active once the group has members, got %+v", result)
+	}
+	if got := testutil.ToFloat64(metrics.NoMembersSuppressed); got != 0 {
+		t.Errorf("kpkls_no_members_suppressed = %v, want 0", got)
+	}
+
+	// Only reported, the count doesn't affect the decision
+	cfg.GroupMembers = config.GroupMembersReport
+	w = lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+	simulateScraper(w, start, cfg.SamplingInterval, 16, 2, 1000)
+	if !New(w, cfg).evaluate().Persistent {
+		t.Error("expected groupMembers report not to suppress activation")
+	}
+}
+
+func TestEvaluate_SuppressedOnSchedule(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.EvaluationCacheTTL = 0
+	schedule, err := config.ParseSchedule("* 1-4 * * 6,0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cfg.SuppressSchedule = schedule
+	w := lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+	srv := New(w, cfg)
+	simulateScraper(w, time.Now().Add(-3*time.Minute), cfg.SamplingInterval, 18, 3, 1000)
+
+	// Saturday 02:30 UTC falls within the schedule
+	now := time.Date(2026, 3, 7, 2, 30, 0, 0, time.UTC)
+	srv.now = func() time.Time { return now }
+	active, err := srv.IsActive(context.Background(), ref())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if active.Result {
+		t.Error("expected inactive within the suppress schedule")
+	}
+	metricsResp, err := srv.GetMetrics(context.Background(), &pb.GetMetricsRequest{ScaledObjectRef: ref()})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := metricsResp.MetricValues[0].MetricValue; got != 0 {
+		t.Errorf("metric = %d within the suppress schedule, want 0", got)
+	}
+	if got := testutil.ToFloat64(metrics.ScheduleSuppressed); got != 1 {
+		t.Errorf("kpkls_schedule_suppressed = %v, want 1", got)
+	}
+
+	// Saturday 05:00 UTC is past it: the same window activates
+	now = time.Date(2026, 3, 7, 5, 0, 0, 0, time.UTC)
+	active, err = srv.IsActive(context.Background(), ref())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !active.Result {
+		t.Error("expected active outside the suppress schedule")
+	}
+	metricsResp, err = srv.GetMetrics(context.Background(), &pb.GetMetricsRequest{ScaledObjectRef: ref()})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := metricsResp.MetricValues[0].MetricValue; got != 3000 {
+		t.Errorf("metric = %d outside the suppress schedule, want 3000", got)
+	}
+	if got := testutil.ToFloat64(metrics.ScheduleSuppressed); got != 0 {
+		t.Errorf("kpkls_schedule_suppressed = %v, want 0", got)
+	}
+}
+
+func TestReconfigure_AppliesToWindowAlreadyHeld(t *testing.T) {
+	cfg := defaultConfig()
+	w := lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+	srv := New(w, cfg)
+
+	// 1 minute of lag at 1000: not sustained for 2 minutes
+	simulateScraper(w, time.Now().Add(-time.Minute), cfg.SamplingInterval, 7, 3, 1000)
+	if srv.evaluate().Persistent {
+		t.Fatal("expected inactive before the sustain duration")
+	}
+
+	next := *cfg
+	next.SustainDuration = 30 * time.Second
+	srv.Reconfigure(&next)
+	if !srv.evaluate().Persistent {
+		t.Fatal("expected the shorter sustain duration to apply to the samples already held")
+	}
+
+	next2 := next
+	next2.LagThreshold = 2000
+	srv.Reconfigure(&next2)
+	result := srv.evaluate()
+	if result.Persistent {
+		t.Error("expected the raised threshold to apply")
+	}
+	if result.TotalCurrentLag != 3000 || w.Len() != 21 {
+		t.Errorf("expected no samples lost, got total lag %d from %d samples", result.TotalCurrentLag, w.Len())
+	}
+}
+
+func TestEvaluate_SuppressedDuringWarmup(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.PanicThreshold = 10000
+	cfg.WarmupSamples = 6
+	w := lag.NewSlidingWindow(cfg.WindowSize, cfg.SamplingInterval)
+	srv := New(w, cfg)
+
+	var buf bytes.Buffer
+	srv.logger = slog.New(slog.NewTextHandler(&buf, nil))
+
+	// A single tick of extreme lag would trip the panic threshold
+	simulateScraper(w, time.Now(), cfg.SamplingInterval, 1, 3, 20000)
+
+	resp, err := srv.IsActive(context.Background(), ref())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Result {
+		t.Error("expected IsActive to be suppressed during warmup")
+	}
+	metricsResp, err := srv.GetMetrics(context.Background(), &pb.GetMetricsRequest{ScaledObjectRef: ref(), MetricName: "persistent_kafka_lag"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v := metricsResp.MetricValues[0].MetricValue; v != 0 {
+		t.Errorf("expected metric 0 during warmup, got %d", v)
+	}
+	if strings.Count(buf.String(), "warming up") != 1 {
+		t.Errorf("expected a single warming up log line, got:\n%s", buf.String())
+	}
+
+	// A second tick brings the window to 6 samples
+	simulateScraper(w, time.Now(), cfg.SamplingInterval, 1, 3, 20000)
+	resp, err = srv.IsActive(context.Background(), ref())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !resp.Result {
+		t.Error("expected decisions to be enabled once warmup is met")
+	}
+	if !strings.Contains(buf.String(), "warmed up") {
+		t.Errorf("expected a warmup complete log line, got:\n%s", buf.String())
+	}
+}
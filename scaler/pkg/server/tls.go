@@ -0,0 +1,46 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+
+	"google.golang.org/grpc/credentials"
+
+	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/config"
+)
+
+// TLSCredentials returns the gRPC server's transport credentials from cfg's
+// GRPCTLSCert and GRPCTLSKey, or nil to serve plaintext when they're unset.
+// With GRPCClientCA set, clients must present a certificate signed by it.
+func TLSCredentials(cfg *config.ScalerConfig) (credentials.TransportCredentials, error) {
+	if cfg.GRPCTLSCert == "" {
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(cfg.GRPCTLSCert, cfg.GRPCTLSKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid server certificate: %w", err)
+	}
+	tlsCfg := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+
+	if cfg.GRPCClientCA != "" {
+		pem, err := os.ReadFile(cfg.GRPCClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("invalid client ca: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in client ca")
+		}
+		tlsCfg.ClientCAs = pool
+		tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return credentials.NewTLS(tlsCfg), nil
+}
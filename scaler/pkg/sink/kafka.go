@@ -0,0 +1,53 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/segmentio/kafka-go"
+
+	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/lag"
+)
+
+// messageWriter is the part of kafka.Writer the Kafka sink uses.
+type messageWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// Kafka produces one JSON message per sample, keyed by the sample's topic
+// and partition so a partition's samples stay in order.
+type Kafka struct {
+	writer messageWriter
+}
+
+// NewKafka returns a sink producing through w, typically from
+// kafka.NewWriter in this module's kafka package.
+func NewKafka(w messageWriter) *Kafka {
+	return &Kafka{writer: w}
+}
+
+func (k *Kafka) Send(ctx context.Context, samples []lag.LagSample) error {
+	msgs := make([]kafka.Message, 0, len(samples))
+	for _, s := range samples {
+		value, err := json.Marshal(toRecord(s))
+		if err != nil {
+			return fmt.Errorf("encode sample: %w", err)
+		}
+		msgs = append(msgs, kafka.Message{
+			Key:   []byte(s.Topic + "/" + strconv.Itoa(s.Partition)),
+			Value: value,
+		})
+	}
+	if err := k.writer.WriteMessages(ctx, msgs...); err != nil {
+		return fmt.Errorf("produce samples: %w", err)
+	}
+	return nil
+}
+
+// Close flushes and closes the underlying writer.
+func (k *Kafka) Close() error {
+	return k.writer.Close()
+}
@@ -0,0 +1,67 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+
+	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/lag"
+)
+
+type fakeWriter struct {
+	msgs   []kafka.Message
+	err    error
+	closed bool
+}
+
+func (w *fakeWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	w.msgs = append(w.msgs, msgs...)
+	return w.err
+}
+
+func (w *fakeWriter) Close() error {
+	w.closed = true
+	return nil
+}
+
+func TestKafka_OneMessagePerSample(t *testing.T) {
+	w := &fakeWriter{}
+	k := NewKafka(w)
+
+	samples := []lag.LagSample{
+		{Topic: "orders", Partition: 0, Lag: 100},
+		{Topic: "orders", Partition: 3, Lag: 7},
+	}
+	if err := k.Send(context.Background(), samples); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(w.msgs) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(w.msgs))
+	}
+	if string(w.msgs[1].Key) != "orders/3" {
+		t.Errorf("key = %q, want orders/3", w.msgs[1].Key)
+	}
+	var rec record
+	if err := json.Unmarshal(w.msgs[1].Value, &rec); err != nil {
+		t.Fatalf("decode value: %v", err)
+	}
+	if rec.Partition != 3 || rec.Lag != 7 {
+		t.Errorf("unexpected record: %+v", rec)
+	}
+
+	k.Close()
+	if !w.closed {
+		t.Error("expected Close to close the writer")
+	}
+}
+
+func TestKafka_WriteError(t *testing.T) {
+	w := &fakeWriter{err: errors.New("leader not available")}
+	if err := NewKafka(w).Send(context.Background(), []lag.LagSample{{Topic: "orders"}}); err == nil {
+		t.Fatal("expected the write error")
+	}
+}
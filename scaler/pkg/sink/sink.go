@@ -0,0 +1,44 @@
+// Package sink forwards the scraper's lag samples to external systems.
+package sink
+
+import (
+	"time"
+
+	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/lag"
+)
+
+// record is the JSON shape of a sample sent to a sink, matching the samples
+// in /debug/scrape.
+type record struct {
+	Timestamp     time.Time `json:"timestamp"`
+	Topic         string    `json:"topic"`
+	Group         string    `json:"group,omitempty"`
+	Partition     int       `json:"partition"`
+	Lag           int64     `json:"lag"`
+	Offset        int64     `json:"offset"`
+	EndOffset     int64     `json:"endOffset"`
+	ConsumeRate   float64   `json:"consumeRate"`
+	ByteLag       int64     `json:"byteLag,omitempty"`
+	TimeLag       int64     `json:"timeLagSeconds,omitempty"`
+	OffsetAhead   bool      `json:"offsetAhead,omitempty"`
+	LeaderChanged bool      `json:"leaderChanged,omitempty"`
+	StaleCommit   bool      `json:"staleCommit,omitempty"`
+}
+
+func toRecord(s lag.LagSample) record {
+	return record{
+		Timestamp:     s.Timestamp,
+		Topic:         s.Topic,
+		Group:         s.Group,
+		Partition:     s.Partition,
+		Lag:           s.Lag,
+		Offset:        s.Offset,
+		EndOffset:     s.EndOffset,
+		ConsumeRate:   s.ConsumeRate,
+		ByteLag:       s.ByteLag,
+		TimeLag:       s.TimeLag,
+		OffsetAhead:   s.OffsetAhead,
+		LeaderChanged: s.LeaderChanged,
+		StaleCommit:   s.StaleCommit,
+	}
+}
@@ -0,0 +1,54 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/lag"
+)
+
+// Webhook POSTs each batch of samples to a URL as a JSON array.
+type Webhook struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhook(url string) *Webhook {
+	return &Webhook{url: url, client: http.DefaultClient}
+}
+
+// Send posts samples and fails on any non-2xx response. The request is bound
+// by ctx, which the scraper limits to the sampling interval.
+func (w *Webhook) Send(ctx context.Context, samples []lag.LagSample) error {
+	records := make([]record, len(samples))
+	for i, s := range samples {
+		records[i] = toRecord(s)
+	}
+	body, err := json.Marshal(records)
+	if err != nil {
+		return fmt.Errorf("encode samples: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("build webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("post samples: %w", err)
+	}
+	defer resp.Body.Close()
+	// Drain so the connection can be reused
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
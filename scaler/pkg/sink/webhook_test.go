@@ -0,0 +1,56 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/lag"
+)
+
+func TestWebhook_PostsSamples(t *testing.T) {
+	var got []map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected request: %s with content type %q", r.Method, r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decode body: %v", err)
+		}
+	}))
+	defer srv.Close()
+
+	now := time.Now()
+	samples := []lag.LagSample{
+		{Timestamp: now, Topic: "orders", Group: "g", Partition: 0, Lag: 100, Offset: 10, EndOffset: 110},
+		{Timestamp: now, Topic: "orders", Group: "g", Partition: 1, Lag: 5},
+	}
+	if err := NewWebhook(srv.URL).Send(context.Background(), samples); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(got))
+	}
+	if got[0]["topic"] != "orders" || got[0]["lag"] != float64(100) || got[0]["endOffset"] != float64(110) {
+		t.Errorf("unexpected first record: %v", got[0])
+	}
+	if got[1]["partition"] != float64(1) {
+		t.Errorf("unexpected second record: %v", got[1])
+	}
+}
+
+func TestWebhook_ErrorStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	err := NewWebhook(srv.URL).Send(context.Background(), []lag.LagSample{{Topic: "orders"}})
+	if err == nil {
+		t.Fatal("expected an error for a 502 response")
+	}
+}
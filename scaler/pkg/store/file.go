@@ -0,0 +1,66 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/lag"
+)
+
+// File persists window samples as JSON at a path, typically on a volume that
+// outlives the pod, so a restart doesn't start from an empty window.
+type File struct {
+	path string
+}
+
+func NewFile(path string) *File {
+	return &File{path: path}
+}
+
+// Load returns the saved samples, or none if nothing has been saved yet.
+func (f *File) Load(ctx context.Context) ([]lag.LagSample, error) {
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read window store: %w", err)
+	}
+
+	var samples []lag.LagSample
+	if err := json.Unmarshal(data, &samples); err != nil {
+		return nil, fmt.Errorf("decode window store %s: %w", f.path, err)
+	}
+	return samples, nil
+}
+
+// Save replaces the stored samples. It writes to a temporary file and renames
+// it into place so a crash mid-write never leaves a truncated store.
+func (f *File) Save(ctx context.Context, samples []lag.LagSample) error {
+	data, err := json.Marshal(samples)
+	if err != nil {
+		return fmt.Errorf("encode window store: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".*")
+	if err != nil {
+		return fmt.Errorf("write window store: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write window store: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write window store: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), f.path); err != nil {
+		return fmt.Errorf("write window store: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package store
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sarkarshuvojit/keda-persistent-kafka-lag-scaler/scaler/pkg/lag"
+)
+
+func TestFile_SaveAndLoad(t *testing.T) {
+	f := NewFile(filepath.Join(t.TempDir(), "window.json"))
+
+	now := time.Now().UTC().Truncate(time.Second)
+	samples := []lag.LagSample{
+		{Timestamp: now.Add(-10 * time.Second), Topic: "orders", Group: "g", Partition: 0, Lag: 100, Offset: 900, EndOffset: 1000},
+		{Timestamp: now, Topic: "orders", Group: "g", Partition: 0, Lag: 120, Offset: 980, EndOffset: 1100, ConsumeRate: 8},
+	}
+	if err := f.Save(context.Background(), samples); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	got, err := f.Load(context.Background())
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected 2 samples, got %d", len(got))
+	}
+	for i := range samples {
+		if !got[i].Timestamp.Equal(samples[i].Timestamp) || got[i].Lag != samples[i].Lag || got[i].ConsumeRate != samples[i].ConsumeRate {
+			t.Errorf("sample %d = %+v, want %+v", i, got[i], samples[i])
+		}
+	}
+}
+
+func TestFile_LoadMissingIsEmpty(t *testing.T) {
+	f := NewFile(filepath.Join(t.TempDir(), "window.json"))
+
+	got, err := f.Load(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("expected no samples, got %d", len(got))
+	}
+}
+
+func TestFile_LoadCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "window.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewFile(path).Load(context.Background()); err == nil {
+		t.Fatal("expected error for a corrupt store")
+	}
+}